@@ -4,8 +4,13 @@ import (
 	"crypto/tls"
 	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 	"github.com/privateerproj/privateer-sdk/utils"
 )
@@ -29,6 +34,7 @@ func CCC_C01_TR01() (testSetName string, result pluginkit.TestSetResult) {
 	result.ExecuteTest(CCC_C01_TR01_T02)
 	result.ExecuteTest(CCC_C01_TR01_T03)
 	result.ExecuteTest(CCC_C01_TR01_T04)
+	result.ExecuteTest(CCC_C01_TR01_T05)
 
 	TestSetResultSetter("TLS and minimum version 1.2 are enforced for non-SSH requests",
 		"TLS or minimum TLS version 1.2 are not being enforced, see test results for more details.",
@@ -43,7 +49,7 @@ func CCC_C01_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	ArmoryTlsFunctions.ConfirmHTTPRequestFails(storageAccountUri, &result)
+	assessServiceEndpoints(&result, ArmoryTlsFunctions.ConfirmHTTPRequestFails)
 
 	return
 }
@@ -60,11 +66,10 @@ func CCC_C01_TR01_T02() (result pluginkit.TestResult) {
 		return
 	}
 
-	// Check TLS version of response
-	ArmoryTlsFunctions.CheckTLSVersion(storageAccountUri, token, &result)
-	if !result.Passed {
-		return
-	}
+	// Check TLS version of the response of each endpoint
+	assessServiceEndpoints(&result, func(endpoint string, endpointResult *pluginkit.TestResult) {
+		ArmoryTlsFunctions.CheckTLSVersion(endpoint, token, endpointResult)
+	})
 	return
 }
 
@@ -76,7 +81,9 @@ func CCC_C01_TR01_T03() (result pluginkit.TestResult) {
 
 	tlsVersion := tls.VersionTLS10
 
-	ArmoryTlsFunctions.ConfirmOutdatedProtocolRequestsFail(storageAccountUri, &result, tlsVersion)
+	assessServiceEndpoints(&result, func(endpoint string, endpointResult *pluginkit.TestResult) {
+		ArmoryTlsFunctions.ConfirmOutdatedProtocolRequestsFail(endpoint, endpointResult, tlsVersion)
+	})
 	return
 }
 
@@ -88,7 +95,19 @@ func CCC_C01_TR01_T04() (result pluginkit.TestResult) {
 
 	tlsVersion := tls.VersionTLS11
 
-	ArmoryTlsFunctions.ConfirmOutdatedProtocolRequestsFail(storageAccountUri, &result, tlsVersion)
+	assessServiceEndpoints(&result, func(endpoint string, endpointResult *pluginkit.TestResult) {
+		ArmoryTlsFunctions.ConfirmOutdatedProtocolRequestsFail(endpoint, endpointResult, tlsVersion)
+	})
+	return
+}
+
+func CCC_C01_TR01_T05() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "The negotiated protocol version, HTTP behaviour, accepted cipher suites without forward secrecy or authenticated encryption and weak or expiring certificates are reported",
+		Function:    utils.CallerPath(0),
+	}
+
+	assessServiceEndpoints(&result, ArmoryTlsFunctions.InspectTLS)
 	return
 }
 
@@ -112,6 +131,194 @@ func CCC_C01_TR02() (testSetName string, result pluginkit.TestSetResult) {
 	return
 }
 
+// -------------------------------------
+// TestSet and Tests for CCC_ObjStor_C01_TR01
+// -------------------------------------
+
+func CCC_ObjStor_C01_TR01() (testSetName string, result pluginkit.TestSetResult) {
+	testSetName = "CCC_ObjStor_C01_TR01"
+	result = pluginkit.TestSetResult{
+		Passed:      false,
+		Description: "When a request is made to read a protected bucket, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		Message:     "TestSet has not yet started.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+		Tests:       make(map[string]pluginkit.TestResult),
+	}
+
+	result.ExecuteTest(CCC_ObjStor_C01_TR01_T01)
+	result.ExecuteTest(CCC_ObjStor_C01_TR01_T02)
+
+	TestSetResultSetter(
+		"Containers can only be read using trusted Key Vault keys.",
+		"Containers can be read using keys which are not trusted, see test results for more details.",
+		&result,
+	)
+
+	return
+}
+
+func CCC_ObjStor_C01_TR01_T01() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that the Storage Account is encrypted with a trusted Key Vault key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmAccountKeyIsTrusted(&result)
+	return
+}
+
+func CCC_ObjStor_C01_TR01_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that every enabled encryption scope, including those used as container defaults, uses a trusted Key Vault key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmEncryptionScopeKeysAreTrusted(&result)
+	return
+}
+
+// -------------------------------------
+// TestSet and Tests for CCC_ObjStor_C01_TR02
+// -------------------------------------
+
+func CCC_ObjStor_C01_TR02() (testSetName string, result pluginkit.TestSetResult) {
+	testSetName = "CCC_ObjStor_C01_TR02"
+	result = pluginkit.TestSetResult{
+		Passed:      false,
+		Description: "When a request is made to read a protected object, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		Message:     "TestSet has not yet started.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+		Tests:       make(map[string]pluginkit.TestResult),
+	}
+
+	result.ExecuteTest(CCC_ObjStor_C01_TR02_T01)
+	result.ExecuteTest(CCC_ObjStor_C01_TR02_T02)
+
+	TestSetResultSetter(
+		"Blobs can only be read using trusted Key Vault keys.",
+		"Blobs can be read using keys which are not trusted, see test results for more details.",
+		&result,
+	)
+
+	return
+}
+
+func CCC_ObjStor_C01_TR02_T01() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that the Storage Account is encrypted with a trusted Key Vault key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmAccountKeyIsTrusted(&result)
+	return
+}
+
+func CCC_ObjStor_C01_TR02_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that every enabled encryption scope, including those used as container defaults, uses a trusted Key Vault key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmEncryptionScopeKeysAreTrusted(&result)
+	return
+}
+
+// -------------------------------------
+// TestSet and Tests for CCC_ObjStor_C01_TR03
+// -------------------------------------
+
+func CCC_ObjStor_C01_TR03() (testSetName string, result pluginkit.TestSetResult) {
+	testSetName = "CCC_ObjStor_C01_TR03"
+	result = pluginkit.TestSetResult{
+		Passed:      false,
+		Description: "When a request is made to write to a bucket, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		Message:     "TestSet has not yet started.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+		Tests:       make(map[string]pluginkit.TestResult),
+	}
+
+	result.ExecuteTest(CCC_ObjStor_C01_TR03_T01)
+	result.ExecuteInvasiveTest(CCC_ObjStor_C01_TR03_T02)
+
+	TestSetResultSetter(
+		"Containers can only be written to using trusted Key Vault keys.",
+		"Containers can be written to using keys which are not trusted, see test results for more details.",
+		&result,
+	)
+
+	return
+}
+
+func CCC_ObjStor_C01_TR03_T01() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that every enabled encryption scope, including those used as container defaults, uses a trusted Key Vault key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmEncryptionScopeKeysAreTrusted(&result)
+	return
+}
+
+func CCC_ObjStor_C01_TR03_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that writing a blob to a new container using an untrusted encryption scope is rejected.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmUntrustedEncryptionScopeWriteIsRejected(&result)
+	return
+}
+
+// -------------------------------------
+// TestSet and Tests for CCC_ObjStor_C01_TR04
+// -------------------------------------
+
+func CCC_ObjStor_C01_TR04() (testSetName string, result pluginkit.TestSetResult) {
+	testSetName = "CCC_ObjStor_C01_TR04"
+	result = pluginkit.TestSetResult{
+		Passed:      false,
+		Description: "When a request is made to write to an object, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		Message:     "TestSet has not yet started.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+		Tests:       make(map[string]pluginkit.TestResult),
+	}
+
+	result.ExecuteTest(CCC_ObjStor_C01_TR04_T01)
+	result.ExecuteInvasiveTest(CCC_ObjStor_C01_TR04_T02)
+
+	TestSetResultSetter(
+		"Blobs can only be written using trusted Key Vault keys.",
+		"Blobs can be written using keys which are not trusted, see test results for more details.",
+		&result,
+	)
+
+	return
+}
+
+func CCC_ObjStor_C01_TR04_T01() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that the Storage Account is encrypted with a trusted Key Vault key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmAccountKeyIsTrusted(&result)
+	return
+}
+
+func CCC_ObjStor_C01_TR04_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that writing a blob using an untrusted encryption scope is rejected.",
+		Function:    utils.CallerPath(0),
+	}
+
+	ConfirmUntrustedEncryptionScopeWriteIsRejected(&result)
+	return
+}
+
 // --------------------------------------
 // Utility functions to support tests
 // --------------------------------------
@@ -120,6 +327,7 @@ type TlsFunctions interface {
 	CheckTLSVersion(endpoint string, token string, result *pluginkit.TestResult)
 	ConfirmHTTPRequestFails(endpoint string, result *pluginkit.TestResult)
 	ConfirmOutdatedProtocolRequestsFail(endpoint string, result *pluginkit.TestResult, tlsVersion int)
+	InspectTLS(endpoint string, result *pluginkit.TestResult)
 }
 
 type tlsFunctions struct{}
@@ -132,6 +340,11 @@ func (*tlsFunctions) CheckTLSVersion(endpoint string, token string, result *plug
 
 	response := ArmoryCommonFunctions.MakeGETRequest(endpoint, token, result, &minTlsVersion, nil)
 
+	// The request failing has already been recorded in the result
+	if response == nil {
+		return
+	}
+
 	// Check if the connection used TLS
 	if response.TLS != nil {
 		tlsVersion := response.TLS.Version
@@ -159,6 +372,10 @@ func (*tlsFunctions) ConfirmHTTPRequestFails(endpoint string, result *pluginkit.
 	httpUrl := strings.Replace(endpoint, "https", "http", 1)
 	response := ArmoryCommonFunctions.MakeGETRequest(httpUrl, "", result, nil, nil)
 
+	if response == nil {
+		return
+	}
+
 	if response.StatusCode == 400 && strings.Contains(response.Status, "http") {
 		result.Passed = true
 		result.Message = "HTTP requests are not supported"
@@ -180,3 +397,337 @@ func (*tlsFunctions) ConfirmOutdatedProtocolRequestsFail(endpoint string, result
 		}
 	}
 }
+
+// ServiceEndpoint is an endpoint of one of the storage account's services, such as the read-access secondary dfs endpoint
+type ServiceEndpoint struct {
+	Name string
+	URL  string
+}
+
+// EndpointResult is the outcome of a test against a single service endpoint
+type EndpointResult struct {
+	ServiceEndpoint
+	Passed  bool
+	Message string
+	Value   interface{}
+}
+
+// getServiceEndpoints lists every endpoint the storage account publishes, primary and secondary, including those of its routing preference
+func getServiceEndpoints() (endpoints []ServiceEndpoint) {
+	add := func(name string, url *string) {
+		if url != nil && *url != "" && !slices.ContainsFunc(endpoints, func(endpoint ServiceEndpoint) bool { return endpoint.URL == *url }) {
+			endpoints = append(endpoints, ServiceEndpoint{Name: name, URL: *url})
+		}
+	}
+
+	addEndpoints := func(suffix string, serviceEndpoints *armstorage.Endpoints) {
+		if serviceEndpoints == nil {
+			return
+		}
+
+		add("blob"+suffix, serviceEndpoints.Blob)
+		add("dfs"+suffix, serviceEndpoints.Dfs)
+		add("file"+suffix, serviceEndpoints.File)
+		add("queue"+suffix, serviceEndpoints.Queue)
+		add("table"+suffix, serviceEndpoints.Table)
+		add("web"+suffix, serviceEndpoints.Web)
+
+		if microsoft := serviceEndpoints.MicrosoftEndpoints; microsoft != nil {
+			add("blob-microsoftrouting"+suffix, microsoft.Blob)
+			add("dfs-microsoftrouting"+suffix, microsoft.Dfs)
+			add("file-microsoftrouting"+suffix, microsoft.File)
+			add("queue-microsoftrouting"+suffix, microsoft.Queue)
+			add("table-microsoftrouting"+suffix, microsoft.Table)
+			add("web-microsoftrouting"+suffix, microsoft.Web)
+		}
+
+		if internet := serviceEndpoints.InternetEndpoints; internet != nil {
+			add("blob-internetrouting"+suffix, internet.Blob)
+			add("dfs-internetrouting"+suffix, internet.Dfs)
+			add("file-internetrouting"+suffix, internet.File)
+			add("web-internetrouting"+suffix, internet.Web)
+		}
+	}
+
+	if properties := currentTarget.storageAccountResource.Properties; properties != nil {
+		addEndpoints("", properties.PrimaryEndpoints)
+		addEndpoints("-secondary", properties.SecondaryEndpoints)
+	}
+
+	if len(endpoints) == 0 && currentTarget.storageAccountUri != "" {
+		endpoints = append(endpoints, ServiceEndpoint{Name: "blob", URL: currentTarget.storageAccountUri})
+	}
+
+	return endpoints
+}
+
+// assessServiceEndpoints runs a test against every service endpoint, passing only when it passes for each of them, and sets the result of each endpoint as the result value
+func assessServiceEndpoints(result *pluginkit.TestResult, assess func(endpoint string, result *pluginkit.TestResult)) {
+	endpoints := getServiceEndpoints()
+
+	if len(endpoints) == 0 {
+		SetResultFailure(result, "The storage account has no service endpoints to test.")
+		return
+	}
+
+	var endpointResults []EndpointResult
+	var passedMessages, failedMessages []string
+	endpointsByMessage := make(map[string][]string)
+
+	for _, endpoint := range endpoints {
+		var endpointResult pluginkit.TestResult
+		assess(endpoint.URL, &endpointResult)
+
+		endpointResults = append(endpointResults, EndpointResult{ServiceEndpoint: endpoint, Passed: endpointResult.Passed, Message: endpointResult.Message, Value: endpointResult.Value})
+
+		// Endpoints with the same outcome are reported together, in the order they were tested
+		if _, ok := endpointsByMessage[endpointResult.Message]; !ok {
+			if endpointResult.Passed {
+				passedMessages = append(passedMessages, endpointResult.Message)
+			} else {
+				failedMessages = append(failedMessages, endpointResult.Message)
+			}
+		}
+
+		endpointsByMessage[endpointResult.Message] = append(endpointsByMessage[endpointResult.Message], endpoint.Name)
+	}
+
+	result.Value = endpointResults
+
+	describe := func(messages []string) string {
+		descriptions := make([]string, len(messages))
+
+		for i, message := range messages {
+			descriptions[i] = fmt.Sprintf("%s (%s)", message, strings.Join(endpointsByMessage[message], ", "))
+		}
+
+		return strings.Join(descriptions, "; ")
+	}
+
+	if len(failedMessages) > 0 {
+		SetResultFailure(result, describe(failedMessages))
+		return
+	}
+
+	result.Passed = true
+	result.Message = describe(passedMessages)
+}
+
+// ConfirmAccountKeyIsTrusted checks the key that the storage account encrypts data with by default against the trusted Key Vault keys
+func ConfirmAccountKeyIsTrusted(result *pluginkit.TestResult) {
+	keyId, customerManaged := getAccountKeyId()
+
+	if !customerManaged {
+		SetResultFailure(result, "Storage Account is encrypted with Microsoft-managed keys, which are not on the list of trusted Key Vault keys.")
+		return
+	}
+
+	result.Value = keyId
+
+	if !isTrustedKey(keyId) {
+		SetResultFailure(result, fmt.Sprintf("Storage Account is encrypted with Key Vault key %s, which is not on the list of trusted Key Vault keys.", keyId))
+		return
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Storage Account is encrypted with trusted Key Vault key %s.", keyId)
+}
+
+// ConfirmEncryptionScopeKeysAreTrusted checks that no enabled encryption scope, which requests can name to read or write data, uses an untrusted key
+func ConfirmEncryptionScopeKeysAreTrusted(result *pluginkit.TestResult) {
+	untrustedScopes, err := getUntrustedEncryptionScopes()
+
+	if err != nil {
+		SetResultFailure(result, fmt.Sprintf("Could not list encryption scopes: %v", err))
+		return
+	}
+
+	if len(untrustedScopes) == 0 {
+		result.Passed = true
+		result.Message = "All enabled encryption scopes use trusted Key Vault keys."
+		return
+	}
+
+	result.Value = untrustedScopes
+	SetResultFailure(result, fmt.Sprintf("Encryption scopes %s use keys which are not on the list of trusted Key Vault keys.", strings.Join(untrustedScopes, ", ")))
+
+	// Report the containers which encrypt new blobs with an untrusted scope unless a request says otherwise
+	var untrustedContainers []string
+	pager := blobContainersClient.NewListPager(currentTarget.resourceId.resourceGroupName, currentTarget.resourceId.storageAccountName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			SetResultFailure(result, fmt.Sprintf("Could not list containers: %v", err))
+			return
+		}
+
+		for _, container := range page.Value {
+			if container.Name != nil && container.Properties != nil && container.Properties.DefaultEncryptionScope != nil && slices.Contains(untrustedScopes, *container.Properties.DefaultEncryptionScope) {
+				untrustedContainers = append(untrustedContainers, *container.Name)
+			}
+		}
+	}
+
+	if len(untrustedContainers) > 0 {
+		SetResultFailure(result, fmt.Sprintf("Containers %s use an untrusted encryption scope by default.", strings.Join(untrustedContainers, ", ")))
+	}
+}
+
+// ConfirmUntrustedEncryptionScopeWriteIsRejected attempts to upload a blob to a new container using an untrusted encryption scope, which should fail
+func ConfirmUntrustedEncryptionScopeWriteIsRejected(result *pluginkit.TestResult) {
+	untrustedScopes, err := getUntrustedEncryptionScopes()
+
+	if err != nil {
+		SetResultFailure(result, fmt.Sprintf("Could not list encryption scopes: %v", err))
+		return
+	}
+
+	if len(untrustedScopes) == 0 {
+		result.Passed = true
+		result.Message = "No enabled encryption scope uses an untrusted key, so no request can name one."
+		return
+	}
+
+	encryptionScope := untrustedScopes[0]
+	randomString := ArmoryCommonFunctions.GenerateRandomString(8)
+	containerName := "privateer-test-container-" + randomString
+	blobName := "privateer-test-blob-" + randomString
+	blobUri := fmt.Sprintf("%s%s/%s", currentTarget.storageAccountUri, containerName, blobName)
+
+	blobBlockClient, err := ArmoryAzureUtils.GetBlockBlobClient(blobUri)
+
+	if err != nil {
+		SetResultFailure(result, fmt.Sprintf("Failed to create block blob client with error: %v", err))
+		return
+	}
+
+	_, err = blobContainersClient.Create(testSetContext,
+		currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
+		containerName,
+		armstorage.BlobContainer{
+			ContainerProperties: &armstorage.ContainerProperties{},
+		},
+		nil,
+	)
+
+	if err != nil {
+		SetResultFailure(result, fmt.Sprintf("Failed to create blob container with error: %v", err))
+		return
+	}
+
+	trackArtifact(artifactContainer, containerName)
+
+	_, err = blobBlockClient.UploadStream(testSetContext, strings.NewReader("Privateer test blob content"), &blockblob.UploadStreamOptions{
+		CPKScopeInfo: &blob.CPKScopeInfo{
+			EncryptionScope: to.Ptr(encryptionScope),
+		},
+	})
+
+	// Only a refusal of the encryption scope itself shows that it cannot be used, rather than a missing permission or a failed connection
+	if err == nil {
+		SetResultFailure(result, fmt.Sprintf("Write using untrusted encryption scope %s was not rejected.", encryptionScope))
+	} else if errorCode := getErrorCode(err); strings.Contains(errorCode, "EncryptionScope") {
+		result.Passed = true
+		result.Message = fmt.Sprintf("Write using untrusted encryption scope %s was rejected with error code %s.", encryptionScope, errorCode)
+	} else {
+		SetResultFailure(result, fmt.Sprintf("Write using untrusted encryption scope %s failed, but not because of its encryption scope: %s", encryptionScope, errorCode))
+	}
+
+	ArmoryAzureUtils.DeleteTestContainer(result, containerName)
+}
+
+// getAccountKeyId returns the identifier of the Key Vault key the storage account is encrypted with, or false when it uses Microsoft-managed keys
+func getAccountKeyId() (keyId string, customerManaged bool) {
+	encryption := currentTarget.storageAccountResource.Properties.Encryption
+
+	if encryption == nil || encryption.KeySource == nil || *encryption.KeySource != armstorage.KeySourceMicrosoftKeyvault || encryption.KeyVaultProperties == nil {
+		return "", false
+	}
+
+	keyVaultProperties := encryption.KeyVaultProperties
+
+	// Prefer the key version that is actually in use, which is only reported when the key is versionless
+	if keyVaultProperties.CurrentVersionedKeyIdentifier != nil && *keyVaultProperties.CurrentVersionedKeyIdentifier != "" {
+		return *keyVaultProperties.CurrentVersionedKeyIdentifier, true
+	}
+
+	if keyVaultProperties.KeyVaultURI == nil || keyVaultProperties.KeyName == nil {
+		return "", false
+	}
+
+	keyId = strings.TrimRight(*keyVaultProperties.KeyVaultURI, "/") + "/keys/" + *keyVaultProperties.KeyName
+
+	if keyVaultProperties.KeyVersion != nil && *keyVaultProperties.KeyVersion != "" {
+		keyId += "/" + *keyVaultProperties.KeyVersion
+	}
+
+	return keyId, true
+}
+
+// getUntrustedEncryptionScopes lists the names of the enabled encryption scopes which use Microsoft-managed keys or an untrusted Key Vault key
+func getUntrustedEncryptionScopes() (untrustedScopes []string, err error) {
+	pager := encryptionScopesClient.NewListPager(currentTarget.resourceId.resourceGroupName, currentTarget.resourceId.storageAccountName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return nil, err
+		}
+
+		for _, scope := range page.Value {
+			if scope.Name == nil || scope.EncryptionScopeProperties == nil {
+				continue
+			}
+
+			properties := scope.EncryptionScopeProperties
+
+			// Disabled encryption scopes cannot be used to read or write data
+			if properties.State != nil && *properties.State == armstorage.EncryptionScopeStateDisabled {
+				continue
+			}
+
+			keyId := ""
+
+			if properties.Source != nil && *properties.Source == armstorage.EncryptionScopeSourceMicrosoftKeyVault && properties.KeyVaultProperties != nil {
+				if properties.KeyVaultProperties.CurrentVersionedKeyIdentifier != nil {
+					keyId = *properties.KeyVaultProperties.CurrentVersionedKeyIdentifier
+				} else if properties.KeyVaultProperties.KeyURI != nil {
+					keyId = *properties.KeyVaultProperties.KeyURI
+				}
+			}
+
+			if keyId == "" || !isTrustedKey(keyId) {
+				untrustedScopes = append(untrustedScopes, *scope.Name)
+			}
+		}
+	}
+
+	return untrustedScopes, nil
+}
+
+// isTrustedKey checks a Key Vault key identifier against the trusted keys, a trusted key without a version matches every version of that key
+func isTrustedKey(keyId string) bool {
+	keyId = normalizeKeyId(keyId)
+
+	for _, trustedKey := range trustedKeyVaultKeys {
+		trustedKey = normalizeKeyId(trustedKey)
+
+		if trustedKey != "" && (keyId == trustedKey || strings.HasPrefix(keyId, trustedKey+"/")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// normalizeKeyId makes Key Vault key identifiers comparable, vault and key names are case-insensitive and the port is optional
+func normalizeKeyId(keyId string) string {
+	keyId = strings.ToLower(strings.TrimSpace(keyId))
+	keyId = strings.Replace(keyId, ":443/", "/", 1)
+
+	return strings.TrimRight(keyId, "/")
+}
@@ -1,10 +1,16 @@
 package abs
 
 import (
+	"context"
 	"crypto/tls"
 	"net/http"
+	"strings"
 	"testing"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 	"github.com/stretchr/testify/assert"
 )
@@ -15,6 +21,7 @@ type tlsFunctionsMock struct {
 	checkTlsVersionResult                     bool
 	confirmHttpRequestFailsResult             bool
 	confirmOutdatedProtocolRequestsFailResult bool
+	inspectTlsFindings                        []string
 }
 
 func (mock *tlsFunctionsMock) CheckTLSVersion(endpoint string, token string, result *pluginkit.TestResult) {
@@ -41,8 +48,28 @@ func (mock *tlsFunctionsMock) ConfirmOutdatedProtocolRequestsFail(endpoint strin
 	}
 }
 
+func (mock *tlsFunctionsMock) InspectTLS(endpoint string, result *pluginkit.TestResult) {
+	result.Value = TlsReport{ProtocolVersion: "TLS 1.3", Findings: mock.inspectTlsFindings}
+
+	if len(mock.inspectTlsFindings) > 0 {
+		SetResultFailure(result, strings.Join(mock.inspectTlsFindings, "; "))
+	} else {
+		result.Passed = true
+		result.Message = "Mocked TLS configuration is strong"
+	}
+}
+
+// useBlobEndpointOnly sets up a storage account which only publishes a primary blob endpoint
+func useBlobEndpointOnly() {
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		PrimaryEndpoints: &armstorage.Endpoints{Blob: to.Ptr("https://account.blob.core.windows.net/")},
+	}}
+}
+
 func Test_CCC_C01_TR01_T02_succeeds(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		checkTlsVersionResult: true,
 		azureUtilsMock:        azureUtilsMock{tokenResult: "mocked_token"},
@@ -56,11 +83,13 @@ func Test_CCC_C01_TR01_T02_succeeds(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "TLS Mock is being used", result.Message)
+	assert.Equal(t, "TLS Mock is being used (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T02_fails_if_checkTlsVersion_fails(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		checkTlsVersionResult: false,
 		azureUtilsMock:        azureUtilsMock{tokenResult: "mocked_token"},
@@ -74,7 +103,7 @@ func Test_CCC_C01_TR01_T02_fails_if_checkTlsVersion_fails(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "TLS Mock is being used", result.Message)
+	assert.Equal(t, "TLS Mock is being used (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T02_fails_if_no_token_received(t *testing.T) {
@@ -97,6 +126,8 @@ func Test_CCC_C01_TR01_T02_fails_if_no_token_received(t *testing.T) {
 
 func Test_CCC_C01_TR01_T01_succeeds(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		confirmHttpRequestFailsResult: true,
 	}
@@ -109,11 +140,13 @@ func Test_CCC_C01_TR01_T01_succeeds(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Mocked HTTP requests are not supported", result.Message)
+	assert.Equal(t, "Mocked HTTP requests are not supported (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T01_fails_if_confirmHttpRequestFails_fails(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		confirmHttpRequestFailsResult: false,
 	}
@@ -126,11 +159,13 @@ func Test_CCC_C01_TR01_T01_fails_if_confirmHttpRequestFails_fails(t *testing.T)
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "Mocked HTTP requests are supported", result.Message)
+	assert.Equal(t, "Mocked HTTP requests are supported (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T03_succeeds(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		confirmOutdatedProtocolRequestsFailResult: true,
 	}
@@ -143,11 +178,13 @@ func Test_CCC_C01_TR01_T03_succeeds(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Insecure TLS version Mocked not supported", result.Message)
+	assert.Equal(t, "Insecure TLS version Mocked not supported (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T03_fails_if_confirmOutdatedProtocolRequestsFail_fails(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		confirmOutdatedProtocolRequestsFailResult: false,
 	}
@@ -160,11 +197,13 @@ func Test_CCC_C01_TR01_T03_fails_if_confirmOutdatedProtocolRequestsFail_fails(t
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "Insecure TLS version Mocked is supported", result.Message)
+	assert.Equal(t, "Insecure TLS version Mocked is supported (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T04_succeeds(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		confirmOutdatedProtocolRequestsFailResult: true,
 	}
@@ -177,11 +216,13 @@ func Test_CCC_C01_TR01_T04_succeeds(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Insecure TLS version Mocked not supported", result.Message)
+	assert.Equal(t, "Insecure TLS version Mocked not supported (blob)", result.Message)
 }
 
 func Test_CCC_C01_TR01_T04_fails_if_confirmOutdatedProtocolRequestsFail_fails(t *testing.T) {
 	// Arrange
+	useBlobEndpointOnly()
+
 	myMock := tlsFunctionsMock{
 		confirmOutdatedProtocolRequestsFailResult: false,
 	}
@@ -194,7 +235,87 @@ func Test_CCC_C01_TR01_T04_fails_if_confirmOutdatedProtocolRequestsFail_fails(t
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "Insecure TLS version Mocked is supported", result.Message)
+	assert.Equal(t, "Insecure TLS version Mocked is supported (blob)", result.Message)
+}
+
+func Test_getServiceEndpoints_lists_primary_secondary_and_routing_endpoints(t *testing.T) {
+	// Arrange
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		PrimaryEndpoints: &armstorage.Endpoints{
+			Blob:               to.Ptr("https://account.blob.core.windows.net/"),
+			Dfs:                to.Ptr("https://account.dfs.core.windows.net/"),
+			MicrosoftEndpoints: &armstorage.AccountMicrosoftEndpoints{Blob: to.Ptr("https://account-microsoftrouting.blob.core.windows.net/")},
+		},
+		SecondaryEndpoints: &armstorage.Endpoints{
+			Blob: to.Ptr("https://account-secondary.blob.core.windows.net/"),
+			Web:  to.Ptr("https://account-secondary.z6.web.core.windows.net/"),
+		},
+	}}
+
+	// Act
+	endpoints := getServiceEndpoints()
+
+	// Assert
+	assert.Equal(t, []ServiceEndpoint{
+		{Name: "blob", URL: "https://account.blob.core.windows.net/"},
+		{Name: "dfs", URL: "https://account.dfs.core.windows.net/"},
+		{Name: "blob-microsoftrouting", URL: "https://account-microsoftrouting.blob.core.windows.net/"},
+		{Name: "blob-secondary", URL: "https://account-secondary.blob.core.windows.net/"},
+		{Name: "web-secondary", URL: "https://account-secondary.z6.web.core.windows.net/"},
+	}, endpoints)
+}
+
+func Test_assessServiceEndpoints_fails_when_any_endpoint_fails(t *testing.T) {
+	// Arrange
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		PrimaryEndpoints:   &armstorage.Endpoints{Blob: to.Ptr("https://account.blob.core.windows.net/"), Dfs: to.Ptr("https://account.dfs.core.windows.net/")},
+		SecondaryEndpoints: &armstorage.Endpoints{Blob: to.Ptr("https://account-secondary.blob.core.windows.net/")},
+	}}
+
+	var result pluginkit.TestResult
+
+	// Act
+	assessServiceEndpoints(&result, func(endpoint string, endpointResult *pluginkit.TestResult) {
+		if endpoint == "https://account-secondary.blob.core.windows.net/" {
+			SetResultFailure(endpointResult, "TLS 1.0 is being used")
+			return
+		}
+
+		endpointResult.Passed = true
+		endpointResult.Message = "TLS 1.2 is being used"
+	})
+
+	// Assert
+	assert.False(t, result.Passed)
+	assert.Equal(t, "TLS 1.0 is being used (blob-secondary)", result.Message)
+	assert.Equal(t, []EndpointResult{
+		{ServiceEndpoint: ServiceEndpoint{Name: "blob", URL: "https://account.blob.core.windows.net/"}, Passed: true, Message: "TLS 1.2 is being used"},
+		{ServiceEndpoint: ServiceEndpoint{Name: "dfs", URL: "https://account.dfs.core.windows.net/"}, Passed: true, Message: "TLS 1.2 is being used"},
+		{ServiceEndpoint: ServiceEndpoint{Name: "blob-secondary", URL: "https://account-secondary.blob.core.windows.net/"}, Passed: false, Message: "TLS 1.0 is being used"},
+	}, result.Value)
+}
+
+func Test_assessServiceEndpoints_groups_endpoints_with_the_same_outcome(t *testing.T) {
+	// Arrange
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		PrimaryEndpoints: &armstorage.Endpoints{Blob: to.Ptr("https://account.blob.core.windows.net/"), Queue: to.Ptr("https://account.queue.core.windows.net/"), Table: to.Ptr("https://account.table.core.windows.net/")},
+	}}
+
+	var result pluginkit.TestResult
+
+	// Act
+	assessServiceEndpoints(&result, func(endpoint string, endpointResult *pluginkit.TestResult) {
+		endpointResult.Passed = true
+		endpointResult.Message = "TLS 1.2 is being used"
+
+		if endpoint == "https://account.queue.core.windows.net/" {
+			endpointResult.Message = "TLS 1.3 is being used"
+		}
+	})
+
+	// Assert
+	assert.True(t, result.Passed)
+	assert.Equal(t, "TLS 1.2 is being used (blob, table); TLS 1.3 is being used (queue)", result.Message)
 }
 
 func Test_CheckTLSVersion_succeeds(t *testing.T) {
@@ -404,3 +525,302 @@ func Test_ConfirmOutdatedProtocolRequestFails_fails_for_bad_statusCode(t *testin
 	assert.Equal(t, false, result.Passed)
 	assert.Equal(t, "Insecure TLS version TLS 1.2 is supported", result.Message)
 }
+
+type encryptionScopesClientMock struct {
+	encryptionScopes []*armstorage.EncryptionScope
+	listError        error
+}
+
+func (mock *encryptionScopesClientMock) NewListPager(resourceGroupName string, accountName string, options *armstorage.EncryptionScopesClientListOptions) *runtime.Pager[armstorage.EncryptionScopesClientListResponse] {
+	if mock.listError != nil {
+		return CreatePager([]armstorage.EncryptionScopesClientListResponse{}, mock.listError)
+	}
+
+	return CreatePager([]armstorage.EncryptionScopesClientListResponse{
+		{
+			EncryptionScopeListResult: armstorage.EncryptionScopeListResult{
+				Value: mock.encryptionScopes,
+			},
+		},
+	}, nil)
+}
+
+func newKeyVaultEncryptionScope(name string, keyUri string, state armstorage.EncryptionScopeState) *armstorage.EncryptionScope {
+	return &armstorage.EncryptionScope{
+		Name: to.Ptr(name),
+		EncryptionScopeProperties: &armstorage.EncryptionScopeProperties{
+			Source: to.Ptr(armstorage.EncryptionScopeSourceMicrosoftKeyVault),
+			State:  to.Ptr(state),
+			KeyVaultProperties: &armstorage.EncryptionScopeKeyVaultProperties{
+				KeyURI: to.Ptr(keyUri),
+			},
+		},
+	}
+}
+
+func Test_CCC_ObjStor_C01_TR01_T01_succeeds_with_trusted_key(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	myMock := storageAccountMock{
+		keySource:   armstorage.KeySourceMicrosoftKeyvault,
+		keyVaultUri: "https://myvault.vault.azure.net/",
+		keyName:     "mykey",
+		keyVersion:  "0123456789abcdef",
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+
+	// Act
+	result := CCC_ObjStor_C01_TR01_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "Storage Account is encrypted with trusted Key Vault key https://myvault.vault.azure.net/keys/mykey/0123456789abcdef.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR01_T01_fails_with_untrusted_key(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	myMock := storageAccountMock{
+		keySource:   armstorage.KeySourceMicrosoftKeyvault,
+		keyVaultUri: "https://othervault.vault.azure.net/",
+		keyName:     "mykey",
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+
+	// Act
+	result := CCC_ObjStor_C01_TR01_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Storage Account is encrypted with Key Vault key https://othervault.vault.azure.net/keys/mykey, which is not on the list of trusted Key Vault keys.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR01_T01_fails_with_microsoft_managed_keys(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	myMock := storageAccountMock{
+		keySource: armstorage.KeySourceMicrosoftStorage,
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+
+	// Act
+	result := CCC_ObjStor_C01_TR01_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Storage Account is encrypted with Microsoft-managed keys, which are not on the list of trusted Key Vault keys.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR01_T02_succeeds_with_trusted_scopes(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	encryptionScopesClient = &encryptionScopesClientMock{
+		encryptionScopes: []*armstorage.EncryptionScope{
+			newKeyVaultEncryptionScope("trustedscope", "https://myvault.vault.azure.net/keys/mykey", armstorage.EncryptionScopeStateEnabled),
+			newKeyVaultEncryptionScope("disabledscope", "https://othervault.vault.azure.net/keys/otherkey", armstorage.EncryptionScopeStateDisabled),
+		},
+	}
+
+	// Act
+	result := CCC_ObjStor_C01_TR01_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "All enabled encryption scopes use trusted Key Vault keys.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR01_T02_fails_with_untrusted_container_default_scope(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	encryptionScopesClient = &encryptionScopesClientMock{
+		encryptionScopes: []*armstorage.EncryptionScope{
+			newKeyVaultEncryptionScope("untrustedscope", "https://othervault.vault.azure.net/keys/otherkey", armstorage.EncryptionScopeStateEnabled),
+		},
+	}
+
+	blobContainersClient = &blobContainersClientMock{
+		containerItem: armstorage.ListContainerItem{
+			Name: to.Ptr("mycontainer"),
+			Properties: &armstorage.ContainerProperties{
+				DefaultEncryptionScope: to.Ptr("untrustedscope"),
+			},
+		},
+	}
+
+	// Act
+	result := CCC_ObjStor_C01_TR01_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, []string{"untrustedscope"}, result.Value)
+	assert.Equal(t, "Encryption scopes untrustedscope use keys which are not on the list of trusted Key Vault keys. Containers mycontainer use an untrusted encryption scope by default.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR01_T02_fails_with_list_error(t *testing.T) {
+	// Arrange
+	encryptionScopesClient = &encryptionScopesClientMock{
+		listError: assert.AnError,
+	}
+
+	// Act
+	result := CCC_ObjStor_C01_TR01_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Could not list encryption scopes: assert.AnError general error for testing", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR03_T02_succeeds_when_write_is_rejected(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	encryptionScopesClient = &encryptionScopesClientMock{
+		encryptionScopes: []*armstorage.EncryptionScope{
+			newKeyVaultEncryptionScope("untrustedscope", "https://othervault.vault.azure.net/keys/otherkey", armstorage.EncryptionScopeStateEnabled),
+		},
+	}
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		blobBlockClient: &mockBlockBlobClient{
+			uploadError: &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "EncryptionScopeDisabled"},
+		},
+	}
+
+	ArmoryCommonFunctions = &commonFunctionsMock{
+		randomString: "randomst",
+	}
+
+	blobContainersClient = &blobContainersClientMock{}
+
+	// Act
+	result := CCC_ObjStor_C01_TR03_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "Write using untrusted encryption scope untrustedscope was rejected with error code EncryptionScopeDisabled.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR03_T02_fails_when_write_fails_for_another_reason(t *testing.T) {
+	tests := []struct {
+		name            string
+		uploadError     error
+		expectedMessage string
+	}{
+		{
+			name:            "permission denied",
+			uploadError:     &azcore.ResponseError{StatusCode: http.StatusForbidden, ErrorCode: "AuthorizationPermissionMismatch"},
+			expectedMessage: "Write using untrusted encryption scope untrustedscope failed, but not because of its encryption scope: AuthorizationPermissionMismatch",
+		},
+		{
+			name:            "cancelled",
+			uploadError:     context.Canceled,
+			expectedMessage: "Write using untrusted encryption scope untrustedscope failed, but not because of its encryption scope: context canceled",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+			encryptionScopesClient = &encryptionScopesClientMock{
+				encryptionScopes: []*armstorage.EncryptionScope{
+					newKeyVaultEncryptionScope("untrustedscope", "https://othervault.vault.azure.net/keys/otherkey", armstorage.EncryptionScopeStateEnabled),
+				},
+			}
+
+			ArmoryAzureUtils = &azureUtilsMock{
+				blobBlockClient: &mockBlockBlobClient{
+					uploadError: tt.uploadError,
+				},
+			}
+
+			ArmoryCommonFunctions = &commonFunctionsMock{
+				randomString: "randomst",
+			}
+
+			blobContainersClient = &blobContainersClientMock{}
+
+			// Act
+			result := CCC_ObjStor_C01_TR03_T02()
+
+			// Assert
+			assert.Equal(t, false, result.Passed)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+		})
+	}
+}
+
+func Test_CCC_ObjStor_C01_TR03_T02_fails_when_write_is_accepted(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	encryptionScopesClient = &encryptionScopesClientMock{
+		encryptionScopes: []*armstorage.EncryptionScope{
+			newKeyVaultEncryptionScope("untrustedscope", "https://othervault.vault.azure.net/keys/otherkey", armstorage.EncryptionScopeStateEnabled),
+		},
+	}
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		blobBlockClient: &mockBlockBlobClient{},
+	}
+
+	ArmoryCommonFunctions = &commonFunctionsMock{
+		randomString: "randomst",
+	}
+
+	blobContainersClient = &blobContainersClientMock{}
+
+	// Act
+	result := CCC_ObjStor_C01_TR03_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Write using untrusted encryption scope untrustedscope was not rejected.", result.Message)
+}
+
+func Test_CCC_ObjStor_C01_TR04_T02_succeeds_without_untrusted_scopes(t *testing.T) {
+	// Arrange
+	trustedKeyVaultKeys = []string{"https://myvault.vault.azure.net/keys/mykey"}
+
+	encryptionScopesClient = &encryptionScopesClientMock{}
+
+	// Act
+	result := CCC_ObjStor_C01_TR04_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "No enabled encryption scope uses an untrusted key, so no request can name one.", result.Message)
+}
+
+func Test_isTrustedKey(t *testing.T) {
+	trustedKeyVaultKeys = []string{
+		"https://myvault.vault.azure.net/keys/mykey",
+		"https://myvault.vault.azure.net/keys/pinnedkey/0123456789abcdef/",
+	}
+
+	tests := []struct {
+		name     string
+		keyId    string
+		expected bool
+	}{
+		{"versionless trusted key", "https://myvault.vault.azure.net/keys/mykey", true},
+		{"any version of a versionless trusted key", "https://myvault.vault.azure.net/keys/mykey/fedcba9876543210", true},
+		{"different case and port", "https://MyVault.vault.azure.net:443/keys/MyKey", true},
+		{"pinned version", "https://myvault.vault.azure.net/keys/pinnedkey/0123456789abcdef", true},
+		{"other version of a pinned key", "https://myvault.vault.azure.net/keys/pinnedkey/fedcba9876543210", false},
+		{"key name sharing a prefix", "https://myvault.vault.azure.net/keys/mykey2", false},
+		{"other vault", "https://othervault.vault.azure.net/keys/mykey", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isTrustedKey(tt.keyId))
+		})
+	}
+}
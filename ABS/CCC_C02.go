@@ -37,10 +37,10 @@ func CCC_C02_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.Encryption.Services.Blob.Enabled {
+	if *currentTarget.storageAccountResource.Properties.Encryption.Services.Blob.Enabled {
 		result.Passed = true
 
-		if *storageAccountResource.Properties.Encryption.KeySource == "Microsoft.Storage" {
+		if *currentTarget.storageAccountResource.Properties.Encryption.KeySource == "Microsoft.Storage" {
 			result.Message = "Encryption with Microsoft-managed keys is enabled on the Azure Storage Account."
 		} else {
 			result.Message = "Encryption with customer-managed keys is enabled on the Azure Storage Account."
@@ -85,7 +85,7 @@ func CCC_ObjStor_C02_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.AllowSharedKeyAccess {
+	if *currentTarget.storageAccountResource.Properties.AllowSharedKeyAccess {
 		SetResultFailure(&result, "Shared Key access is enabled for the storage account.")
 	} else {
 		result.Passed = true
@@ -127,7 +127,7 @@ func CCC_ObjStor_C02_TR02_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.AllowSharedKeyAccess {
+	if *currentTarget.storageAccountResource.Properties.AllowSharedKeyAccess {
 		SetResultFailure(&result, "Shared Key access is enabled for the storage account.")
 	} else {
 		result.Passed = true
@@ -13,7 +13,7 @@ func Test_CCC_C02_TR01_T01_succeeds_with_microsoft_managed_keys(t *testing.T) {
 		keySource:         "Microsoft.Storage",
 	}
 
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C02_TR01_T01()
@@ -30,7 +30,7 @@ func Test_CCC_C02_TR01_T01_succeeds_with_customer_managed_keys(t *testing.T) {
 		keySource:         "Microsoft.KeyVault",
 	}
 
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C02_TR01_T01()
@@ -47,7 +47,7 @@ func Test_CCC_C02_TR01_T01_fails_if_encryption_disabled(t *testing.T) {
 		keySource:         "Microsoft.Storage",
 	}
 
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C02_TR01_T01()
@@ -62,7 +62,7 @@ func Test_CCC_ObjStor_C02_TR01_T01_succeeds(t *testing.T) {
 	myMock := storageAccountMock{
 		allowSharedKeyAccess: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR02_T02()
@@ -77,7 +77,7 @@ func Test_CCC_ObjStor_C02_TR01_T01_fails(t *testing.T) {
 	myMock := storageAccountMock{
 		allowSharedKeyAccess: true,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR02_T02()
@@ -92,7 +92,7 @@ func Test_CCC_ObjStor_C02_TR02_T01_succeeds(t *testing.T) {
 	myMock := storageAccountMock{
 		allowSharedKeyAccess: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR02_T02()
@@ -107,7 +107,7 @@ func Test_CCC_ObjStor_C02_TR02_T01_fails(t *testing.T) {
 	myMock := storageAccountMock{
 		allowSharedKeyAccess: true,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR02_T02()
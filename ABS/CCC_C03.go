@@ -1,7 +1,6 @@
 package abs
 
 import (
-	"context"
 	"fmt"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
@@ -69,11 +68,34 @@ func CCC_C03_TR02_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.AllowBlobPublicAccess {
-		SetResultFailure(&result, "Public anonymous blob access is enabled for the storage account.")
-	} else {
+	// Anonymous access is only granted by the containers whose public access level allows it, they are inventoried either way
+	//  as their access level takes effect again if the storage account setting is ever enabled
+	inventory, err := ArmoryAzureUtils.GetContainerInventory()
+	result.Value = inventory
+	publicContainers := describeContainers(inventory, ContainerInventoryItem.allowsPublicAccess, func(item ContainerInventoryItem) string { return item.PublicAccess })
+
+	if !*currentTarget.storageAccountResource.Properties.AllowBlobPublicAccess {
 		result.Passed = true
 		result.Message = "Public anonymous blob access is disabled for the storage account."
+
+		if err != nil {
+			result.Message += fmt.Sprintf(" Its containers could not be inventoried: %v", err)
+		} else if publicContainers != "" {
+			result.Message += " The public access level of the containers " + publicContainers + " has no effect while it is disabled."
+		}
+
+		return
+	}
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Public anonymous blob access is enabled for the storage account, its containers could not be inventoried: %v", err))
+		return
+	}
+
+	if publicContainers != "" {
+		SetResultFailure(&result, "Public anonymous blob access is enabled for the storage account, and allowed by the containers "+publicContainers+".")
+	} else {
+		SetResultFailure(&result, "Public anonymous blob access is enabled for the storage account, although no container allows it yet.")
 	}
 
 	return
@@ -85,7 +107,7 @@ func CCC_C03_TR02_T02() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.AllowSharedKeyAccess {
+	if *currentTarget.storageAccountResource.Properties.AllowSharedKeyAccess {
 		SetResultFailure(&result, "Shared Key access is enabled for the storage account.")
 	} else {
 		result.Passed = true
@@ -152,6 +174,10 @@ func CCC_C03_TR05() (testSetName string, result pluginkit.TestSetResult) {
 
 	result.ExecuteTest(CCC_C03_TR05_T01)
 
+	if runnerNetworkAccess != "" {
+		result.ExecuteTest(CCC_C03_TR05_T02)
+	}
+
 	return
 }
 
@@ -161,42 +187,19 @@ func CCC_C03_TR05_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.PublicNetworkAccess == "Disabled" {
-		result.Passed = true
-		result.Message = "Public network access is disabled for the storage account."
-	} else if *storageAccountResource.Properties.PublicNetworkAccess == "Enabled" {
-
-		if *storageAccountResource.Properties.NetworkRuleSet.DefaultAction == "Deny" {
+	assessNetworkExposure(&result)
 
-			type AllowedIps struct {
-				Name string
-				IPs  []string
-			}
-
-			allowedIps := AllowedIps{
-				Name: "Allowlisted IPs and IP ranges",
-				IPs:  []string{},
-			}
-
-			for _, ip := range storageAccountResource.Properties.NetworkRuleSet.IPRules {
-				allowedIps.IPs = append(allowedIps.IPs, *ip.IPAddressOrRange)
-			}
-
-			result.Value = allowedIps
-			result.Passed = true
-			result.Message = "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist IPs (see result value)."
-
-		} else {
-			SetResultFailure(&result, "Public network access is enabled for the storage account and the default action is not set to deny for sources outside of the allowlist.")
-		}
+	return
+}
 
-	} else if *storageAccountResource.Properties.PublicNetworkAccess == "SecuredByPerimeter" {
-		// This isn't publicly available yet so we shouldn't hit this condition with customers
-		SetResultFailure(&result, "Public network access to the storage account is secured by Network Security Perimeter, this plugin does not support assessment of network access via Network Security Perimeter.")
-	} else {
-		SetResultFailure(&result, fmt.Sprintf("Public network access status of %s unclear.", *storageAccountResource.Properties.PublicNetworkAccess))
+func CCC_C03_TR05_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that requests to the data plane of the service from the runner are blocked or allowed by the network rules, as the runner is expected to be outside or inside of the allowed networks.",
+		Function:    utils.CallerPath(0),
 	}
 
+	probeNetworkReachability(&result)
+
 	return
 }
 
@@ -258,14 +261,14 @@ func CCC_ObjStor_C03_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *blobServiceProperties.BlobServiceProperties.ContainerDeleteRetentionPolicy.Enabled {
+	if *currentTarget.blobServiceProperties.BlobServiceProperties.ContainerDeleteRetentionPolicy.Enabled {
 		retentionPolicy := RetentionPolicy{
 			Name: "Soft Delete Policy Retention Period in Days",
-			Days: *blobServiceProperties.BlobServiceProperties.ContainerDeleteRetentionPolicy.Days,
+			Days: *currentTarget.blobServiceProperties.BlobServiceProperties.ContainerDeleteRetentionPolicy.Days,
 		}
 		result.Value = retentionPolicy
 
-		if *blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.AllowPermanentDelete {
+		if *currentTarget.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.AllowPermanentDelete {
 			SetResultFailure(&result, "Soft delete is enabled for Storage Account Containers, but permanent delete of soft deleted items is allowed.")
 		} else {
 			result.Passed = true
@@ -285,9 +288,9 @@ func CCC_ObjStor_C03_TR01_T02() (result pluginkit.TestResult) {
 
 	containerName := "privateer-test-container-" + ArmoryCommonFunctions.GenerateRandomString(8)
 
-	_, err := blobContainersClient.Create(context.Background(),
-		resourceId.resourceGroupName,
-		resourceId.storageAccountName,
+	_, err := blobContainersClient.Create(testSetContext,
+		currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
 		containerName,
 		armstorage.BlobContainer{
 			ContainerProperties: &armstorage.ContainerProperties{},
@@ -300,9 +303,11 @@ func CCC_ObjStor_C03_TR01_T02() (result pluginkit.TestResult) {
 		return
 	}
 
-	_, err = blobContainersClient.Delete(context.Background(),
-		resourceId.resourceGroupName,
-		resourceId.storageAccountName,
+	trackArtifact(artifactContainer, containerName)
+
+	_, err = blobContainersClient.Delete(testSetContext,
+		currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
 		containerName,
 		nil,
 	)
@@ -312,15 +317,17 @@ func CCC_ObjStor_C03_TR01_T02() (result pluginkit.TestResult) {
 		return
 	}
 
-	containersPager := blobContainersClient.NewListPager(resourceId.resourceGroupName,
-		resourceId.storageAccountName,
+	releaseArtifact(artifactContainer, containerName)
+
+	containersPager := blobContainersClient.NewListPager(currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
 		&armstorage.BlobContainersClientListOptions{
 			Include: to.Ptr(armstorage.ListContainersIncludeDeleted),
 		},
 	)
 
 	for containersPager.More() {
-		page, err := containersPager.NextPage(context.Background())
+		page, err := containersPager.NextPage(testSetContext)
 		if err != nil {
 			SetResultFailure(&result, fmt.Sprintf("Failed to list blob containers with error: %v", err))
 			return
@@ -346,14 +353,14 @@ func CCC_ObjStor_C03_TR01_T03() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.Enabled {
+	if *currentTarget.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.Enabled {
 		retentionPolicy := RetentionPolicy{
 			Name: "Soft Delete Policy Retention Period in Days",
-			Days: *blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.Days,
+			Days: *currentTarget.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.Days,
 		}
 		result.Value = retentionPolicy
 
-		if *blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.AllowPermanentDelete {
+		if *currentTarget.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.AllowPermanentDelete {
 			SetResultFailure(&result, "Soft delete is enabled for Storage Account Blobs, but permanent delete of soft deleted items is allowed.")
 		} else {
 			result.Passed = true
@@ -375,7 +382,7 @@ func CCC_ObjStor_C03_TR01_T04() (result pluginkit.TestResult) {
 	randomString := ArmoryCommonFunctions.GenerateRandomString(8)
 	containerName := "privateer-test-container-" + randomString
 	blobName := "privateer-test-blob-" + randomString
-	blobUri := fmt.Sprintf("%s%s/%s", storageAccountUri, containerName, blobName)
+	blobUri := fmt.Sprintf("%s%s/%s", currentTarget.storageAccountUri, containerName, blobName)
 	blobContent := "Privateer test blob content"
 
 	blobBlockClient, newBlockBlobClientFailedError := ArmoryAzureUtils.GetBlockBlobClient(blobUri)
@@ -388,10 +395,10 @@ func CCC_ObjStor_C03_TR01_T04() (result pluginkit.TestResult) {
 	blobBlockClient, createContainerSucceeded := ArmoryAzureUtils.CreateContainerWithBlobContent(&result, blobBlockClient, containerName, blobName, blobContent)
 
 	if createContainerSucceeded {
-		_, blobDeleteFailedError := blobBlockClient.Delete(context.Background(), nil)
+		_, blobDeleteFailedError := blobBlockClient.Delete(testSetContext, nil)
 
 		if blobDeleteFailedError == nil {
-			_, blobUndeleteFailedError := blobBlockClient.Undelete(context.Background(), nil)
+			_, blobUndeleteFailedError := blobBlockClient.Undelete(testSetContext, nil)
 
 			if blobUndeleteFailedError == nil {
 				result.Passed = true
@@ -440,25 +447,38 @@ func CCC_ObjStor_C03_TR02_T01() (result pluginkit.TestResult) {
 	}
 
 	immutabilityConfiguration := ArmoryAzureUtils.GetImmutabilityConfiguration()
-	result.Value = immutabilityConfiguration
+	var failure string
 
 	if !immutabilityConfiguration.Enabled {
-		SetResultFailure(&result, "Immutability is not enabled for Storage Account.")
-		return
+		failure = "Immutability is not enabled for Storage Account."
+	} else if immutabilityConfiguration.PolicyState == nil {
+		failure = "Immutability policy is not set for the storage account."
+	} else if *immutabilityConfiguration.PolicyState != armstorage.AccountImmutabilityPolicyStateLocked {
+		failure = "Immutability policy is not locked."
 	}
 
-	if immutabilityConfiguration.PolicyState == nil {
-		SetResultFailure(&result, "Immutability policy is not set for the storage account.")
+	if failure == "" {
+		result.Value = immutabilityConfiguration
+		result.Passed = true
+		result.Message = "Immutability policy is locked for the storage account."
 		return
 	}
 
-	if *immutabilityConfiguration.PolicyState != armstorage.AccountImmutabilityPolicyStateLocked {
-		SetResultFailure(&result, "Immutability policy is not locked.")
+	// Without a locked account-level policy, the retention policies cannot be unset if every container has a locked policy of its own
+	allLocked := inventoryContainerImmutability(&immutabilityConfiguration, ContainerInventoryItem.isLocked)
+	result.Value = immutabilityConfiguration
+
+	if allLocked {
+		result.Passed = true
+		result.Message = fmt.Sprintf("Immutability policies are locked for all %d containers of the storage account.", len(immutabilityConfiguration.Containers))
 		return
 	}
 
-	result.Passed = true
-	result.Message = "Immutability policy is locked for the storage account."
+	if len(immutabilityConfiguration.Containers) > 0 {
+		failure += fmt.Sprintf(" %d of %d containers have a locked immutability policy.", countContainers(immutabilityConfiguration.Containers, ContainerInventoryItem.isLocked), len(immutabilityConfiguration.Containers))
+	}
+
+	SetResultFailure(&result, failure)
 	return
 }
 
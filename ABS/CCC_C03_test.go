@@ -20,7 +20,8 @@ func Test_CCC_C03_TR02_T01_succeeds(t *testing.T) {
 	myMock := storageAccountMock{
 		allowBlobPublicAccess: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{}
 
 	// Act
 	result := CCC_C03_TR02_T01()
@@ -30,19 +31,104 @@ func Test_CCC_C03_TR02_T01_succeeds(t *testing.T) {
 	assert.Equal(t, "Public anonymous blob access is disabled for the storage account.", result.Message)
 }
 
+func Test_CCC_C03_TR02_T01_succeeds_and_inventories_containers_when_public_access_is_disabled(t *testing.T) {
+	tests := []struct {
+		name            string
+		azureUtils      *azureUtilsMock
+		expectedLen     int
+		expectedMessage string
+	}{
+		{
+			name: "containers with a public access level",
+			azureUtils: &azureUtilsMock{
+				containerInventory: []ContainerInventoryItem{
+					{Name: "website", PublicAccess: "Blob"},
+					{Name: "private", PublicAccess: "None"},
+				},
+			},
+			expectedLen:     2,
+			expectedMessage: "Public anonymous blob access is disabled for the storage account. The public access level of the containers website (Blob) has no effect while it is disabled.",
+		},
+		{
+			name:            "containers cannot be inventoried",
+			azureUtils:      &azureUtilsMock{getContainerInventoryError: assert.AnError},
+			expectedMessage: "Public anonymous blob access is disabled for the storage account. Its containers could not be inventoried: assert.AnError general error for testing",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			myMock := storageAccountMock{
+				allowBlobPublicAccess: false,
+			}
+			currentTarget.storageAccountResource = myMock.SetStorageAccount()
+			ArmoryAzureUtils = tt.azureUtils
+
+			// Act
+			result := CCC_C03_TR02_T01()
+
+			// Assert
+			assert.Equal(t, true, result.Passed)
+			assert.Len(t, result.Value, tt.expectedLen)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+		})
+	}
+}
+
 func Test_CCC_C03_TR02_T01_fails(t *testing.T) {
 	// Arrange
 	myMock := storageAccountMock{
 		allowBlobPublicAccess: true,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{}
 
 	// Act
 	result := CCC_C03_TR02_T01()
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "Public anonymous blob access is enabled for the storage account.", result.Message)
+	assert.Equal(t, "Public anonymous blob access is enabled for the storage account, although no container allows it yet.", result.Message)
+}
+
+func Test_CCC_C03_TR02_T01_fails_with_public_containers(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{
+		allowBlobPublicAccess: true,
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{
+			{Name: "website", PublicAccess: "Blob"},
+			{Name: "private", PublicAccess: "None"},
+			{Name: "listing", PublicAccess: "Container"},
+		},
+	}
+
+	// Act
+	result := CCC_C03_TR02_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Len(t, result.Value, 3)
+	assert.Equal(t, "Public anonymous blob access is enabled for the storage account, and allowed by the containers website (Blob), listing (Container).", result.Message)
+}
+
+func Test_CCC_C03_TR02_T01_fails_when_containers_cannot_be_inventoried(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{
+		allowBlobPublicAccess: true,
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{getContainerInventoryError: assert.AnError}
+
+	// Act
+	result := CCC_C03_TR02_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Public anonymous blob access is enabled for the storage account, its containers could not be inventoried: assert.AnError general error for testing", result.Message)
 }
 
 func Test_CCC_C03_TR02_T02_succeeds(t *testing.T) {
@@ -50,7 +136,7 @@ func Test_CCC_C03_TR02_T02_succeeds(t *testing.T) {
 	myMock := storageAccountMock{
 		allowSharedKeyAccess: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR02_T02()
@@ -65,7 +151,7 @@ func Test_CCC_C03_TR02_T02_fails(t *testing.T) {
 	myMock := storageAccountMock{
 		allowSharedKeyAccess: true,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR02_T02()
@@ -80,14 +166,14 @@ func Test_CCC_C03_TR05_T01_succeeds_with_public_network_access_disabled(t *testi
 	myMock := storageAccountMock{
 		publicNetworkAccess: armstorage.PublicNetworkAccessDisabled,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR05_T01()
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Public network access is disabled for the storage account.", result.Message)
+	assert.Equal(t, "Public network access is disabled for the storage account, and it has no approved private endpoints to be reached through.", result.Message)
 }
 
 func Test_CCC_C03_TR05_T01_succeeds_with_public_network_access_enabled_and_default_action_deny(t *testing.T) {
@@ -96,14 +182,14 @@ func Test_CCC_C03_TR05_T01_succeeds_with_public_network_access_enabled_and_defau
 		publicNetworkAccess: armstorage.PublicNetworkAccessEnabled,
 		defaultAction:       armstorage.DefaultActionDeny,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR05_T01()
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist IPs (see result value).", result.Message)
+	assert.Equal(t, "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist of 0 IP rules, 0 virtual network rules, 0 resource instance rules and 0 approved private endpoints (see result value).", result.Message)
 }
 
 func Test_CCC_C03_TR05_T01_fails_with_public_network_access_enabled_and_default_action_not_deny(t *testing.T) {
@@ -112,7 +198,7 @@ func Test_CCC_C03_TR05_T01_fails_with_public_network_access_enabled_and_default_
 		publicNetworkAccess: armstorage.PublicNetworkAccessEnabled,
 		defaultAction:       armstorage.DefaultActionAllow,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR05_T01()
@@ -122,19 +208,20 @@ func Test_CCC_C03_TR05_T01_fails_with_public_network_access_enabled_and_default_
 	assert.Equal(t, "Public network access is enabled for the storage account and the default action is not set to deny for sources outside of the allowlist.", result.Message)
 }
 
-func Test_CCC_C03_TR05_T01_fails_with_public_network_access_secured_by_perimeter(t *testing.T) {
+func Test_CCC_C03_TR05_T01_fails_with_public_network_access_secured_by_perimeter_without_a_perimeter(t *testing.T) {
 	// Arrange
 	myMock := storageAccountMock{
 		publicNetworkAccess: armstorage.PublicNetworkAccessSecuredByPerimeter,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	perimeterConfigsClient = &perimeterConfigsClientMock{}
 
 	// Act
 	result := CCC_C03_TR05_T01()
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "Public network access to the storage account is secured by Network Security Perimeter, this plugin does not support assessment of network access via Network Security Perimeter.", result.Message)
+	assert.Equal(t, "Public network access to the storage account is secured by Network Security Perimeter, but it is not associated with any perimeter.", result.Message)
 }
 
 func Test_CCC_C03_TR05_T01_fails_with_public_network_access_status_unclear(t *testing.T) {
@@ -142,7 +229,7 @@ func Test_CCC_C03_TR05_T01_fails_with_public_network_access_status_unclear(t *te
 	myMock := storageAccountMock{
 		publicNetworkAccess: armstorage.PublicNetworkAccess("Unknown"),
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C03_TR05_T01()
@@ -158,7 +245,7 @@ func Test_CCC_ObjStor_C03_TR01_T01_succeeds(t *testing.T) {
 		softDeleteContainerPolicyEnabled: true,
 		softDeleteContainerRetentionDays: 7,
 	}
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C03_TR01_T01()
@@ -174,7 +261,7 @@ func Test_CCC_ObjStor_C03_TR01_T01_fails_with_soft_delete_disabled(t *testing.T)
 	myMock := blobServicePropertiesMock{
 		softDeleteContainerPolicyEnabled: false,
 	}
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C03_TR01_T01()
@@ -191,7 +278,7 @@ func Test_CCC_ObjStor_C03_TR01_T01_fails_with_permanent_delete_enabled(t *testin
 		softDeleteContainerRetentionDays: 7,
 		allowPermanentDelete:             true,
 	}
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C03_TR01_T01()
@@ -279,7 +366,7 @@ func Test_CCC_ObjStor_C03_TR01_T03_succeeds(t *testing.T) {
 		softDeleteBlobRetentionDays: 7,
 	}
 
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C03_TR01_T03()
@@ -296,7 +383,7 @@ func Test_CCC_ObjStor_C03_TR01_T03_fails_with_soft_delete_disabled(t *testing.T)
 		softDeleteBlobPolicyEnabled: false,
 	}
 
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C03_TR01_T03()
@@ -314,7 +401,7 @@ func Test_CCC_ObjStor_C03_TR01_T03_fails_with_permanent_delete_enabled(t *testin
 		allowPermanentDelete:        true,
 	}
 
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C03_TR01_T03()
@@ -436,7 +523,7 @@ func Test_CCC_ObjStor_C03_TR02_T01_succeeds_with_immutability_locked(t *testing.
 		immutabilityPolicyEnabled: true,
 		immutabilityPolicyState:   "Locked",
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C03_TR02_T01()
@@ -453,7 +540,7 @@ func Test_CCC_ObjStor_C03_TR02_T01_fails_with_immutability_unlocked(t *testing.T
 		immutabilityPolicyEnabled: true,
 		immutabilityPolicyState:   "Unlocked",
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C03_TR02_T01()
@@ -470,7 +557,7 @@ func Test_CCC_ObjStor_C03_TR02_T01_fails_with_immutability_disabled(t *testing.T
 		immutabilityPopulated:     true,
 		immutabilityPolicyEnabled: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C03_TR02_T01()
@@ -483,7 +570,7 @@ func Test_CCC_ObjStor_C03_TR02_T01_fails_with_immutability_disabled(t *testing.T
 func Test_CCC_ObjStor_C03_TR02_T01_fails_when_immutability_nil(t *testing.T) {
 	// Arrange
 	myMock := storageAccountMock{}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C03_TR02_T01()
@@ -499,7 +586,7 @@ func Test_CCC_ObjStor_C03_TR02_T01_fails_with_no_immutability_policy(t *testing.
 		immutabilityPopulated:     true,
 		immutabilityPolicyEnabled: true,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C03_TR02_T01()
@@ -508,3 +595,42 @@ func Test_CCC_ObjStor_C03_TR02_T01_fails_with_no_immutability_policy(t *testing.
 	assert.Equal(t, false, result.Passed)
 	assert.Equal(t, "Immutability policy is not locked.", result.Message)
 }
+
+func Test_CCC_ObjStor_C03_TR02_T01_succeeds_with_locked_container_policies(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{
+			{Name: "records", ImmutabilityPolicyState: "Locked", ImmutabilityPeriodInDays: 365},
+			{Name: "audit", ImmutabilityPolicyState: "Locked", ImmutabilityPeriodInDays: 2555, LegalHold: true},
+		},
+	}
+
+	// Act
+	result := CCC_ObjStor_C03_TR02_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Len(t, result.Value.(ImmutabilityConfiguration).Containers, 2)
+	assert.Equal(t, "Immutability policies are locked for all 2 containers of the storage account.", result.Message)
+}
+
+func Test_CCC_ObjStor_C03_TR02_T01_fails_with_an_unlocked_container_policy(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{
+			{Name: "records", ImmutabilityPolicyState: "Locked", ImmutabilityPeriodInDays: 365},
+			{Name: "scratch", ImmutabilityPolicyState: "Unlocked", ImmutabilityPeriodInDays: 1},
+		},
+	}
+
+	// Act
+	result := CCC_ObjStor_C03_TR02_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Immutability is not enabled for Storage Account. 1 of 2 containers have a locked immutability policy.", result.Message)
+}
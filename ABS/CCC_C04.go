@@ -1,17 +1,15 @@
 package abs
 
 import (
-	"context"
 	"fmt"
 	"log"
 	"net/http"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
 	"github.com/google/uuid"
@@ -54,7 +52,7 @@ func CCC_C04_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	storageAccountBlobResourceId := storageAccountResourceId + "/blobServices/default"
+	storageAccountBlobResourceId := currentTarget.storageAccountResourceId + "/blobServices/default"
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
 		storageAccountBlobResourceId,
 		diagnosticsSettingsClient,
@@ -70,14 +68,14 @@ func CCC_C04_TR01_T02() (result pluginkit.TestResult) {
 	}
 
 	token := ArmoryAzureUtils.GetToken(&result)
-	response := ArmoryCommonFunctions.MakeGETRequest(storageAccountUri, token, &result, nil, nil)
+	response := ArmoryCommonFunctions.MakeGETRequest(currentTarget.storageAccountUri, token, &result, nil, nil)
 
 	if response.StatusCode != http.StatusOK {
 		SetResultFailure(&result, "Could not successfully authenticate with storage account")
 		return
 	}
 
-	ArmoryLoggingFunctions.ConfirmHTTPResponseIsLogged(response, storageAccountResourceId, logsClient, &result)
+	ArmoryLoggingFunctions.ConfirmHTTPResponseIsLogged(response, currentTarget.storageAccountResourceId, logsClient, &result)
 	return
 }
 
@@ -117,7 +115,7 @@ func CCC_C04_TR02_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	storageAccountBlobResourceId := storageAccountResourceId + "/blobServices/default"
+	storageAccountBlobResourceId := currentTarget.storageAccountResourceId + "/blobServices/default"
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
 		storageAccountBlobResourceId,
 		diagnosticsSettingsClient,
@@ -133,14 +131,14 @@ func CCC_C04_TR02_T02() (result pluginkit.TestResult) {
 	}
 
 	token := ArmoryAzureUtils.GetToken(&result)
-	response := ArmoryCommonFunctions.MakeGETRequest(storageAccountUri, token, &result, nil, nil)
+	response := ArmoryCommonFunctions.MakeGETRequest(currentTarget.storageAccountUri, token, &result, nil, nil)
 
 	if response.StatusCode != http.StatusOK {
 		SetResultFailure(&result, "Could not successfully authenticate with storage account")
 		return
 	}
 
-	ArmoryLoggingFunctions.ConfirmHTTPResponseIsLogged(response, storageAccountResourceId, logsClient, &result)
+	ArmoryLoggingFunctions.ConfirmHTTPResponseIsLogged(response, currentTarget.storageAccountResourceId, logsClient, &result)
 	return
 }
 
@@ -150,14 +148,14 @@ func CCC_C04_TR02_T03() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	response := ArmoryCommonFunctions.MakeGETRequest(storageAccountUri, "", &result, nil, nil)
+	response := ArmoryCommonFunctions.MakeGETRequest(currentTarget.storageAccountUri, "", &result, nil, nil)
 
 	if response.StatusCode != http.StatusUnauthorized {
 		SetResultFailure(&result, "Could not unsuccessfully authenticate with storage account")
 		return
 	}
 
-	ArmoryLoggingFunctions.ConfirmHTTPResponseIsLogged(response, storageAccountResourceId, logsClient, &result)
+	ArmoryLoggingFunctions.ConfirmHTTPResponseIsLogged(response, currentTarget.storageAccountResourceId, logsClient, &result)
 	return
 }
 
@@ -194,15 +192,15 @@ func CCC_C04_TR03_T01() (result pluginkit.TestResult) {
 	}
 
 	var respFromCtx *http.Response
-	ctx := runtime.WithCaptureResponse(context.Background(), &respFromCtx)
+	ctx := runtime.WithCaptureResponse(testSetContext, &respFromCtx)
 	activityTime := time.Now().UTC()
 
 	// Rotate the secondary storage access key
 	// https://learn.microsoft.com/en-us/rest/api/storagerp/storage-accounts/regenerate-key
 	_, err := armstorageClient.RegenerateKey(
 		ctx,
-		resourceId.resourceGroupName,
-		*storageAccountResource.Name,
+		currentTarget.resourceId.resourceGroupName,
+		*currentTarget.storageAccountResource.Name,
 		armstorage.AccountRegenerateKeyParameters{KeyName: to.Ptr("key2")},
 		nil)
 
@@ -229,7 +227,7 @@ func CCC_C04_TR03_T02() (result pluginkit.TestResult) {
 
 	var err error
 	var respFromCtx *http.Response
-	ctx := runtime.WithCaptureResponse(context.Background(), &respFromCtx)
+	ctx := runtime.WithCaptureResponse(testSetContext, &respFromCtx)
 	activityTime := time.Now().UTC()
 
 	// https://learn.microsoft.com/en-us/azure/role-based-access-control/role-assignments-rest
@@ -243,12 +241,13 @@ func CCC_C04_TR03_T02() (result pluginkit.TestResult) {
 
 	_, err = roleAssignmentsClient.Create(
 		ctx,
-		storageAccountResourceId,
+		currentTarget.storageAccountResourceId,
 		roleAssignmentName,
 		armauthorization.RoleAssignmentCreateParameters{
 			Properties: &armauthorization.RoleAssignmentProperties{
 				PrincipalID:      to.Ptr(principalId),
 				RoleDefinitionID: to.Ptr(roleDefinitionId),
+				Description:      to.Ptr(testRoleAssignmentDescription),
 			},
 		},
 		nil)
@@ -258,6 +257,8 @@ func CCC_C04_TR03_T02() (result pluginkit.TestResult) {
 		return
 	}
 
+	trackArtifact(artifactRoleAssignment, roleAssignmentName)
+
 	// Check to see if the add was logged
 	ArmoryLoggingFunctions.ConfirmAdminActivityIsLogged(
 		respFromCtx,
@@ -265,18 +266,24 @@ func CCC_C04_TR03_T02() (result pluginkit.TestResult) {
 		activityLogsClient,
 		&result)
 
-	// Remove the X role
+	// Remove the X role, even if waiting for the logs was interrupted
+	cleanupContext, cancel := newCleanupContext()
+	defer cancel()
+
 	_, err = roleAssignmentsClient.Delete(
-		ctx,
-		storageAccountResourceId,
+		cleanupContext,
+		currentTarget.storageAccountResourceId,
 		roleAssignmentName,
 		&armauthorization.RoleAssignmentsClientDeleteOptions{},
 	)
 
 	if err != nil {
 		SetResultFailure(&result, fmt.Sprintf("Could not revoke permission: %v", err))
+		return
 	}
 
+	releaseArtifact(artifactRoleAssignment, roleAssignmentName)
+
 	return
 }
 
@@ -311,25 +318,38 @@ func CCC_ObjStor_C04_TR01_T01() (result pluginkit.TestResult) {
 	}
 
 	immutabilityConfiguration := ArmoryAzureUtils.GetImmutabilityConfiguration()
-	result.Value = immutabilityConfiguration
+	var failure string
 
 	if !immutabilityConfiguration.Enabled {
-		SetResultFailure(&result, "Immutability is not enabled for Storage Account Blobs.")
-		return
+		failure = "Immutability is not enabled for Storage Account Blobs."
+	} else if immutabilityConfiguration.PolicyState == nil {
+		failure = "Immutability is enabled for Storage Account Blobs, but no immutability policy is set."
+	} else if *immutabilityConfiguration.PolicyState == armstorage.AccountImmutabilityPolicyStateDisabled {
+		failure = "Immutability is enabled for Storage Account Blobs, but immutability policy is disabled."
 	}
 
-	if immutabilityConfiguration.PolicyState == nil {
-		SetResultFailure(&result, "Immutability is enabled for Storage Account Blobs, but no immutability policy is set.")
+	if failure == "" {
+		result.Value = immutabilityConfiguration
+		result.Passed = true
+		result.Message = "Immutability is enabled for Storage Account Blobs, and an immutability policy is set."
 		return
 	}
 
-	if *immutabilityConfiguration.PolicyState == armstorage.AccountImmutabilityPolicyStateDisabled {
-		SetResultFailure(&result, "Immutability is enabled for Storage Account Blobs, but immutability policy is disabled.")
+	// Without an account-level policy, uploaded blobs are still retained if every container has an immutability policy or legal hold of its own
+	allRetained := inventoryContainerImmutability(&immutabilityConfiguration, ContainerInventoryItem.retainsBlobs)
+	result.Value = immutabilityConfiguration
+
+	if allRetained {
+		result.Passed = true
+		result.Message = fmt.Sprintf("All %d containers of the storage account retain their blobs with an immutability policy or legal hold.", len(immutabilityConfiguration.Containers))
 		return
 	}
 
-	result.Passed = true
-	result.Message = "Immutability is enabled for Storage Account Blobs, and an immutability policy is set."
+	if len(immutabilityConfiguration.Containers) > 0 {
+		failure += fmt.Sprintf(" %d of %d containers retain their blobs with an immutability policy or legal hold.", countContainers(immutabilityConfiguration.Containers, ContainerInventoryItem.retainsBlobs), len(immutabilityConfiguration.Containers))
+	}
+
+	SetResultFailure(&result, failure)
 	return
 }
 
@@ -362,7 +382,7 @@ func CCC_ObjStor_C04_TR02_T01() (result pluginkit.TestResult) {
 	randomString := ArmoryCommonFunctions.GenerateRandomString(8)
 	containerName := "privateer-test-container-" + randomString
 	blobName := "privateer-test-blob-" + randomString
-	blobUri := fmt.Sprintf("%s%s/%s", storageAccountUri, containerName, blobName)
+	blobUri := fmt.Sprintf("%s%s/%s", currentTarget.storageAccountUri, containerName, blobName)
 	blobContent := "Privateer test blob content"
 
 	blobBlockClient, newBlockBlobClientFailedError := ArmoryAzureUtils.GetBlockBlobClient(blobUri)
@@ -376,16 +396,21 @@ func CCC_ObjStor_C04_TR02_T01() (result pluginkit.TestResult) {
 
 	if createContainerSucceeded {
 
-		_, blobDeleteFailedError := blobBlockClient.Delete(context.Background(), nil)
+		_, blobDeleteFailedError := blobBlockClient.Delete(testSetContext, nil)
 
 		if blobDeleteFailedError == nil {
 			SetResultFailure(&result, "Object deletion is not prevented for objects subject to a retention policy.")
-		} else if blobDeleteFailedError.(*azcore.ResponseError).ErrorCode == "BlobImmutableDueToPolicy" {
+		} else if getErrorCode(blobDeleteFailedError) == "BlobImmutableDueToPolicy" {
 			result.Passed = true
 			result.Message = "Object deletion is prevented for objects subject to a retention policy."
 		} else {
 			SetResultFailure(&result, fmt.Sprintf("Failed to delete blob with error unrelated to immutability: %v", blobDeleteFailedError))
 		}
+
+		// The container cannot be deleted while the blob is retained, which does not affect the result, so it is left
+		//  in the cleanup ledger until it can be deleted
+		var deleteResult pluginkit.TestResult
+		ArmoryAzureUtils.DeleteTestContainer(&deleteResult, containerName)
 	}
 
 	return
@@ -426,18 +451,25 @@ func (*loggingFunctions) ConfirmHTTPResponseIsLogged(response *http.Response, re
 
 	// Wait until we hit the minimum ingestion time for logs (usually 2 minutes)
 	log.Default().Printf("Waiting %v for logs to be ingested", loggingVariables.minimumIngestionTime)
-	time.Sleep(loggingVariables.minimumIngestionTime - loggingVariables.pollingDelay)
+
+	if err := waitFor(testSetContext, loggingVariables.minimumIngestionTime-loggingVariables.pollingDelay); err != nil {
+		SetResultFailure(result, fmt.Sprintf("Stopped waiting for logs to be ingested: %v", err))
+		return
+	}
 
 	// Determine how many times we should retry until we hit the maximum
 	retries := int((loggingVariables.maximumIngestionTime.Seconds() - loggingVariables.minimumIngestionTime.Seconds()) / loggingVariables.pollingDelay.Seconds())
 
 	for i := 0; i < retries; i++ {
 
-		time.Sleep(loggingVariables.pollingDelay)
+		if err := waitFor(testSetContext, loggingVariables.pollingDelay); err != nil {
+			SetResultFailure(result, fmt.Sprintf("Stopped waiting for logs to be ingested: %v", err))
+			return
+		}
 		timeWaitedSoFar := loggingVariables.minimumIngestionTime + (loggingVariables.pollingDelay * time.Duration(i))
 
 		logsResult, err := logsClient.QueryResource(
-			context.Background(),
+			testSetContext,
 			resourceId,
 			azquery.Body{
 				Query:    to.Ptr(kustoQuery),
@@ -523,20 +555,27 @@ func (*loggingFunctions) ConfirmAdminActivityIsLogged(response *http.Response, a
 
 	// Wait until we hit the minimum ingestion time for logs (usually 2 minutes)
 	log.Default().Printf("Waiting %v for logs to be ingested", loggingVariables.minimumIngestionTime)
-	time.Sleep(loggingVariables.minimumIngestionTime - loggingVariables.pollingDelay)
+
+	if err := waitFor(testSetContext, loggingVariables.minimumIngestionTime-loggingVariables.pollingDelay); err != nil {
+		SetResultFailure(result, fmt.Sprintf("Stopped waiting for logs to be ingested: %v", err))
+		return
+	}
 
 	// Determine how many times we should retry until we hit the maximum
 	retries := int((loggingVariables.maximumIngestionTime.Seconds() - loggingVariables.minimumIngestionTime.Seconds()) / loggingVariables.pollingDelay.Seconds())
 
 	for i := 0; i < retries; i++ {
 
-		time.Sleep(loggingVariables.pollingDelay)
+		if err := waitFor(testSetContext, loggingVariables.pollingDelay); err != nil {
+			SetResultFailure(result, fmt.Sprintf("Stopped waiting for logs to be ingested: %v", err))
+			return
+		}
 		timeWaitedSoFar := loggingVariables.minimumIngestionTime + (loggingVariables.pollingDelay * time.Duration(i))
 
 		pager := activityLogsClient.NewListPager(filter, nil)
 
 		for pager.More() {
-			page, err := pager.NextPage(context.Background())
+			page, err := pager.NextPage(testSetContext)
 
 			if err != nil {
 				SetResultFailure(result, fmt.Sprintf("Failed to query activity logs: %v", err))
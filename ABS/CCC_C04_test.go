@@ -12,7 +12,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
 	"github.com/privateerproj/privateer-sdk/pluginkit"
@@ -67,8 +67,10 @@ func (mock *mockDiagnosticSettingsClient) NewListPager(resourceURI string, optio
 }
 
 type mockRoleAssignmentsClient struct {
-	createRoleErr error
-	deleteRoleErr error
+	createRoleErr   error
+	deleteRoleErr   error
+	roleAssignments []*armauthorization.RoleAssignment
+	listRoleErr     error
 }
 
 func (mock *mockRoleAssignmentsClient) Create(ctx context.Context, scope string, roleAssignmentName string, parameters armauthorization.RoleAssignmentCreateParameters, options *armauthorization.RoleAssignmentsClientCreateOptions) (armauthorization.RoleAssignmentsClientCreateResponse, error) {
@@ -79,6 +81,16 @@ func (mock *mockRoleAssignmentsClient) Delete(ctx context.Context, scope string,
 	return armauthorization.RoleAssignmentsClientDeleteResponse{}, mock.deleteRoleErr
 }
 
+func (mock *mockRoleAssignmentsClient) NewListForScopePager(scope string, options *armauthorization.RoleAssignmentsClientListForScopeOptions) *runtime.Pager[armauthorization.RoleAssignmentsClientListForScopeResponse] {
+	return CreatePager([]armauthorization.RoleAssignmentsClientListForScopeResponse{
+		{
+			RoleAssignmentListResult: armauthorization.RoleAssignmentListResult{
+				Value: mock.roleAssignments,
+			},
+		},
+	}, mock.listRoleErr)
+}
+
 type mockActivityLogClient struct {
 	pages []armmonitor.ActivityLogsClientListResponse
 	err   error
@@ -279,7 +291,7 @@ func Test_CCC_C04_TR03_T01_succeeds(t *testing.T) {
 		confirmAdminActivityIsLoggedResult: true}
 
 	armstorageClient = &mockAccountsClient{}
-	storageAccountResource = armstorage.Account{Name: to.Ptr("test")}
+	currentTarget.storageAccountResource = armstorage.Account{Name: to.Ptr("test")}
 	ArmoryLoggingFunctions = &myMock
 	ArmoryCommonFunctions = &myMock
 
@@ -296,7 +308,7 @@ func Test_CCC_C04_TR03_T01_fails_if_regenerateKey_fails(t *testing.T) {
 	myMock := loggingFunctionsMock{}
 
 	armstorageClient = &mockAccountsClient{regenerateKeyError: fmt.Errorf("Test error")}
-	storageAccountResource = armstorage.Account{Name: to.Ptr("test")}
+	currentTarget.storageAccountResource = armstorage.Account{Name: to.Ptr("test")}
 	ArmoryLoggingFunctions = &myMock
 	ArmoryCommonFunctions = &myMock
 
@@ -314,7 +326,7 @@ func Test_CCC_C04_TR03_T01_fails_if_confirmAdminActivityIsLogged_fails(t *testin
 		confirmAdminActivityIsLoggedResult: false}
 
 	armstorageClient = &mockAccountsClient{}
-	storageAccountResource = armstorage.Account{Name: to.Ptr("test")}
+	currentTarget.storageAccountResource = armstorage.Account{Name: to.Ptr("test")}
 	ArmoryLoggingFunctions = &myMock
 	ArmoryCommonFunctions = &myMock
 
@@ -677,7 +689,7 @@ func Test_CCC_ObjStor_C04_TR01_T01_succeeds_with_immutability_enabled(t *testing
 		immutabilityPolicyEnabled: true,
 		immutabilityPolicyDays:    30,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C04_TR01_T01()
@@ -693,7 +705,7 @@ func Test_CCC_ObjStor_C04_TR01_T01_fails_with_immutability_empty(t *testing.T) {
 	myMock := storageAccountMock{
 		immutabilityPopulated: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C04_TR01_T01()
@@ -709,7 +721,7 @@ func Test_CCC_ObjStor_C04_TR01_T01_fails_with_immutability_disabled_populated(t
 		immutabilityPopulated:     true,
 		immutabilityPolicyEnabled: false,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C04_TR01_T01()
@@ -726,7 +738,7 @@ func Test_CCC_ObjStor_C04_TR01_T01_fails_with_policy_disabled(t *testing.T) {
 		immutabilityPolicyEnabled: true,
 		immutabilityPolicyState:   armstorage.AccountImmutabilityPolicyStateDisabled,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_ObjStor_C04_TR01_T01()
@@ -736,6 +748,44 @@ func Test_CCC_ObjStor_C04_TR01_T01_fails_with_policy_disabled(t *testing.T) {
 	assert.Equal(t, "Immutability is enabled for Storage Account Blobs, but immutability policy is disabled.", result.Message)
 }
 
+func Test_CCC_ObjStor_C04_TR01_T01_succeeds_with_container_policies_and_legal_holds(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{
+			{Name: "records", ImmutabilityPolicyState: "Unlocked", ImmutabilityPeriodInDays: 30},
+			{Name: "evidence", LegalHold: true},
+		},
+	}
+
+	// Act
+	result := CCC_ObjStor_C04_TR01_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "All 2 containers of the storage account retain their blobs with an immutability policy or legal hold.", result.Message)
+}
+
+func Test_CCC_ObjStor_C04_TR01_T01_fails_with_an_unretained_container(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{
+			{Name: "records", ImmutabilityPolicyState: "Locked", ImmutabilityPeriodInDays: 30},
+			{Name: "uploads"},
+		},
+	}
+
+	// Act
+	result := CCC_ObjStor_C04_TR01_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Immutability is not enabled for Storage Account Blobs. 1 of 2 containers retain their blobs with an immutability policy or legal hold.", result.Message)
+}
+
 func Test_CCC_ObjStor_C04_TR02_T01_succeeds(t *testing.T) {
 	// Arrange
 	ArmoryAzureUtils = &azureUtilsMock{
@@ -831,3 +881,21 @@ func Test_CCC_ObjStor_C04_TR02_T01_fails_delete_fails_wrong_error(t *testing.T)
 	assert.Equal(t, false, result.Passed)
 	assert.Equal(t, "Failed to delete blob with error unrelated to immutability: Missing RawResponse\n--------------------------------------------------------------------------------\nERROR CODE: AnotherErrorCode\n--------------------------------------------------------------------------------\n", result.Message)
 }
+
+func Test_CCC_ObjStor_C04_TR02_T01_fails_delete_times_out(t *testing.T) {
+	// Arrange
+	ArmoryAzureUtils = &azureUtilsMock{
+		blobBlockClient: &mockBlockBlobClient{
+			deleteError: context.DeadlineExceeded,
+		},
+	}
+
+	blobContainersClient = &blobContainersClientMock{}
+
+	// Act
+	result := CCC_ObjStor_C04_TR02_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Failed to delete blob with error unrelated to immutability: context deadline exceeded", result.Message)
+}
@@ -1,7 +1,6 @@
 package abs
 
 import (
-	"context"
 	"fmt"
 	"strings"
 
@@ -28,6 +27,11 @@ func CCC_C05_TR01() (testSetName string, result pluginkit.TestSetResult) {
 
 	result.ExecuteTest(CCC_C05_TR01_T01)
 
+	// The probe only proves the network rules are enforced when it is known whether the runner should be allowed through them
+	if runnerNetworkAccess != "" {
+		result.ExecuteTest(CCC_C05_TR01_T02)
+	}
+
 	TestSetResultSetter(
 		"This service blocks access to sensitive resources and admin access from untrusted sources",
 		"This service does not block access to sensitive resources and admin access from untrusted sources, see test results for more details",
@@ -42,42 +46,19 @@ func CCC_C05_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if *storageAccountResource.Properties.PublicNetworkAccess == "Disabled" {
-		result.Passed = true
-		result.Message = "Public network access is disabled for the storage account."
-	} else if *storageAccountResource.Properties.PublicNetworkAccess == "Enabled" {
-
-		if *storageAccountResource.Properties.NetworkRuleSet.DefaultAction == "Deny" {
-
-			type AllowedIps struct {
-				Name string
-				IPs  []string
-			}
-
-			allowedIps := AllowedIps{
-				Name: "Allowlisted IPs and IP ranges",
-				IPs:  []string{},
-			}
-
-			for _, ip := range storageAccountResource.Properties.NetworkRuleSet.IPRules {
-				allowedIps.IPs = append(allowedIps.IPs, *ip.IPAddressOrRange)
-			}
-
-			result.Value = allowedIps
-			result.Passed = true
-			result.Message = "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist IPs (see result value)."
+	assessNetworkExposure(&result)
 
-		} else {
-			SetResultFailure(&result, "Public network access is enabled for the storage account and the default action is not set to deny for sources outside of the allowlist.")
-		}
+	return
+}
 
-	} else if *storageAccountResource.Properties.PublicNetworkAccess == "SecuredByPerimeter" {
-		// This isn't publicly available yet so we shouldn't hit this condition with customers
-		SetResultFailure(&result, "Public network access to the storage account is secured by Network Security Perimeter, this plugin does not support assessment of network access via Network Security Perimeter.")
-	} else {
-		SetResultFailure(&result, fmt.Sprintf("Public network access status of %s unclear.", *storageAccountResource.Properties.PublicNetworkAccess))
+func CCC_C05_TR01_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that requests to the data plane from the runner are blocked or allowed, as the runner is expected to be outside or inside of the allowlist.",
+		Function:    utils.CallerPath(0),
 	}
 
+	probeNetworkReachability(&result)
+
 	return
 }
 
@@ -159,7 +140,7 @@ func CCC_C05_TR04_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	storageAccountBlobResourceId := storageAccountResourceId + "/blobServices/default"
+	storageAccountBlobResourceId := currentTarget.storageAccountResourceId + "/blobServices/default"
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
 		storageAccountBlobResourceId,
 		diagnosticsSettingsClient,
@@ -183,7 +164,12 @@ func CCC_ObjStor_C05_TR01() (testSetName string, result pluginkit.TestSetResult)
 		Tests:       make(map[string]pluginkit.TestResult),
 	}
 
-	result.ExecuteInvasiveTest(CCC_ObjStor_C05_TR02_T01)
+	// The versioning configuration decides whether uploaded blobs are stored with a unique identifier, and is what remediate fixes,
+	//  the invasive upload would only confirm a failure of it, so is skipped without creating a test container
+	result.ExecuteTest(CCC_ObjStor_C05_TR01_T01)
+	if result.Tests["CCC_ObjStor_C05_TR01_T01"].Passed {
+		result.ExecuteInvasiveTest(CCC_ObjStor_C05_TR02_T01)
+	}
 
 	return
 }
@@ -228,7 +214,7 @@ func CCC_ObjStor_C05_TR02_T01() (result pluginkit.TestResult) {
 	randomString := ArmoryCommonFunctions.GenerateRandomString(8)
 	containerName := "privateer-test-container-" + randomString
 	blobName := "privateer-test-blob-" + randomString
-	blobUri := fmt.Sprintf("%s%s/%s", storageAccountUri, containerName, blobName)
+	blobUri := fmt.Sprintf("%s%s/%s", currentTarget.storageAccountUri, containerName, blobName)
 	blobContent := "Privateer test blob content"
 	updatedBlobContent := "Updated " + blobContent
 
@@ -239,7 +225,7 @@ func CCC_ObjStor_C05_TR02_T01() (result pluginkit.TestResult) {
 		return
 	}
 
-	azblobClient, newBlobClientFailedError := ArmoryAzureUtils.GetBlobClient(storageAccountUri)
+	azblobClient, newBlobClientFailedError := ArmoryAzureUtils.GetBlobClient(currentTarget.storageAccountUri)
 
 	if newBlobClientFailedError != nil {
 		SetResultFailure(&result, fmt.Sprintf("Failed to create blob client with error: %v", newBlobClientFailedError))
@@ -286,7 +272,7 @@ func CCC_ObjStor_C05_TR03_T01() (result pluginkit.TestResult) {
 	randomString := ArmoryCommonFunctions.GenerateRandomString(8)
 	containerName := "privateer-test-container-" + randomString
 	blobName := "privateer-test-blob-" + randomString
-	blobUri := fmt.Sprintf("%s%s/%s", storageAccountUri, containerName, blobName)
+	blobUri := fmt.Sprintf("%s%s/%s", currentTarget.storageAccountUri, containerName, blobName)
 	blobContent := "Privateer test blob content"
 	updatedBlobContent := "Updated " + blobContent
 
@@ -297,7 +283,7 @@ func CCC_ObjStor_C05_TR03_T01() (result pluginkit.TestResult) {
 		return
 	}
 
-	azblobClient, newBlobClientFailedError := ArmoryAzureUtils.GetBlobClient(storageAccountUri)
+	azblobClient, newBlobClientFailedError := ArmoryAzureUtils.GetBlobClient(currentTarget.storageAccountUri)
 
 	if newBlobClientFailedError != nil {
 		SetResultFailure(&result, fmt.Sprintf("Failed to create blob client with error: %v", newBlobClientFailedError))
@@ -344,7 +330,7 @@ func CCC_ObjStor_C05_TR04_T01() (result pluginkit.TestResult) {
 	randomString := ArmoryCommonFunctions.GenerateRandomString(8)
 	containerName := "privateer-test-container-" + randomString
 	blobName := "privateer-test-blob-" + randomString
-	blobUri := fmt.Sprintf("%s%s/%s", storageAccountUri, containerName, blobName)
+	blobUri := fmt.Sprintf("%s%s/%s", currentTarget.storageAccountUri, containerName, blobName)
 	blobContent := "Privateer test blob content"
 
 	blobBlockClient, newBlockBlobClientFailedError := ArmoryAzureUtils.GetBlockBlobClient(blobUri)
@@ -354,7 +340,7 @@ func CCC_ObjStor_C05_TR04_T01() (result pluginkit.TestResult) {
 		return
 	}
 
-	azblobClient, newBlobClientFailedError := ArmoryAzureUtils.GetBlobClient(storageAccountUri)
+	azblobClient, newBlobClientFailedError := ArmoryAzureUtils.GetBlobClient(currentTarget.storageAccountUri)
 
 	if newBlobClientFailedError != nil {
 		SetResultFailure(&result, fmt.Sprintf("Failed to create blob client with error: %v", newBlobClientFailedError))
@@ -365,7 +351,7 @@ func CCC_ObjStor_C05_TR04_T01() (result pluginkit.TestResult) {
 
 	if createContainerSucceeded {
 
-		_, deleteBlobFailedError := blobBlockClient.Delete(context.Background(), &blob.DeleteOptions{})
+		_, deleteBlobFailedError := blobBlockClient.Delete(testSetContext, &blob.DeleteOptions{})
 
 		if deleteBlobFailedError == nil {
 			blobVersionsPager := azblobClient.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{
@@ -375,7 +361,7 @@ func CCC_ObjStor_C05_TR04_T01() (result pluginkit.TestResult) {
 
 			var deletedBlobFound bool
 			for blobVersionsPager.More() {
-				page, err := blobVersionsPager.NextPage(context.Background())
+				page, err := blobVersionsPager.NextPage(testSetContext)
 				if err != nil {
 					SetResultFailure(&result, fmt.Sprintf("Failed to list blob versions with error: %v", err))
 					return
@@ -418,9 +404,9 @@ type BlobVersioningFunctions interface {
 type blobVersioningFunctions struct{}
 
 func (*blobVersioningFunctions) CheckVersioningIsEnabled(result *pluginkit.TestResult) {
-	if blobServiceProperties.BlobServiceProperties.IsVersioningEnabled == nil {
+	if currentTarget.blobServiceProperties.BlobServiceProperties.IsVersioningEnabled == nil {
 		SetResultFailure(result, "Versioning is not enabled for Storage Account Blobs.")
-	} else if *blobServiceProperties.BlobServiceProperties.IsVersioningEnabled {
+	} else if *currentTarget.blobServiceProperties.BlobServiceProperties.IsVersioningEnabled {
 		result.Passed = true
 		result.Message = "Versioning is enabled for Storage Account Blobs."
 	} else {
@@ -430,7 +416,7 @@ func (*blobVersioningFunctions) CheckVersioningIsEnabled(result *pluginkit.TestR
 
 func (*blobVersioningFunctions) UpdateContentAndCheckVersionAvailable(result *pluginkit.TestResult, blobBlockClient BlockBlobClientInterface, azblobClient BlobClientInterface, containerName string, blobName string, updatedBlobContent string) {
 
-	_, updateBlobFailedError := blobBlockClient.UploadStream(context.Background(), strings.NewReader(updatedBlobContent), nil)
+	_, updateBlobFailedError := blobBlockClient.UploadStream(testSetContext, strings.NewReader(updatedBlobContent), nil)
 
 	if updateBlobFailedError == nil {
 		blobVersionsPager := azblobClient.NewListBlobsFlatPager(containerName, &azblob.ListBlobsFlatOptions{
@@ -440,7 +426,7 @@ func (*blobVersioningFunctions) UpdateContentAndCheckVersionAvailable(result *pl
 
 		var versions int
 		for blobVersionsPager.More() {
-			page, err := blobVersionsPager.NextPage(context.Background())
+			page, err := blobVersionsPager.NextPage(testSetContext)
 			if err != nil {
 				SetResultFailure(result, fmt.Sprintf("Failed to list blob versions with error: %v", err))
 				return
@@ -14,14 +14,14 @@ func Test_CCC_C05_TR01_T01_succeeds_with_public_network_access_disabled(t *testi
 	myMock := storageAccountMock{
 		publicNetworkAccess: armstorage.PublicNetworkAccessDisabled,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C05_TR01_T01()
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Public network access is disabled for the storage account.", result.Message)
+	assert.Equal(t, "Public network access is disabled for the storage account, and it has no approved private endpoints to be reached through.", result.Message)
 }
 
 func Test_CCC_C05_TR01_T01_succeeds_with_public_network_access_enabled_and_default_action_deny(t *testing.T) {
@@ -30,14 +30,14 @@ func Test_CCC_C05_TR01_T01_succeeds_with_public_network_access_enabled_and_defau
 		publicNetworkAccess: armstorage.PublicNetworkAccessEnabled,
 		defaultAction:       armstorage.DefaultActionDeny,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C05_TR01_T01()
 
 	// Assert
 	assert.Equal(t, true, result.Passed)
-	assert.Equal(t, "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist IPs (see result value).", result.Message)
+	assert.Equal(t, "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist of 0 IP rules, 0 virtual network rules, 0 resource instance rules and 0 approved private endpoints (see result value).", result.Message)
 }
 
 func Test_CCC_C05_TR01_T01_fails_with_public_network_access_enabled_and_default_action_not_deny(t *testing.T) {
@@ -46,7 +46,7 @@ func Test_CCC_C05_TR01_T01_fails_with_public_network_access_enabled_and_default_
 		publicNetworkAccess: armstorage.PublicNetworkAccessEnabled,
 		defaultAction:       armstorage.DefaultActionAllow,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C05_TR01_T01()
@@ -56,19 +56,20 @@ func Test_CCC_C05_TR01_T01_fails_with_public_network_access_enabled_and_default_
 	assert.Equal(t, "Public network access is enabled for the storage account and the default action is not set to deny for sources outside of the allowlist.", result.Message)
 }
 
-func Test_CCC_C05_TR01_T01_fails_with_public_network_access_secured_by_perimeter(t *testing.T) {
+func Test_CCC_C05_TR01_T01_fails_with_public_network_access_secured_by_perimeter_without_a_perimeter(t *testing.T) {
 	// Arrange
 	myMock := storageAccountMock{
 		publicNetworkAccess: armstorage.PublicNetworkAccessSecuredByPerimeter,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	perimeterConfigsClient = &perimeterConfigsClientMock{}
 
 	// Act
 	result := CCC_C05_TR01_T01()
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, "Public network access to the storage account is secured by Network Security Perimeter, this plugin does not support assessment of network access via Network Security Perimeter.", result.Message)
+	assert.Equal(t, "Public network access to the storage account is secured by Network Security Perimeter, but it is not associated with any perimeter.", result.Message)
 }
 
 func Test_CCC_C05_TR01_T01_fails_with_public_network_access_status_unclear(t *testing.T) {
@@ -76,7 +77,7 @@ func Test_CCC_C05_TR01_T01_fails_with_public_network_access_status_unclear(t *te
 	myMock := storageAccountMock{
 		publicNetworkAccess: armstorage.PublicNetworkAccess("Unknown"),
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C05_TR01_T01()
@@ -118,7 +119,7 @@ func Test_CCC_ObjStor_C05_TR01_T01_succeeds(t *testing.T) {
 	myMock := blobServicePropertiesMock{
 		blobVersioningEnabled: true,
 	}
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C05_TR01_T01()
@@ -133,7 +134,7 @@ func Test_CCC_ObjStor_C05_TR01_T01_fails_versioning_disabled(t *testing.T) {
 	myMock := blobServicePropertiesMock{
 		blobVersioningEnabled: false,
 	}
-	blobServiceProperties = myMock.SetBlobServiceProperties()
+	currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
 
 	// Act
 	result := CCC_ObjStor_C05_TR01_T01()
@@ -143,6 +144,36 @@ func Test_CCC_ObjStor_C05_TR01_T01_fails_versioning_disabled(t *testing.T) {
 	assert.Equal(t, "Versioning is not enabled for Storage Account Blobs.", result.Message)
 }
 
+func Test_CCC_ObjStor_C05_TR01_runs_the_versioning_check(t *testing.T) {
+	tests := []struct {
+		name              string
+		versioningEnabled bool
+	}{
+		{name: "versioning enabled", versioningEnabled: true},
+		{name: "versioning disabled", versioningEnabled: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			myMock := blobServicePropertiesMock{
+				blobVersioningEnabled: tt.versioningEnabled,
+			}
+			currentTarget.blobServiceProperties = myMock.SetBlobServiceProperties()
+			ArmoryBlobVersioningFunctions = &blobVersioningFunctions{}
+
+			// Act
+			testSetName, result := CCC_ObjStor_C05_TR01()
+
+			// Assert
+			assert.Equal(t, "CCC_ObjStor_C05_TR01", testSetName)
+			assert.Contains(t, result.Tests, "CCC_ObjStor_C05_TR01_T01")
+			assert.Equal(t, tt.versioningEnabled, result.Tests["CCC_ObjStor_C05_TR01_T01"].Passed)
+			assert.NotContains(t, result.Tests, "CCC_ObjStor_C05_TR02_T01")
+		})
+	}
+}
+
 func Test_CCC_ObjStor_C05_TR02_T01_succeeds(t *testing.T) {
 	// Arrange
 	ArmoryAzureUtils = &azureUtilsMock{
@@ -1,16 +1,13 @@
 package abs
 
 import (
-	"context"
 	"fmt"
 	"slices"
 	"strings"
 	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 	"github.com/privateerproj/privateer-sdk/utils"
@@ -48,45 +45,52 @@ func CCC_C06_TR01_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	// Get Azure Policies assigned to the resource
-	policiesPager := policyClient.NewListForResourcePager(resourceId.resourceGroupName, "Microsoft.Storage", "", "storageAccounts", resourceId.storageAccountName, nil)
+	// Find an Azure Policy, built-in or custom and assigned directly or through an initiative, that denies deployment outside of allowed locations
+	policy, value, found, err := findEnforcingPolicy(allowedLocationsRequirement)
 
-	// Check if the built-in Azure Policy "Allowed locations" is assigned to the resource
-	for policiesPager.More() {
-		page, err := policiesPager.NextPage(context.Background())
+	if err != nil {
+		SetResultFailure(&result, err.Error())
+		return
+	}
 
-		if err != nil {
-			SetResultFailure(&result, "Could not get next page of policies: "+err.Error())
-			return
-		}
+	if !found {
+		SetResultFailure(&result, "Neither the built-in Azure Policy Allowed locations, nor an equivalent custom policy, is assigned to the resource.")
+		return
+	}
 
-		for _, assignment := range page.Value {
-			// Check that the default policy is assigned (https://github.com/Azure/azure-policy/blob/master/built-in-policies/policyDefinitions/General/AllowedLocations_Deny.json)
-			if strings.Contains(*assignment.Properties.PolicyDefinitionID, "/providers/Microsoft.Authorization/policyDefinitions/e56962a6-4747-49cd-b67b-bf8b01975c4c") && *assignment.Properties.EnforcementMode != armpolicy.EnforcementModeDoNotEnforce {
-				result.Message = "Azure Policy is in place that prevents deployment in some regions."
+	// Confirm the policy is evaluated against this storage account, rather than only assigned
+	compliance, err := getPolicyCompliance(policy)
 
-				// Check if any restricted regions are allowed by Policy
-				var extraAllowedRegions []string
+	if err != nil {
+		SetResultFailure(&result, err.Error())
+		return
+	}
 
-				for _, v := range assignment.Properties.Parameters["listOfAllowedLocations"].Value.([]interface{}) {
-					if !slices.Contains(allowedRegions, v.(string)) {
-						extraAllowedRegions = append(extraAllowedRegions, v.(string))
-					}
-				}
+	result.Value = compliance
 
-				if len(extraAllowedRegions) == 0 {
-					result.Passed = true
-					result.Message = fmt.Sprintf("%s The only regions allowed by Policy are the provided allowed regions: %v.", result.Message, allowedRegions)
-					return
-				} else {
-					SetResultFailure(&result, fmt.Sprintf("%s There are other regions allowed Policy in addition to the provided allowed regions, the additional regions are: %v", result.Message, extraAllowedRegions))
-					return
-				}
-			}
+	if message := compliance.nonComplianceMessage(); message != "" {
+		SetResultFailure(&result, message)
+		return
+	}
+
+	result.Message = "Azure Policy is in place that prevents deployment in some regions."
+
+	// Check if any restricted regions are allowed by Policy
+	var extraAllowedRegions []string
+
+	for _, v := range value.([]string) {
+		if !slices.Contains(allowedRegions, v) {
+			extraAllowedRegions = append(extraAllowedRegions, v)
 		}
 	}
 
-	SetResultFailure(&result, "Built-in Azure Policy Allowed locations is not assigned to the resource, there could be a custom policy or policy set preventing deployment in restricted regions but this has not been validated.")
+	if len(extraAllowedRegions) == 0 {
+		result.Passed = true
+		result.Message = fmt.Sprintf("%s The only regions allowed by Policy are the provided allowed regions: %v.", result.Message, allowedRegions)
+		return
+	}
+
+	SetResultFailure(&result, fmt.Sprintf("%s There are other regions allowed Policy in addition to the provided allowed regions, the additional regions are: %v", result.Message, extraAllowedRegions))
 	return
 }
 
@@ -106,15 +110,29 @@ func CCC_C06_TR01_T02() (result pluginkit.TestResult) {
 	for region := range restrictedRegions {
 		accountName, parameters := ArmoryRestrictedRegionsFunctions.NewAccountParameters(restrictedRegions[region])
 
-		_, createError := armstorageClient.BeginCreate(context.Background(), resourceId.resourceGroupName, accountName, parameters, nil)
+		poller, createError := armstorageClient.BeginCreate(testSetContext, currentTarget.resourceId.resourceGroupName, accountName, parameters, nil)
 
 		if createError == nil {
+			trackArtifact(artifactStorageAccount, accountName)
 			SetResultFailure(&result, "Successfully created Storage Account in restricted region "+restrictedRegions[region])
 
-			_, deleteError := armstorageClient.Delete(context.Background(), resourceId.resourceGroupName, accountName, nil)
+			// The Storage Account cannot be deleted until it has finished being created
+			_, pollError := poller.PollUntilDone(testSetContext, nil)
+
+			if pollError != nil {
+				SetResultFailure(&result, "Failed waiting for Storage Account to be created with error: "+pollError.Error())
+				return
+			}
+
+			cleanupContext, cancel := newCleanupContext()
+			defer cancel()
+
+			_, deleteError := armstorageClient.Delete(cleanupContext, currentTarget.resourceId.resourceGroupName, accountName, nil)
 
 			if deleteError != nil {
 				SetResultFailure(&result, "Failed to delete Storage Account with error: "+deleteError.Error())
+			} else {
+				releaseArtifact(artifactStorageAccount, accountName)
 			}
 
 			return
@@ -124,21 +142,36 @@ func CCC_C06_TR01_T02() (result pluginkit.TestResult) {
 	// Test creating storage account in allowed region
 	accountName, parameters := ArmoryRestrictedRegionsFunctions.NewAccountParameters(allowedRegions[0])
 
-	_, createError := armstorageClient.BeginCreate(context.Background(), resourceId.resourceGroupName, accountName, parameters, nil)
+	poller, createError := armstorageClient.BeginCreate(testSetContext, currentTarget.resourceId.resourceGroupName, accountName, parameters, nil)
 
 	if createError != nil {
 		result.Passed = false
-		result.Message = "Failed to create Storage Account in allowed region " + allowedRegions[0] + ". Indicating there is another reason deployments to restricted regions are failing (e.g. incorrect permissions) other than regional restrictions. Error code: " + createError.(*azcore.ResponseError).ErrorCode + "."
+		result.Message = "Failed to create Storage Account in allowed region " + allowedRegions[0] + ". Indicating there is another reason deployments to restricted regions are failing (e.g. incorrect permissions) other than regional restrictions. Error code: " + getErrorCode(createError) + "."
 		return
 	}
 
-	_, deleteError := armstorageClient.Delete(context.Background(), resourceId.resourceGroupName, accountName, nil)
+	trackArtifact(artifactStorageAccount, accountName)
+
+	// The Storage Account cannot be deleted until it has finished being created
+	_, pollError := poller.PollUntilDone(testSetContext, nil)
+
+	if pollError != nil {
+		SetResultFailure(&result, "Failed waiting for Storage Account to be created in allowed region "+allowedRegions[0]+" with error: "+pollError.Error())
+		return
+	}
+
+	cleanupContext, cancel := newCleanupContext()
+	defer cancel()
+
+	_, deleteError := armstorageClient.Delete(cleanupContext, currentTarget.resourceId.resourceGroupName, accountName, nil)
 
 	if deleteError != nil {
-		SetResultFailure(&result, "Failed to delete Storage Account with error: "+deleteError.(*azcore.ResponseError).ErrorCode)
+		SetResultFailure(&result, "Failed to delete Storage Account with error: "+getErrorCode(deleteError))
 		return
 	}
 
+	releaseArtifact(artifactStorageAccount, accountName)
+
 	result.Passed = true
 	result.Message = "Deployment to all restricted regions failed, and deployment to allowed regions succeeded (confirming that incorrect permissions are not what is blocking creation). This is the expected behavior."
 	return
@@ -171,10 +204,10 @@ func CCC_C06_TR02_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	locationsPager := subscriptionsClient.NewListLocationsPager(resourceId.subscriptionId, nil)
+	locationsPager := subscriptionsClient.NewListLocationsPager(currentTarget.resourceId.subscriptionId, nil)
 
 	for locationsPager.More() {
-		page, err := locationsPager.NextPage(context.Background())
+		page, err := locationsPager.NextPage(testSetContext)
 
 		if err != nil {
 			SetResultFailure(&result, "Could not get next page of locations: "+err.Error())
@@ -214,15 +247,26 @@ func CCC_C06_TR02_T02() (result pluginkit.TestResult) {
 	for region := range restrictedRegions {
 		vaultName, parameters := ArmoryRestrictedRegionsFunctions.NewBackupVaultParameters(restrictedRegions[region])
 
-		_, createError := vaultsClient.BeginCreateOrUpdate(context.Background(), resourceId.resourceGroupName, vaultName, parameters, nil)
+		poller, createError := vaultsClient.BeginCreateOrUpdate(testSetContext, currentTarget.resourceId.resourceGroupName, vaultName, parameters, nil)
 
 		if createError == nil {
+			trackArtifact(artifactBackupVault, vaultName)
 			SetResultFailure(&result, "Successfully created Backup Vault in restricted region "+restrictedRegions[region])
 
+			// The Backup Vault cannot be deleted until it has finished being created
+			_, pollError := poller.PollUntilDone(testSetContext, nil)
+
+			if pollError != nil {
+				SetResultFailure(&result, "Failed waiting for Backup Vault to be created with error: "+pollError.Error())
+				return
+			}
+
 			deleteError := ArmoryRestrictedRegionsFunctions.DeleteBackupVaultWithRetry(vaultName)
 
 			if deleteError != nil {
 				SetResultFailure(&result, "Failed to delete Backup Vault with error: "+deleteError.Error())
+			} else {
+				releaseArtifact(artifactBackupVault, vaultName)
 			}
 
 			return
@@ -232,21 +276,33 @@ func CCC_C06_TR02_T02() (result pluginkit.TestResult) {
 	// Test creating backup vault in allowed region
 	vaultName, parameters := ArmoryRestrictedRegionsFunctions.NewBackupVaultParameters(allowedRegions[0])
 
-	_, createError := vaultsClient.BeginCreateOrUpdate(context.Background(), resourceId.resourceGroupName, vaultName, parameters, nil)
+	poller, createError := vaultsClient.BeginCreateOrUpdate(testSetContext, currentTarget.resourceId.resourceGroupName, vaultName, parameters, nil)
 
 	if createError != nil {
 		result.Passed = false
-		result.Message = "Failed to create Backup Vault in allowed region " + allowedRegions[0] + ". Indicating there is another reason deployments to restricted regions are failing (e.g. incorrect permissions) other than regional restrictions. Error code: " + createError.(*azcore.ResponseError).ErrorCode + "."
+		result.Message = "Failed to create Backup Vault in allowed region " + allowedRegions[0] + ". Indicating there is another reason deployments to restricted regions are failing (e.g. incorrect permissions) other than regional restrictions. Error code: " + getErrorCode(createError) + "."
+		return
+	}
+
+	trackArtifact(artifactBackupVault, vaultName)
+
+	// The Backup Vault cannot be deleted until it has finished being created
+	_, pollError := poller.PollUntilDone(testSetContext, nil)
+
+	if pollError != nil {
+		SetResultFailure(&result, "Failed waiting for Backup Vault to be created in allowed region "+allowedRegions[0]+" with error: "+pollError.Error())
 		return
 	}
 
 	deleteError := ArmoryRestrictedRegionsFunctions.DeleteBackupVaultWithRetry(vaultName)
 
 	if deleteError != nil {
-		SetResultFailure(&result, "Failed to delete Backup Vault with error: "+deleteError.(*azcore.ResponseError).ErrorCode)
+		SetResultFailure(&result, "Failed to delete Backup Vault with error: "+getErrorCode(deleteError))
 		return
 	}
 
+	releaseArtifact(artifactBackupVault, vaultName)
+
 	result.Passed = true
 	result.Message = "Deployment to all restricted regions failed, and deployment to allowed regions succeeded (confirming that incorrect permissions are not what is blocking creation). This is the expected behavior."
 	return
@@ -279,7 +335,7 @@ func CCC_ObjStor_C06_TR01_T01() (result pluginkit.TestResult) {
 	}
 
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
-		storageAccountResourceId+"/blobServices/default",
+		currentTarget.storageAccountResourceId+"/blobServices/default",
 		diagnosticsSettingsClient,
 		&result)
 
@@ -290,6 +346,35 @@ func CCC_ObjStor_C06_TR01_T01() (result pluginkit.TestResult) {
 // Utility functions to support tests
 // --------------------------------------
 
+// allowedLocationsRequirement recognises the built-in Allowed locations policy, and custom policies that deny storage accounts whose location is not in a list
+var allowedLocationsRequirement = policyRequirement{
+	// https://github.com/Azure/azure-policy/blob/master/built-in-policies/policyDefinitions/General/AllowedLocations_Deny.json
+	builtInDefinitionName: "e56962a6-4747-49cd-b67b-bf8b01975c4c",
+	matches: func(policy effectivePolicy) (any, bool) {
+		if policy.definition == nil {
+			return toStringSlice(policy.parameters["listOfAllowedLocations"]), true
+		}
+
+		if getPolicyEffect(policy) != "deny" {
+			return nil, false
+		}
+
+		conditions := getPolicyConditions(policy)
+
+		if !appliesToStorageAccounts(conditions) {
+			return nil, false
+		}
+
+		for _, condition := range conditions {
+			if strings.EqualFold(condition.field, "location") && condition.operator == "notin" {
+				return toStringSlice(condition.value), true
+			}
+		}
+
+		return nil, false
+	},
+}
+
 type RestrictedRegionsFunctions interface {
 	GetRestrictedRegions(result *pluginkit.TestResult) []string
 	NewAccountParameters(region string) (accountName string, parameters armstorage.AccountCreateParameters)
@@ -306,7 +391,7 @@ func (*restrictedRegionsFunctions) GetRestrictedRegions(result *pluginkit.TestRe
 
 	for storageSkusPager.More() {
 
-		page, err := storageSkusPager.NextPage(context.Background())
+		page, err := storageSkusPager.NextPage(testSetContext)
 
 		if err != nil {
 			SetResultFailure(result, "Could not get next page of storage SKUs, in order to list available regions with error: "+err.Error())
@@ -326,7 +411,8 @@ func (*restrictedRegionsFunctions) GetRestrictedRegions(result *pluginkit.TestRe
 }
 
 func (*restrictedRegionsFunctions) NewAccountParameters(region string) (accountName string, parameters armstorage.AccountCreateParameters) {
-	accountName = ArmoryCommonFunctions.GenerateRandomString(20)
+	// Storage Account names are at most 24 lowercase letters and numbers
+	accountName = testStorageAccountPrefix + ArmoryCommonFunctions.GenerateRandomString(11)
 	parameters = armstorage.AccountCreateParameters{
 		SKU: &armstorage.SKU{
 			Name: to.Ptr(armstorage.SKUNameStandardLRS),
@@ -339,7 +425,7 @@ func (*restrictedRegionsFunctions) NewAccountParameters(region string) (accountN
 }
 
 func (*restrictedRegionsFunctions) NewBackupVaultParameters(region string) (vaultName string, parameters armrecoveryservices.Vault) {
-	vaultName = ArmoryCommonFunctions.GenerateRandomString(20)
+	vaultName = testArtifactPrefix + "vault-" + ArmoryCommonFunctions.GenerateRandomString(12)
 	parameters = armrecoveryservices.Vault{
 		SKU: &armrecoveryservices.SKU{
 			Name: to.Ptr(armrecoveryservices.SKUNameStandard),
@@ -354,14 +440,19 @@ func (*restrictedRegionsFunctions) NewBackupVaultParameters(region string) (vaul
 }
 
 func (*restrictedRegionsFunctions) DeleteBackupVaultWithRetry(vaultName string) (deleteError error) {
+	cleanupContext, cancel := newCleanupContext()
+	defer cancel()
+
 	for i := 0; i < 6; i++ {
-		_, deleteError = vaultsClient.Delete(context.Background(), resourceId.resourceGroupName, vaultName, nil)
+		_, deleteError = vaultsClient.Delete(cleanupContext, currentTarget.resourceId.resourceGroupName, vaultName, nil)
 
-		if deleteError == nil || deleteError.(*azcore.ResponseError).ErrorCode != "RSVaultUpdateErrorConflictingOperationInProgress" {
+		if deleteError == nil || getErrorCode(deleteError) != "RSVaultUpdateErrorConflictingOperationInProgress" {
 			break
 		}
 
-		time.Sleep(10 * time.Second)
+		if err := waitFor(cleanupContext, 10*time.Second); err != nil {
+			return err
+		}
 	}
 
 	return deleteError
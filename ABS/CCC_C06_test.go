@@ -124,6 +124,8 @@ func (mock *mockSubscriptionsClient) NewListLocationsPager(subscriptionID string
 
 type mockVaultsClient struct {
 	deleteError error
+	pollError   error
+	vaults      []*armrecoveryservices.Vault
 }
 
 func (mock *mockVaultsClient) BeginCreateOrUpdate(ctx context.Context, resourceGroupName string, vaultName string, vault armrecoveryservices.Vault, options *armrecoveryservices.VaultsClientBeginCreateOrUpdateOptions) (*runtime.Poller[armrecoveryservices.VaultsClientCreateOrUpdateResponse], error) {
@@ -131,7 +133,7 @@ func (mock *mockVaultsClient) BeginCreateOrUpdate(ctx context.Context, resourceG
 	if strings.Contains(*vault.Location, "restrictedRegion") {
 		return nil, &azcore.ResponseError{ErrorCode: "AnError"}
 	} else {
-		return nil, nil
+		return CreatePoller[armrecoveryservices.VaultsClientCreateOrUpdateResponse](mock.pollError), nil
 	}
 }
 
@@ -139,6 +141,18 @@ func (mock *mockVaultsClient) Delete(ctx context.Context, resourceGroupName stri
 	return armrecoveryservices.VaultsClientDeleteResponse{}, mock.deleteError
 }
 
+func (mock *mockVaultsClient) NewListByResourceGroupPager(resourceGroupName string, options *armrecoveryservices.VaultsClientListByResourceGroupOptions) *runtime.Pager[armrecoveryservices.VaultsClientListByResourceGroupResponse] {
+	vaultsPages := []armrecoveryservices.VaultsClientListByResourceGroupResponse{
+		{
+			VaultList: armrecoveryservices.VaultList{
+				Value: mock.vaults,
+			},
+		},
+	}
+
+	return CreatePager(vaultsPages, nil)
+}
+
 func Test_CCC_C06_TR01_T01_succeeds(t *testing.T) {
 	// Arrange
 	mock := &mockPolicyClient{
@@ -150,6 +164,7 @@ func Test_CCC_C06_TR01_T01_succeeds(t *testing.T) {
 
 	allowedRegions = []string{"westus", "eastus"}
 	policyClient = mock
+	policyStatesClient = &mockPolicyStatesClient{complianceState: "Compliant"}
 
 	// Act
 	result := CCC_C06_TR01_T01()
@@ -192,7 +207,7 @@ func Test_CCC_C06_TR01_T01_fails_when_policy_not_found(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Contains(t, result.Message, "Built-in Azure Policy Allowed locations is not assigned to the resource")
+	assert.Contains(t, result.Message, "Neither the built-in Azure Policy Allowed locations, nor an equivalent custom policy, is assigned to the resource")
 }
 func Test_CCC_C06_TR01_T01_fails_when_enforcement_mode_disabled(t *testing.T) {
 	// Arrange
@@ -211,7 +226,7 @@ func Test_CCC_C06_TR01_T01_fails_when_enforcement_mode_disabled(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Contains(t, result.Message, "Built-in Azure Policy Allowed locations is not assigned to the resource")
+	assert.Contains(t, result.Message, "Neither the built-in Azure Policy Allowed locations, nor an equivalent custom policy, is assigned to the resource")
 }
 
 func Test_CCC_C06_TR01_T01_fails_when_extra_regions_in_policy(t *testing.T) {
@@ -251,6 +266,28 @@ func Test_CCC_C06_TR01_T02_succeeds(t *testing.T) {
 	assert.Equal(t, true, result.Passed)
 }
 
+func Test_CCC_C06_TR01_T02_leaves_storage_account_for_cleanup_when_creation_fails(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	allowedRegions = []string{"allowedRegion"}
+	storageSkusClient = &mockSkusClient{
+		locations: []*string{to.Ptr("allowedRegion"), to.Ptr("restrictedRegion")},
+	}
+	armstorageClient = &mockAccountsClient{
+		pollError: assert.AnError,
+	}
+
+	// Act
+	result := CCC_C06_TR01_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Failed waiting for Storage Account to be created in allowed region allowedRegion with error: "+assert.AnError.Error(), result.Message)
+	assert.Len(t, testArtifacts.artifacts, 1)
+	assert.Equal(t, artifactStorageAccount, testArtifacts.artifacts[0].Kind)
+}
+
 func Test_CCC_C06_TR01_T02_fails_when_pager_errors(t *testing.T) {
 	// Arrange
 	allowedRegions = []string{"allowedRegion"}
@@ -345,6 +382,24 @@ func Test_CCC_C06_TR01_T02_fails_when_allowedRegion_delete_fails(t *testing.T) {
 	assert.Contains(t, result.Message, "Failed to delete Storage Account with error")
 }
 
+func Test_CCC_C06_TR01_T02_fails_when_allowedRegion_delete_times_out(t *testing.T) {
+	// Arrange
+	allowedRegions = []string{"allowedRegion"}
+	storageSkusClient = &mockSkusClient{
+		locations: []*string{to.Ptr("restrictedRegion"), to.Ptr("allowedRegion")},
+	}
+	armstorageClient = &mockAccountsClient{
+		deleteError: context.DeadlineExceeded,
+	}
+
+	// Act
+	result := CCC_C06_TR01_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Failed to delete Storage Account with error: context deadline exceeded", result.Message)
+}
+
 func Test_CCC_C06_TR02_T01_succeeds(t *testing.T) {
 	// Arrange
 	allowedRegions = []string{"uksouth", "ukwest"}
@@ -498,6 +553,24 @@ func Test_CCC_C06_TR02_T02_fails_when_allowedRegion_delete_fails(t *testing.T) {
 	assert.Contains(t, result.Message, "Failed to delete Backup Vault with error")
 }
 
+func Test_CCC_C06_TR02_T02_fails_when_allowedRegion_delete_is_cancelled(t *testing.T) {
+	// Arrange
+	allowedRegions = []string{"allowedRegion"}
+	storageSkusClient = &mockSkusClient{
+		locations: []*string{to.Ptr("restrictedRegion"), to.Ptr("allowedRegion")},
+	}
+	vaultsClient = &mockVaultsClient{
+		deleteError: context.Canceled,
+	}
+
+	// Act
+	result := CCC_C06_TR02_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Failed to delete Backup Vault with error: context canceled", result.Message)
+}
+
 func Test_CCC_ObjStor_C06_TR01_T01_succeeds(t *testing.T) {
 	// Arrange
 	myMock := loggingFunctionsMock{
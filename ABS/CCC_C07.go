@@ -1,8 +1,6 @@
 package abs
 
 import (
-	"context"
-
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 	"github.com/privateerproj/privateer-sdk/utils"
 
@@ -87,7 +85,7 @@ func CCC_C07_TR02_T01() (result pluginkit.TestResult) {
 // --------------------------------------
 
 func ConfirmDefenderForStorageIsEnabled(result *pluginkit.TestResult) {
-	defenderForStorageResponse, err := defenderForStorageClient.Get(context.Background(), storageAccountResourceId, armsecurity.SettingNameCurrent, &armsecurity.DefenderForStorageClientGetOptions{})
+	defenderForStorageResponse, err := defenderForStorageClient.Get(testSetContext, currentTarget.storageAccountResourceId, armsecurity.SettingNameCurrent, &armsecurity.DefenderForStorageClientGetOptions{})
 
 	if err != nil {
 		SetResultFailure(result, "Error getting Defender for Storage settings: "+err.Error())
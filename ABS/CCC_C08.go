@@ -37,20 +37,20 @@ func CCC_C08_TR01_T01() (result pluginkit.TestResult) {
 	}
 
 	SKU := SKU{
-		SKUName: string(*storageAccountResource.SKU.Name),
+		SKUName: string(*currentTarget.storageAccountResource.SKU.Name),
 	}
 	result.Value = SKU
 
-	if strings.Contains(string(*storageAccountResource.SKU.Name), "ZRS") {
+	if strings.Contains(string(*currentTarget.storageAccountResource.SKU.Name), "ZRS") {
 		result.Passed = true
 		result.Message = "Data is replicated across multiple availability zones."
-	} else if strings.Contains(string(*storageAccountResource.SKU.Name), "GRS") ||
-		strings.Contains(string(*storageAccountResource.SKU.Name), "RAGRS") ||
-		strings.Contains(string(*storageAccountResource.SKU.Name), "GZRS") ||
-		strings.Contains(string(*storageAccountResource.SKU.Name), "RAGZRS") {
+	} else if strings.Contains(string(*currentTarget.storageAccountResource.SKU.Name), "GRS") ||
+		strings.Contains(string(*currentTarget.storageAccountResource.SKU.Name), "RAGRS") ||
+		strings.Contains(string(*currentTarget.storageAccountResource.SKU.Name), "GZRS") ||
+		strings.Contains(string(*currentTarget.storageAccountResource.SKU.Name), "RAGZRS") {
 		result.Passed = true
 		result.Message = "Data is replicated across multiple regions."
-	} else if strings.Contains(string(*storageAccountResource.SKU.Name), "LRS") {
+	} else if strings.Contains(string(*currentTarget.storageAccountResource.SKU.Name), "LRS") {
 		SetResultFailure(&result, "Data is not replicated across multiple availability zones or regions.")
 	} else {
 		SetResultFailure(&result, "Data replication type is unknown.")
@@ -94,10 +94,10 @@ func CCC_C08_TR02_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if storageAccountResource.Properties.StatusOfSecondary == nil {
+	if currentTarget.storageAccountResource.Properties.StatusOfSecondary == nil {
 		SetResultFailure(&result, "Secondary location is not enabled.")
 		return
-	} else if *storageAccountResource.Properties.StatusOfSecondary == armstorage.AccountStatusAvailable {
+	} else if *currentTarget.storageAccountResource.Properties.StatusOfSecondary == armstorage.AccountStatusAvailable {
 		result.Passed = true
 		result.Message = "Secondary location is enabled and available."
 		return
@@ -113,8 +113,8 @@ func CCC_C08_TR02_T02() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	if storageAccountResource.Properties.GeoReplicationStats == nil ||
-		storageAccountResource.Properties.GeoReplicationStats.LastSyncTime == nil {
+	if currentTarget.storageAccountResource.Properties.GeoReplicationStats == nil ||
+		currentTarget.storageAccountResource.Properties.GeoReplicationStats.LastSyncTime == nil {
 		SetResultFailure(&result, "Last sync time is not available, this usually indicates geo-replication is not enabled - see previous test for details on replication configuration.")
 		return
 
@@ -122,10 +122,10 @@ func CCC_C08_TR02_T02() (result pluginkit.TestResult) {
 
 		result.Value = LastSyncTime{
 			Name:  "Last Sync Time (UTC)",
-			Value: *storageAccountResource.Properties.GeoReplicationStats.LastSyncTime,
+			Value: *currentTarget.storageAccountResource.Properties.GeoReplicationStats.LastSyncTime,
 		}
 
-		if storageAccountPropertiesTimestamp.Sub(*storageAccountResource.Properties.GeoReplicationStats.LastSyncTime) <= 15*time.Minute {
+		if currentTarget.storageAccountPropertiesTimestamp.Sub(*currentTarget.storageAccountResource.Properties.GeoReplicationStats.LastSyncTime) <= 15*time.Minute {
 			result.Passed = true
 			result.Message = "Last sync time is within 15 minutes."
 			return
@@ -14,7 +14,7 @@ func Test_CCC_C08_TR01_succeeds_with_ZRS(t *testing.T) {
 	myMock := storageAccountMock{
 		sku: "Premium_ZRS",
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR01_T01()
@@ -30,7 +30,7 @@ func Test_CCC_C08_TR01_succeeds_with_GRS(t *testing.T) {
 	myMock := storageAccountMock{
 		sku: "Premium_GRS",
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR01_T01()
@@ -46,7 +46,7 @@ func Test_CCC_C08_TR01_fails_with_LRS(t *testing.T) {
 	myMock := storageAccountMock{
 		sku: "Premium_LRS",
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR01_T01()
@@ -62,7 +62,7 @@ func Test_CCC_C08_TR01_fails_with_unknown_replication(t *testing.T) {
 	myMock := storageAccountMock{
 		sku: "UNKNOWN",
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR01_T01()
@@ -79,7 +79,7 @@ func Test_CCC_C08_TR02_T01_succeeds(t *testing.T) {
 	myMock := storageAccountMock{
 		StatusOfSecondary: to.Ptr(armstorage.AccountStatusAvailable),
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR02_T01()
@@ -94,7 +94,7 @@ func Test_CCC_C08_TR02_T01_fails_secondary_status_is_nil(t *testing.T) {
 	myMock := storageAccountMock{
 		StatusOfSecondary: nil,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR02_T01()
@@ -109,7 +109,7 @@ func Test_CCC_C08_TR02_T01_fails_secondary_status_is_not_available(t *testing.T)
 	myMock := storageAccountMock{
 		StatusOfSecondary: to.Ptr(armstorage.AccountStatusUnavailable),
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR02_T01()
@@ -124,7 +124,7 @@ func Test_CCC_C08_TR02_T02_succeeds(t *testing.T) {
 	myMock := storageAccountMock{
 		LastSyncTime: to.Ptr(time.Now()),
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR02_T02()
@@ -139,7 +139,7 @@ func Test_CCC_C08_TR02_T02_fails_last_sync_nil(t *testing.T) {
 	myMock := storageAccountMock{
 		LastSyncTime: nil,
 	}
-	storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
 
 	// Act
 	result := CCC_C08_TR02_T02()
@@ -154,8 +154,8 @@ func Test_CCC_C08_TR02_T02_fails_last_sync_30mins_ago(t *testing.T) {
 	myMock := storageAccountMock{
 		LastSyncTime: to.Ptr(time.Now().Add(-30 * time.Minute)),
 	}
-	storageAccountResource = myMock.SetStorageAccount()
-	storageAccountPropertiesTimestamp = time.Now()
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountPropertiesTimestamp = time.Now()
 
 	// Act
 	result := CCC_C08_TR02_T02()
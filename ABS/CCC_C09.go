@@ -38,7 +38,7 @@ func CCC_C09_TR01_T01() (result pluginkit.TestResult) {
 	}
 
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
-		storageAccountResourceId+"/blobServices/default",
+		currentTarget.storageAccountResourceId+"/blobServices/default",
 		diagnosticsSettingsClient,
 		&result)
 
@@ -78,7 +78,7 @@ func CCC_C09_TR02_T01() (result pluginkit.TestResult) {
 	}
 
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
-		storageAccountResourceId+"/blobServices/default",
+		currentTarget.storageAccountResourceId+"/blobServices/default",
 		diagnosticsSettingsClient,
 		&result)
 
@@ -118,7 +118,7 @@ func CCC_C09_TR03_T01() (result pluginkit.TestResult) {
 	}
 
 	ArmoryAzureUtils.ConfirmLoggingToLogAnalyticsIsConfigured(
-		storageAccountResourceId+"/blobServices/default",
+		currentTarget.storageAccountResourceId+"/blobServices/default",
 		diagnosticsSettingsClient,
 		&result)
 
@@ -1,10 +1,16 @@
 package abs
 
 import (
-	"context"
+	"fmt"
+	"slices"
 	"strings"
+	"time"
 
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 	"github.com/privateerproj/privateer-sdk/utils"
 )
@@ -45,10 +51,11 @@ func CCC_C11_TR02() (testSetName string, result pluginkit.TestSetResult) {
 	}
 
 	result.ExecuteTest(CCC_C11_TR02_T01)
+	result.ExecuteTest(CCC_C11_TR02_T02)
 
 	TestSetResultSetter(
-		"Built-in Azure Policy is assigned which requires key rotation is scheduled within the specified number of days after creation.",
-		"Built-in Azure Policy which requires key rotation is scheduled within the specified number of days after creation is not assigned. There may be a custom policy that enforces this requirement, this TestSet currently does not support validating any custom Azure Policies.",
+		"Azure Policy is assigned which requires key rotation is scheduled within the specified number of days after creation, and the encryption key is within the maximum key age.",
+		"Encryption keys are not rotated as required, see test results for more details.",
 		&result,
 	)
 
@@ -61,32 +68,68 @@ func CCC_C11_TR02_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	policiesPager := policyClient.NewListForResourcePager(resourceId.resourceGroupName, "Microsoft.Storage", "", "storageAccounts", resourceId.storageAccountName, nil)
+	policy, value, found, err := findEnforcingPolicy(keyRotationRequirement)
 
-	for policiesPager.More() {
-		page, err := policiesPager.NextPage(context.Background())
+	if err != nil {
+		SetResultFailure(&result, err.Error())
+		return
+	}
 
-		if err != nil {
-			SetResultFailure(&result, "Could not get next page of policies: "+err.Error())
-			return
-		}
+	if !found {
+		SetResultFailure(&result, "Neither the built-in Azure Policy that requires keys have a rotation policy, nor an equivalent custom policy, is assigned.")
+		return
+	}
 
-		for _, assignment := range page.Value {
-			// Check that the default policy is assigned (https://github.com/Azure/azure-policy/blob/0c3bf524cb141cd08ca72b7e6beb9d01a7955791/built-in-policies/policyDefinitions/Key%20Vault/Keys_KeyRotationPolicy_MaximumDaysToRotate.json)
-			if strings.Contains(*assignment.Properties.PolicyDefinitionID, "/providers/Microsoft.Authorization/policyDefinitions/d8cf8476-a2ec-4916-896e-992351803c44") && *assignment.Properties.EnforcementMode != armpolicy.EnforcementModeDoNotEnforce {
-				result.Message = "Azure Policy is assigned that requires keys be rotated for Storage Account encryption."
-				result.Passed = true
-				result.Value = KeyRotationPolicy{
-					Name: "MaximumDaysToRotateRequiredByPolicy",
-					Days: int(assignment.Properties.Parameters["maximumDaysToRotate"].Value.(float64)),
-				}
+	result.Message = fmt.Sprintf("Azure Policy is assigned that requires keys be rotated for Storage Account encryption (assignment %s).", policy.assignmentName)
+	result.Passed = true
+	result.Value = value
+	return
+}
 
-				return
-			}
-		}
+func CCC_C11_TR02_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that the customer-managed key in use was created within the maximum key age, and reports its rotation policy and last rotation.",
+		Function:    utils.CallerPath(0),
+	}
+
+	encryption := currentTarget.storageAccountResource.Properties.Encryption
+
+	if encryption == nil || encryption.KeySource == nil || *encryption.KeySource != armstorage.KeySourceMicrosoftKeyvault {
+		result.Passed = true
+		result.Message = "Storage Account is encrypted with Microsoft-managed keys, which are rotated by Microsoft."
+		return
+	}
+
+	if encryption.KeyVaultProperties == nil || encryption.KeyVaultProperties.KeyVaultURI == nil || encryption.KeyVaultProperties.KeyName == nil {
+		SetResultFailure(&result, "Storage Account uses a customer-managed key but the Key Vault properties are not set.")
+		return
+	}
+
+	keyName := *encryption.KeyVaultProperties.KeyName
+
+	keysClient, err := ArmoryAzureUtils.GetKeyVaultKeysClient(*encryption.KeyVaultProperties.KeyVaultURI)
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Failed to create Key Vault keys client with error: %v", err))
+		return
+	}
+
+	rotationState, err := getKeyRotationState(keysClient, encryption.KeyVaultProperties)
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Could not read the rotation state of key %s: %v", keyName, err))
+		return
+	}
+
+	result.Value = rotationState
+
+	if rotationState.KeyAgeDays > maxKeyAgeDays {
+		SetResultFailure(&result, fmt.Sprintf("Key %s in use is %d days old, which is older than the maximum key age of %d days.", rotationState.KeyID, rotationState.KeyAgeDays, maxKeyAgeDays))
+		return
 	}
 
-	SetResultFailure(&result, "Built-in policy that requires customer-managed keys be used for Storage Account encryption is not assigned.")
+	result.Passed = true
+	result.Message = fmt.Sprintf("Key %s in use is %d days old, which is within the maximum key age of %d days.", rotationState.KeyID, rotationState.KeyAgeDays, maxKeyAgeDays)
 	return
 }
 
@@ -108,8 +151,8 @@ func CCC_C11_TR03() (testSetName string, result pluginkit.TestSetResult) {
 	result.ExecuteTest(CCC_C11_TR03_T01)
 
 	TestSetResultSetter(
-		"Built-in Azure Policy is assigned which requires customer-managed keys are used for Storage Account encryption.",
-		"Built-in Azure Policy which requires customer-managed keys are used for Storage Account encryption is not assigned. There may be a custom policy that enforces this requirement, this TestSet currently does not support validating any custom Azure Policies.",
+		"Azure Policy is assigned which requires customer-managed keys are used for Storage Account encryption.",
+		"Neither the built-in Azure Policy which requires customer-managed keys are used for Storage Account encryption, nor an equivalent custom policy, is assigned.",
 		&result,
 	)
 
@@ -122,27 +165,128 @@ func CCC_C11_TR03_T01() (result pluginkit.TestResult) {
 		Function:    utils.CallerPath(0),
 	}
 
-	policiesPager := policyClient.NewListForResourcePager(resourceId.resourceGroupName, "Microsoft.Storage", "", "storageAccounts", resourceId.storageAccountName, nil)
+	policy, _, found, err := findEnforcingPolicy(customerManagedKeyRequirement)
+
+	if err != nil {
+		SetResultFailure(&result, err.Error())
+		return
+	}
+
+	if !found {
+		SetResultFailure(&result, "Neither the built-in Azure Policy that requires customer-managed keys be used for Storage Account encryption, nor an equivalent custom policy, is assigned.")
+		return
+	}
+
+	// Confirm the policy is evaluated against this storage account, rather than only assigned
+	compliance, err := getPolicyCompliance(policy)
+
+	if err != nil {
+		SetResultFailure(&result, err.Error())
+		return
+	}
+
+	result.Value = compliance
+
+	if message := compliance.nonComplianceMessage(); message != "" {
+		SetResultFailure(&result, message)
+		return
+	}
+
+	result.Message = fmt.Sprintf("Azure Policy is assigned that requires customer-managed keys be used for Storage Account encryption (assignment %s).", policy.assignmentName)
+	result.Passed = true
+	return
+}
+
+// -----
+// TestSet and Tests for CCC_C11_TR04
+// -----
+
+func CCC_C11_TR04() (testSetName string, result pluginkit.TestSetResult) {
+	testSetName = "CCC_C11_TR04"
+	result = pluginkit.TestSetResult{
+		Passed:      false,
+		Description: "When encryption keys are accessed, the service MUST verify that access to encryption keys is restricted to authorized personnel and services, following the principle of least privilege.",
+		Message:     "TestSet has not yet started.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C11.TR04",
+		Tests:       make(map[string]pluginkit.TestResult),
+	}
+
+	result.ExecuteTest(CCC_C11_TR04_T01)
+
+	TestSetResultSetter(
+		"Access to the encryption key is restricted to the Storage Account and the key administrators.",
+		"Access to the encryption key is not restricted to the Storage Account and the key administrators, see test results for more details.",
+		&result,
+	)
+
+	return
+}
+
+func CCC_C11_TR04_T01() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that only the Storage Account's managed identities and the allowlisted key administrators can use or manage the customer-managed key.",
+		Function:    utils.CallerPath(0),
+	}
+
+	encryption := currentTarget.storageAccountResource.Properties.Encryption
+
+	if encryption == nil || encryption.KeySource == nil || *encryption.KeySource != armstorage.KeySourceMicrosoftKeyvault {
+		result.Passed = true
+		result.Message = "Storage Account is encrypted with Microsoft-managed keys, access to which is managed by Microsoft."
+		return
+	}
+
+	if encryption.KeyVaultProperties == nil || encryption.KeyVaultProperties.KeyVaultURI == nil || encryption.KeyVaultProperties.KeyName == nil {
+		SetResultFailure(&result, "Storage Account uses a customer-managed key but the Key Vault properties are not set.")
+		return
+	}
 
-	for policiesPager.More() {
-		page, err := policiesPager.NextPage(context.Background())
+	vault, err := getKeyVaultByUri(*encryption.KeyVaultProperties.KeyVaultURI)
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Could not check access to the encryption key: %v", err))
+		return
+	}
+
+	var grants []KeyAccessGrant
+
+	// Data plane access is controlled either by Azure RBAC or by the vault's access policies, never both
+	if vault.Properties != nil && vault.Properties.EnableRbacAuthorization != nil && *vault.Properties.EnableRbacAuthorization {
+		grants, err = getRoleAssignmentKeyAccess(*vault.ID + "/keys/" + *encryption.KeyVaultProperties.KeyName)
 
 		if err != nil {
-			SetResultFailure(&result, "Could not get next page of policies: "+err.Error())
+			SetResultFailure(&result, fmt.Sprintf("Could not check access to the encryption key: %v", err))
 			return
 		}
+	} else {
+		grants = getAccessPolicyKeyAccess(vault)
+	}
 
-		for _, assignment := range page.Value {
-			// Check that the default policy is assigned (https://github.com/Azure/azure-policy/blob/0c3bf524cb141cd08ca72b7e6beb9d01a7955791/built-in-policies/policyDefinitions/Storage/StorageAccountCustomerManagedKeyEnabled_Audit.json)
-			if strings.Contains(*assignment.Properties.PolicyDefinitionID, "/providers/Microsoft.Authorization/policyDefinitions/6fac406b-40ca-413b-bf8e-0bf964659c25") && *assignment.Properties.EnforcementMode != armpolicy.EnforcementModeDoNotEnforce {
-				result.Message = "Azure Policy is assigned that requires customer-managed keys be used for Storage Account encryption."
-				result.Passed = true
-				return
-			}
+	authorizedPrincipalIds := append(getStorageAccountPrincipalIds(), keyAdministrators...)
+
+	var unauthorizedGrants []KeyAccessGrant
+	var unauthorizedDescriptions []string
+
+	for _, grant := range grants {
+		if slices.ContainsFunc(authorizedPrincipalIds, func(principalId string) bool {
+			return strings.EqualFold(principalId, grant.PrincipalID)
+		}) {
+			continue
 		}
+
+		unauthorizedGrants = append(unauthorizedGrants, grant)
+		unauthorizedDescriptions = append(unauthorizedDescriptions, fmt.Sprintf("%s (%s: %s)", grant.PrincipalID, grant.Source, strings.Join(grant.Permissions, ", ")))
 	}
 
-	SetResultFailure(&result, "Built-in policy that requires customer-managed keys be used for Storage Account encryption is not assigned.")
+	if len(unauthorizedGrants) > 0 {
+		result.Value = unauthorizedGrants
+		SetResultFailure(&result, fmt.Sprintf("Principals other than the Storage Account and the key administrators can use or manage key %s: %s", *encryption.KeyVaultProperties.KeyName, strings.Join(unauthorizedDescriptions, "; ")))
+		return
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("Only the Storage Account and the key administrators can use or manage key %s.", *encryption.KeyVaultProperties.KeyName)
 	return
 }
 
@@ -154,3 +298,356 @@ type KeyRotationPolicy struct {
 	Name string
 	Days int
 }
+
+// keyRotationRequirement recognises the built-in key rotation policy, and custom policies with a rule on the rotation policy of Key Vault keys
+var keyRotationRequirement = policyRequirement{
+	// https://github.com/Azure/azure-policy/blob/0c3bf524cb141cd08ca72b7e6beb9d01a7955791/built-in-policies/policyDefinitions/Key%20Vault/Keys_KeyRotationPolicy_MaximumDaysToRotate.json
+	builtInDefinitionName: "d8cf8476-a2ec-4916-896e-992351803c44",
+	matches: func(policy effectivePolicy) (any, bool) {
+		days, _ := toInt(policy.parameters["maximumDaysToRotate"])
+
+		if policy.definition == nil {
+			return KeyRotationPolicy{Name: "MaximumDaysToRotateRequiredByPolicy", Days: days}, true
+		}
+
+		if effect := getPolicyEffect(policy); effect != "audit" && effect != "deny" {
+			return nil, false
+		}
+
+		for _, condition := range getPolicyConditions(policy) {
+			if strings.HasPrefix(strings.ToLower(condition.field), "microsoft.keyvault.data/vaults/keys/rotationpolicy") {
+				// Custom policies may compare the rotation policy against a number of days directly, rather than through a parameter
+				if conditionDays, ok := toInt(condition.value); ok && days == 0 {
+					days = conditionDays
+				}
+
+				return KeyRotationPolicy{Name: "MaximumDaysToRotateRequiredByPolicy", Days: days}, true
+			}
+		}
+
+		return nil, false
+	},
+}
+
+// customerManagedKeyRequirement recognises the built-in customer-managed key policy, and custom policies with a rule on the key source of storage accounts
+var customerManagedKeyRequirement = policyRequirement{
+	// https://github.com/Azure/azure-policy/blob/0c3bf524cb141cd08ca72b7e6beb9d01a7955791/built-in-policies/policyDefinitions/Storage/StorageAccountCustomerManagedKeyEnabled_Audit.json
+	builtInDefinitionName: "6fac406b-40ca-413b-bf8e-0bf964659c25",
+	matches: func(policy effectivePolicy) (any, bool) {
+		if policy.definition == nil {
+			return nil, true
+		}
+
+		if effect := getPolicyEffect(policy); effect != "audit" && effect != "deny" {
+			return nil, false
+		}
+
+		conditions := getPolicyConditions(policy)
+
+		if !appliesToStorageAccounts(conditions) {
+			return nil, false
+		}
+
+		// The rule matches non-compliant storage accounts, so it must match those not using Key Vault keys
+		for _, condition := range conditions {
+			if !strings.EqualFold(condition.field, "Microsoft.Storage/storageAccounts/encryption.keySource") {
+				continue
+			}
+
+			keySources := toStringSlice(condition.value)
+
+			switch condition.operator {
+			case "notequals", "notin":
+				if slices.ContainsFunc(keySources, func(keySource string) bool {
+					return strings.EqualFold(keySource, string(armstorage.KeySourceMicrosoftKeyvault))
+				}) {
+					return nil, true
+				}
+			case "equals", "in":
+				if slices.ContainsFunc(keySources, func(keySource string) bool {
+					return strings.EqualFold(keySource, string(armstorage.KeySourceMicrosoftStorage))
+				}) {
+					return nil, true
+				}
+			}
+		}
+
+		return nil, false
+	},
+}
+
+// KeyRotationState is the rotation history and policy of the customer-managed key a storage account is encrypted with
+type KeyRotationState struct {
+	KeyID               string
+	KeyCreated          *time.Time
+	KeyAgeDays          int
+	LastRotation        *time.Time
+	VersionCount        int
+	AutoRotationEnabled bool
+	RotationTrigger     string
+}
+
+// getKeyRotationState reads the version history and rotation policy of a key, the version in use is the pinned version or else the one the storage account last picked up
+func getKeyRotationState(keysClient KeyVaultKeysClientInterface, keyVaultProperties *armstorage.KeyVaultProperties) (state KeyRotationState, err error) {
+	keyName := *keyVaultProperties.KeyName
+
+	versionInUse := ""
+
+	if keyVaultProperties.KeyVersion != nil && *keyVaultProperties.KeyVersion != "" {
+		versionInUse = *keyVaultProperties.KeyVersion
+	} else if keyVaultProperties.CurrentVersionedKeyIdentifier != nil {
+		versionInUse = (*azkeys.ID)(keyVaultProperties.CurrentVersionedKeyIdentifier).Version()
+	}
+
+	var keyInUse *azkeys.KeyProperties
+	var newestKey *azkeys.KeyProperties
+
+	pager := keysClient.NewListKeyPropertiesVersionsPager(keyName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return state, fmt.Errorf("failed to list key versions: %v", err)
+		}
+
+		for _, version := range page.Value {
+			if version.KID == nil || version.Attributes == nil || version.Attributes.Created == nil {
+				continue
+			}
+
+			state.VersionCount++
+
+			if newestKey == nil || version.Attributes.Created.After(*newestKey.Attributes.Created) {
+				newestKey = version
+			}
+
+			if versionInUse != "" && strings.EqualFold(version.KID.Version(), versionInUse) {
+				keyInUse = version
+			}
+		}
+	}
+
+	if newestKey == nil {
+		return state, fmt.Errorf("key has no versions")
+	}
+
+	// A versionless key which the storage account has not reported using yet is always the newest version
+	if keyInUse == nil {
+		keyInUse = newestKey
+	}
+
+	state.KeyID = string(*keyInUse.KID)
+	state.KeyCreated = keyInUse.Attributes.Created
+	state.KeyAgeDays = int(now().Sub(*keyInUse.Attributes.Created).Hours() / 24)
+	state.LastRotation = newestKey.Attributes.Created
+
+	rotationPolicy, err := keysClient.GetKeyRotationPolicy(testSetContext, keyName, nil)
+
+	if err != nil {
+		return state, fmt.Errorf("failed to get key rotation policy: %v", err)
+	}
+
+	for _, lifetimeAction := range rotationPolicy.LifetimeActions {
+		if lifetimeAction == nil || lifetimeAction.Action == nil || lifetimeAction.Action.Type == nil || !strings.EqualFold(string(*lifetimeAction.Action.Type), string(azkeys.KeyRotationPolicyActionRotate)) {
+			continue
+		}
+
+		state.AutoRotationEnabled = true
+
+		if lifetimeAction.Trigger != nil && lifetimeAction.Trigger.TimeAfterCreate != nil {
+			state.RotationTrigger = *lifetimeAction.Trigger.TimeAfterCreate + " after creation"
+		} else if lifetimeAction.Trigger != nil && lifetimeAction.Trigger.TimeBeforeExpiry != nil {
+			state.RotationTrigger = *lifetimeAction.Trigger.TimeBeforeExpiry + " before expiry"
+		}
+	}
+
+	return state, nil
+}
+
+// KeyAccessGrant is a principal which can use or manage an encryption key, and how that access was granted
+type KeyAccessGrant struct {
+	PrincipalID string
+	Source      string
+	Permissions []string
+}
+
+var (
+	// keyAccessDataActions are the Key Vault data actions that use a key, read it, or manage it
+	keyAccessDataActions = []string{
+		"Microsoft.KeyVault/vaults/keys/read",
+		"Microsoft.KeyVault/vaults/keys/wrap/action",
+		"Microsoft.KeyVault/vaults/keys/unwrap/action",
+		"Microsoft.KeyVault/vaults/keys/encrypt/action",
+		"Microsoft.KeyVault/vaults/keys/decrypt/action",
+		"Microsoft.KeyVault/vaults/keys/create/action",
+		"Microsoft.KeyVault/vaults/keys/import/action",
+		"Microsoft.KeyVault/vaults/keys/update/action",
+		"Microsoft.KeyVault/vaults/keys/delete",
+		"Microsoft.KeyVault/vaults/keys/rotate/action",
+		"Microsoft.KeyVault/vaults/keys/backup/action",
+		"Microsoft.KeyVault/vaults/keys/restore/action",
+		"Microsoft.KeyVault/vaults/keys/release/action",
+		"Microsoft.KeyVault/vaults/keyrotationpolicies/write",
+	}
+
+	// keyAccessPermissions are the Key Vault access policy key permissions that use a key, read it, or manage it
+	keyAccessPermissions = []armkeyvault.KeyPermissions{
+		armkeyvault.KeyPermissionsAll,
+		armkeyvault.KeyPermissionsGet,
+		armkeyvault.KeyPermissionsWrapKey,
+		armkeyvault.KeyPermissionsUnwrapKey,
+		armkeyvault.KeyPermissionsEncrypt,
+		armkeyvault.KeyPermissionsDecrypt,
+		armkeyvault.KeyPermissionsCreate,
+		armkeyvault.KeyPermissionsImport,
+		armkeyvault.KeyPermissionsUpdate,
+		armkeyvault.KeyPermissionsDelete,
+		armkeyvault.KeyPermissionsPurge,
+		armkeyvault.KeyPermissionsRecover,
+		armkeyvault.KeyPermissionsRotate,
+		armkeyvault.KeyPermissionsSetrotationpolicy,
+		armkeyvault.KeyPermissionsBackup,
+		armkeyvault.KeyPermissionsRestore,
+		armkeyvault.KeyPermissionsRelease,
+	}
+)
+
+// getKeyVaultByUri finds the Key Vault with the given URI in the storage account's subscription
+func getKeyVaultByUri(keyVaultUri string) (*armkeyvault.Vault, error) {
+	pager := keyVaultsClient.NewListBySubscriptionPager(nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Key Vaults: %v", err)
+		}
+
+		for _, vault := range page.Value {
+			if vault.ID != nil && vault.Properties != nil && vault.Properties.VaultURI != nil && normalizeKeyId(*vault.Properties.VaultURI) == normalizeKeyId(keyVaultUri) {
+				return vault, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("Key Vault %s was not found in the Storage Account's subscription", keyVaultUri)
+}
+
+// getStorageAccountPrincipalIds returns the principal IDs of the system-assigned and user-assigned identities of the storage account
+func getStorageAccountPrincipalIds() (principalIds []string) {
+	identity := currentTarget.storageAccountResource.Identity
+
+	if identity == nil {
+		return nil
+	}
+
+	if identity.PrincipalID != nil {
+		principalIds = append(principalIds, *identity.PrincipalID)
+	}
+
+	for _, userAssignedIdentity := range identity.UserAssignedIdentities {
+		if userAssignedIdentity != nil && userAssignedIdentity.PrincipalID != nil {
+			principalIds = append(principalIds, *userAssignedIdentity.PrincipalID)
+		}
+	}
+
+	return principalIds
+}
+
+// getRoleAssignmentKeyAccess lists the principals with a role assignment on the key, or any scope above it, that grants access to the key
+func getRoleAssignmentKeyAccess(keyId string) (grants []KeyAccessGrant, err error) {
+	roleDefinitions := make(map[string]*armauthorization.RoleDefinition)
+	pager := roleAssignmentsClient.NewListForScopePager(keyId, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+		Filter: to.Ptr("atScope()"),
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list role assignments: %v", err)
+		}
+
+		for _, assignment := range page.Value {
+			if assignment.Properties == nil || assignment.Properties.PrincipalID == nil || assignment.Properties.RoleDefinitionID == nil {
+				continue
+			}
+
+			roleDefinitionId := *assignment.Properties.RoleDefinitionID
+			roleDefinition, ok := roleDefinitions[roleDefinitionId]
+
+			if !ok {
+				response, err := roleDefinitionsClient.GetByID(testSetContext, roleDefinitionId, nil)
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to get role definition %s: %v", roleDefinitionId, err)
+				}
+
+				roleDefinition = &response.RoleDefinition
+				roleDefinitions[roleDefinitionId] = roleDefinition
+			}
+
+			if roleDefinition.Properties == nil {
+				continue
+			}
+
+			var permissions []string
+
+			for _, dataAction := range keyAccessDataActions {
+				if isPermitted(roleDefinition.Properties.Permissions, rbacDataAction(dataAction)) {
+					permissions = append(permissions, dataAction)
+				}
+			}
+
+			if len(permissions) > 0 {
+				roleName := roleDefinitionId
+
+				if roleDefinition.Properties.RoleName != nil {
+					roleName = *roleDefinition.Properties.RoleName
+				}
+
+				grants = append(grants, KeyAccessGrant{
+					PrincipalID: *assignment.Properties.PrincipalID,
+					Source:      "role " + roleName,
+					Permissions: permissions,
+				})
+			}
+		}
+	}
+
+	return grants, nil
+}
+
+// getAccessPolicyKeyAccess lists the principals with an access policy on the vault that grants access to its keys
+func getAccessPolicyKeyAccess(vault *armkeyvault.Vault) (grants []KeyAccessGrant) {
+	if vault.Properties == nil {
+		return nil
+	}
+
+	for _, accessPolicy := range vault.Properties.AccessPolicies {
+		if accessPolicy == nil || accessPolicy.ObjectID == nil || accessPolicy.Permissions == nil {
+			continue
+		}
+
+		var permissions []string
+
+		for _, keyPermission := range accessPolicy.Permissions.Keys {
+			if keyPermission != nil && slices.ContainsFunc(keyAccessPermissions, func(permission armkeyvault.KeyPermissions) bool {
+				return strings.EqualFold(string(permission), string(*keyPermission))
+			}) {
+				permissions = append(permissions, string(*keyPermission))
+			}
+		}
+
+		if len(permissions) > 0 {
+			grants = append(grants, KeyAccessGrant{
+				PrincipalID: *accessPolicy.ObjectID,
+				Source:      "access policy",
+				Permissions: permissions,
+			})
+		}
+	}
+
+	return grants
+}
@@ -1,9 +1,17 @@
 package abs
 
 import (
+	"context"
 	"testing"
+	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -56,7 +64,7 @@ func Test_CCC_C11_TR02_T01_fails_when_policy_not_found(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, result.Message, "Built-in policy that requires customer-managed keys be used for Storage Account encryption is not assigned.")
+	assert.Equal(t, result.Message, "Neither the built-in Azure Policy that requires keys have a rotation policy, nor an equivalent custom policy, is assigned.")
 }
 
 func Test_CCC_C11_TR02_T01_fails_when_enforcement_mode_is_disabled(t *testing.T) {
@@ -74,7 +82,7 @@ func Test_CCC_C11_TR02_T01_fails_when_enforcement_mode_is_disabled(t *testing.T)
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, result.Message, "Built-in policy that requires customer-managed keys be used for Storage Account encryption is not assigned.")
+	assert.Equal(t, result.Message, "Neither the built-in Azure Policy that requires keys have a rotation policy, nor an equivalent custom policy, is assigned.")
 }
 
 func Test_CCC_C11_TR03_T01_succeeds(t *testing.T) {
@@ -85,6 +93,7 @@ func Test_CCC_C11_TR03_T01_succeeds(t *testing.T) {
 	}
 
 	policyClient = mock
+	policyStatesClient = &mockPolicyStatesClient{complianceState: "Compliant"}
 
 	// Act
 	result := CCC_C11_TR03_T01()
@@ -124,7 +133,7 @@ func Test_CCC_C11_TR03_T01_fails_when_enforcement_mode_is_disabled(t *testing.T)
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, result.Message, "Built-in policy that requires customer-managed keys be used for Storage Account encryption is not assigned.")
+	assert.Equal(t, result.Message, "Neither the built-in Azure Policy that requires customer-managed keys be used for Storage Account encryption, nor an equivalent custom policy, is assigned.")
 }
 
 func Test_CCC_C11_TR03_T01_fails_when_policy_not_found(t *testing.T) {
@@ -141,5 +150,379 @@ func Test_CCC_C11_TR03_T01_fails_when_policy_not_found(t *testing.T) {
 
 	// Assert
 	assert.Equal(t, false, result.Passed)
-	assert.Equal(t, result.Message, "Built-in policy that requires customer-managed keys be used for Storage Account encryption is not assigned.")
+	assert.Equal(t, result.Message, "Neither the built-in Azure Policy that requires customer-managed keys be used for Storage Account encryption, nor an equivalent custom policy, is assigned.")
+}
+
+type mockKeyVaultsClient struct {
+	vaults  []*armkeyvault.Vault
+	listErr error
+}
+
+func (mock *mockKeyVaultsClient) NewListBySubscriptionPager(options *armkeyvault.VaultsClientListBySubscriptionOptions) *runtime.Pager[armkeyvault.VaultsClientListBySubscriptionResponse] {
+	return CreatePager([]armkeyvault.VaultsClientListBySubscriptionResponse{
+		{
+			VaultListResult: armkeyvault.VaultListResult{
+				Value: mock.vaults,
+			},
+		},
+	}, mock.listErr)
+}
+
+type mockRoleDefinitionsClient struct {
+	roleDefinitions map[string]armauthorization.RoleDefinition
+	getErr          error
+}
+
+func (mock *mockRoleDefinitionsClient) GetByID(ctx context.Context, roleID string, options *armauthorization.RoleDefinitionsClientGetByIDOptions) (armauthorization.RoleDefinitionsClientGetByIDResponse, error) {
+	return armauthorization.RoleDefinitionsClientGetByIDResponse{RoleDefinition: mock.roleDefinitions[roleID]}, mock.getErr
+}
+
+const testKeyVaultId = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/myrg/providers/Microsoft.KeyVault/vaults/myvault"
+
+func setCustomerManagedKeyStorageAccount() {
+	myMock := storageAccountMock{
+		keySource:   armstorage.KeySourceMicrosoftKeyvault,
+		keyVaultUri: "https://myvault.vault.azure.net/",
+		keyName:     "mykey",
+	}
+
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+	currentTarget.storageAccountResource.Identity = &armstorage.Identity{
+		PrincipalID: to.Ptr("storage-account-identity"),
+	}
+}
+
+func newKeyVault(rbacAuthorization bool, accessPolicies ...*armkeyvault.AccessPolicyEntry) *armkeyvault.Vault {
+	return &armkeyvault.Vault{
+		ID: to.Ptr(testKeyVaultId),
+		Properties: &armkeyvault.VaultProperties{
+			VaultURI:                to.Ptr("https://myvault.vault.azure.net"),
+			EnableRbacAuthorization: to.Ptr(rbacAuthorization),
+			AccessPolicies:          accessPolicies,
+		},
+	}
+}
+
+func newRoleAssignment(principalId string, roleDefinitionId string) *armauthorization.RoleAssignment {
+	return &armauthorization.RoleAssignment{
+		Properties: &armauthorization.RoleAssignmentProperties{
+			PrincipalID:      to.Ptr(principalId),
+			RoleDefinitionID: to.Ptr(roleDefinitionId),
+		},
+	}
+}
+
+func newRoleDefinition(roleName string, dataActions ...string) armauthorization.RoleDefinition {
+	return armauthorization.RoleDefinition{
+		Properties: &armauthorization.RoleDefinitionProperties{
+			RoleName: to.Ptr(roleName),
+			Permissions: []*armauthorization.Permission{
+				{
+					DataActions: to.SliceOfPtrs(dataActions...),
+				},
+			},
+		},
+	}
+}
+
+func newAccessPolicy(objectId string, keyPermissions ...armkeyvault.KeyPermissions) *armkeyvault.AccessPolicyEntry {
+	return &armkeyvault.AccessPolicyEntry{
+		ObjectID: to.Ptr(objectId),
+		Permissions: &armkeyvault.Permissions{
+			Keys: to.SliceOfPtrs(keyPermissions...),
+		},
+	}
+}
+
+func Test_CCC_C11_TR04_T01_succeeds_with_microsoft_managed_keys(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{
+		keySource: armstorage.KeySourceMicrosoftStorage,
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+
+	// Act
+	result := CCC_C11_TR04_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "Storage Account is encrypted with Microsoft-managed keys, access to which is managed by Microsoft.", result.Message)
+}
+
+func Test_CCC_C11_TR04_T01_succeeds_with_only_authorized_role_assignments(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+	keyAdministrators = []string{"key-administrator"}
+
+	keyVaultsClient = &mockKeyVaultsClient{vaults: []*armkeyvault.Vault{newKeyVault(true)}}
+	roleAssignmentsClient = &mockRoleAssignmentsClient{
+		roleAssignments: []*armauthorization.RoleAssignment{
+			newRoleAssignment("storage-account-identity", "encryption-user"),
+			newRoleAssignment("key-administrator", "crypto-officer"),
+			newRoleAssignment("someone-else", "secrets-user"),
+		},
+	}
+	roleDefinitionsClient = &mockRoleDefinitionsClient{
+		roleDefinitions: map[string]armauthorization.RoleDefinition{
+			"encryption-user": newRoleDefinition("Key Vault Crypto Service Encryption User", "Microsoft.KeyVault/vaults/keys/read", "Microsoft.KeyVault/vaults/keys/wrap/action", "Microsoft.KeyVault/vaults/keys/unwrap/action"),
+			"crypto-officer":  newRoleDefinition("Key Vault Crypto Officer", "Microsoft.KeyVault/vaults/keys/*"),
+			"secrets-user":    newRoleDefinition("Key Vault Secrets User", "Microsoft.KeyVault/vaults/secrets/getSecret/action"),
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR04_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "Only the Storage Account and the key administrators can use or manage key mykey.", result.Message)
+}
+
+func Test_CCC_C11_TR04_T01_fails_with_unauthorized_role_assignment(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+	keyAdministrators = nil
+
+	keyVaultsClient = &mockKeyVaultsClient{vaults: []*armkeyvault.Vault{newKeyVault(true)}}
+	roleAssignmentsClient = &mockRoleAssignmentsClient{
+		roleAssignments: []*armauthorization.RoleAssignment{
+			newRoleAssignment("someone-else", "crypto-user"),
+		},
+	}
+	roleDefinitionsClient = &mockRoleDefinitionsClient{
+		roleDefinitions: map[string]armauthorization.RoleDefinition{
+			"crypto-user": newRoleDefinition("Key Vault Crypto User", "Microsoft.KeyVault/vaults/keys/read", "Microsoft.KeyVault/vaults/keys/wrap/action"),
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR04_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Principals other than the Storage Account and the key administrators can use or manage key mykey: someone-else (role Key Vault Crypto User: Microsoft.KeyVault/vaults/keys/read, Microsoft.KeyVault/vaults/keys/wrap/action)", result.Message)
+	assert.Len(t, result.Value, 1)
+}
+
+func Test_CCC_C11_TR04_T01_fails_with_unauthorized_access_policy(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+	keyAdministrators = nil
+
+	keyVaultsClient = &mockKeyVaultsClient{
+		vaults: []*armkeyvault.Vault{
+			newKeyVault(false,
+				newAccessPolicy("storage-account-identity", armkeyvault.KeyPermissionsGet, armkeyvault.KeyPermissionsWrapKey, armkeyvault.KeyPermissionsUnwrapKey),
+				newAccessPolicy("lister", armkeyvault.KeyPermissionsList),
+				newAccessPolicy("someone-else", armkeyvault.KeyPermissionsList, armkeyvault.KeyPermissionsGet),
+			),
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR04_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Principals other than the Storage Account and the key administrators can use or manage key mykey: someone-else (access policy: get)", result.Message)
+}
+
+func Test_CCC_C11_TR04_T01_fails_when_key_vault_is_not_found(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+
+	keyVaultsClient = &mockKeyVaultsClient{}
+
+	// Act
+	result := CCC_C11_TR04_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Could not check access to the encryption key: Key Vault https://myvault.vault.azure.net/ was not found in the Storage Account's subscription", result.Message)
+}
+
+func Test_CCC_C11_TR04_T01_fails_when_role_definition_errors(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+
+	keyVaultsClient = &mockKeyVaultsClient{vaults: []*armkeyvault.Vault{newKeyVault(true)}}
+	roleAssignmentsClient = &mockRoleAssignmentsClient{
+		roleAssignments: []*armauthorization.RoleAssignment{
+			newRoleAssignment("someone-else", "crypto-user"),
+		},
+	}
+	roleDefinitionsClient = &mockRoleDefinitionsClient{
+		getErr: assert.AnError,
+	}
+
+	// Act
+	result := CCC_C11_TR04_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Could not check access to the encryption key: failed to get role definition crypto-user: assert.AnError general error for testing", result.Message)
+}
+
+type mockKeyVaultKeysClient struct {
+	keyVersions       []*azkeys.KeyProperties
+	listErr           error
+	rotationPolicy    azkeys.KeyRotationPolicy
+	rotationPolicyErr error
+}
+
+func (mock *mockKeyVaultKeysClient) NewListKeyPropertiesVersionsPager(name string, options *azkeys.ListKeyPropertiesVersionsOptions) *runtime.Pager[azkeys.ListKeyPropertiesVersionsResponse] {
+	return CreatePager([]azkeys.ListKeyPropertiesVersionsResponse{
+		{
+			KeyPropertiesListResult: azkeys.KeyPropertiesListResult{
+				Value: mock.keyVersions,
+			},
+		},
+	}, mock.listErr)
+}
+
+func (mock *mockKeyVaultKeysClient) GetKeyRotationPolicy(ctx context.Context, name string, options *azkeys.GetKeyRotationPolicyOptions) (azkeys.GetKeyRotationPolicyResponse, error) {
+	return azkeys.GetKeyRotationPolicyResponse{KeyRotationPolicy: mock.rotationPolicy}, mock.rotationPolicyErr
+}
+
+func newKeyVersion(version string, ageDays int) *azkeys.KeyProperties {
+	return &azkeys.KeyProperties{
+		KID: to.Ptr(azkeys.ID("https://myvault.vault.azure.net/keys/mykey/" + version)),
+		Attributes: &azkeys.KeyAttributes{
+			Created: to.Ptr(time.Now().AddDate(0, 0, -ageDays)),
+		},
+	}
+}
+
+func newAutoRotationPolicy(timeAfterCreate string) azkeys.KeyRotationPolicy {
+	return azkeys.KeyRotationPolicy{
+		LifetimeActions: []*azkeys.LifetimeAction{
+			{
+				Action:  &azkeys.LifetimeActionType{Type: to.Ptr(azkeys.KeyRotationPolicyActionRotate)},
+				Trigger: &azkeys.LifetimeActionTrigger{TimeAfterCreate: to.Ptr(timeAfterCreate)},
+			},
+		},
+	}
+}
+
+func Test_CCC_C11_TR02_T02_succeeds_with_microsoft_managed_keys(t *testing.T) {
+	// Arrange
+	myMock := storageAccountMock{
+		keySource: armstorage.KeySourceMicrosoftStorage,
+	}
+	currentTarget.storageAccountResource = myMock.SetStorageAccount()
+
+	// Act
+	result := CCC_C11_TR02_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "Storage Account is encrypted with Microsoft-managed keys, which are rotated by Microsoft.", result.Message)
+}
+
+func Test_CCC_C11_TR02_T02_succeeds_with_recently_rotated_versionless_key(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+	maxKeyAgeDays = 90
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		keyVaultKeysClient: &mockKeyVaultKeysClient{
+			keyVersions:    []*azkeys.KeyProperties{newKeyVersion("oldversion", 200), newKeyVersion("newversion", 10)},
+			rotationPolicy: newAutoRotationPolicy("P90D"),
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR02_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, "Key https://myvault.vault.azure.net/keys/mykey/newversion in use is 10 days old, which is within the maximum key age of 90 days.", result.Message)
+
+	rotationState := result.Value.(KeyRotationState)
+	assert.Equal(t, 2, rotationState.VersionCount)
+	assert.Equal(t, true, rotationState.AutoRotationEnabled)
+	assert.Equal(t, "P90D after creation", rotationState.RotationTrigger)
+}
+
+func Test_CCC_C11_TR02_T02_judges_key_age_at_recording_time_when_replaying(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+	maxKeyAgeDays = 90
+
+	recordedAt := time.Now().AddDate(0, 0, -150)
+	activeCassette = &cassette{mode: cassetteReplaying, lastRecordedAt: recordedAt}
+	defer func() { activeCassette = nil }()
+
+	keyVersion := newKeyVersion("newversion", 0)
+	keyVersion.Attributes.Created = to.Ptr(recordedAt.AddDate(0, 0, -10))
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		keyVaultKeysClient: &mockKeyVaultKeysClient{
+			keyVersions:    []*azkeys.KeyProperties{keyVersion},
+			rotationPolicy: newAutoRotationPolicy("P90D"),
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR02_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, 10, result.Value.(KeyRotationState).KeyAgeDays)
+}
+
+func Test_CCC_C11_TR02_T02_fails_when_pinned_key_version_is_too_old(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+	currentTarget.storageAccountResource.Properties.Encryption.KeyVaultProperties.KeyVersion = to.Ptr("oldversion")
+	maxKeyAgeDays = 90
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		keyVaultKeysClient: &mockKeyVaultKeysClient{
+			keyVersions: []*azkeys.KeyProperties{newKeyVersion("oldversion", 200), newKeyVersion("newversion", 10)},
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR02_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Key https://myvault.vault.azure.net/keys/mykey/oldversion in use is 200 days old, which is older than the maximum key age of 90 days.", result.Message)
+	assert.Equal(t, false, result.Value.(KeyRotationState).AutoRotationEnabled)
+}
+
+func Test_CCC_C11_TR02_T02_fails_when_rotation_policy_errors(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		keyVaultKeysClient: &mockKeyVaultKeysClient{
+			keyVersions:       []*azkeys.KeyProperties{newKeyVersion("newversion", 10)},
+			rotationPolicyErr: assert.AnError,
+		},
+	}
+
+	// Act
+	result := CCC_C11_TR02_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Could not read the rotation state of key mykey: failed to get key rotation policy: assert.AnError general error for testing", result.Message)
+}
+
+func Test_CCC_C11_TR02_T02_fails_when_keys_client_errors(t *testing.T) {
+	// Arrange
+	setCustomerManagedKeyStorageAccount()
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		getKeyVaultKeysClientError: assert.AnError,
+	}
+
+	// Act
+	result := CCC_C11_TR02_T02()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Failed to create Key Vault keys client with error: assert.AnError general error for testing", result.Message)
 }
@@ -0,0 +1,419 @@
+package abs
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/privateerproj/privateer-sdk/utils"
+)
+
+// maxUserDelegationKeyLifetime is the longest Azure Storage issues a user delegation key for
+const maxUserDelegationKeyLifetime = 7 * 24 * time.Hour
+
+// -----
+// TestSet and Tests for CCC_F05_TR01
+// -----
+
+func CCC_F05_TR01() (testSetName string, result pluginkit.TestSetResult) {
+	testSetName = "CCC_F05_TR01"
+	result = pluginkit.TestSetResult{
+		Passed:      false,
+		Description: "When signed URLs are used to grant temporary access, the service MUST limit how long they remain valid and the keys which sign them MUST be rotated.",
+		Message:     "TestSet has not yet started.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.F05",
+		Tests:       make(map[string]pluginkit.TestResult),
+	}
+
+	result.ExecuteTest(CCC_F05_TR01_T01)
+	result.ExecuteTest(CCC_F05_TR01_T02)
+	result.ExecuteTest(CCC_F05_TR01_T03)
+	result.ExecuteInvasiveTest(CCC_F05_TR01_T04)
+
+	TestSetResultSetter(
+		"SAS tokens cannot be valid for longer than the maximum SAS lifetime and the account keys which sign them are rotated.",
+		"SAS tokens can be long-lived or the account keys which sign them are not rotated, see test results for more details.",
+		&result,
+	)
+
+	return
+}
+
+func CCC_F05_TR01_T01() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that a SAS expiration policy blocks SAS tokens signed with the account keys which are valid for longer than the maximum SAS lifetime.",
+		Function:    utils.CallerPath(0),
+	}
+
+	properties := currentTarget.storageAccountResource.Properties
+
+	if !sharedKeyAccessAllowed(properties) {
+		result.Passed = true
+		result.Message = "Shared Key access is disabled for the storage account, so SAS tokens signed with the account keys are rejected."
+		return
+	}
+
+	if properties.SasPolicy == nil || properties.SasPolicy.SasExpirationPeriod == nil {
+		SetResultFailure(&result, "No SAS expiration policy is set, SAS tokens signed with the account keys can be valid for any length of time.")
+		return
+	}
+
+	expirationPeriod, err := parseSasExpirationPeriod(*properties.SasPolicy.SasExpirationPeriod)
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Could not read the SAS expiration period: %v", err))
+		return
+	}
+
+	expirationAction := armstorage.ExpirationActionLog
+
+	if properties.SasPolicy.ExpirationAction != nil {
+		expirationAction = *properties.SasPolicy.ExpirationAction
+	}
+
+	result.Value = SasExpirationPolicy{ExpirationPeriod: expirationPeriod.String(), ExpirationAction: string(expirationAction)}
+
+	if expirationPeriod > maxSasLifetime {
+		SetResultFailure(&result, fmt.Sprintf("The SAS expiration policy allows SAS tokens to be valid for %s, which is longer than the maximum SAS lifetime of %s.", expirationPeriod, maxSasLifetime))
+		return
+	}
+
+	if expirationAction != armstorage.ExpirationActionBlock {
+		SetResultFailure(&result, fmt.Sprintf("The SAS expiration policy limits SAS tokens to %s, but its action is %s so longer-lived SAS tokens are only logged rather than blocked.", expirationPeriod, expirationAction))
+		return
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("The SAS expiration policy blocks SAS tokens which are valid for longer than %s, within the maximum SAS lifetime of %s.", expirationPeriod, maxSasLifetime)
+	return
+}
+
+func CCC_F05_TR01_T02() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that the account keys have a key expiration period within the maximum key age, and that both have been rotated within it.",
+		Function:    utils.CallerPath(0),
+	}
+
+	properties := currentTarget.storageAccountResource.Properties
+
+	if !sharedKeyAccessAllowed(properties) {
+		result.Passed = true
+		result.Message = "Shared Key access is disabled for the storage account, so the account keys cannot be used to sign SAS tokens."
+		return
+	}
+
+	rotation := getAccountKeyRotation(properties)
+	result.Value = rotation
+
+	if rotation.KeyExpirationPeriodInDays == 0 {
+		SetResultFailure(&result, "No key expiration period is set, the account keys are never due to be rotated.")
+		return
+	}
+
+	if rotation.KeyExpirationPeriodInDays > maxKeyAgeDays {
+		SetResultFailure(&result, fmt.Sprintf("The key expiration period of %d days is longer than the maximum key age of %d days.", rotation.KeyExpirationPeriodInDays, maxKeyAgeDays))
+		return
+	}
+
+	var staleKeys []string
+
+	for _, key := range rotation.Keys {
+		switch {
+		case key.Created == nil:
+			staleKeys = append(staleKeys, fmt.Sprintf("%s has never been rotated", key.Name))
+		case key.AgeDays > maxKeyAgeDays && key.NeverRotated:
+			staleKeys = append(staleKeys, fmt.Sprintf("%s has never been rotated since the account was created %d days ago", key.Name, key.AgeDays))
+		case key.AgeDays > maxKeyAgeDays:
+			staleKeys = append(staleKeys, fmt.Sprintf("%s was last rotated %d days ago", key.Name, key.AgeDays))
+		}
+	}
+
+	if len(staleKeys) > 0 {
+		SetResultFailure(&result, fmt.Sprintf("Account keys are older than the maximum key age of %d days: %s.", maxKeyAgeDays, strings.Join(staleKeys, ", ")))
+		return
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("The key expiration period is %d days and both account keys have been rotated within the maximum key age of %d days.", rotation.KeyExpirationPeriodInDays, maxKeyAgeDays)
+	return
+}
+
+func CCC_F05_TR01_T03() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Confirms that no stored access policy of a container allows the SAS tokens which refer to it to be valid for longer than the maximum SAS lifetime.",
+		Function:    utils.CallerPath(0),
+	}
+
+	if !sharedKeyAccessAllowed(currentTarget.storageAccountResource.Properties) {
+		result.Passed = true
+		result.Message = "Shared Key access is disabled for the storage account, so service SAS tokens which refer to stored access policies are rejected."
+		return
+	}
+
+	inventory, err := ArmoryAzureUtils.GetContainerInventory()
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Could not list the containers to check their stored access policies: %v", err))
+		return
+	}
+
+	var policies []StoredAccessPolicy
+	var longLivedPolicies []string
+
+	for _, item := range inventory {
+		signedIdentifiers, err := ArmoryAzureUtils.GetStoredAccessPolicies(item.Name)
+
+		if err != nil {
+			SetResultFailure(&result, err.Error())
+			return
+		}
+
+		for _, signedIdentifier := range signedIdentifiers {
+			policy := newStoredAccessPolicy(item.Name, signedIdentifier)
+			policies = append(policies, policy)
+
+			// The SAS expiration policy does not apply to service SAS tokens which refer to a stored access policy, so a policy
+			//  without an expiry lets the token be valid for any length of time
+			if policy.Expiry == nil {
+				longLivedPolicies = append(longLivedPolicies, fmt.Sprintf("%s/%s (no expiry)", policy.Container, policy.ID))
+			} else if policy.lifetime() > maxSasLifetime {
+				longLivedPolicies = append(longLivedPolicies, fmt.Sprintf("%s/%s (valid for %s)", policy.Container, policy.ID, policy.lifetime().Round(time.Minute)))
+			}
+		}
+	}
+
+	result.Value = policies
+
+	if len(longLivedPolicies) > 0 {
+		SetResultFailure(&result, fmt.Sprintf("Stored access policies allow SAS tokens to be valid for longer than the maximum SAS lifetime of %s: %s.", maxSasLifetime, strings.Join(longLivedPolicies, ", ")))
+		return
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("The %d stored access policies of %d containers limit SAS tokens to the maximum SAS lifetime of %s.", len(policies), len(inventory), maxSasLifetime)
+	return
+}
+
+func CCC_F05_TR01_T04() (result pluginkit.TestResult) {
+	result = pluginkit.TestResult{
+		Description: "Attempts to list a test container with a user delegation SAS token which is valid for longer than the maximum SAS lifetime, which must be refused while a token within it is accepted.",
+		Function:    utils.CallerPath(0),
+	}
+
+	// Azure never issues a user delegation key for longer than 7 days, so there is no longer SAS token to attempt
+	if maxSasLifetime >= maxUserDelegationKeyLifetime {
+		result.Passed = true
+		result.Message = fmt.Sprintf("User delegation SAS tokens cannot be valid for longer than %s, within the maximum SAS lifetime of %s.", maxUserDelegationKeyLifetime, maxSasLifetime)
+		return
+	}
+
+	expiry := time.Now().UTC().Add(min(maxSasLifetime+time.Hour, maxUserDelegationKeyLifetime))
+	credential, err := ArmoryAzureUtils.GetUserDelegationCredential(expiry)
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Could not request a user delegation key: %v", err))
+		return
+	}
+
+	containerName := "privateer-test-container-" + ArmoryCommonFunctions.GenerateRandomString(8)
+
+	_, err = blobContainersClient.Create(testSetContext,
+		currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
+		containerName,
+		armstorage.BlobContainer{
+			ContainerProperties: &armstorage.ContainerProperties{},
+		},
+		nil,
+	)
+
+	if err != nil {
+		SetResultFailure(&result, fmt.Sprintf("Failed to create blob container with error: %v", err))
+		return
+	}
+
+	trackArtifact(artifactContainer, containerName)
+	defer ArmoryAzureUtils.DeleteTestContainer(&result, containerName)
+
+	// The tokens start no earlier than the key, which is valid from when it was requested
+	start := time.Now().UTC()
+
+	// A token within the maximum SAS lifetime must be accepted, otherwise the refusal of the longer-lived token could have any cause
+	allowedResponse := sendUserDelegationSasRequest(&result, credential, containerName, start, start.Add(maxSasLifetime/2))
+
+	if allowedResponse == nil {
+		return
+	}
+
+	if allowedResponse.StatusCode != http.StatusOK {
+		SetResultFailure(&result, fmt.Sprintf("A user delegation SAS token valid for %s was refused (%d %s), so it could not be confirmed that longer-lived tokens are refused.", maxSasLifetime/2, allowedResponse.StatusCode, allowedResponse.Header.Get("x-ms-error-code")))
+		return
+	}
+
+	response := sendUserDelegationSasRequest(&result, credential, containerName, start, expiry)
+
+	if response == nil {
+		return
+	}
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		SetResultFailure(&result, fmt.Sprintf("A user delegation SAS token valid until %s listed the test container, which is longer than the maximum SAS lifetime of %s.", expiry.Format(time.RFC3339), maxSasLifetime))
+	case http.StatusForbidden:
+		result.Passed = true
+		result.Message = fmt.Sprintf("A user delegation SAS token valid until %s was refused (%d %s), while a token within the maximum SAS lifetime of %s was accepted.", expiry.Format(time.RFC3339), response.StatusCode, response.Header.Get("x-ms-error-code"), maxSasLifetime)
+	default:
+		SetResultFailure(&result, fmt.Sprintf("A user delegation SAS token valid until %s got an unexpected response (%d %s).", expiry.Format(time.RFC3339), response.StatusCode, response.Header.Get("x-ms-error-code")))
+	}
+
+	return
+}
+
+// --------------------------------------
+// Utility functions to support tests
+// --------------------------------------
+
+// SasExpirationPolicy is the SAS expiration policy of a storage account
+type SasExpirationPolicy struct {
+	ExpirationPeriod string
+	ExpirationAction string
+}
+
+// AccountKeyRotation is the key expiration period of a storage account and when each of its access keys was last rotated
+type AccountKeyRotation struct {
+	KeyExpirationPeriodInDays int
+	Keys                      []AccountKeyAge
+}
+
+type AccountKeyAge struct {
+	Name    string
+	Created *time.Time
+	AgeDays int
+	// NeverRotated is set when the key was created along with the storage account
+	NeverRotated bool
+}
+
+// StoredAccessPolicy is a stored access policy of a container, which the service SAS tokens that refer to it take their lifetime from
+type StoredAccessPolicy struct {
+	Container  string
+	ID         string
+	Start      *time.Time
+	Expiry     *time.Time
+	Permission string
+}
+
+// sendUserDelegationSasRequest lists the blobs of a container with a user delegation SAS token which is valid from start until expiry
+func sendUserDelegationSasRequest(result *pluginkit.TestResult, credential *service.UserDelegationCredential, containerName string, start time.Time, expiry time.Time) *http.Response {
+	queryParameters, err := sas.BlobSignatureValues{
+		Protocol:      sas.ProtocolHTTPS,
+		StartTime:     start,
+		ExpiryTime:    expiry,
+		Permissions:   (&sas.ContainerPermissions{Read: true, List: true}).String(),
+		ContainerName: containerName,
+	}.SignWithUserDelegation(credential)
+
+	if err != nil {
+		SetResultFailure(result, fmt.Sprintf("Could not sign a user delegation SAS token valid until %s: %v", expiry.Format(time.RFC3339), err))
+		return nil
+	}
+
+	return ArmoryCommonFunctions.MakeGETRequest(fmt.Sprintf("%s%s?restype=container&%s", currentTarget.storageAccountUri, containerName, queryParameters.Encode()), "", result, nil, nil)
+}
+
+// lifetime is how long a SAS token which refers to the policy is valid for, a policy without a start time is valid from now
+func (policy StoredAccessPolicy) lifetime() time.Duration {
+	start := now()
+
+	if policy.Start != nil && policy.Start.After(start) {
+		start = *policy.Start
+	}
+
+	return policy.Expiry.Sub(start)
+}
+
+func newStoredAccessPolicy(containerName string, signedIdentifier *container.SignedIdentifier) StoredAccessPolicy {
+	policy := StoredAccessPolicy{Container: containerName}
+
+	if signedIdentifier.ID != nil {
+		policy.ID = *signedIdentifier.ID
+	}
+
+	if accessPolicy := signedIdentifier.AccessPolicy; accessPolicy != nil {
+		policy.Start = accessPolicy.Start
+		policy.Expiry = accessPolicy.Expiry
+
+		if accessPolicy.Permission != nil {
+			policy.Permission = *accessPolicy.Permission
+		}
+	}
+
+	return policy
+}
+
+// sharedKeyAccessAllowed is whether requests can be authorized with the account keys, which Azure allows unless it is disabled
+func sharedKeyAccessAllowed(properties *armstorage.AccountProperties) bool {
+	return properties.AllowSharedKeyAccess == nil || *properties.AllowSharedKeyAccess
+}
+
+// parseSasExpirationPeriod parses the DD.HH:MM:SS format in which Azure sets the SAS expiration period
+func parseSasExpirationPeriod(period string) (time.Duration, error) {
+	days, clock, found := strings.Cut(period, ".")
+
+	if !found {
+		days, clock = "0", period
+	}
+
+	parts := strings.Split(clock, ":")
+	units := []time.Duration{time.Hour, time.Minute, time.Second}
+	parsedDays, err := strconv.Atoi(days)
+
+	if err != nil || len(parts) != len(units) {
+		return 0, fmt.Errorf("%s is not in the DD.HH:MM:SS format", period)
+	}
+
+	duration := time.Duration(parsedDays) * 24 * time.Hour
+
+	for i, part := range parts {
+		value, err := strconv.Atoi(part)
+
+		if err != nil {
+			return 0, fmt.Errorf("%s is not in the DD.HH:MM:SS format", period)
+		}
+
+		duration += time.Duration(value) * units[i]
+	}
+
+	return duration, nil
+}
+
+// getAccountKeyRotation reads the key expiration period and the creation time of both account keys, which Azure leaves unset on older accounts until the key is first rotated
+func getAccountKeyRotation(properties *armstorage.AccountProperties) (rotation AccountKeyRotation) {
+	if properties.KeyPolicy != nil && properties.KeyPolicy.KeyExpirationPeriodInDays != nil {
+		rotation.KeyExpirationPeriodInDays = int(*properties.KeyPolicy.KeyExpirationPeriodInDays)
+	}
+
+	var key1Created, key2Created *time.Time
+
+	if properties.KeyCreationTime != nil {
+		key1Created, key2Created = properties.KeyCreationTime.Key1, properties.KeyCreationTime.Key2
+	}
+
+	for _, key := range []AccountKeyAge{{Name: "key1", Created: key1Created}, {Name: "key2", Created: key2Created}} {
+		if key.Created != nil {
+			key.AgeDays = int(now().Sub(*key.Created).Hours() / 24)
+			key.NeverRotated = properties.CreationTime != nil && key.Created.Sub(*properties.CreationTime).Abs() < time.Minute
+		}
+
+		rotation.Keys = append(rotation.Keys, key)
+	}
+
+	return rotation
+}
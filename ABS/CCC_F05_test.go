@@ -0,0 +1,331 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_CCC_F05_TR01_T01(t *testing.T) {
+	maxSasLifetime = 24 * time.Hour
+
+	tests := []struct {
+		name            string
+		properties      armstorage.AccountProperties
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			name:            "shared key access disabled",
+			properties:      armstorage.AccountProperties{AllowSharedKeyAccess: to.Ptr(false)},
+			expectedPassed:  true,
+			expectedMessage: "Shared Key access is disabled for the storage account, so SAS tokens signed with the account keys are rejected.",
+		},
+		{
+			name:            "no SAS expiration policy",
+			properties:      armstorage.AccountProperties{AllowSharedKeyAccess: to.Ptr(true)},
+			expectedPassed:  false,
+			expectedMessage: "No SAS expiration policy is set, SAS tokens signed with the account keys can be valid for any length of time.",
+		},
+		{
+			name: "expiration period longer than the maximum",
+			properties: armstorage.AccountProperties{SasPolicy: &armstorage.SasPolicy{
+				SasExpirationPeriod: to.Ptr("7.00:00:00"),
+				ExpirationAction:    to.Ptr(armstorage.ExpirationActionBlock),
+			}},
+			expectedPassed:  false,
+			expectedMessage: "The SAS expiration policy allows SAS tokens to be valid for 168h0m0s, which is longer than the maximum SAS lifetime of 24h0m0s.",
+		},
+		{
+			name: "expired SAS tokens are only logged",
+			properties: armstorage.AccountProperties{SasPolicy: &armstorage.SasPolicy{
+				SasExpirationPeriod: to.Ptr("0.08:00:00"),
+				ExpirationAction:    to.Ptr(armstorage.ExpirationActionLog),
+			}},
+			expectedPassed:  false,
+			expectedMessage: "The SAS expiration policy limits SAS tokens to 8h0m0s, but its action is Log so longer-lived SAS tokens are only logged rather than blocked.",
+		},
+		{
+			name: "expired SAS tokens are blocked",
+			properties: armstorage.AccountProperties{SasPolicy: &armstorage.SasPolicy{
+				SasExpirationPeriod: to.Ptr("0.08:00:00"),
+				ExpirationAction:    to.Ptr(armstorage.ExpirationActionBlock),
+			}},
+			expectedPassed:  true,
+			expectedMessage: "The SAS expiration policy blocks SAS tokens which are valid for longer than 8h0m0s, within the maximum SAS lifetime of 24h0m0s.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			currentTarget.storageAccountResource = armstorage.Account{Properties: &tt.properties}
+
+			// Act
+			result := CCC_F05_TR01_T01()
+
+			// Assert
+			assert.Equal(t, tt.expectedPassed, result.Passed)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+		})
+	}
+}
+
+func Test_CCC_F05_TR01_T02(t *testing.T) {
+	maxKeyAgeDays = 90
+	accountCreated := time.Now().AddDate(0, 0, -365)
+	recentlyRotated := time.Now().AddDate(0, 0, -10)
+
+	tests := []struct {
+		name            string
+		properties      armstorage.AccountProperties
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			name:            "no key expiration period",
+			properties:      armstorage.AccountProperties{},
+			expectedPassed:  false,
+			expectedMessage: "No key expiration period is set, the account keys are never due to be rotated.",
+		},
+		{
+			name:            "key expiration period longer than the maximum key age",
+			properties:      armstorage.AccountProperties{KeyPolicy: &armstorage.KeyPolicy{KeyExpirationPeriodInDays: to.Ptr(int32(365))}},
+			expectedPassed:  false,
+			expectedMessage: "The key expiration period of 365 days is longer than the maximum key age of 90 days.",
+		},
+		{
+			name: "keys never rotated",
+			properties: armstorage.AccountProperties{
+				KeyPolicy:       &armstorage.KeyPolicy{KeyExpirationPeriodInDays: to.Ptr(int32(90))},
+				CreationTime:    to.Ptr(accountCreated),
+				KeyCreationTime: &armstorage.KeyCreationTime{Key1: to.Ptr(accountCreated), Key2: to.Ptr(recentlyRotated)},
+			},
+			expectedPassed:  false,
+			expectedMessage: "Account keys are older than the maximum key age of 90 days: key1 has never been rotated since the account was created 365 days ago.",
+		},
+		{
+			name: "key creation time unknown",
+			properties: armstorage.AccountProperties{
+				KeyPolicy:       &armstorage.KeyPolicy{KeyExpirationPeriodInDays: to.Ptr(int32(90))},
+				KeyCreationTime: &armstorage.KeyCreationTime{Key1: to.Ptr(recentlyRotated)},
+			},
+			expectedPassed:  false,
+			expectedMessage: "Account keys are older than the maximum key age of 90 days: key2 has never been rotated.",
+		},
+		{
+			name: "keys rotated within the maximum key age",
+			properties: armstorage.AccountProperties{
+				KeyPolicy:       &armstorage.KeyPolicy{KeyExpirationPeriodInDays: to.Ptr(int32(90))},
+				CreationTime:    to.Ptr(accountCreated),
+				KeyCreationTime: &armstorage.KeyCreationTime{Key1: to.Ptr(recentlyRotated), Key2: to.Ptr(recentlyRotated)},
+			},
+			expectedPassed:  true,
+			expectedMessage: "The key expiration period is 90 days and both account keys have been rotated within the maximum key age of 90 days.",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			currentTarget.storageAccountResource = armstorage.Account{Properties: &tt.properties}
+
+			// Act
+			result := CCC_F05_TR01_T02()
+
+			// Assert
+			assert.Equal(t, tt.expectedPassed, result.Passed)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+		})
+	}
+}
+
+func Test_CCC_F05_TR01_T02_judges_key_age_at_recording_time_when_replaying(t *testing.T) {
+	// Arrange
+	maxKeyAgeDays = 90
+
+	recordedAt := time.Now().AddDate(0, 0, -150)
+	activeCassette = &cassette{mode: cassetteReplaying, lastRecordedAt: recordedAt}
+	defer func() { activeCassette = nil }()
+
+	rotated := recordedAt.AddDate(0, 0, -10)
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		KeyPolicy:       &armstorage.KeyPolicy{KeyExpirationPeriodInDays: to.Ptr(int32(90))},
+		CreationTime:    to.Ptr(recordedAt.AddDate(0, 0, -365)),
+		KeyCreationTime: &armstorage.KeyCreationTime{Key1: to.Ptr(rotated), Key2: to.Ptr(rotated)},
+	}}
+
+	// Act
+	result := CCC_F05_TR01_T02()
+
+	// Assert
+	assert.Equal(t, true, result.Passed, result.Message)
+	assert.Equal(t, 10, result.Value.(AccountKeyRotation).Keys[0].AgeDays)
+}
+
+func Test_CCC_F05_TR01_T03_fails_with_long_lived_stored_access_policies(t *testing.T) {
+	// Arrange
+	maxSasLifetime = 24 * time.Hour
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{AllowSharedKeyAccess: to.Ptr(true)}}
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{{Name: "exports"}, {Name: "uploads"}},
+		storedAccessPolicies: map[string][]*container.SignedIdentifier{
+			"exports": {
+				{ID: to.Ptr("daily"), AccessPolicy: &container.AccessPolicy{Expiry: to.Ptr(time.Now().Add(12 * time.Hour)), Permission: to.Ptr("r")}},
+				{ID: to.Ptr("partner"), AccessPolicy: &container.AccessPolicy{Permission: to.Ptr("rl")}},
+			},
+			"uploads": {
+				{ID: to.Ptr("quarterly"), AccessPolicy: &container.AccessPolicy{Expiry: to.Ptr(time.Now().AddDate(0, 3, 0)), Permission: to.Ptr("w")}},
+			},
+		},
+	}
+
+	// Act
+	result := CCC_F05_TR01_T03()
+
+	// Assert
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Message, "exports/partner (no expiry), uploads/quarterly (valid for ")
+	assert.NotContains(t, result.Message, "daily")
+	assert.Len(t, result.Value, 3)
+}
+
+func Test_CCC_F05_TR01_T03_succeeds_with_short_lived_stored_access_policies(t *testing.T) {
+	// Arrange
+	maxSasLifetime = 24 * time.Hour
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{AllowSharedKeyAccess: to.Ptr(true)}}
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		containerInventory: []ContainerInventoryItem{{Name: "exports"}},
+		storedAccessPolicies: map[string][]*container.SignedIdentifier{
+			"exports": {{ID: to.Ptr("daily"), AccessPolicy: &container.AccessPolicy{Expiry: to.Ptr(time.Now().Add(12 * time.Hour)), Permission: to.Ptr("r")}}},
+		},
+	}
+
+	// Act
+	result := CCC_F05_TR01_T03()
+
+	// Assert
+	assert.True(t, result.Passed)
+	assert.Equal(t, "The 1 stored access policies of 1 containers limit SAS tokens to the maximum SAS lifetime of 24h0m0s.", result.Message)
+}
+
+// newUserDelegationCredential gets a user delegation credential from a stub of the blob service, as the SDK only creates them from its response
+func newUserDelegationCredential(t *testing.T) *service.UserDelegationCredential {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/xml")
+		fmt.Fprint(w, `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey><SignedOid>11111111-1111-1111-1111-111111111111</SignedOid><SignedTid>22222222-2222-2222-2222-222222222222</SignedTid><SignedStart>2026-10-17T00:00:00Z</SignedStart><SignedExpiry>2026-10-18T01:00:00Z</SignedExpiry><SignedService>b</SignedService><SignedVersion>2025-01-05</SignedVersion><Value>c2lnbmluZyBrZXk=</Value></UserDelegationKey>`)
+	}))
+	t.Cleanup(server.Close)
+
+	client, err := service.NewClientWithNoCredential(server.URL, nil)
+	assert.NoError(t, err)
+
+	credential, err := client.GetUserDelegationCredential(context.Background(), service.KeyInfo{Start: to.Ptr("2026-10-17T00:00:00Z"), Expiry: to.Ptr("2026-10-18T01:00:00Z")}, nil)
+	assert.NoError(t, err)
+
+	return credential
+}
+
+func Test_CCC_F05_TR01_T04(t *testing.T) {
+	tests := []struct {
+		name            string
+		responses       []*http.Response
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			name:            "longer-lived token is refused",
+			responses:       []*http.Response{newStorageErrorResponse(http.StatusOK, ""), newStorageErrorResponse(http.StatusForbidden, "AuthenticationFailed")},
+			expectedPassed:  true,
+			expectedMessage: "was refused (403 AuthenticationFailed), while a token within the maximum SAS lifetime of 24h0m0s was accepted.",
+		},
+		{
+			name:            "longer-lived token is accepted",
+			responses:       []*http.Response{newStorageErrorResponse(http.StatusOK, ""), newStorageErrorResponse(http.StatusOK, "")},
+			expectedMessage: "listed the test container, which is longer than the maximum SAS lifetime of 24h0m0s.",
+		},
+		{
+			name:            "token within the maximum SAS lifetime is refused",
+			responses:       []*http.Response{newStorageErrorResponse(http.StatusForbidden, "AuthorizationPermissionMismatch")},
+			expectedMessage: "A user delegation SAS token valid for 12h0m0s was refused (403 AuthorizationPermissionMismatch), so it could not be confirmed that longer-lived tokens are refused.",
+		},
+		{
+			name:            "unexpected response",
+			responses:       []*http.Response{newStorageErrorResponse(http.StatusOK, ""), newStorageErrorResponse(http.StatusInternalServerError, "InternalError")},
+			expectedMessage: "got an unexpected response (500 InternalError).",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			setupCleanupTest(t)
+			maxSasLifetime = 24 * time.Hour
+			currentTarget.storageAccountUri = "https://account.blob.core.windows.net/"
+
+			ArmoryAzureUtils = &azureUtilsMock{userDelegationCredential: newUserDelegationCredential(t)}
+			ArmoryCommonFunctions = &commonFunctionsMock{randomString: "abcdefgh", httpResponses: tt.responses}
+			blobContainersClient = &blobContainersClientMock{}
+
+			// Act
+			result := CCC_F05_TR01_T04()
+
+			// Assert
+			assert.Equal(t, tt.expectedPassed, result.Passed)
+			assert.Contains(t, result.Message, tt.expectedMessage)
+			assert.Empty(t, testArtifacts.artifacts)
+		})
+	}
+}
+
+func Test_CCC_F05_TR01_T04_fails_when_the_user_delegation_key_cannot_be_requested(t *testing.T) {
+	// Arrange
+	maxSasLifetime = 24 * time.Hour
+
+	ArmoryAzureUtils = &azureUtilsMock{
+		getUserDelegationCredentialError: errors.New("no role assignment"),
+	}
+
+	// Act
+	result := CCC_F05_TR01_T04()
+
+	// Assert
+	assert.False(t, result.Passed)
+	assert.Equal(t, "Could not request a user delegation key: no role assignment", result.Message)
+}
+
+func Test_parseSasExpirationPeriod(t *testing.T) {
+	tests := []struct {
+		name             string
+		period           string
+		expectedDuration time.Duration
+		expectedError    bool
+	}{
+		{name: "days and time", period: "1.12:30:00", expectedDuration: 36*time.Hour + 30*time.Minute},
+		{name: "time only", period: "08:00:00", expectedDuration: 8 * time.Hour},
+		{name: "not a period", period: "1 day", expectedError: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			duration, err := parseSasExpirationPeriod(tt.period)
+
+			// Assert
+			assert.Equal(t, tt.expectedError, err != nil)
+			assert.Equal(t, tt.expectedDuration, duration)
+		})
+	}
+}
@@ -1,22 +1,22 @@
 package abs
 
 import (
-	"context"
 	"crypto/tls"
 	"fmt"
-	"log"
 	"math/rand"
 	"net/http"
-	"regexp"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
-	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/azidentity"
 	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/managementgroups/armmanagementgroups"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/policyinsights/armpolicyinsights"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
@@ -24,7 +24,6 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
 
 	"github.com/privateerproj/privateer-sdk/pluginkit"
-	"github.com/privateerproj/privateer-sdk/utils"
 )
 
 var (
@@ -60,6 +59,7 @@ var (
 				CCC_C11_TR02,
 				CCC_C11_TR03,
 				CCC_C11_TR04,
+				CCC_F05_TR01,
 				CCC_ObjStor_C01_TR01,
 				CCC_ObjStor_C01_TR02,
 				CCC_ObjStor_C01_TR03,
@@ -171,6 +171,7 @@ var (
 				CCC_C11_TR02,
 				CCC_C11_TR03,
 				CCC_C11_TR04,
+				CCC_F05_TR01,
 				CCC_ObjStor_C01_TR01,
 				CCC_ObjStor_C01_TR02,
 				CCC_ObjStor_C01_TR03,
@@ -191,34 +192,60 @@ var (
 	}
 )
 
+const (
+	// defaultMaxKeyAgeDays is used when maxKeyAgeDays is not configured
+	defaultMaxKeyAgeDays = 90
+
+	// defaultMaxSasLifetime is used when maxSasLifetime is not configured
+	defaultMaxSasLifetime = 24 * time.Hour
+)
+
 var (
-	storageAccountResourceId          string
-	storageAccountUri                 string
-	token                             azcore.AccessToken
-	cred                              *azidentity.DefaultAzureCredential
-	storageAccountResource            armstorage.Account
-	storageAccountPropertiesTimestamp time.Time
-	resourceId                        struct {
-		subscriptionId     string
-		resourceGroupName  string
-		storageAccountName string
-	}
+	token          azcore.AccessToken
+	cred           azcore.TokenCredential
 	allowedRegions []string
 
+	// trustedKeyVaultKeys are the Key Vault key identifiers the organization trusts for encryption, a key without a version trusts every version of it
+	trustedKeyVaultKeys []string
+
+	// keyAdministrators are the principal IDs, besides the storage account's own identities, which are allowed access to customer-managed keys
+	keyAdministrators []string
+
+	// maxKeyAgeDays is the oldest a customer-managed key version in use, or an account access key, may be before it must have been rotated
+	maxKeyAgeDays int
+
+	// maxSasLifetime is the longest a shared access signature may be valid for
+	maxSasLifetime time.Duration
+
 	armstorageClient          accountsClientInterface
 	logsClient                *azquery.LogsClient
 	armMonitorClientFactory   *armmonitor.ClientFactory
 	diagnosticsSettingsClient *armmonitor.DiagnosticSettingsClient
-	blobServicesClient        *armstorage.BlobServicesClient
-	blobServiceProperties     *armstorage.BlobServiceProperties
+	blobServicesClient        blobServicesClientInterface
 	blobContainersClient      blobContainersClientInterface
+	encryptionScopesClient    encryptionScopesClientInterface
+	perimeterConfigsClient    perimeterConfigsClientInterface
 	defenderForStorageClient  defenderForStorageClientInterface
 	activityLogsClient        *armmonitor.ActivityLogsClient
 	roleAssignmentsClient     roleAssignmentsClientInterface
+	roleDefinitionsClient     roleDefinitionsClientInterface
+	permissionsClient         permissionsClientInterface
 	policyClient              policyClientInterface
 	storageSkusClient         storageSkuClientInterface
 	subscriptionsClient       subscriptionsClientInterface
 	vaultsClient              vaultsClientInterface
+	keyVaultsClient           keyVaultsClientInterface
+	managementGroupsClient    managementGroupsClientInterface
+
+	// Policy definitions are fetched when expanding the policy assignments of a storage account
+	policyDefinitionsClient    policyDefinitionsClientInterface
+	policySetDefinitionsClient policySetDefinitionsClientInterface
+
+	// Policy states show whether the storage account has been evaluated against, and is compliant with, its policies
+	policyStatesClient policyStatesClientInterface
+
+	// clientsSubscriptionId is the subscription the subscription-scoped clients above were created for
+	clientsSubscriptionId string
 
 	ArmoryCommonFunctions            CommonFunctions            = &commonFunctions{}
 	ArmoryAzureUtils                 AzureUtils                 = &azureUtils{}
@@ -229,148 +256,366 @@ var (
 )
 
 func Initialize() error {
-	// Parse resource ID
-	storageAccountResourceId = Armory.Config.GetString("storageaccountresourceid")
+	// Assess the storage accounts in exported snapshots, or those which Terraform plans and ARM templates would deploy,
+	//  without a credential or any requests to Azure
+	snapshotFiles := getConfigStringSlice("snapshotfiles")
+	terraformPlanFiles := getConfigStringSlice("terraformplanfiles")
+	armTemplateFiles := getConfigStringSlice("armtemplatefiles")
+	assessingSnapshots = len(snapshotFiles) > 0 || len(terraformPlanFiles) > 0 || len(armTemplateFiles) > 0
+
+	// The remediation file is only written by an assessment, which starts it once initialized
+	remediationFilePath = ""
 
-	if storageAccountResourceId == "" {
-		return fmt.Errorf("required variable storage account resource ID is not provided")
+	if assessingSnapshots {
+		return initializeFromSnapshots(snapshotFiles, terraformPlanFiles, armTemplateFiles)
 	}
 
-	re := regexp.MustCompile(`^/subscriptions/(?P<subscription>[0-9a-fA-F-]+)/resourceGroups/(?P<resourceGroup>[a-zA-Z0-9-_()]+)/providers/Microsoft\.Storage/storageAccounts/(?P<storageAccount>[a-z0-9]+)$`)
-	match := re.FindStringSubmatch(storageAccountResourceId)
+	// Collect the storage accounts to assess
+	storageAccountResourceIds := getConfigStringSlice("storageaccountresourceids")
 
-	if len(match) == 0 {
-		return fmt.Errorf("failed to parse storage account resource ID")
+	if storageAccountResourceId := Armory.Config.GetString("storageaccountresourceid"); storageAccountResourceId != "" {
+		storageAccountResourceIds = append([]string{storageAccountResourceId}, storageAccountResourceIds...)
 	}
 
-	resourceId.subscriptionId, resourceId.resourceGroupName, resourceId.storageAccountName = match[1], match[2], match[3]
+	resourceGroupIds := getConfigStringSlice("resourcegroupids")
+	subscriptionIds := getConfigStringSlice("subscriptionids")
+	managementGroupIds := getConfigStringSlice("managementgroupids")
+
+	if len(storageAccountResourceIds) == 0 && len(resourceGroupIds) == 0 && len(subscriptionIds) == 0 && len(managementGroupIds) == 0 {
+		return fmt.Errorf("required variable storage account resource ID is not provided, set storageAccountResourceId, storageAccountResourceIds, resourceGroupIds, subscriptionIds or managementGroupIds")
+	}
 
-	// Get an Azure credential
 	var err error
-	cred, err = azidentity.NewDefaultAzureCredential(nil)
+	discoveryFilter, err = newStorageAccountFilter(getConfigStringMap("tagfilters"), Armory.Config.GetString("namefilter"))
+
 	if err != nil {
-		return fmt.Errorf("failed to get Azure credential: %v", err)
+		return err
 	}
 
-	// Create an Azure resources client
-	armstorageClient, err = armstorage.NewAccountsClient(resourceId.subscriptionId, cred, nil)
+	// Record the requests made to Azure, or replay those recorded earlier
+	err = loadCassette()
+
 	if err != nil {
-		return fmt.Errorf("failed to create armstorage client: %v", err)
+		return err
 	}
 
-	// Set context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
-	defer cancel()
+	loadClientOptions()
 
-	// Get storage account resource
-	storageAccountResponse, err := armstorageClient.GetProperties(ctx, resourceId.resourceGroupName, resourceId.storageAccountName, &armstorage.AccountsClientGetPropertiesOptions{Expand: to.Ptr(armstorage.StorageAccountExpandGeoReplicationStats)})
+	// Get an Azure credential, no TestSet can run without one
+	if isReplaying() {
+		cred = replayCredential{principalId: activeCassette.PrincipalID}
+	} else if environmentCredential != nil {
+		cred = environmentCredential
+	} else {
+		cred, err = azidentity.NewDefaultAzureCredential(nil)
+		if err != nil {
+			return fmt.Errorf("failed to get Azure credential: %v", err)
+		}
+	}
 
-	storageAccountPropertiesTimestamp = time.Now()
+	// Get allowed regions from config
+	allowedRegions = getConfigStringSlice("allowedregions")
 
-	if err != nil {
-		// If the GetProperties fails, this may be due to geo-replication stats not being available,
-		//  instead try to get the storage account without the expand parameter
-		storageAccountResponse, err = armstorageClient.GetProperties(ctx, resourceId.resourceGroupName, resourceId.storageAccountName, nil)
+	// Get trusted Key Vault keys from config
+	trustedKeyVaultKeys = getConfigStringSlice("trustedkeyvaultkeys")
 
-		if err != nil {
-			return fmt.Errorf("failed to get storage account resource: %v", err)
-		}
+	// Get the principals allowed to access customer-managed keys from config
+	keyAdministrators = getConfigStringSlice("keyadministrators")
+
+	// Get the maximum key age from config
+	maxKeyAgeDays = Armory.Config.GetInt("maxkeyagedays")
+
+	if maxKeyAgeDays <= 0 {
+		maxKeyAgeDays = defaultMaxKeyAgeDays
 	}
 
-	storageAccountResource = storageAccountResponse.Account
-	storageAccountUri = *storageAccountResource.Properties.PrimaryEndpoints.Blob
+	// Get the maximum SAS lifetime from config
+	maxSasLifetime = defaultMaxSasLifetime
 
-	// Get allowed regions from config
-	allowedRegionsInterface, _ := Armory.Config.GetVar("allowedregions")
+	if value := Armory.Config.GetString("maxsaslifetime"); value != "" {
+		maxSasLifetime, err = time.ParseDuration(value)
 
-	for _, v := range allowedRegionsInterface.([]interface{}) {
-		allowedRegions = append(allowedRegions, v.(string))
+		if err != nil || maxSasLifetime <= 0 {
+			return fmt.Errorf("failed to parse maximum SAS lifetime %s, it must be a positive duration such as 8h", value)
+		}
 	}
 
-	// Get a logs client
-	logsClient, err = azquery.NewLogsClient(cred, nil)
+	// Get the TestSet timeouts from config
+	err = loadTimeouts()
 
 	if err != nil {
-		log.Fatalf("Failed to create Azure logs client: %v", err)
+		return err
 	}
 
-	// Get a diagnostic settings client
-	armMonitorClientFactory, err = armmonitor.NewClientFactory(resourceId.subscriptionId, cred, nil)
+	// Get the approved CIDRs for network rules from config
+	err = loadNetworkAllowlist()
 
 	if err != nil {
-		log.Fatalf("Failed to create Azure monitor client factory: %v", err)
+		return err
 	}
 
-	diagnosticsSettingsClient = armMonitorClientFactory.NewDiagnosticSettingsClient()
-	activityLogsClient = armMonitorClientFactory.NewActivityLogsClient()
-
-	// Get a blob services client
-	blobServicesClient, err = armstorage.NewBlobServicesClient(resourceId.subscriptionId, cred, nil)
+	// Get whether the runner is expected to be allowed or denied by the network rules from config
+	err = loadNetworkProbe()
 
 	if err != nil {
-		log.Fatalf("Failed to create blob services client with error: %v", err)
+		return err
 	}
 
-	// Get blob service properties
-	blobServicePropertiesResponse, err := blobServicesClient.GetServiceProperties(ctx, resourceId.resourceGroupName, resourceId.storageAccountName, nil)
+	// Artifacts left behind by an earlier run are deleted along with those created by this run, a replayed run only deletes those it recorded
+	if !isReplaying() {
+		err = loadCleanupLedger()
 
-	if err != nil {
-		log.Fatalf("Failed to get blob service properties for storage account with error: %v", err)
+		if err != nil {
+			return err
+		}
 	}
 
-	blobServiceProperties = &blobServicePropertiesResponse.BlobServiceProperties
+	// From here on failures are collected rather than returned, so that the TestSets which do not depend on the failed component still run
+	initErrors = nil
+	subscriptionInitErrors = make(map[string]initializationErrors)
+	clientsSubscriptionId = ""
 
-	// Get a blob containers client
-	blobContainersClient, err = armstorage.NewBlobContainersClient(resourceId.subscriptionId, cred, nil)
+	// Get a logs client
+	logsClient, err = azquery.NewLogsClient(cred, &azquery.LogsClientOptions{ClientOptions: clientOptions})
+	initErrors.add(componentLogsClient, "", err)
+
+	defenderForStorageClient, err = armsecurity.NewDefenderForStorageClient(cred, armClientOptions)
+	initErrors.add(componentDefenderForStorageClient, "", err)
+
+	subscriptionClientFactory, err := armsubscriptions.NewClientFactory(cred, armClientOptions)
 
 	if err != nil {
-		log.Fatalf("Failed to create blob containers client with error: %v", err)
+		initErrors.add(componentSubscriptionsClient, "", err)
+	} else {
+		subscriptionsClient = subscriptionClientFactory.NewClient()
 	}
 
-	defenderForStorageClient, err = armsecurity.NewDefenderForStorageClient(cred, nil)
+	managementGroupsClient, err = armmanagementgroups.NewClient(cred, armClientOptions)
+	initErrors.add(componentManagementGroupsClient, "", err)
 
-	if err != nil {
-		log.Fatalf("Error creating Defender for Storage client: %v", err)
+	roleDefinitionsClient, err = armauthorization.NewRoleDefinitionsClient(cred, armClientOptions)
+	initErrors.add(componentRoleDefinitionsClient, "", err)
+
+	policyStatesClient, err = armpolicyinsights.NewPolicyStatesClient(cred, armClientOptions)
+	initErrors.add(componentPolicyInsightsClient, "", err)
+
+	// Discover storage accounts in the requested resource groups, subscriptions and management groups
+	for _, managementGroupId := range managementGroupIds {
+		if failed := initErrors.forComponents(componentManagementGroupsClient); len(failed) > 0 {
+			initErrors.add(componentDiscovery, managementGroupId, failed)
+			continue
+		}
+
+		discoveredSubscriptionIds, err := discoverSubscriptionsInManagementGroup(managementGroupId)
+		initErrors.add(componentDiscovery, managementGroupId, err)
+
+		subscriptionIds = append(subscriptionIds, discoveredSubscriptionIds...)
 	}
 
-	// Get a client factory for azure authorization
-	roleAssignmentsClient, err = armauthorization.NewRoleAssignmentsClient(resourceId.subscriptionId, cred, nil)
+	for _, resourceGroupId := range resourceGroupIds {
+		discoveredIds, err := discoverStorageAccountsInResourceGroup(resourceGroupId)
+		initErrors.add(componentDiscovery, resourceGroupId, err)
+
+		storageAccountResourceIds = append(storageAccountResourceIds, discoveredIds...)
+	}
+
+	for _, subscriptionId := range subscriptionIds {
+		discoveredIds, err := discoverStorageAccountsInSubscription(subscriptionId)
+		initErrors.add(componentDiscovery, subscriptionId, err)
+
+		storageAccountResourceIds = append(storageAccountResourceIds, discoveredIds...)
+	}
+
+	// Load the properties of every storage account
+	targets = nil
+
+	for _, storageAccountResourceId := range storageAccountResourceIds {
+		if slices.ContainsFunc(targets, func(t *storageAccountTarget) bool {
+			return strings.EqualFold(t.storageAccountResourceId, storageAccountResourceId)
+		}) {
+			continue
+		}
+
+		target, err := newStorageAccountTarget(storageAccountResourceId)
+
+		if err != nil {
+			initErrors.add(componentDiscovery, storageAccountResourceId, err)
+			continue
+		}
+
+		activateTarget(target)
+		target.initErrors = target.loadProperties()
+
+		targets = append(targets, target)
+	}
+
+	logInitializationErrors()
+
+	if len(targets) == 0 {
+		if len(initErrors) > 0 {
+			return initErrors
+		}
+
+		return fmt.Errorf("no storage accounts were found to assess")
+	}
+
+	wrapTestSuites()
+	activateTarget(targets[0])
+
+	return nil
+}
+
+// wrapTestSuites wraps every TestSet in the TestSuites with the checks and behaviour shared by all TestSets
+func wrapTestSuites() {
+	// TestSets are marked as errored when a component they depend on failed to initialize, or they cannot be assessed from a snapshot,
+	//  have their Azure calls cancelled when they time out and the remediation of their failed tests written out, and when more than one
+	//  storage account, or any IaC resource, is assessed every TestSet is run once per account. The artifacts created by tests are deleted
+	//  once the last TestSet of the suite has run, or sooner if a TestSet panics
+	for testSuiteName, testSets := range Armory.TestSuites {
+		checkedTestSets := make([]pluginkit.TestSet, len(testSets))
+
+		for i, testSet := range testSets {
+			testSetName := getTestSetName(testSet)
+			checkedTestSets[i] = withInitializationCheck(testSet)
+
+			if assessingSnapshots {
+				checkedTestSets[i] = withSnapshotCheck(testSetName, checkedTestSets[i])
+			}
+
+			checkedTestSets[i] = withRemediationCode(withTimeout(testSetName, checkedTestSets[i]))
+
+			if len(targets) > 1 || targets[0].iacAddress != "" {
+				checkedTestSets[i] = forEachTarget(checkedTestSets[i])
+			}
+
+			checkedTestSets[i] = withCleanup(checkedTestSets[i], i == len(testSets)-1)
+		}
+
+		Armory.TestSuites[testSuiteName] = checkedTestSets
+	}
+}
+
+// setupSubscriptionClients creates the clients which are scoped to a single subscription, recording any failures against the subscription
+func setupSubscriptionClients(subscriptionId string) (errs initializationErrors) {
+	var err error
+	scope := "subscription " + subscriptionId
+
+	// Create an Azure resources client
+	armstorageClient, err = armstorage.NewAccountsClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentStorageAccountsClient, scope, err)
+
+	// Get a diagnostic settings client
+	armMonitorClientFactory, err = armmonitor.NewClientFactory(subscriptionId, cred, armClientOptions)
+
 	if err != nil {
-		log.Fatalf("Failed to create Azure role assignments client: %v", err)
+		errs.add(componentDiagnosticSettingsClient, scope, err)
+		errs.add(componentActivityLogsClient, scope, err)
+	} else {
+		diagnosticsSettingsClient = armMonitorClientFactory.NewDiagnosticSettingsClient()
+		activityLogsClient = armMonitorClientFactory.NewActivityLogsClient()
 	}
 
+	// Get a blob services client
+	blobServicesClient, err = armstorage.NewBlobServicesClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentBlobServicesClient, scope, err)
+
+	// Get a blob containers client
+	blobContainersClient, err = armstorage.NewBlobContainersClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentBlobContainersClient, scope, err)
+
+	// Get an encryption scopes client
+	encryptionScopesClient, err = armstorage.NewEncryptionScopesClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentEncryptionScopesClient, scope, err)
+
+	// Get a client for the Network Security Perimeter associations of storage accounts
+	perimeterConfigsClient, err = armstorage.NewNetworkSecurityPerimeterConfigurationsClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentPerimeterConfigsClient, scope, err)
+
+	// Get a client factory for azure authorization
+	roleAssignmentsClient, err = armauthorization.NewRoleAssignmentsClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentRoleAssignmentsClient, scope, err)
+
+	// Get a client for the effective permissions of the current identity
+	permissionsClient, err = armauthorization.NewPermissionsClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentPermissionsClient, scope, err)
+
 	// Get a client for Azure Policy
-	armPolicyClientFactory, err := armpolicy.NewClientFactory(resourceId.subscriptionId, cred, nil)
+	armPolicyClientFactory, err := armpolicy.NewClientFactory(subscriptionId, cred, armClientOptions)
 
 	if err != nil {
-		log.Fatalf("Could not get Azure Policy client: %v", err)
+		errs.add(componentPolicyClient, scope, err)
+	} else {
+		policyClient = armPolicyClientFactory.NewAssignmentsClient()
+		policyDefinitionsClient = armPolicyClientFactory.NewDefinitionsClient()
+		policySetDefinitionsClient = armPolicyClientFactory.NewSetDefinitionsClient()
 	}
 
-	policyClient = armPolicyClientFactory.NewAssignmentsClient()
+	storageSkusClient, err = armstorage.NewSKUsClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentStorageSkusClient, scope, err)
 
-	storageSkusClient, err = armstorage.NewSKUsClient(resourceId.subscriptionId, cred, nil)
+	recoveryServicesClientFactory, err := armrecoveryservices.NewClientFactory(subscriptionId, cred, armClientOptions)
 
 	if err != nil {
-		log.Fatalf("Could not get storage SKUs client: %v", err)
+		errs.add(componentVaultsClient, scope, err)
+	} else {
+		vaultsClient = recoveryServicesClientFactory.NewVaultsClient()
 	}
 
-	subscriptionClientFactory, err := armsubscriptions.NewClientFactory(cred, nil)
+	// Get a client for the Key Vaults holding customer-managed keys
+	keyVaultsClient, err = armkeyvault.NewVaultsClient(subscriptionId, cred, armClientOptions)
+	errs.add(componentKeyVaultsClient, scope, err)
 
-	if err != nil {
-		log.Fatalf("Could not get subscriptions client factory: %v", err)
+	clientsSubscriptionId = subscriptionId
+	subscriptionInitErrors[subscriptionId] = errs
+
+	return errs
+}
+
+// useSubscription switches the subscription-scoped clients to the given subscription, returning any failures to create them
+func useSubscription(subscriptionId string) initializationErrors {
+	if subscriptionId != clientsSubscriptionId {
+		return setupSubscriptionClients(subscriptionId)
 	}
 
-	subscriptionsClient = subscriptionClientFactory.NewClient()
+	return subscriptionInitErrors[subscriptionId]
+}
 
-	recoveryServicesClientFactory, err := armrecoveryservices.NewClientFactory(resourceId.subscriptionId, cred, nil)
+// getConfigStringSlice reads a list variable from the config, returning nil if it is not set
+func getConfigStringSlice(key string) (values []string) {
+	valuesInterface, _ := Armory.Config.GetVar(key)
 
-	if err != nil {
-		log.Fatalf("Could not get recovery services client factory: %v", err)
+	list, ok := valuesInterface.([]interface{})
+	if !ok {
+		return nil
 	}
 
-	vaultsClient = recoveryServicesClientFactory.NewVaultsClient()
+	for _, v := range list {
+		values = append(values, v.(string))
+	}
 
-	return nil
+	return values
+}
+
+// getConfigStringMap reads a map variable from the config, returning nil if it is not set
+func getConfigStringMap(key string) (values map[string]string) {
+	valuesInterface, _ := Armory.Config.GetVar(key)
+
+	valuesMap, ok := valuesInterface.(map[string]interface{})
+	if !ok {
+		return nil
+	}
+
+	values = make(map[string]string, len(valuesMap))
+
+	for k, v := range valuesMap {
+		if v == nil {
+			values[k] = ""
+		} else {
+			values[k] = fmt.Sprint(v)
+		}
+	}
+
+	return values
 }
 
 type CommonFunctions interface {
@@ -381,21 +626,25 @@ type CommonFunctions interface {
 type commonFunctions struct{}
 
 func (*commonFunctions) GenerateRandomString(n int) string {
+	if value, ok := activeCassette.replayRandomString(n); ok {
+		return value
+	}
+
 	const letters = "abcdefghijklmnopqrstuvwxyz"
 	r := rand.New(rand.NewSource(time.Now().UnixNano()))
 	b := make([]byte, n)
 	for i := range b {
 		b[i] = letters[r.Intn(len(letters))]
 	}
+
+	activeCassette.recordRandomString(string(b))
+
 	return string(b)
 }
 
 func (*commonFunctions) MakeGETRequest(endpoint string, token string, result *pluginkit.TestResult, minTlsVersion *int, maxTlsVersion *int) *http.Response {
-	// Add query parameters to request URL
-	endpoint = endpoint + "?comp=list"
-
 	// If specific TLS versions are provided, configure the TLS version
-	tlsConfig := &tls.Config{}
+	tlsConfig := &tls.Config{RootCAs: trustedRootCAs}
 	if minTlsVersion != nil {
 		tlsConfig.MinVersion = uint16(*minTlsVersion)
 	}
@@ -404,28 +653,14 @@ func (*commonFunctions) MakeGETRequest(endpoint string, token string, result *pl
 		tlsConfig.MaxVersion = uint16(*maxTlsVersion)
 	}
 
-	// Create an HTTP client with a timeout and the specified TLS configuration
-	client := &http.Client{
-		Timeout: 10 * time.Second,
-		Transport: &http.Transport{
-			TLSClientConfig: tlsConfig,
-		},
-	}
+	client := newStorageHTTPClient(tlsConfig)
 
-	// Create a new GET request
-	req, err := http.NewRequest("GET", endpoint, nil)
+	req, err := newListRequest(endpoint, token)
 	if err != nil {
 		SetResultFailure(result, "Request creation failed with error:"+err.Error())
 		return nil
 	}
 
-	// Set the required headers
-	req.Header.Set("x-ms-version", "2025-01-05")
-	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
-	if token != "" {
-		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
-	}
-
 	// Make the GET request
 	response, err := client.Do(req)
 	if err != nil {
@@ -437,6 +672,39 @@ func (*commonFunctions) MakeGETRequest(endpoint string, token string, result *pl
 	return response
 }
 
+// newStorageHTTPClient creates an HTTP client with a timeout and the specified TLS configuration, for requests made without the Azure SDK
+func newStorageHTTPClient(tlsConfig *tls.Config) *http.Client {
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: withCassetteRoundTripper(&http.Transport{
+			TLSClientConfig: tlsConfig,
+		}),
+	}
+}
+
+// newListRequest creates a request to list the containers, or other resources, of a service endpoint
+func newListRequest(endpoint string, token string) (*http.Request, error) {
+	// Add query parameters to request URL, after those the endpoint already has
+	separator := "?"
+	if strings.Contains(endpoint, "?") {
+		separator = "&"
+	}
+
+	req, err := http.NewRequestWithContext(testSetContext, "GET", endpoint+separator+"comp=list", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the required headers
+	req.Header.Set("x-ms-version", "2025-01-05")
+	req.Header.Set("x-ms-date", time.Now().UTC().Format(http.TimeFormat))
+	if token != "" {
+		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+	}
+
+	return req, nil
+}
+
 func SetResultFailure(result *pluginkit.TestResult, message string) {
 	result.Passed = false
 
@@ -462,153 +730,3 @@ func TestSetResultSetter(successMessage string, failureMessage string, result *p
 	result.Passed = true
 	result.Message = successMessage
 }
-
-// -----
-// TestSet and Tests for CCC_ObjStor_C01_TR01
-// -----
-
-func CCC_ObjStor_C01_TR01() (testSetName string, result pluginkit.TestSetResult) {
-	testSetName = "CCC_ObjStor_C01_TR01"
-	result = pluginkit.TestSetResult{
-		Passed:      false,
-		Description: "When a request is made to read a protected bucket, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
-		Message:     "TestSet has not yet started.",
-		DocsURL:     "https://maintainer.com/docs/raids/ABS",
-		ControlID:   "CCC.ObjStor.C01",
-		Tests:       make(map[string]pluginkit.TestResult),
-	}
-
-	result.ExecuteTest(CCC_ObjStor_C01_TR01_T01)
-
-	return
-}
-
-func CCC_ObjStor_C01_TR01_T01() (result pluginkit.TestResult) {
-	result = pluginkit.TestResult{
-		Description: "This test is still under construction",
-		Function:    utils.CallerPath(0),
-	}
-
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C01_TR01
-	return
-}
-
-// -----
-// TestSet and Tests for CCC_ObjStor_C01_TR02
-// -----
-
-func CCC_ObjStor_C01_TR02() (testSetName string, result pluginkit.TestSetResult) {
-	testSetName = "CCC_ObjStor_C01_TR02"
-	result = pluginkit.TestSetResult{
-		Passed:      false,
-		Description: "When a request is made to read a protected object, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
-		Message:     "TestSet has not yet started.",
-		DocsURL:     "https://maintainer.com/docs/raids/ABS",
-		ControlID:   "CCC.ObjStor.C01",
-		Tests:       make(map[string]pluginkit.TestResult),
-	}
-
-	result.ExecuteTest(CCC_ObjStor_C01_TR02_T01)
-
-	return
-}
-
-func CCC_ObjStor_C01_TR02_T01() (result pluginkit.TestResult) {
-	result = pluginkit.TestResult{
-		Description: "This test is still under construction",
-		Function:    utils.CallerPath(0),
-	}
-
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C01_TR02
-	return
-}
-
-// -----
-// TestSet and Tests for CCC_ObjStor_C01_TR03
-// -----
-
-func CCC_ObjStor_C01_TR03() (testSetName string, result pluginkit.TestSetResult) {
-	testSetName = "CCC_ObjStor_C01_TR03"
-	result = pluginkit.TestSetResult{
-		Passed:      false,
-		Description: "When a request is made to write to a bucket, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
-		Message:     "TestSet has not yet started.",
-		DocsURL:     "https://maintainer.com/docs/raids/ABS",
-		ControlID:   "CCC.ObjStor.C01",
-		Tests:       make(map[string]pluginkit.TestResult),
-	}
-
-	result.ExecuteTest(CCC_ObjStor_C01_TR03_T01)
-
-	return
-}
-
-func CCC_ObjStor_C01_TR03_T01() (result pluginkit.TestResult) {
-	result = pluginkit.TestResult{
-		Description: "This test is still under construction",
-		Function:    utils.CallerPath(0),
-	}
-
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C01_TR03
-	return
-}
-
-// -----
-// TestSet and Tests for CCC_ObjStor_C01_TR04
-// -----
-
-func CCC_ObjStor_C01_TR04() (testSetName string, result pluginkit.TestSetResult) {
-	testSetName = "CCC_ObjStor_C01_TR04"
-	result = pluginkit.TestSetResult{
-		Passed:      false,
-		Description: "When a request is made to write to an object, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
-		Message:     "TestSet has not yet started.",
-		DocsURL:     "https://maintainer.com/docs/raids/ABS",
-		ControlID:   "CCC.ObjStor.C01",
-		Tests:       make(map[string]pluginkit.TestResult),
-	}
-
-	result.ExecuteTest(CCC_ObjStor_C01_TR04_T01)
-
-	return
-}
-
-func CCC_ObjStor_C01_TR04_T01() (result pluginkit.TestResult) {
-	result = pluginkit.TestResult{
-		Description: "This test is still under construction",
-		Function:    utils.CallerPath(0),
-	}
-
-	// TODO: Use this section to write a single step or test that contributes to CCC_ObjStor_C01_TR04
-	return
-}
-
-// -----
-// TestSet and Tests for CCC_C11_TR04
-// -----
-
-func CCC_C11_TR04() (testSetName string, result pluginkit.TestSetResult) {
-	testSetName = "CCC_C11_TR04"
-	result = pluginkit.TestSetResult{
-		Passed:      false,
-		Description: "When encryption keys are accessed, the service MUST verify that access to encryption keys is restricted to authorized personnel and services, following the principle of least privilege.",
-		Message:     "TestSet has not yet started.",
-		DocsURL:     "https://maintainer.com/docs/raids/ABS",
-		ControlID:   "CCC.C11.TR04",
-		Tests:       make(map[string]pluginkit.TestResult),
-	}
-
-	result.ExecuteTest(CCC_C11_TR04_T01)
-
-	return
-}
-
-func CCC_C11_TR04_T01() (result pluginkit.TestResult) {
-	result = pluginkit.TestResult{
-		Description: "This test is still under construction",
-		Function:    utils.CallerPath(0),
-	}
-
-	// TODO: Use this section to write a single step or test that contributes to CCC_C11_TR04
-	return
-}
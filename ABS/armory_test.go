@@ -16,6 +16,10 @@ import (
 type commonFunctionsMock struct {
 	httpResponse *http.Response
 	randomString string
+	// anonResponse is returned instead of httpResponse for requests without a token, when set
+	anonResponse *http.Response
+	// httpResponses are returned in order before httpResponse, when set
+	httpResponses []*http.Response
 }
 
 func (mock *commonFunctionsMock) GenerateRandomString(length int) string {
@@ -23,6 +27,16 @@ func (mock *commonFunctionsMock) GenerateRandomString(length int) string {
 }
 
 func (mock *commonFunctionsMock) MakeGETRequest(endpoint string, token string, result *pluginkit.TestResult, minTlsVersion *int, maxTlsVersion *int) *http.Response {
+	if token == "" && mock.anonResponse != nil {
+		return mock.anonResponse
+	}
+
+	if len(mock.httpResponses) > 0 {
+		response := mock.httpResponses[0]
+		mock.httpResponses = mock.httpResponses[1:]
+		return response
+	}
+
 	if mock.httpResponse == nil {
 		SetResultFailure(result, "Mocked MakeGETRequest Error")
 	}
@@ -33,6 +47,8 @@ type storageAccountMock struct {
 	encryptionEnabled         bool
 	keySource                 armstorage.KeySource
 	keyVaultUri               string
+	keyName                   string
+	keyVersion                string
 	publicNetworkAccess       armstorage.PublicNetworkAccess
 	defaultAction             armstorage.DefaultAction
 	allowBlobPublicAccess     bool
@@ -69,6 +85,8 @@ func (mock *storageAccountMock) SetStorageAccount() armstorage.Account {
 				KeySource: (*armstorage.KeySource)(to.Ptr(mock.keySource)),
 				KeyVaultProperties: &armstorage.KeyVaultProperties{
 					KeyVaultURI: to.Ptr(mock.keyVaultUri),
+					KeyName:     to.Ptr(mock.keyName),
+					KeyVersion:  to.Ptr(mock.keyVersion),
 				},
 			},
 			ImmutableStorageWithVersioning: func() *armstorage.ImmutableStorageAccount {
@@ -152,3 +170,28 @@ func CreatePager[T any](listItems []T, err error) *runtime.Pager[T] {
 		Tracer: tracing.Tracer{},
 	})
 }
+
+// completedPollingHandler is a long-running operation that has already finished, failing with err if it is set
+type completedPollingHandler[T any] struct {
+	err error
+}
+
+func (handler completedPollingHandler[T]) Done() bool {
+	return true
+}
+
+func (handler completedPollingHandler[T]) Poll(ctx context.Context) (*http.Response, error) {
+	return nil, handler.err
+}
+
+func (handler completedPollingHandler[T]) Result(ctx context.Context, out *T) error {
+	return handler.err
+}
+
+func CreatePoller[T any](err error) *runtime.Poller[T] {
+	poller, _ := runtime.NewPoller(nil, runtime.Pipeline{}, &runtime.NewPollerOptions[T]{
+		Handler: completedPollingHandler[T]{err: err},
+	})
+
+	return poller
+}
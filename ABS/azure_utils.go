@@ -4,6 +4,7 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -11,19 +12,28 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
 	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
-	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/keyvault/armkeyvault"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/managementgroups/armmanagementgroups"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/policyinsights/armpolicyinsights"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/security/armsecurity"
 	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/Azure/azure-sdk-for-go/sdk/security/keyvault/azkeys"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/sas"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 )
@@ -33,10 +43,14 @@ type AzureUtils interface {
 	GetCurrentPrincipalID(result *pluginkit.TestResult) string
 	GetBlockBlobClient(blobUri string) (BlockBlobClientInterface, error)
 	GetBlobClient(blobUri string) (BlobClientInterface, error)
+	GetKeyVaultKeysClient(keyVaultUri string) (KeyVaultKeysClientInterface, error)
 	CreateContainerWithBlobContent(result *pluginkit.TestResult, blobBlockClient BlockBlobClientInterface, containerName string, blobName string, blobContent string) (BlockBlobClientInterface, bool)
 	DeleteTestContainer(result *pluginkit.TestResult, containerName string)
 	ConfirmLoggingToLogAnalyticsIsConfigured(resourceId string, diagnosticsClient DiagnosticSettingsClientInterface, result *pluginkit.TestResult)
 	GetImmutabilityConfiguration() ImmutabilityConfiguration
+	GetContainerInventory() ([]ContainerInventoryItem, error)
+	GetStoredAccessPolicies(containerName string) ([]*container.SignedIdentifier, error)
+	GetUserDelegationCredential(expiry time.Time) (*service.UserDelegationCredential, error)
 }
 
 type azureUtils struct{}
@@ -46,7 +60,7 @@ func (*azureUtils) GetToken(result *pluginkit.TestResult) string {
 
 		log.Default().Printf("Getting new access token")
 		var err error
-		token, err = cred.GetToken(context.Background(), policy.TokenRequestOptions{
+		token, err = cred.GetToken(testSetContext, policy.TokenRequestOptions{
 			Scopes: []string{"https://storage.azure.com/.default"},
 		})
 		if err != nil {
@@ -87,17 +101,51 @@ func (*azureUtils) GetCurrentPrincipalID(result *pluginkit.TestResult) string {
 }
 
 func (*azureUtils) GetBlockBlobClient(blobUri string) (BlockBlobClientInterface, error) {
-	return blockblob.NewClient(blobUri, cred, nil)
+	return blockblob.NewClient(blobUri, cred, &blockblob.ClientOptions{ClientOptions: clientOptions})
 }
 
 func (*azureUtils) GetBlobClient(blobUri string) (BlobClientInterface, error) {
-	return azblob.NewClient(blobUri, cred, nil)
+	return azblob.NewClient(blobUri, cred, &azblob.ClientOptions{ClientOptions: clientOptions})
+}
+
+func (*azureUtils) GetKeyVaultKeysClient(keyVaultUri string) (KeyVaultKeysClientInterface, error) {
+	return azkeys.NewClient(keyVaultUri, cred, &azkeys.ClientOptions{ClientOptions: clientOptions})
+}
+
+func (*azureUtils) GetStoredAccessPolicies(containerName string) ([]*container.SignedIdentifier, error) {
+	client, err := azblob.NewClient(currentTarget.storageAccountUri, cred, &azblob.ClientOptions{ClientOptions: clientOptions})
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.ServiceClient().NewContainerClient(containerName).GetAccessPolicy(testSetContext, nil)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the stored access policies of container %s: %v", containerName, err)
+	}
+
+	return response.SignedIdentifiers, nil
+}
+
+// GetUserDelegationCredential requests a user delegation key, which signs user delegation SAS tokens, valid from now until the expiry
+func (*azureUtils) GetUserDelegationCredential(expiry time.Time) (*service.UserDelegationCredential, error) {
+	client, err := service.NewClient(currentTarget.storageAccountUri, cred, &service.ClientOptions{ClientOptions: clientOptions})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return client.GetUserDelegationCredential(testSetContext, service.KeyInfo{
+		Start:  to.Ptr(time.Now().UTC().Format(sas.TimeFormat)),
+		Expiry: to.Ptr(expiry.UTC().Format(sas.TimeFormat)),
+	}, nil)
 }
 
 func (*azureUtils) CreateContainerWithBlobContent(result *pluginkit.TestResult, blobBlockClient BlockBlobClientInterface, containerName string, blobName string, blobContent string) (BlockBlobClientInterface, bool) {
-	_, err := blobContainersClient.Create(context.Background(),
-		resourceId.resourceGroupName,
-		resourceId.storageAccountName,
+	_, err := blobContainersClient.Create(testSetContext,
+		currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
 		containerName,
 		armstorage.BlobContainer{
 			ContainerProperties: &armstorage.ContainerProperties{},
@@ -110,7 +158,9 @@ func (*azureUtils) CreateContainerWithBlobContent(result *pluginkit.TestResult,
 		return nil, false
 	}
 
-	_, uploadBlobFailedError := blobBlockClient.UploadStream(context.Background(), strings.NewReader(blobContent), nil)
+	trackArtifact(artifactContainer, containerName)
+
+	_, uploadBlobFailedError := blobBlockClient.UploadStream(testSetContext, strings.NewReader(blobContent), nil)
 
 	if uploadBlobFailedError != nil {
 		SetResultFailure(result, fmt.Sprintf("Failed to upload blob with error: %v", uploadBlobFailedError))
@@ -121,9 +171,12 @@ func (*azureUtils) CreateContainerWithBlobContent(result *pluginkit.TestResult,
 }
 
 func (*azureUtils) DeleteTestContainer(result *pluginkit.TestResult, containerName string) {
-	_, deleteContainerFailedError := blobContainersClient.Delete(context.Background(),
-		resourceId.resourceGroupName,
-		resourceId.storageAccountName,
+	cleanupContext, cancel := newCleanupContext()
+	defer cancel()
+
+	_, deleteContainerFailedError := blobContainersClient.Delete(cleanupContext,
+		currentTarget.resourceId.resourceGroupName,
+		currentTarget.resourceId.storageAccountName,
 		containerName,
 		nil,
 	)
@@ -132,13 +185,15 @@ func (*azureUtils) DeleteTestContainer(result *pluginkit.TestResult, containerNa
 		SetResultFailure(result, fmt.Sprintf("Failed to delete blob container with error: %v", deleteContainerFailedError))
 		return
 	}
+
+	releaseArtifact(artifactContainer, containerName)
 }
 
 func (*azureUtils) ConfirmLoggingToLogAnalyticsIsConfigured(resourceId string, diagnosticsClient DiagnosticSettingsClientInterface, result *pluginkit.TestResult) {
 	pager := diagnosticsClient.NewListPager(resourceId, nil)
 
 	for pager.More() {
-		page, err := pager.NextPage(context.Background())
+		page, err := pager.NextPage(testSetContext)
 
 		if err != nil {
 			SetResultFailure(result, fmt.Sprintf("Could not find diagnostic setting: %v", err))
@@ -201,29 +256,43 @@ func (*azureUtils) ConfirmLoggingToLogAnalyticsIsConfigured(resourceId string, d
 }
 
 func (*azureUtils) GetImmutabilityConfiguration() ImmutabilityConfiguration {
-	if storageAccountResource.Properties.ImmutableStorageWithVersioning == nil {
+	if currentTarget.storageAccountResource.Properties.ImmutableStorageWithVersioning == nil {
 		return ImmutabilityConfiguration{Enabled: false}
 	}
 
-	if !*storageAccountResource.Properties.ImmutableStorageWithVersioning.Enabled {
+	if !*currentTarget.storageAccountResource.Properties.ImmutableStorageWithVersioning.Enabled {
 		return ImmutabilityConfiguration{Enabled: false}
 	}
 
-	if storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy == nil {
+	if currentTarget.storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy == nil {
 		return ImmutabilityConfiguration{Enabled: true}
 	}
 
 	return ImmutabilityConfiguration{
 		Enabled:                     true,
-		PolicyState:                 storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy.State,
-		PolicyRetentionPeriodInDays: storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy.ImmutabilityPeriodSinceCreationInDays,
+		PolicyState:                 currentTarget.storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy.State,
+		PolicyRetentionPeriodInDays: currentTarget.storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy.ImmutabilityPeriodSinceCreationInDays,
+	}
+}
+
+// getErrorCode returns the Azure error code of a failed request, or the error itself when there was no response, such as when the request was cancelled
+func getErrorCode(err error) string {
+	var responseError *azcore.ResponseError
+
+	if errors.As(err, &responseError) {
+		return responseError.ErrorCode
 	}
+
+	return err.Error()
 }
 
 type ImmutabilityConfiguration struct {
 	Enabled                     bool
 	PolicyState                 *armstorage.AccountImmutabilityPolicyState
 	PolicyRetentionPeriodInDays *int32
+	// Containers are only inventoried when the account-level immutability is not enough, as each container can have its own
+	Containers              []ContainerInventoryItem
+	ContainerInventoryError string
 }
 
 type logAnalyticsWorkspace struct {
@@ -238,8 +307,16 @@ type logAnalyticsWorkspace struct {
 type accountsClientInterface interface {
 	RegenerateKey(ctx context.Context, resourceGroupName string, accountName string, regenerateKey armstorage.AccountRegenerateKeyParameters, options *armstorage.AccountsClientRegenerateKeyOptions) (armstorage.AccountsClientRegenerateKeyResponse, error)
 	GetProperties(ctx context.Context, resourceGroupName string, accountName string, options *armstorage.AccountsClientGetPropertiesOptions) (armstorage.AccountsClientGetPropertiesResponse, error)
+	Update(ctx context.Context, resourceGroupName string, accountName string, parameters armstorage.AccountUpdateParameters, options *armstorage.AccountsClientUpdateOptions) (armstorage.AccountsClientUpdateResponse, error)
 	BeginCreate(ctx context.Context, resourceGroupName string, accountName string, parameters armstorage.AccountCreateParameters, options *armstorage.AccountsClientBeginCreateOptions) (*runtime.Poller[armstorage.AccountsClientCreateResponse], error)
 	Delete(ctx context.Context, resourceGroupName string, accountName string, options *armstorage.AccountsClientDeleteOptions) (armstorage.AccountsClientDeleteResponse, error)
+	NewListByResourceGroupPager(resourceGroupName string, options *armstorage.AccountsClientListByResourceGroupOptions) *runtime.Pager[armstorage.AccountsClientListByResourceGroupResponse]
+	NewListPager(options *armstorage.AccountsClientListOptions) *runtime.Pager[armstorage.AccountsClientListResponse]
+}
+
+type blobServicesClientInterface interface {
+	GetServiceProperties(ctx context.Context, resourceGroupName string, accountName string, options *armstorage.BlobServicesClientGetServicePropertiesOptions) (armstorage.BlobServicesClientGetServicePropertiesResponse, error)
+	SetServiceProperties(ctx context.Context, resourceGroupName string, accountName string, parameters armstorage.BlobServiceProperties, options *armstorage.BlobServicesClientSetServicePropertiesOptions) (armstorage.BlobServicesClientSetServicePropertiesResponse, error)
 }
 
 type DiagnosticSettingsClientInterface interface {
@@ -256,6 +333,11 @@ type BlockBlobClientInterface interface {
 	Undelete(ctx context.Context, options *blob.UndeleteOptions) (blob.UndeleteResponse, error)
 }
 
+type KeyVaultKeysClientInterface interface {
+	NewListKeyPropertiesVersionsPager(name string, options *azkeys.ListKeyPropertiesVersionsOptions) *runtime.Pager[azkeys.ListKeyPropertiesVersionsResponse]
+	GetKeyRotationPolicy(ctx context.Context, name string, options *azkeys.GetKeyRotationPolicyOptions) (azkeys.GetKeyRotationPolicyResponse, error)
+}
+
 type BlobClientInterface interface {
 	NewListBlobsFlatPager(containerName string, options *azblob.ListBlobsFlatOptions) *runtime.Pager[azblob.ListBlobsFlatResponse]
 }
@@ -266,6 +348,14 @@ type blobContainersClientInterface interface {
 	NewListPager(resourceGroupName string, accountName string, options *armstorage.BlobContainersClientListOptions) *runtime.Pager[armstorage.BlobContainersClientListResponse]
 }
 
+type perimeterConfigsClientInterface interface {
+	NewListPager(resourceGroupName string, accountName string, options *armstorage.NetworkSecurityPerimeterConfigurationsClientListOptions) *runtime.Pager[armstorage.NetworkSecurityPerimeterConfigurationsClientListResponse]
+}
+
+type encryptionScopesClientInterface interface {
+	NewListPager(resourceGroupName string, accountName string, options *armstorage.EncryptionScopesClientListOptions) *runtime.Pager[armstorage.EncryptionScopesClientListResponse]
+}
+
 type defenderForStorageClientInterface interface {
 	Get(context.Context, string, armsecurity.SettingName, *armsecurity.DefenderForStorageClientGetOptions) (armsecurity.DefenderForStorageClientGetResponse, error)
 }
@@ -273,12 +363,38 @@ type defenderForStorageClientInterface interface {
 type roleAssignmentsClientInterface interface {
 	Create(ctx context.Context, scope string, roleAssignmentName string, parameters armauthorization.RoleAssignmentCreateParameters, options *armauthorization.RoleAssignmentsClientCreateOptions) (armauthorization.RoleAssignmentsClientCreateResponse, error)
 	Delete(ctx context.Context, scope string, roleAssignmentName string, options *armauthorization.RoleAssignmentsClientDeleteOptions) (armauthorization.RoleAssignmentsClientDeleteResponse, error)
+	NewListForScopePager(scope string, options *armauthorization.RoleAssignmentsClientListForScopeOptions) *runtime.Pager[armauthorization.RoleAssignmentsClientListForScopeResponse]
+}
+
+type roleDefinitionsClientInterface interface {
+	GetByID(ctx context.Context, roleID string, options *armauthorization.RoleDefinitionsClientGetByIDOptions) (armauthorization.RoleDefinitionsClientGetByIDResponse, error)
+}
+
+type permissionsClientInterface interface {
+	NewListForResourcePager(resourceGroupName string, resourceProviderNamespace string, parentResourcePath string, resourceType string, resourceName string, options *armauthorization.PermissionsClientListForResourceOptions) *runtime.Pager[armauthorization.PermissionsClientListForResourceResponse]
+	NewListForResourceGroupPager(resourceGroupName string, options *armauthorization.PermissionsClientListForResourceGroupOptions) *runtime.Pager[armauthorization.PermissionsClientListForResourceGroupResponse]
 }
 
 type policyClientInterface interface {
 	NewListForResourcePager(resourceGroupName string, namespace string, policySetDefinitionName string, resourceType string, resourceName string, options *armpolicy.AssignmentsClientListForResourceOptions) *runtime.Pager[armpolicy.AssignmentsClientListForResourceResponse]
 }
 
+type policyDefinitionsClientInterface interface {
+	Get(ctx context.Context, policyDefinitionName string, options *armpolicy.DefinitionsClientGetOptions) (armpolicy.DefinitionsClientGetResponse, error)
+	GetBuiltIn(ctx context.Context, policyDefinitionName string, options *armpolicy.DefinitionsClientGetBuiltInOptions) (armpolicy.DefinitionsClientGetBuiltInResponse, error)
+	GetAtManagementGroup(ctx context.Context, policyDefinitionName string, managementGroupID string, options *armpolicy.DefinitionsClientGetAtManagementGroupOptions) (armpolicy.DefinitionsClientGetAtManagementGroupResponse, error)
+}
+
+type policySetDefinitionsClientInterface interface {
+	Get(ctx context.Context, policySetDefinitionName string, options *armpolicy.SetDefinitionsClientGetOptions) (armpolicy.SetDefinitionsClientGetResponse, error)
+	GetBuiltIn(ctx context.Context, policySetDefinitionName string, options *armpolicy.SetDefinitionsClientGetBuiltInOptions) (armpolicy.SetDefinitionsClientGetBuiltInResponse, error)
+	GetAtManagementGroup(ctx context.Context, policySetDefinitionName string, managementGroupID string, options *armpolicy.SetDefinitionsClientGetAtManagementGroupOptions) (armpolicy.SetDefinitionsClientGetAtManagementGroupResponse, error)
+}
+
+type policyStatesClientInterface interface {
+	NewListQueryResultsForResourcePager(policyStatesResource armpolicyinsights.PolicyStatesResource, resourceID string, queryOptions *armpolicyinsights.QueryOptions, options *armpolicyinsights.PolicyStatesClientListQueryResultsForResourceOptions) *runtime.Pager[armpolicyinsights.PolicyStatesClientListQueryResultsForResourceResponse]
+}
+
 type storageSkuClientInterface interface {
 	NewListPager(options *armstorage.SKUsClientListOptions) *runtime.Pager[armstorage.SKUsClientListResponse]
 }
@@ -287,7 +403,16 @@ type subscriptionsClientInterface interface {
 	NewListLocationsPager(subscriptionID string, options *armsubscriptions.ClientListLocationsOptions) *runtime.Pager[armsubscriptions.ClientListLocationsResponse]
 }
 
+type managementGroupsClientInterface interface {
+	NewGetDescendantsPager(groupID string, options *armmanagementgroups.ClientGetDescendantsOptions) *runtime.Pager[armmanagementgroups.ClientGetDescendantsResponse]
+}
+
+type keyVaultsClientInterface interface {
+	NewListBySubscriptionPager(options *armkeyvault.VaultsClientListBySubscriptionOptions) *runtime.Pager[armkeyvault.VaultsClientListBySubscriptionResponse]
+}
+
 type vaultsClientInterface interface {
 	BeginCreateOrUpdate(ctx context.Context, resourceGroupName string, vaultName string, vault armrecoveryservices.Vault, options *armrecoveryservices.VaultsClientBeginCreateOrUpdateOptions) (*runtime.Poller[armrecoveryservices.VaultsClientCreateOrUpdateResponse], error)
 	Delete(ctx context.Context, resourceGroupName string, vaultName string, options *armrecoveryservices.VaultsClientDeleteOptions) (armrecoveryservices.VaultsClientDeleteResponse, error)
+	NewListByResourceGroupPager(resourceGroupName string, options *armrecoveryservices.VaultsClientListByResourceGroupOptions) *runtime.Pager[armrecoveryservices.VaultsClientListByResourceGroupResponse]
 }
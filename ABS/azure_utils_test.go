@@ -5,6 +5,7 @@ import (
 	"io"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
 	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
@@ -15,6 +16,7 @@ import (
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/blockblob"
 	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/container"
+	"github.com/Azure/azure-sdk-for-go/sdk/storage/azblob/service"
 	"github.com/privateerproj/privateer-sdk/pluginkit"
 	"github.com/stretchr/testify/assert"
 )
@@ -27,7 +29,27 @@ type azureUtilsMock struct {
 	blobBlockClient                                BlockBlobClientInterface
 	blobClient                                     BlobClientInterface
 	getBlobClientError                             error
+	keyVaultKeysClient                             KeyVaultKeysClientInterface
+	getKeyVaultKeysClientError                     error
 	confirmLoggingToLogAnalyticsIsConfiguredResult bool
+	containerInventory                             []ContainerInventoryItem
+	getContainerInventoryError                     error
+	storedAccessPolicies                           map[string][]*container.SignedIdentifier
+	getStoredAccessPoliciesError                   error
+	userDelegationCredential                       *service.UserDelegationCredential
+	getUserDelegationCredentialError               error
+}
+
+func (mock *azureUtilsMock) GetContainerInventory() ([]ContainerInventoryItem, error) {
+	return mock.containerInventory, mock.getContainerInventoryError
+}
+
+func (mock *azureUtilsMock) GetStoredAccessPolicies(containerName string) ([]*container.SignedIdentifier, error) {
+	return mock.storedAccessPolicies[containerName], mock.getStoredAccessPoliciesError
+}
+
+func (mock *azureUtilsMock) GetUserDelegationCredential(expiry time.Time) (*service.UserDelegationCredential, error) {
+	return mock.userDelegationCredential, mock.getUserDelegationCredentialError
 }
 
 func (mock *azureUtilsMock) ConfirmLoggingToLogAnalyticsIsConfigured(storageAccountBlobResourceId string, diagnosticsClient DiagnosticSettingsClientInterface, result *pluginkit.TestResult) {
@@ -60,9 +82,19 @@ func (mock *azureUtilsMock) GetBlobClient(storageAccountUri string) (BlobClientI
 	return mock.blobClient, mock.getBlobClientError
 }
 
+func (mock *azureUtilsMock) GetKeyVaultKeysClient(keyVaultUri string) (KeyVaultKeysClientInterface, error) {
+	return mock.keyVaultKeysClient, mock.getKeyVaultKeysClientError
+}
+
 type mockAccountsClient struct {
-	regenerateKeyError error
-	deleteError        error
+	regenerateKeyError    error
+	deleteError           error
+	getPropertiesResponse armstorage.AccountsClientGetPropertiesResponse
+	getPropertiesError    error
+	accounts              []*armstorage.Account
+	listError             error
+	pollError             error
+	updateError           error
 }
 
 func (mock *mockAccountsClient) RegenerateKey(ctx context.Context, resourceGroupName string, accountName string, regenerateKey armstorage.AccountRegenerateKeyParameters, options *armstorage.AccountsClientRegenerateKeyOptions) (armstorage.AccountsClientRegenerateKeyResponse, error) {
@@ -70,14 +102,18 @@ func (mock *mockAccountsClient) RegenerateKey(ctx context.Context, resourceGroup
 }
 
 func (mock *mockAccountsClient) GetProperties(ctx context.Context, resourceGroupName string, accountName string, options *armstorage.AccountsClientGetPropertiesOptions) (armstorage.AccountsClientGetPropertiesResponse, error) {
-	return armstorage.AccountsClientGetPropertiesResponse{}, nil
+	return mock.getPropertiesResponse, mock.getPropertiesError
+}
+
+func (mock *mockAccountsClient) Update(ctx context.Context, resourceGroupName string, accountName string, parameters armstorage.AccountUpdateParameters, options *armstorage.AccountsClientUpdateOptions) (armstorage.AccountsClientUpdateResponse, error) {
+	return armstorage.AccountsClientUpdateResponse{}, mock.updateError
 }
 
 func (mock *mockAccountsClient) BeginCreate(ctx context.Context, resourceGroupName string, accountName string, parameters armstorage.AccountCreateParameters, options *armstorage.AccountsClientBeginCreateOptions) (*runtime.Poller[armstorage.AccountsClientCreateResponse], error) {
 	if strings.Contains(*parameters.Location, "restrictedRegion") {
 		return nil, &azcore.ResponseError{ErrorCode: "AnError"}
 	} else {
-		return nil, nil
+		return CreatePoller[armstorage.AccountsClientCreateResponse](mock.pollError), nil
 	}
 }
 
@@ -85,6 +121,44 @@ func (mock *mockAccountsClient) Delete(ctx context.Context, resourceGroupName st
 	return armstorage.AccountsClientDeleteResponse{}, mock.deleteError
 }
 
+func (mock *mockAccountsClient) NewListByResourceGroupPager(resourceGroupName string, options *armstorage.AccountsClientListByResourceGroupOptions) *runtime.Pager[armstorage.AccountsClientListByResourceGroupResponse] {
+	accountsPages := []armstorage.AccountsClientListByResourceGroupResponse{
+		{
+			AccountListResult: armstorage.AccountListResult{
+				Value: mock.accounts,
+			},
+		},
+	}
+
+	return CreatePager(accountsPages, mock.listError)
+}
+
+func (mock *mockAccountsClient) NewListPager(options *armstorage.AccountsClientListOptions) *runtime.Pager[armstorage.AccountsClientListResponse] {
+	accountsPages := []armstorage.AccountsClientListResponse{
+		{
+			AccountListResult: armstorage.AccountListResult{
+				Value: mock.accounts,
+			},
+		},
+	}
+
+	return CreatePager(accountsPages, mock.listError)
+}
+
+type mockBlobServicesClient struct {
+	blobServiceProperties armstorage.BlobServiceProperties
+	getPropertiesError    error
+	setPropertiesError    error
+}
+
+func (mock *mockBlobServicesClient) GetServiceProperties(ctx context.Context, resourceGroupName string, accountName string, options *armstorage.BlobServicesClientGetServicePropertiesOptions) (armstorage.BlobServicesClientGetServicePropertiesResponse, error) {
+	return armstorage.BlobServicesClientGetServicePropertiesResponse{BlobServiceProperties: mock.blobServiceProperties}, mock.getPropertiesError
+}
+
+func (mock *mockBlobServicesClient) SetServiceProperties(ctx context.Context, resourceGroupName string, accountName string, parameters armstorage.BlobServiceProperties, options *armstorage.BlobServicesClientSetServicePropertiesOptions) (armstorage.BlobServicesClientSetServicePropertiesResponse, error) {
+	return armstorage.BlobServicesClientSetServicePropertiesResponse{}, mock.setPropertiesError
+}
+
 type blobContainersClientMock struct {
 	createResponse armstorage.BlobContainersClientCreateResponse
 	createError    error
@@ -0,0 +1,504 @@
+package abs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+)
+
+type cassetteMode int
+
+const (
+	cassetteRecording cassetteMode = iota + 1
+	cassetteReplaying
+)
+
+const scrubbedValue = "REDACTED"
+
+var (
+	// activeCassette records or replays the HTTP interactions of the run, it is nil when neither is configured
+	activeCassette *cassette
+
+	// scrubbedHeaders carry credentials, their values are never written to a cassette
+	scrubbedHeaders = []string{"Authorization", "Cookie", "Set-Cookie", "x-ms-copy-source-authorization"}
+
+	// scrubbedFields are the JSON properties holding keys, tokens and secrets, in request and response bodies
+	scrubbedFields = []string{"accessToken", "access_token", "refresh_token", "id_token", "primaryKey", "secondaryKey", "connectionString", "password", "secret", "sasToken", "accountKey"}
+
+	// userDelegationKeyRegex matches the elements of a user delegation key which would let anyone holding the cassette sign SAS tokens until the key expires
+	userDelegationKeyRegex = regexp.MustCompile(`(<(?:Value|SignedOid)>)[^<]*(</)`)
+
+	// sasSignatureRegex matches the signature of a shared access signature in a URL
+	sasSignatureRegex = regexp.MustCompile(`([?&]sig=)[^&]*`)
+
+	// generatedNameRegex matches the parts of request paths which differ on every run, the names of test artifacts and generated GUIDs
+	generatedNameRegex = regexp.MustCompile(`(?i)(privateer-test-[a-z]+-|privateertest)[a-z0-9]+|[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}`)
+)
+
+// cassette is a recording of the HTTP interactions of an assessment, which can be replayed to repeat the assessment offline
+type cassette struct {
+	// PrincipalID is the object ID of the identity that made the recorded requests, replayed tokens identify as it
+	PrincipalID string `json:"principalId,omitempty"`
+	// RandomStrings are those generated for the names of test artifacts, which are generated again in the same order when replaying
+	RandomStrings []string       `json:"randomStrings,omitempty"`
+	Interactions  []*interaction `json:"interactions"`
+
+	mode     cassetteMode
+	filePath string
+	mutex    sync.Mutex
+	// replayed marks the interactions which have already been replayed, each is replayed once in the order it was recorded
+	replayed []bool
+	// lastRecordedAt is when the most recently replayed interaction was recorded
+	lastRecordedAt time.Time
+	// replayedRandomStrings is how many of the random strings have been generated again
+	replayedRandomStrings int
+}
+
+type interaction struct {
+	RecordedAt time.Time         `json:"recordedAt"`
+	Request    recordedRequest   `json:"request"`
+	Response   *recordedResponse `json:"response,omitempty"`
+	// Error is why the request failed without a response, such as a TLS handshake failure
+	Error string `json:"error,omitempty"`
+}
+
+type recordedRequest struct {
+	Method  string      `json:"method"`
+	URL     string      `json:"url"`
+	Headers http.Header `json:"headers,omitempty"`
+	Body    string      `json:"body,omitempty"`
+}
+
+type recordedResponse struct {
+	Status     string      `json:"status"`
+	StatusCode int         `json:"statusCode"`
+	Headers    http.Header `json:"headers,omitempty"`
+	Body       string      `json:"body,omitempty"`
+	// TLSVersion is the version of the connection the response was received over, zero when it was not received over TLS
+	TLSVersion uint16 `json:"tlsVersion,omitempty"`
+
+	// TLSCipherSuite and TLSCertificates are the negotiated cipher suite and the DER encoded certificates the server presented
+	TLSCipherSuite  uint16   `json:"tlsCipherSuite,omitempty"`
+	TLSCertificates [][]byte `json:"tlsCertificates,omitempty"`
+}
+
+// loadCassette starts recording to, or replaying from, the cassette file in the config
+func loadCassette() error {
+	activeCassette = nil
+
+	recordPath := Armory.Config.GetString("recordcassette")
+	replayPath := Armory.Config.GetString("replaycassette")
+
+	switch {
+	case recordPath != "" && replayPath != "":
+		return fmt.Errorf("recordCassette and replayCassette cannot both be set")
+	case recordPath != "":
+		activeCassette = &cassette{mode: cassetteRecording, filePath: recordPath}
+		log.Printf("Recording Azure requests to cassette %s", recordPath)
+	case replayPath != "":
+		recording, err := os.ReadFile(replayPath)
+
+		if err != nil {
+			return fmt.Errorf("failed to read cassette %s: %v", replayPath, err)
+		}
+
+		activeCassette = &cassette{mode: cassetteReplaying, filePath: replayPath}
+
+		if err := json.Unmarshal(recording, activeCassette); err != nil {
+			return fmt.Errorf("failed to parse cassette %s: %v", replayPath, err)
+		}
+
+		activeCassette.replayed = make([]bool, len(activeCassette.Interactions))
+		log.Printf("Replaying %d Azure requests from cassette %s", len(activeCassette.Interactions), replayPath)
+	}
+
+	return nil
+}
+
+// isReplaying is whether responses come from a cassette rather than Azure
+func isReplaying() bool {
+	return activeCassette != nil && activeCassette.mode == cassetteReplaying
+}
+
+// now returns the current time, or when replaying the time the last replayed response was recorded, so that the age of data is judged as it was when recorded
+func now() time.Time {
+	if isReplaying() {
+		activeCassette.mutex.Lock()
+		defer activeCassette.mutex.Unlock()
+
+		if !activeCassette.lastRecordedAt.IsZero() {
+			return activeCassette.lastRecordedAt
+		}
+	}
+
+	return time.Now()
+}
+
+// replayRandomString returns the next recorded random string of length n when replaying, so that requests name the artifacts they did when recorded
+func (c *cassette) replayRandomString(n int) (value string, ok bool) {
+	if c == nil || c.mode != cassetteReplaying {
+		return "", false
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.replayedRandomStrings >= len(c.RandomStrings) || len(c.RandomStrings[c.replayedRandomStrings]) != n {
+		return "", false
+	}
+
+	c.replayedRandomStrings++
+
+	return c.RandomStrings[c.replayedRandomStrings-1], true
+}
+
+// recordRandomString adds a generated random string to the cassette when recording
+func (c *cassette) recordRandomString(value string) {
+	if c == nil || c.mode != cassetteRecording {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.RandomStrings = append(c.RandomStrings, value)
+}
+
+// withCassetteTransporter returns a transport for the Azure SDK clients which records or replays their requests through the active cassette
+func withCassetteTransporter(transporter policy.Transporter) policy.Transporter {
+	if activeCassette == nil {
+		return transporter
+	}
+
+	if transporter == nil {
+		transporter = &http.Client{}
+	}
+
+	return cassetteTransport{cassette: activeCassette, next: transporter.Do}
+}
+
+// withCassetteRoundTripper returns a transport for requests made without the Azure SDK which records or replays them through the active cassette
+func withCassetteRoundTripper(roundTripper http.RoundTripper) http.RoundTripper {
+	if activeCassette == nil {
+		return roundTripper
+	}
+
+	return cassetteTransport{cassette: activeCassette, next: roundTripper.RoundTrip}
+}
+
+// cassetteTransport is both an Azure SDK transport and an http.RoundTripper
+type cassetteTransport struct {
+	cassette *cassette
+	next     func(*http.Request) (*http.Response, error)
+}
+
+func (transport cassetteTransport) Do(request *http.Request) (*http.Response, error) {
+	return transport.RoundTrip(request)
+}
+
+func (transport cassetteTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	if transport.cassette.mode == cassetteReplaying {
+		return transport.cassette.replay(request)
+	}
+
+	return transport.cassette.record(request, transport.next)
+}
+
+// record makes the request and adds it, with its response, to the cassette, the cassette file is rewritten so that an interrupted run keeps its recording
+func (c *cassette) record(request *http.Request, next func(*http.Request) (*http.Response, error)) (*http.Response, error) {
+	requestBody, err := readBody(&request.Body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	recorded := &interaction{
+		RecordedAt: time.Now().UTC(),
+		Request: recordedRequest{
+			Method:  request.Method,
+			URL:     scrubURL(request.URL.String()),
+			Headers: scrubHeaders(request.Header),
+			Body:    scrubBody(requestBody),
+		},
+	}
+
+	response, err := next(request)
+
+	if err != nil {
+		recorded.Error = err.Error()
+	} else {
+		responseBody, err := readBody(&response.Body)
+
+		if err != nil {
+			return nil, err
+		}
+
+		recorded.Response = &recordedResponse{
+			Status:     response.Status,
+			StatusCode: response.StatusCode,
+			Headers:    scrubHeaders(response.Header),
+			Body:       scrubBody(responseBody),
+		}
+
+		if response.TLS != nil {
+			recorded.Response.TLSVersion = response.TLS.Version
+			recorded.Response.TLSCipherSuite = response.TLS.CipherSuite
+
+			for _, certificate := range response.TLS.PeerCertificates {
+				recorded.Response.TLSCertificates = append(recorded.Response.TLSCertificates, certificate.Raw)
+			}
+		}
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if c.PrincipalID == "" {
+		c.PrincipalID = getTokenObjectId(request.Header.Get("Authorization"))
+	}
+
+	c.Interactions = append(c.Interactions, recorded)
+	c.write()
+
+	return response, err
+}
+
+// replay returns the response of the first interaction not yet replayed with the request's method and path, disregarding generated names if none match exactly
+func (c *cassette) replay(request *http.Request) (*http.Response, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	index := c.findInteraction(request, false)
+
+	if index == -1 {
+		index = c.findInteraction(request, true)
+	}
+
+	if index == -1 {
+		return nil, fmt.Errorf("cassette %s has no recorded response for %s %s", c.filePath, request.Method, request.URL.Path)
+	}
+
+	c.replayed[index] = true
+	recorded := c.Interactions[index]
+	c.lastRecordedAt = recorded.RecordedAt
+
+	if recorded.Response == nil {
+		return nil, errors.New(recorded.Error)
+	}
+
+	response := &http.Response{
+		Status:        recorded.Response.Status,
+		StatusCode:    recorded.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Response.Headers.Clone(),
+		Body:          io.NopCloser(strings.NewReader(recorded.Response.Body)),
+		ContentLength: int64(len(recorded.Response.Body)),
+		Request:       request,
+	}
+
+	if response.Header == nil {
+		response.Header = make(http.Header)
+	}
+
+	if recorded.Response.TLSVersion != 0 {
+		response.TLS = &tls.ConnectionState{Version: recorded.Response.TLSVersion, CipherSuite: recorded.Response.TLSCipherSuite, HandshakeComplete: true}
+
+		for _, der := range recorded.Response.TLSCertificates {
+			certificate, err := x509.ParseCertificate(der)
+
+			if err != nil {
+				return nil, fmt.Errorf("cassette %s has an invalid certificate for %s %s: %v", c.filePath, request.Method, request.URL.Path, err)
+			}
+
+			response.TLS.PeerCertificates = append(response.TLS.PeerCertificates, certificate)
+		}
+	}
+
+	return response, nil
+}
+
+func (c *cassette) findInteraction(request *http.Request, disregardGeneratedNames bool) int {
+	requestPath := normalizeCassettePath(request.URL.Path, disregardGeneratedNames)
+
+	for i, recorded := range c.Interactions {
+		if c.replayed[i] || recorded.Request.Method != request.Method {
+			continue
+		}
+
+		recordedURL, err := request.URL.Parse(recorded.Request.URL)
+
+		if err == nil && normalizeCassettePath(recordedURL.Path, disregardGeneratedNames) == requestPath {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func normalizeCassettePath(requestPath string, disregardGeneratedNames bool) string {
+	requestPath = strings.ToLower(path.Clean("/" + requestPath))
+
+	if disregardGeneratedNames {
+		requestPath = generatedNameRegex.ReplaceAllString(requestPath, "${1}*")
+	}
+
+	return requestPath
+}
+
+func (c *cassette) write() {
+	recording, err := json.MarshalIndent(c, "", "  ")
+
+	if err == nil {
+		err = os.MkdirAll(path.Dir(c.filePath), 0755)
+	}
+
+	if err == nil {
+		err = os.WriteFile(c.filePath, recording, 0600)
+	}
+
+	if err != nil {
+		log.Printf("[ERROR] Failed to write cassette %s: %v", c.filePath, err)
+	}
+}
+
+// readBody reads a request or response body, replacing it so that it can still be read by the caller
+func readBody(body *io.ReadCloser) (string, error) {
+	if *body == nil || *body == http.NoBody {
+		return "", nil
+	}
+
+	content, err := io.ReadAll(*body)
+	(*body).Close()
+
+	if err != nil {
+		return "", fmt.Errorf("failed to read body: %v", err)
+	}
+
+	*body = io.NopCloser(bytes.NewReader(content))
+
+	return string(content), nil
+}
+
+func scrubHeaders(headers http.Header) http.Header {
+	scrubbed := headers.Clone()
+
+	for _, name := range scrubbedHeaders {
+		if scrubbed.Get(name) != "" {
+			scrubbed.Set(name, scrubbedValue)
+		}
+	}
+
+	return scrubbed
+}
+
+func scrubURL(rawURL string) string {
+	return sasSignatureRegex.ReplaceAllString(rawURL, "${1}"+scrubbedValue)
+}
+
+// scrubBody removes keys, tokens and secrets from a JSON body, including the values of storage account keys which are listed by name,
+// and the key material from the XML body of a user delegation key
+func scrubBody(body string) string {
+	if strings.Contains(body, "<UserDelegationKey>") {
+		return userDelegationKeyRegex.ReplaceAllString(body, "${1}"+scrubbedValue+"${2}")
+	}
+
+	var document any
+
+	// Numbers are kept as written, rather than converted to floating point
+	decoder := json.NewDecoder(strings.NewReader(body))
+	decoder.UseNumber()
+
+	if decoder.Decode(&document) != nil {
+		return body
+	}
+
+	scrubbed, err := json.Marshal(scrubJSON(document))
+
+	if err != nil {
+		return body
+	}
+
+	return string(scrubbed)
+}
+
+func scrubJSON(document any) any {
+	switch value := document.(type) {
+	case map[string]any:
+		_, isAccountKey := value["keyName"]
+
+		for name, field := range value {
+			if (isAccountKey && name == "value") || slices.ContainsFunc(scrubbedFields, func(field string) bool { return strings.EqualFold(field, name) }) {
+				value[name] = scrubbedValue
+			} else {
+				value[name] = scrubJSON(field)
+			}
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = scrubJSON(item)
+		}
+	}
+
+	return document
+}
+
+// getTokenObjectId returns the object ID claim of a bearer token, without the token itself
+func getTokenObjectId(authorization string) string {
+	parts := strings.Split(strings.TrimPrefix(authorization, "Bearer "), ".")
+
+	if len(parts) < 2 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		ObjectId string `json:"oid"`
+	}
+
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+
+	return claims.ObjectId
+}
+
+// replayCredential stands in for an Azure credential when replaying, its unsigned tokens identify as the principal that made the recording
+type replayCredential struct {
+	principalId string
+}
+
+func (credential replayCredential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	expiresOn := time.Now().Add(time.Hour)
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{"oid": credential.principalId, "exp": expiresOn.Unix()})
+
+	return azcore.AccessToken{
+		Token:     base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims) + ".",
+		ExpiresOn: expiresOn,
+	}, nil
+}
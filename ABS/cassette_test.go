@@ -0,0 +1,190 @@
+package abs
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/azure/finos-azure-blob-storage-raid/ABS/emulator"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_scrubBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		expected string
+	}{
+		{
+			name:     "storage account keys",
+			body:     `{"keys":[{"keyName":"key1","permissions":"FULL","value":"c2VjcmV0"}]}`,
+			expected: `{"keys":[{"keyName":"key1","permissions":"FULL","value":"REDACTED"}]}`,
+		},
+		{
+			name:     "tokens",
+			body:     `{"access_token":"eyJ0eXAi","expires_in":3599}`,
+			expected: `{"access_token":"REDACTED","expires_in":3599}`,
+		},
+		{
+			name:     "values which are not keys",
+			body:     `{"value":[{"name":"eastus"}],"count":12345678901234567}`,
+			expected: `{"count":12345678901234567,"value":[{"name":"eastus"}]}`,
+		},
+		{
+			name:     "user delegation key",
+			body:     `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey><SignedOid>11111111-1111-1111-1111-111111111111</SignedOid><SignedTid>22222222-2222-2222-2222-222222222222</SignedTid><SignedExpiry>2026-10-18T00:00:00Z</SignedExpiry><Value>c2lnbmluZyBrZXk=</Value></UserDelegationKey>`,
+			expected: `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey><SignedOid>REDACTED</SignedOid><SignedTid>22222222-2222-2222-2222-222222222222</SignedTid><SignedExpiry>2026-10-18T00:00:00Z</SignedExpiry><Value>REDACTED</Value></UserDelegationKey>`,
+		},
+		{
+			name:     "not JSON",
+			body:     `<?xml version="1.0" encoding="utf-8"?><EnumerationResults/>`,
+			expected: `<?xml version="1.0" encoding="utf-8"?><EnumerationResults/>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			scrubbed := scrubBody(tt.body)
+
+			// Assert
+			assert.Equal(t, tt.expected, scrubbed)
+		})
+	}
+}
+
+func Test_scrubHeaders_and_scrubURL(t *testing.T) {
+	// Arrange
+	headers := http.Header{}
+	headers.Set("Authorization", "Bearer eyJ0eXAi")
+	headers.Set("x-ms-version", "2025-01-05")
+
+	// Act
+	scrubbedHeaders := scrubHeaders(headers)
+	scrubbedURL := scrubURL("https://account.blob.core.windows.net/container?sv=2022-11-02&sig=c2lnbmF0dXJl&sp=r")
+
+	// Assert
+	assert.Equal(t, "REDACTED", scrubbedHeaders.Get("Authorization"))
+	assert.Equal(t, "2025-01-05", scrubbedHeaders.Get("x-ms-version"))
+	assert.Equal(t, "Bearer eyJ0eXAi", headers.Get("Authorization"))
+	assert.Equal(t, "https://account.blob.core.windows.net/container?sv=2022-11-02&sig=REDACTED&sp=r", scrubbedURL)
+}
+
+func Test_normalizeCassettePath(t *testing.T) {
+	tests := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{
+			name:     "test container",
+			path:     "/account/privateer-test-container-abcdefgh/privateer-test-blob-abcdefgh",
+			expected: "/account/privateer-test-container-*/privateer-test-blob-*",
+		},
+		{
+			name:     "role assignment",
+			path:     "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/roleAssignments/6F2C8A3E-0A4B-4C7D-9E1F-2A3B4C5D6E7F",
+			expected: "/subscriptions/*/providers/microsoft.authorization/roleassignments/*",
+		},
+		{
+			name:     "test storage account",
+			path:     "//subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/privateertestabcdefgh",
+			expected: "/subscriptions/sub/resourcegroups/rg/providers/microsoft.storage/storageaccounts/privateertest*",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, normalizeCassettePath(tt.path, true))
+		})
+	}
+}
+
+func Test_cassette_replays_a_recorded_assessment(t *testing.T) {
+	// Arrange
+	cassettePath := path.Join(t.TempDir(), "cassette.json")
+	server := emulator.NewServer(emulator.NoLogging())
+	t.Cleanup(server.Close)
+
+	recordedResults := runTestSuite(t, server, map[string]interface{}{"recordcassette": cassettePath})
+	server.Close()
+
+	// Act
+	replayedResults := runTestSuite(t, server, map[string]interface{}{"replaycassette": cassettePath})
+
+	// Assert
+	assert.Len(t, replayedResults, len(recordedResults))
+
+	for testSetName, recorded := range recordedResults {
+		assert.Equal(t, recorded.Passed, replayedResults[testSetName].Passed, testSetName)
+		assert.Equal(t, recorded.Message, replayedResults[testSetName].Message, testSetName)
+	}
+
+	recording, err := os.ReadFile(cassettePath)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(recording), "Bearer ")
+	assert.Contains(t, string(recording), `"principalId": "`+emulator.PrincipalID+`"`)
+}
+
+func Test_cassette_does_not_record_user_delegation_key(t *testing.T) {
+	// Arrange
+	recording := &cassette{mode: cassetteRecording, filePath: path.Join(t.TempDir(), "cassette.json")}
+	keyBody := `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey><SignedOid>11111111-1111-1111-1111-111111111111</SignedOid><SignedExpiry>2026-10-18T00:00:00Z</SignedExpiry><Value>c2lnbmluZyBrZXk=</Value></UserDelegationKey>`
+
+	request, err := http.NewRequest(http.MethodPost, "https://account.blob.core.windows.net/?restype=service&comp=userdelegationkey", strings.NewReader("<KeyInfo/>"))
+	assert.NoError(t, err)
+
+	// Act
+	response, err := recording.record(request, func(*http.Request) (*http.Response, error) {
+		return &http.Response{Status: "200 OK", StatusCode: http.StatusOK, Header: http.Header{}, Body: io.NopCloser(strings.NewReader(keyBody))}, nil
+	})
+
+	// Assert
+	assert.NoError(t, err)
+
+	body, err := io.ReadAll(response.Body)
+	assert.NoError(t, err)
+	assert.Equal(t, keyBody, string(body))
+
+	file, err := os.ReadFile(recording.filePath)
+	assert.NoError(t, err)
+
+	var recorded cassette
+	assert.NoError(t, json.Unmarshal(file, &recorded))
+	assert.Equal(t, `<?xml version="1.0" encoding="utf-8"?><UserDelegationKey><SignedOid>REDACTED</SignedOid><SignedExpiry>2026-10-18T00:00:00Z</SignedExpiry><Value>REDACTED</Value></UserDelegationKey>`, recorded.Interactions[0].Response.Body)
+}
+
+func Test_loadCassette_rejects_recording_and_replaying(t *testing.T) {
+	// Arrange
+	previousConfig := Armory.Config
+	Armory.Config = &config.Config{Vars: map[string]interface{}{"recordcassette": "record.json", "replaycassette": "replay.json"}}
+	defer func() { Armory.Config = previousConfig }()
+
+	// Act
+	err := loadCassette()
+
+	// Assert
+	assert.EqualError(t, err, "recordCassette and replayCassette cannot both be set")
+}
+
+func Test_waitFor_does_not_wait_when_replaying(t *testing.T) {
+	// Arrange
+	activeCassette = &cassette{mode: cassetteReplaying}
+	defer func() { activeCassette = nil }()
+
+	start := time.Now()
+
+	// Act
+	err := waitFor(context.Background(), time.Hour)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Less(t, time.Since(start), time.Second)
+}
@@ -0,0 +1,509 @@
+package abs
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+// artifactKind is the type of Azure resource that a test created
+type artifactKind string
+
+const (
+	artifactContainer      artifactKind = "container"
+	artifactStorageAccount artifactKind = "storageAccount"
+	artifactBackupVault    artifactKind = "backupVault"
+	artifactRoleAssignment artifactKind = "roleAssignment"
+
+	// testArtifactPrefix starts the names of the containers and backup vaults, and the descriptions of the role assignments, that tests create
+	testArtifactPrefix = "privateer-test-"
+
+	// testStorageAccountPrefix starts the names of the storage accounts that tests create, which cannot contain hyphens
+	testStorageAccountPrefix = "privateertest"
+
+	// testRoleAssignmentDescription marks the role assignments that tests create
+	testRoleAssignmentDescription = testArtifactPrefix + "role-assignment"
+
+	cleanupLedgerFileName = "cleanup-ledger.json"
+)
+
+// testArtifact is an Azure resource created by a test, which must be deleted once the test is done with it
+type testArtifact struct {
+	Kind              artifactKind `json:"kind"`
+	Name              string       `json:"name"`
+	SubscriptionId    string       `json:"subscriptionId"`
+	ResourceGroupName string       `json:"resourceGroupName"`
+	// StorageAccountName is the account that a container was created in
+	StorageAccountName string `json:"storageAccountName,omitempty"`
+	// Scope is the resource that a role assignment was created at
+	Scope     string    `json:"scope,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+	// Error is why the artifact could not be deleted
+	Error string `json:"error,omitempty"`
+}
+
+// cleanupRegistry holds the artifacts created during the run which have not yet been deleted, in the order they were created
+type cleanupRegistry struct {
+	mutex     sync.Mutex
+	artifacts []*testArtifact
+	// interrupted is set once the registry has been torn down because the run was interrupted, the process exits straight after so it is not torn down again
+	interrupted bool
+}
+
+var (
+	testArtifacts = &cleanupRegistry{}
+
+	// cleanupLedgerPath is where the artifacts which have not been deleted are written, so that they are not lost if the run exits early
+	cleanupLedgerPath string
+)
+
+func (artifact *testArtifact) String() string {
+	switch artifact.Kind {
+	case artifactContainer:
+		return fmt.Sprintf("container %s in storage account %s", artifact.Name, artifact.StorageAccountName)
+	case artifactRoleAssignment:
+		return fmt.Sprintf("role assignment %s at %s", artifact.Name, artifact.Scope)
+	default:
+		return fmt.Sprintf("%s %s in resource group %s", artifact.Kind, artifact.Name, artifact.ResourceGroupName)
+	}
+}
+
+func (artifact *testArtifact) matches(other *testArtifact) bool {
+	return artifact.Kind == other.Kind &&
+		strings.EqualFold(artifact.Name, other.Name) &&
+		strings.EqualFold(artifact.SubscriptionId, other.SubscriptionId) &&
+		strings.EqualFold(artifact.ResourceGroupName, other.ResourceGroupName) &&
+		strings.EqualFold(artifact.StorageAccountName, other.StorageAccountName) &&
+		strings.EqualFold(artifact.Scope, other.Scope)
+}
+
+// newTestArtifact describes a resource created by a test against the current storage account
+func newTestArtifact(kind artifactKind, name string) *testArtifact {
+	artifact := &testArtifact{
+		Kind:              kind,
+		Name:              name,
+		SubscriptionId:    currentTarget.resourceId.subscriptionId,
+		ResourceGroupName: currentTarget.resourceId.resourceGroupName,
+		CreatedAt:         time.Now().UTC(),
+	}
+
+	switch kind {
+	case artifactContainer:
+		artifact.StorageAccountName = currentTarget.resourceId.storageAccountName
+	case artifactRoleAssignment:
+		artifact.Scope = currentTarget.storageAccountResourceId
+	}
+
+	return artifact
+}
+
+// trackArtifact records a resource created by a test, so that it is deleted at the end of the run if the test does not delete it
+func trackArtifact(kind artifactKind, name string) {
+	testArtifacts.add(newTestArtifact(kind, name))
+}
+
+// releaseArtifact stops tracking a resource once the test that created it has deleted it
+func releaseArtifact(kind artifactKind, name string) {
+	testArtifacts.remove(newTestArtifact(kind, name))
+}
+
+func (registry *cleanupRegistry) add(artifact *testArtifact) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for _, existing := range registry.artifacts {
+		if existing.matches(artifact) {
+			return
+		}
+	}
+
+	registry.artifacts = append(registry.artifacts, artifact)
+	registry.writeLedger()
+}
+
+func (registry *cleanupRegistry) remove(artifact *testArtifact) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	for i, existing := range registry.artifacts {
+		if existing.matches(artifact) {
+			registry.artifacts = append(registry.artifacts[:i], registry.artifacts[i+1:]...)
+			registry.writeLedger()
+			return
+		}
+	}
+}
+
+// teardown deletes every artifact in the registry newest first, the artifacts which could not be deleted remain in the registry and the ledger
+func (registry *cleanupRegistry) teardown() (deleted []*testArtifact, failed []*testArtifact) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.interrupted {
+		return nil, nil
+	}
+
+	return registry.deleteArtifacts(testSetContext)
+}
+
+// interrupt tears the registry down when the run is interrupted, while the interrupted TestSet may still be running
+func (registry *cleanupRegistry) interrupt() (deleted []*testArtifact, failed []*testArtifact) {
+	registry.mutex.Lock()
+	defer registry.mutex.Unlock()
+
+	if registry.interrupted {
+		return nil, nil
+	}
+
+	registry.interrupted = true
+
+	return registry.deleteArtifacts(pluginContext)
+}
+
+// deleteArtifacts deletes every artifact in the registry newest first, the registry must be locked
+func (registry *cleanupRegistry) deleteArtifacts(ctx context.Context) (deleted []*testArtifact, failed []*testArtifact) {
+	if len(registry.artifacts) == 0 {
+		return nil, nil
+	}
+
+	// The artifacts are deleted with their own clients, as an interrupted TestSet may still be using the clients of the current target
+	clients := make(map[string]*artifactClients)
+
+	for i := len(registry.artifacts) - 1; i >= 0; i-- {
+		artifact := registry.artifacts[i]
+
+		if _, ok := clients[artifact.SubscriptionId]; !ok {
+			clients[artifact.SubscriptionId] = newArtifactClients(artifact.SubscriptionId)
+		}
+
+		err := clients[artifact.SubscriptionId].deleteArtifact(ctx, artifact)
+
+		if err != nil {
+			log.Printf("[ERROR] Failed to delete %s: %v", artifact, err)
+			artifact.Error = err.Error()
+			failed = append(failed, artifact)
+		} else {
+			artifact.Error = ""
+			deleted = append(deleted, artifact)
+		}
+	}
+
+	// The failures are kept in creation order, so that a later teardown still deletes them newest first
+	registry.artifacts = nil
+
+	for i := len(failed) - 1; i >= 0; i-- {
+		registry.artifacts = append(registry.artifacts, failed[i])
+	}
+
+	registry.writeLedger()
+
+	return deleted, failed
+}
+
+// writeLedger writes the artifacts which have not been deleted to the cleanup ledger, removing the ledger when there are none
+func (registry *cleanupRegistry) writeLedger() {
+	if cleanupLedgerPath == "" {
+		return
+	}
+
+	if len(registry.artifacts) == 0 {
+		err := os.Remove(cleanupLedgerPath)
+
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("[ERROR] Failed to remove cleanup ledger %s: %v", cleanupLedgerPath, err)
+		}
+
+		return
+	}
+
+	ledger, err := json.MarshalIndent(registry.artifacts, "", "  ")
+
+	if err == nil {
+		err = os.MkdirAll(path.Dir(cleanupLedgerPath), 0755)
+	}
+
+	if err == nil {
+		err = os.WriteFile(cleanupLedgerPath, ledger, 0644)
+	}
+
+	if err != nil {
+		log.Printf("[ERROR] Failed to write cleanup ledger %s: %v", cleanupLedgerPath, err)
+	}
+}
+
+// loadCleanupLedger adds the artifacts left behind by earlier runs to the registry, so that they are deleted at the end of this run
+func loadCleanupLedger() error {
+	cleanupLedgerPath = path.Join(Armory.Config.WriteDirectory, Armory.Config.ServiceName, cleanupLedgerFileName)
+
+	ledger, err := os.ReadFile(cleanupLedgerPath)
+
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to read cleanup ledger %s: %v", cleanupLedgerPath, err)
+	}
+
+	var artifacts []*testArtifact
+
+	err = json.Unmarshal(ledger, &artifacts)
+
+	if err != nil {
+		return fmt.Errorf("failed to parse cleanup ledger %s: %v", cleanupLedgerPath, err)
+	}
+
+	for _, artifact := range artifacts {
+		testArtifacts.add(artifact)
+	}
+
+	return nil
+}
+
+// artifactClients are the clients which delete the artifacts in a subscription
+type artifactClients struct {
+	blobContainers  blobContainersClientInterface
+	storageAccounts accountsClientInterface
+	vaults          vaultsClientInterface
+	roleAssignments roleAssignmentsClientInterface
+	errs            initializationErrors
+}
+
+// newArtifactClients creates the clients which delete the artifacts in a subscription, without switching the subscription-scoped clients used by TestSets
+var newArtifactClients = func(subscriptionId string) *artifactClients {
+	clients := &artifactClients{}
+	scope := "subscription " + subscriptionId
+
+	blobContainers, err := armstorage.NewBlobContainersClient(subscriptionId, cred, armClientOptions)
+	clients.blobContainers = blobContainers
+	clients.errs.add(componentBlobContainersClient, scope, err)
+
+	storageAccounts, err := armstorage.NewAccountsClient(subscriptionId, cred, armClientOptions)
+	clients.storageAccounts = storageAccounts
+	clients.errs.add(componentStorageAccountsClient, scope, err)
+
+	roleAssignments, err := armauthorization.NewRoleAssignmentsClient(subscriptionId, cred, armClientOptions)
+	clients.roleAssignments = roleAssignments
+	clients.errs.add(componentRoleAssignmentsClient, scope, err)
+
+	recoveryServicesClientFactory, err := armrecoveryservices.NewClientFactory(subscriptionId, cred, armClientOptions)
+
+	if err != nil {
+		clients.errs.add(componentVaultsClient, scope, err)
+	} else {
+		clients.vaults = recoveryServicesClientFactory.NewVaultsClient()
+	}
+
+	return clients
+}
+
+// deleteArtifact deletes a resource created by a test, an artifact which no longer exists counts as deleted
+func (clients *artifactClients) deleteArtifact(ctx context.Context, artifact *testArtifact) error {
+	// The artifacts are still deleted once the run has been interrupted
+	cleanupContext, cancel := context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+	defer cancel()
+
+	var err error
+
+	switch artifact.Kind {
+	case artifactContainer:
+		if failed := clients.errs.forComponents(componentBlobContainersClient); len(failed) > 0 {
+			return failed
+		}
+
+		_, err = clients.blobContainers.Delete(cleanupContext, artifact.ResourceGroupName, artifact.StorageAccountName, artifact.Name, nil)
+	case artifactStorageAccount:
+		if failed := clients.errs.forComponents(componentStorageAccountsClient); len(failed) > 0 {
+			return failed
+		}
+
+		_, err = clients.storageAccounts.Delete(cleanupContext, artifact.ResourceGroupName, artifact.Name, nil)
+	case artifactBackupVault:
+		if failed := clients.errs.forComponents(componentVaultsClient); len(failed) > 0 {
+			return failed
+		}
+
+		_, err = clients.vaults.Delete(cleanupContext, artifact.ResourceGroupName, artifact.Name, nil)
+	case artifactRoleAssignment:
+		if failed := clients.errs.forComponents(componentRoleAssignmentsClient); len(failed) > 0 {
+			return failed
+		}
+
+		_, err = clients.roleAssignments.Delete(cleanupContext, artifact.Scope, artifact.Name, nil)
+	default:
+		return fmt.Errorf("unknown artifact kind %s", artifact.Kind)
+	}
+
+	var responseError *azcore.ResponseError
+
+	if errors.As(err, &responseError) && responseError.StatusCode == http.StatusNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// withCleanup wraps a TestSet so that the artifacts created by tests are deleted if it panics, and when endOfSuite is set once it has run
+func withCleanup(testSet pluginkit.TestSet, endOfSuite bool) pluginkit.TestSet {
+	return func() (string, pluginkit.TestSetResult) {
+		claimInterrupts()
+
+		defer func() {
+			// A panic ends the run, so the artifacts are deleted before it is passed on
+			if recovered := recover(); recovered != nil {
+				testArtifacts.teardown()
+				panic(recovered)
+			}
+
+			if endOfSuite {
+				testArtifacts.teardown()
+			}
+		}()
+
+		return testSet()
+	}
+}
+
+// Cleanup deletes the artifacts in the cleanup ledger, and any privateer-test-* artifacts left behind alongside the configured storage accounts
+func Cleanup(output io.Writer) error {
+	err := Initialize()
+
+	if err != nil {
+		return err
+	}
+
+	err = requireAzure("cleanup")
+
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		activateTarget(target)
+
+		artifacts, err := findLeftoverArtifacts()
+
+		if err != nil {
+			fmt.Fprintf(output, "Could not search for leftover artifacts alongside %s: %v\n", target.storageAccountResourceId, err)
+		}
+
+		for _, artifact := range artifacts {
+			testArtifacts.add(artifact)
+		}
+	}
+
+	deleted, failed := testArtifacts.teardown()
+
+	for _, artifact := range deleted {
+		fmt.Fprintf(output, "Deleted %s\n", artifact)
+	}
+
+	for _, artifact := range failed {
+		fmt.Fprintf(output, "Failed to delete %s: %s\n", artifact, artifact.Error)
+	}
+
+	if len(failed) > 0 {
+		return fmt.Errorf("%d artifacts could not be deleted, they are listed in %s", len(failed), cleanupLedgerPath)
+	}
+
+	fmt.Fprintf(output, "Deleted %d artifacts.\n", len(deleted))
+
+	return nil
+}
+
+// findLeftoverArtifacts lists the artifacts created by tests which remain in the current storage account and its resource group
+func findLeftoverArtifacts() (artifacts []*testArtifact, err error) {
+	errs := currentTarget.getInitErrors()
+
+	if failed := errs.forComponents(componentBlobContainersClient, componentStorageAccountsClient, componentVaultsClient, componentRoleAssignmentsClient); len(failed) > 0 {
+		return nil, failed
+	}
+
+	ctx := pluginContext
+	resourceGroupName := currentTarget.resourceId.resourceGroupName
+
+	containers, err := findTestContainers()
+
+	if err != nil {
+		return artifacts, err
+	}
+
+	for _, container := range containers {
+		artifacts = append(artifacts, newTestArtifact(artifactContainer, *container.Name))
+	}
+
+	accountsPager := armstorageClient.NewListByResourceGroupPager(resourceGroupName, nil)
+
+	for accountsPager.More() {
+		page, err := accountsPager.NextPage(ctx)
+
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to list storage accounts: %v", err)
+		}
+
+		for _, account := range page.Value {
+			if account.Name != nil && strings.HasPrefix(*account.Name, testStorageAccountPrefix) {
+				artifacts = append(artifacts, newTestArtifact(artifactStorageAccount, *account.Name))
+			}
+		}
+	}
+
+	vaultsPager := vaultsClient.NewListByResourceGroupPager(resourceGroupName, nil)
+
+	for vaultsPager.More() {
+		page, err := vaultsPager.NextPage(ctx)
+
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to list backup vaults: %v", err)
+		}
+
+		for _, vault := range page.Value {
+			if vault.Name != nil && strings.HasPrefix(*vault.Name, testArtifactPrefix) {
+				artifacts = append(artifacts, newTestArtifact(artifactBackupVault, *vault.Name))
+			}
+		}
+	}
+
+	roleAssignmentsPager := roleAssignmentsClient.NewListForScopePager(currentTarget.storageAccountResourceId, &armauthorization.RoleAssignmentsClientListForScopeOptions{
+		Filter: to.Ptr("atScope()"),
+	})
+
+	for roleAssignmentsPager.More() {
+		page, err := roleAssignmentsPager.NextPage(ctx)
+
+		if err != nil {
+			return artifacts, fmt.Errorf("failed to list role assignments: %v", err)
+		}
+
+		for _, roleAssignment := range page.Value {
+			if roleAssignment.Name == nil || roleAssignment.Properties == nil || roleAssignment.Properties.Description == nil {
+				continue
+			}
+
+			// Role assignments inherited from a parent scope were not created by the tests
+			if roleAssignment.Properties.Scope == nil || !strings.EqualFold(*roleAssignment.Properties.Scope, currentTarget.storageAccountResourceId) {
+				continue
+			}
+
+			if *roleAssignment.Properties.Description == testRoleAssignmentDescription {
+				artifacts = append(artifacts, newTestArtifact(artifactRoleAssignment, *roleAssignment.Name))
+			}
+		}
+	}
+
+	return artifacts, nil
+}
@@ -0,0 +1,309 @@
+package abs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"os/signal"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+const testStorageAccountResourceId = "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account"
+
+// setupCleanupTest points the tests at a storage account in the subscription the mock clients are active for, with an empty cleanup registry
+func setupCleanupTest(t *testing.T) {
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	currentTarget = &storageAccountTarget{
+		storageAccountResourceId: testStorageAccountResourceId,
+		resourceId: resourceIdentifier{
+			subscriptionId:     clientsSubscriptionId,
+			resourceGroupName:  "rg",
+			storageAccountName: "account",
+		},
+	}
+
+	testArtifacts = &cleanupRegistry{}
+	cleanupLedgerPath = path.Join(t.TempDir(), cleanupLedgerFileName)
+
+	// The artifacts are deleted by the mock clients the tests set up
+	previousNewArtifactClients := newArtifactClients
+	newArtifactClients = func(subscriptionId string) *artifactClients {
+		return &artifactClients{
+			blobContainers:  blobContainersClient,
+			storageAccounts: armstorageClient,
+			vaults:          vaultsClient,
+			roleAssignments: roleAssignmentsClient,
+		}
+	}
+
+	t.Cleanup(func() {
+		testArtifacts = &cleanupRegistry{}
+		cleanupLedgerPath = ""
+		newArtifactClients = previousNewArtifactClients
+	})
+}
+
+func readCleanupLedger(t *testing.T) (artifacts []*testArtifact) {
+	ledger, err := os.ReadFile(cleanupLedgerPath)
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(ledger, &artifacts))
+
+	return artifacts
+}
+
+func Test_trackArtifact_writes_ledger_until_artifact_is_released(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	// Act
+	trackArtifact(artifactContainer, "privateer-test-container-abc")
+	ledger := readCleanupLedger(t)
+	releaseArtifact(artifactContainer, "privateer-test-container-abc")
+
+	// Assert
+	assert.Len(t, ledger, 1)
+	assert.Equal(t, artifactContainer, ledger[0].Kind)
+	assert.Equal(t, "account", ledger[0].StorageAccountName)
+	assert.NoFileExists(t, cleanupLedgerPath)
+}
+
+func Test_teardown_deletes_artifacts_newest_first(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	blobContainersClient = &blobContainersClientMock{}
+	armstorageClient = &mockAccountsClient{}
+	vaultsClient = &mockVaultsClient{}
+	roleAssignmentsClient = &mockRoleAssignmentsClient{}
+
+	trackArtifact(artifactContainer, "privateer-test-container-abc")
+	trackArtifact(artifactStorageAccount, "privateertestabc")
+	trackArtifact(artifactBackupVault, "privateer-test-vault-abc")
+	trackArtifact(artifactRoleAssignment, "00000000-0000-0000-0000-000000000001")
+
+	// Act
+	deleted, failed := testArtifacts.teardown()
+
+	// Assert
+	assert.Empty(t, failed)
+	assert.Len(t, deleted, 4)
+	assert.Equal(t, artifactRoleAssignment, deleted[0].Kind)
+	assert.Equal(t, artifactBackupVault, deleted[1].Kind)
+	assert.Equal(t, artifactStorageAccount, deleted[2].Kind)
+	assert.Equal(t, artifactContainer, deleted[3].Kind)
+	assert.Empty(t, testArtifacts.artifacts)
+	assert.NoFileExists(t, cleanupLedgerPath)
+}
+
+func Test_teardown_records_artifacts_that_could_not_be_deleted_in_ledger(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	blobContainersClient = &blobContainersClientMock{deleteError: assert.AnError}
+	armstorageClient = &mockAccountsClient{}
+
+	trackArtifact(artifactContainer, "privateer-test-container-abc")
+	trackArtifact(artifactStorageAccount, "privateertestabc")
+
+	// Act
+	deleted, failed := testArtifacts.teardown()
+
+	// Assert
+	assert.Len(t, deleted, 1)
+	assert.Len(t, failed, 1)
+
+	ledger := readCleanupLedger(t)
+	assert.Len(t, ledger, 1)
+	assert.Equal(t, "privateer-test-container-abc", ledger[0].Name)
+	assert.Equal(t, assert.AnError.Error(), ledger[0].Error)
+}
+
+func Test_teardown_treats_artifacts_that_no_longer_exist_as_deleted(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	vaultsClient = &mockVaultsClient{deleteError: &azcore.ResponseError{StatusCode: http.StatusNotFound, ErrorCode: "ResourceNotFound"}}
+	trackArtifact(artifactBackupVault, "privateer-test-vault-abc")
+
+	// Act
+	deleted, failed := testArtifacts.teardown()
+
+	// Assert
+	assert.Len(t, deleted, 1)
+	assert.Empty(t, failed)
+}
+
+func Test_withCleanup_tears_down_when_test_set_panics(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	blobContainersClient = &blobContainersClientMock{}
+
+	testSet := func() (string, pluginkit.TestSetResult) {
+		trackArtifact(artifactContainer, "privateer-test-container-abc")
+		panic("test set failed")
+	}
+
+	// Act & Assert
+	assert.Panics(t, func() { withCleanup(testSet, false)() })
+	assert.Empty(t, testArtifacts.artifacts)
+}
+
+func Test_withCleanup_tears_down_only_at_end_of_suite(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	blobContainersClient = &blobContainersClientMock{}
+
+	testSet := func() (string, pluginkit.TestSetResult) {
+		trackArtifact(artifactContainer, "privateer-test-container-abc")
+		return "CCC_Test_TR01", pluginkit.TestSetResult{Passed: true}
+	}
+
+	// Act
+	withCleanup(testSet, false)()
+	remainingAfterTestSet := len(testArtifacts.artifacts)
+
+	withCleanup(testSet, true)()
+
+	// Assert
+	assert.Equal(t, 1, remainingAfterTestSet)
+	assert.Empty(t, testArtifacts.artifacts)
+}
+
+func Test_HandleInterrupts_tears_down_before_exiting_when_interrupted_mid_test_set(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	blobContainersClient = &blobContainersClientMock{}
+
+	exitCodes := make(chan int, 1)
+	exitProcess = func(code int) { exitCodes <- code }
+
+	// The handler of an earlier run still waits for a second interrupt on its own channel
+	interrupts = make(chan os.Signal, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	SetContext(ctx)
+	HandleInterrupts(cancel)
+
+	t.Cleanup(func() {
+		signal.Reset(interruptSignals...)
+		handlingInterrupts = false
+		exitProcess = os.Exit
+		SetContext(context.Background())
+	})
+
+	exitCode := -1
+	var ledgerRemovedBeforeExit bool
+	var deletedSubscriptions []string
+	target, containersClient := currentTarget, blobContainersClient
+
+	newArtifactClients = func(subscriptionId string) *artifactClients {
+		deletedSubscriptions = append(deletedSubscriptions, subscriptionId)
+		return &artifactClients{blobContainers: &blobContainersClientMock{}}
+	}
+
+	testSet := func() (string, pluginkit.TestSetResult) {
+		trackArtifact(artifactContainer, "privateer-test-container-abc")
+
+		// An artifact left behind in another subscription by an earlier run
+		testArtifacts.add(&testArtifact{Kind: artifactContainer, Name: "privateer-test-container-def", SubscriptionId: "11111111-1111-1111-1111-111111111111", ResourceGroupName: "rg", StorageAccountName: "other"})
+
+		process, err := os.FindProcess(os.Getpid())
+		assert.NoError(t, err)
+		assert.NoError(t, process.Signal(os.Interrupt))
+
+		// The TestSet is still running when the process exits
+		select {
+		case exitCode = <-exitCodes:
+			_, err = os.Stat(cleanupLedgerPath)
+			ledgerRemovedBeforeExit = os.IsNotExist(err)
+		case <-time.After(5 * time.Second):
+		}
+
+		return "CCC_Test_TR01", pluginkit.TestSetResult{Tests: make(map[string]pluginkit.TestResult)}
+	}
+
+	// Act
+	_, result := withCleanup(withTimeout("CCC_Test_TR01", testSet), true)()
+
+	// Assert
+	assert.Equal(t, 1, exitCode)
+	assert.True(t, ledgerRemovedBeforeExit)
+	assert.Empty(t, testArtifacts.artifacts)
+	assert.Contains(t, result.Message, "TestSet was interrupted")
+	assert.ElementsMatch(t, []string{"11111111-1111-1111-1111-111111111111", "00000000-0000-0000-0000-000000000000"}, deletedSubscriptions)
+	assert.Same(t, target, currentTarget)
+	assert.Equal(t, containersClient, blobContainersClient)
+}
+
+func Test_findLeftoverArtifacts_finds_test_artifacts(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+
+	blobContainersClient = &blobContainersClientMock{
+		containerItem: armstorage.ListContainerItem{Name: to.Ptr("privateer-test-container-abc")},
+	}
+	armstorageClient = &mockAccountsClient{
+		accounts: []*armstorage.Account{
+			{Name: to.Ptr("account")},
+			{Name: to.Ptr("privateertestabc")},
+		},
+	}
+	vaultsClient = &mockVaultsClient{
+		vaults: []*armrecoveryservices.Vault{
+			{Name: to.Ptr("production-vault")},
+			{Name: to.Ptr("privateer-test-vault-abc")},
+		},
+	}
+	roleAssignmentsClient = &mockRoleAssignmentsClient{
+		roleAssignments: []*armauthorization.RoleAssignment{
+			{
+				Name: to.Ptr("00000000-0000-0000-0000-000000000001"),
+				Properties: &armauthorization.RoleAssignmentProperties{
+					Scope:       to.Ptr(testStorageAccountResourceId),
+					Description: to.Ptr(testRoleAssignmentDescription),
+				},
+			},
+			{
+				Name: to.Ptr("00000000-0000-0000-0000-000000000002"),
+				Properties: &armauthorization.RoleAssignmentProperties{
+					Scope:       to.Ptr(testStorageAccountResourceId),
+					Description: to.Ptr("Granted to the storage administrators"),
+				},
+			},
+			{
+				Name: to.Ptr("00000000-0000-0000-0000-000000000003"),
+				Properties: &armauthorization.RoleAssignmentProperties{
+					Scope:       to.Ptr("/subscriptions/00000000-0000-0000-0000-000000000000"),
+					Description: to.Ptr(testRoleAssignmentDescription),
+				},
+			},
+		},
+	}
+
+	// Act
+	artifacts, err := findLeftoverArtifacts()
+
+	// Assert
+	assert.NoError(t, err)
+
+	names := make([]string, len(artifacts))
+	for i, artifact := range artifacts {
+		names[i] = artifact.Name
+	}
+
+	assert.Equal(t, []string{"privateer-test-container-abc", "privateertestabc", "privateer-test-vault-abc", "00000000-0000-0000-0000-000000000001"}, names)
+}
@@ -0,0 +1,130 @@
+package abs
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// ContainerInventoryItem is the public access level, immutability and legal hold of a single container
+type ContainerInventoryItem struct {
+	Name                     string
+	PublicAccess             string
+	ImmutabilityPolicyState  string
+	ImmutabilityPeriodInDays int32
+	VersionLevelWorm         bool
+	LegalHold                bool
+}
+
+// allowsPublicAccess is whether anonymous clients can read the blobs, or list the blobs, of the container
+func (item ContainerInventoryItem) allowsPublicAccess() bool {
+	return item.PublicAccess != "" && item.PublicAccess != string(armstorage.PublicAccessNone)
+}
+
+// isLocked is whether the container has a locked time-based retention policy, which cannot be removed or shortened
+func (item ContainerInventoryItem) isLocked() bool {
+	return item.ImmutabilityPolicyState == string(armstorage.ImmutabilityPolicyStateLocked)
+}
+
+// retainsBlobs is whether the blobs uploaded to the container are retained by a time-based retention policy or a legal hold
+func (item ContainerInventoryItem) retainsBlobs() bool {
+	return item.ImmutabilityPolicyState != "" || item.LegalHold
+}
+
+func (*azureUtils) GetContainerInventory() (inventory []ContainerInventoryItem, err error) {
+	if assessingSnapshots {
+		return nil, fmt.Errorf("the containers of a snapshot, Terraform plan or ARM template cannot be listed")
+	}
+
+	if failed := currentTarget.getInitErrors().forComponents(componentBlobContainersClient); len(failed) > 0 {
+		return nil, failed
+	}
+
+	pager := blobContainersClient.NewListPager(currentTarget.resourceId.resourceGroupName, currentTarget.resourceId.storageAccountName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %v", err)
+		}
+
+		for _, container := range page.Value {
+			// The containers created by tests are not part of the storage account's configuration
+			if container.Name == nil || strings.HasPrefix(*container.Name, testArtifactPrefix) {
+				continue
+			}
+
+			inventory = append(inventory, newContainerInventoryItem(container))
+		}
+	}
+
+	return inventory, nil
+}
+
+func newContainerInventoryItem(container *armstorage.ListContainerItem) ContainerInventoryItem {
+	item := ContainerInventoryItem{Name: *container.Name}
+	properties := container.Properties
+
+	if properties == nil {
+		return item
+	}
+
+	if properties.PublicAccess != nil {
+		item.PublicAccess = string(*properties.PublicAccess)
+	}
+
+	if properties.ImmutabilityPolicy != nil && properties.ImmutabilityPolicy.Properties != nil {
+		if properties.ImmutabilityPolicy.Properties.State != nil {
+			item.ImmutabilityPolicyState = string(*properties.ImmutabilityPolicy.Properties.State)
+		}
+
+		if properties.ImmutabilityPolicy.Properties.ImmutabilityPeriodSinceCreationInDays != nil {
+			item.ImmutabilityPeriodInDays = *properties.ImmutabilityPolicy.Properties.ImmutabilityPeriodSinceCreationInDays
+		}
+	}
+
+	item.VersionLevelWorm = properties.ImmutableStorageWithVersioning != nil && properties.ImmutableStorageWithVersioning.Enabled != nil && *properties.ImmutableStorageWithVersioning.Enabled
+	item.LegalHold = properties.HasLegalHold != nil && *properties.HasLegalHold
+
+	return item
+}
+
+// inventoryContainerImmutability adds the containers to the immutability configuration, returning whether there are any and every one of them matches
+func inventoryContainerImmutability(configuration *ImmutabilityConfiguration, matches func(ContainerInventoryItem) bool) bool {
+	inventory, err := ArmoryAzureUtils.GetContainerInventory()
+
+	if err != nil {
+		configuration.ContainerInventoryError = err.Error()
+		return false
+	}
+
+	configuration.Containers = inventory
+
+	return len(inventory) > 0 && countContainers(inventory, matches) == len(inventory)
+}
+
+// describeContainers lists the names of the containers which match, with the detail given for each
+func describeContainers(inventory []ContainerInventoryItem, matches func(ContainerInventoryItem) bool, detail func(ContainerInventoryItem) string) string {
+	var descriptions []string
+
+	for _, item := range inventory {
+		if matches(item) {
+			descriptions = append(descriptions, fmt.Sprintf("%s (%s)", item.Name, detail(item)))
+		}
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// countContainers returns the number of containers which match
+func countContainers(inventory []ContainerInventoryItem, matches func(ContainerInventoryItem) bool) (count int) {
+	for _, item := range inventory {
+		if matches(item) {
+			count++
+		}
+	}
+
+	return count
+}
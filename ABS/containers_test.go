@@ -0,0 +1,26 @@
+package abs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/azure/finos-azure-blob-storage-raid/ABS/emulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_GetContainerInventory_is_cancelled_with_the_test_set(t *testing.T) {
+	// Arrange
+	runEmulatedTestSuite(t, emulator.Compliant())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	testSetContext = ctx
+	defer func() { testSetContext = pluginContext }()
+
+	// Act
+	_, err := (&azureUtils{}).GetContainerInventory()
+
+	// Assert
+	assert.ErrorContains(t, err, context.Canceled.Error())
+}
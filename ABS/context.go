@@ -0,0 +1,187 @@
+package abs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+const (
+	defaultTestSetTimeout = 15 * time.Minute
+
+	// cleanupTimeout bounds the deletion of resources created by tests, which still runs after the run has been interrupted
+	cleanupTimeout = 2 * time.Minute
+)
+
+var (
+	// pluginContext is cancelled when the run is interrupted, every Azure call made by the plugin derives from it
+	pluginContext = context.Background()
+
+	// testSetContext is used for the Azure calls made by the TestSet currently being run, it is cancelled when the TestSet times out or the run is interrupted
+	testSetContext = context.Background()
+
+	// testSetTimeout is how long each TestSet may run before its Azure calls are cancelled, testSetTimeouts overrides it for individual TestSets
+	testSetTimeout  = defaultTestSetTimeout
+	testSetTimeouts map[string]time.Duration
+
+	interruptSignals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+
+	// interrupts receives the signals which interrupt the run, once HandleInterrupts has been called
+	interrupts         = make(chan os.Signal, 1)
+	handlingInterrupts bool
+
+	// exitProcess ends the run once it has been cleaned up after an interrupt
+	exitProcess = os.Exit
+)
+
+// SetContext sets the context that the plugin's Azure calls derive from, cancelling it cancels any calls in flight
+func SetContext(ctx context.Context) {
+	pluginContext = ctx
+	testSetContext = ctx
+}
+
+// HandleInterrupts calls cancel when the run is interrupted, and deletes the artifacts created by tests before exiting
+func HandleInterrupts(cancel context.CancelFunc) {
+	handlingInterrupts = true
+	signals := interrupts
+	signal.Notify(signals, interruptSignals...)
+
+	go func() {
+		<-signals
+		log.Print("Interrupted, cancelling the running tests and cleaning up. Interrupt again to exit immediately.")
+		cancel()
+
+		go func() {
+			<-signals
+			exitProcess(1)
+		}()
+
+		_, failed := testArtifacts.interrupt()
+
+		if len(failed) > 0 {
+			log.Printf("[ERROR] %d artifacts could not be deleted, they are listed in %s", len(failed), cleanupLedgerPath)
+		}
+
+		exitProcess(1)
+	}()
+}
+
+// claimInterrupts replaces the interrupt handler the SDK registers whenever it executes a TestSuite, which exits straight away without deleting the artifacts created by tests
+func claimInterrupts() {
+	if !handlingInterrupts {
+		return
+	}
+
+	signal.Reset(interruptSignals...)
+	signal.Notify(interrupts, interruptSignals...)
+}
+
+// loadTimeouts reads the default TestSet timeout, and the timeouts of individual TestSets, from the config
+func loadTimeouts() error {
+	testSetTimeout = defaultTestSetTimeout
+
+	if value := Armory.Config.GetString("testsettimeout"); value != "" {
+		timeout, err := parseTimeout(value)
+
+		if err != nil {
+			return fmt.Errorf("failed to parse test set timeout %s: %v", value, err)
+		}
+
+		testSetTimeout = timeout
+	}
+
+	testSetTimeouts = make(map[string]time.Duration)
+
+	for testSetName, value := range getConfigStringMap("testsettimeouts") {
+		timeout, err := parseTimeout(value)
+
+		if err != nil {
+			return fmt.Errorf("failed to parse timeout %s for test set %s: %v", value, testSetName, err)
+		}
+
+		// Config keys are not case-sensitive
+		testSetTimeouts[strings.ToLower(testSetName)] = timeout
+	}
+
+	return nil
+}
+
+func parseTimeout(value string) (time.Duration, error) {
+	timeout, err := time.ParseDuration(value)
+
+	if err == nil && timeout <= 0 {
+		err = errors.New("timeout must be greater than zero")
+	}
+
+	return timeout, err
+}
+
+func getTestSetTimeout(testSetName string) time.Duration {
+	if timeout, ok := testSetTimeouts[strings.ToLower(testSetName)]; ok {
+		return timeout
+	}
+
+	return testSetTimeout
+}
+
+// withTimeout wraps a TestSet so that the Azure calls it makes are cancelled when its timeout expires or the run is interrupted
+func withTimeout(testSetName string, testSet pluginkit.TestSet) pluginkit.TestSet {
+	return func() (string, pluginkit.TestSetResult) {
+		// The remaining TestSets are not started once the run has been interrupted
+		if pluginContext.Err() != nil {
+			return testSetName, newNotRunResult(testSetName, "TestSet was not run as the run was interrupted.")
+		}
+
+		timeout := getTestSetTimeout(testSetName)
+		ctx, cancel := context.WithTimeout(pluginContext, timeout)
+
+		testSetContext = ctx
+
+		defer func() {
+			cancel()
+			testSetContext = pluginContext
+		}()
+
+		name, result := testSet()
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			log.Printf("[ERROR] %s timed out after %v", testSetName, timeout)
+			result.Message = fmt.Sprintf("%s TestSet timed out after %v, requests to Azure which were still running were cancelled.", result.Message, timeout)
+		} else if pluginContext.Err() != nil {
+			result.Message = fmt.Sprintf("%s TestSet was interrupted, requests to Azure which were still running were cancelled.", result.Message)
+		}
+
+		return name, result
+	}
+}
+
+// newCleanupContext creates a context for deleting resources created by tests, it is not cancelled when the run is interrupted so that test resources are not left behind
+func newCleanupContext() (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(testSetContext), cleanupTimeout)
+}
+
+// waitFor pauses for the given duration, returning early with the context's error if it is cancelled
+func waitFor(ctx context.Context, duration time.Duration) error {
+	// Replayed responses are returned in the order they were received, so there is nothing to wait for
+	if isReplaying() {
+		return ctx.Err()
+	}
+
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
@@ -0,0 +1,136 @@
+package abs
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_getTestSetTimeout(t *testing.T) {
+	// Arrange
+	testSetTimeout = time.Minute
+	testSetTimeouts = map[string]time.Duration{"ccc_c04_tr01": time.Hour}
+	defer func() {
+		testSetTimeout = defaultTestSetTimeout
+		testSetTimeouts = nil
+	}()
+
+	// Act & Assert
+	assert.Equal(t, time.Hour, getTestSetTimeout("CCC_C04_TR01"))
+	assert.Equal(t, time.Minute, getTestSetTimeout("CCC_C04_TR02"))
+}
+
+func Test_parseTimeout(t *testing.T) {
+	tests := []struct {
+		name        string
+		value       string
+		expected    time.Duration
+		expectedErr bool
+	}{
+		{name: "minutes", value: "10m", expected: 10 * time.Minute},
+		{name: "not a duration", value: "ten minutes", expectedErr: true},
+		{name: "zero", value: "0s", expectedErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			timeout, err := parseTimeout(tt.value)
+
+			// Assert
+			if tt.expectedErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, timeout)
+			}
+		})
+	}
+}
+
+func Test_withTimeout_cancels_requests_when_test_set_times_out(t *testing.T) {
+	// Arrange
+	testSetTimeouts = map[string]time.Duration{"ccc_test_tr01": time.Millisecond}
+	defer func() { testSetTimeouts = nil }()
+
+	var requestErr error
+	testSet := func() (string, pluginkit.TestSetResult) {
+		requestErr = waitFor(testSetContext, time.Minute)
+		return "CCC_Test_TR01", pluginkit.TestSetResult{Message: "Request failed."}
+	}
+
+	// Act
+	_, result := withTimeout("CCC_Test_TR01", testSet)()
+
+	// Assert
+	assert.ErrorIs(t, requestErr, context.DeadlineExceeded)
+	assert.Contains(t, result.Message, "TestSet timed out after 1ms")
+	assert.Equal(t, pluginContext, testSetContext)
+}
+
+func Test_withTimeout_does_not_run_test_set_when_interrupted(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	SetContext(ctx)
+	defer SetContext(context.Background())
+
+	testSetRan := false
+	testSet := func() (string, pluginkit.TestSetResult) {
+		testSetRan = true
+		return "CCC_Test_TR01", pluginkit.TestSetResult{Passed: true}
+	}
+
+	// Act
+	testSetName, result := withTimeout("CCC_Test_TR01", testSet)()
+
+	// Assert
+	assert.Equal(t, false, testSetRan)
+	assert.Equal(t, "CCC_Test_TR01", testSetName)
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "TestSet was not run as the run was interrupted.", result.Message)
+}
+
+func Test_newCleanupContext_is_not_cancelled_when_interrupted(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	SetContext(ctx)
+	defer SetContext(context.Background())
+
+	// Act
+	cancel()
+	cleanupContext, cancelCleanup := newCleanupContext()
+	defer cancelCleanup()
+
+	// Assert
+	assert.NoError(t, cleanupContext.Err())
+}
+
+func Test_ConfirmHTTPResponseIsLogged_stops_waiting_when_interrupted(t *testing.T) {
+	// Arrange
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	SetContext(ctx)
+	defer SetContext(context.Background())
+
+	loggingVariables.minimumIngestionTime = time.Minute
+	loggingVariables.pollingDelay = time.Millisecond
+
+	httpResponse := &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"x-ms-request-id": []string{"TestRequestId"}}}
+
+	// Act
+	result := pluginkit.TestResult{}
+	(&loggingFunctions{}).ConfirmHTTPResponseIsLogged(httpResponse, "resourceId", &mockLogClient{}, &result)
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Stopped waiting for logs to be ingested: context canceled", result.Message)
+}
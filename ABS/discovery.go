@@ -0,0 +1,147 @@
+package abs
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// storageAccountFilter narrows the storage accounts found by discovery, explicitly configured resource IDs are not filtered
+type storageAccountFilter struct {
+	// tags that a storage account must have, an empty value matches any value of the tag
+	tags map[string]string
+	// namePattern that the storage account name must match, nil matches every name
+	namePattern *regexp.Regexp
+}
+
+var (
+	discoveryFilter storageAccountFilter
+
+	resourceGroupIdRegex = regexp.MustCompile(`^/subscriptions/(?P<subscription>[0-9a-fA-F-]+)/resourceGroups/(?P<resourceGroup>[-\w\._\(\)]+)$`)
+	subscriptionIdRegex  = regexp.MustCompile(`^(/subscriptions/)?(?P<subscription>[0-9a-fA-F-]+)$`)
+)
+
+func newStorageAccountFilter(tags map[string]string, namePattern string) (filter storageAccountFilter, err error) {
+	filter.tags = tags
+
+	if namePattern != "" {
+		filter.namePattern, err = regexp.Compile(namePattern)
+
+		if err != nil {
+			return filter, fmt.Errorf("failed to parse storage account name filter %s: %v", namePattern, err)
+		}
+	}
+
+	return filter, nil
+}
+
+func (filter storageAccountFilter) matches(account *armstorage.Account) bool {
+	if filter.namePattern != nil && (account.Name == nil || !filter.namePattern.MatchString(*account.Name)) {
+		return false
+	}
+
+	for tagName, tagValue := range filter.tags {
+		found := false
+
+		// Tag names are case-insensitive in Azure, tag values are not
+		for accountTagName, accountTagValue := range account.Tags {
+			if strings.EqualFold(accountTagName, tagName) && (tagValue == "" || (accountTagValue != nil && *accountTagValue == tagValue)) {
+				found = true
+				break
+			}
+		}
+
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+// discoverStorageAccountsInResourceGroup lists the resource IDs of all storage accounts in a resource group which match the discovery filter
+func discoverStorageAccountsInResourceGroup(resourceGroupId string) (storageAccountResourceIds []string, err error) {
+	match := resourceGroupIdRegex.FindStringSubmatch(resourceGroupId)
+
+	if len(match) == 0 {
+		return nil, fmt.Errorf("failed to parse resource group ID %s", resourceGroupId)
+	}
+
+	if failed := useSubscription(match[1]).forComponents(componentStorageAccountsClient); len(failed) > 0 {
+		return nil, failed
+	}
+
+	pager := armstorageClient.NewListByResourceGroupPager(match[2], nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(pluginContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list storage accounts in resource group %s: %v", resourceGroupId, err)
+		}
+
+		for _, account := range page.Value {
+			if discoveryFilter.matches(account) {
+				storageAccountResourceIds = append(storageAccountResourceIds, *account.ID)
+			}
+		}
+	}
+
+	return storageAccountResourceIds, nil
+}
+
+// discoverStorageAccountsInSubscription lists the resource IDs of all storage accounts in a subscription which match the discovery filter
+func discoverStorageAccountsInSubscription(subscriptionId string) (storageAccountResourceIds []string, err error) {
+	match := subscriptionIdRegex.FindStringSubmatch(subscriptionId)
+
+	if len(match) == 0 {
+		return nil, fmt.Errorf("failed to parse subscription ID %s", subscriptionId)
+	}
+
+	if failed := useSubscription(match[2]).forComponents(componentStorageAccountsClient); len(failed) > 0 {
+		return nil, failed
+	}
+
+	pager := armstorageClient.NewListPager(nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(pluginContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list storage accounts in subscription %s: %v", subscriptionId, err)
+		}
+
+		for _, account := range page.Value {
+			if discoveryFilter.matches(account) {
+				storageAccountResourceIds = append(storageAccountResourceIds, *account.ID)
+			}
+		}
+	}
+
+	return storageAccountResourceIds, nil
+}
+
+// discoverSubscriptionsInManagementGroup lists the IDs of all subscriptions below a management group, including those in child management groups
+func discoverSubscriptionsInManagementGroup(managementGroupId string) (subscriptionIds []string, err error) {
+	managementGroupName := managementGroupId[strings.LastIndex(managementGroupId, "/")+1:]
+
+	pager := managementGroupsClient.NewGetDescendantsPager(managementGroupName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(pluginContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list descendants of management group %s: %v", managementGroupId, err)
+		}
+
+		for _, descendant := range page.Value {
+			if descendant.Type != nil && *descendant.Type == "/subscriptions" && descendant.Name != nil {
+				subscriptionIds = append(subscriptionIds, *descendant.Name)
+			}
+		}
+	}
+
+	return subscriptionIds, nil
+}
@@ -0,0 +1,201 @@
+package abs
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/managementgroups/armmanagementgroups"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockManagementGroupsClient struct {
+	descendants []*armmanagementgroups.DescendantInfo
+	pagerError  error
+}
+
+func (mock *mockManagementGroupsClient) NewGetDescendantsPager(groupID string, options *armmanagementgroups.ClientGetDescendantsOptions) *runtime.Pager[armmanagementgroups.ClientGetDescendantsResponse] {
+	descendantsPages := []armmanagementgroups.ClientGetDescendantsResponse{
+		{
+			DescendantListResult: armmanagementgroups.DescendantListResult{
+				Value: mock.descendants,
+			},
+		},
+	}
+
+	return CreatePager(descendantsPages, mock.pagerError)
+}
+
+func Test_storageAccountFilter_matches(t *testing.T) {
+	namePatternFilter, _ := newStorageAccountFilter(nil, "^prod")
+
+	tests := []struct {
+		name     string
+		filter   storageAccountFilter
+		account  armstorage.Account
+		expected bool
+	}{
+		{
+			name:     "Empty filter matches every account",
+			filter:   storageAccountFilter{},
+			account:  armstorage.Account{Name: to.Ptr("anyaccount")},
+			expected: true,
+		},
+		{
+			name:     "Name pattern matches",
+			filter:   namePatternFilter,
+			account:  armstorage.Account{Name: to.Ptr("prodaccount")},
+			expected: true,
+		},
+		{
+			name:     "Name pattern does not match",
+			filter:   namePatternFilter,
+			account:  armstorage.Account{Name: to.Ptr("devaccount")},
+			expected: false,
+		},
+		{
+			name:     "Tag name is matched case-insensitively",
+			filter:   storageAccountFilter{tags: map[string]string{"environment": "prod"}},
+			account:  armstorage.Account{Tags: map[string]*string{"Environment": to.Ptr("prod")}},
+			expected: true,
+		},
+		{
+			name:     "Tag value does not match",
+			filter:   storageAccountFilter{tags: map[string]string{"environment": "prod"}},
+			account:  armstorage.Account{Tags: map[string]*string{"Environment": to.Ptr("dev")}},
+			expected: false,
+		},
+		{
+			name:     "Empty tag value matches any value",
+			filter:   storageAccountFilter{tags: map[string]string{"owner": ""}},
+			account:  armstorage.Account{Tags: map[string]*string{"owner": to.Ptr("security")}},
+			expected: true,
+		},
+		{
+			name:     "Missing tag does not match",
+			filter:   storageAccountFilter{tags: map[string]string{"owner": ""}},
+			account:  armstorage.Account{},
+			expected: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, tt.filter.matches(&tt.account))
+		})
+	}
+}
+
+func Test_newStorageAccountFilter_fails_with_invalid_name_pattern(t *testing.T) {
+	// Act
+	_, err := newStorageAccountFilter(nil, "[")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to parse storage account name filter")
+}
+
+func Test_discoverStorageAccountsInResourceGroup_succeeds(t *testing.T) {
+	// Arrange
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	armstorageClient = &mockAccountsClient{
+		accounts: []*armstorage.Account{
+			{ID: to.Ptr("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Storage/storageAccounts/accountone")},
+			{ID: to.Ptr("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Storage/storageAccounts/accounttwo")},
+		},
+	}
+
+	// Act
+	ids, err := discoverStorageAccountsInResourceGroup("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, ids, 2)
+}
+
+func Test_discoverStorageAccountsInResourceGroup_fails_when_list_errors(t *testing.T) {
+	// Arrange
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	armstorageClient = &mockAccountsClient{listError: assert.AnError}
+
+	// Act
+	_, err := discoverStorageAccountsInResourceGroup("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to list storage accounts in resource group")
+}
+
+func Test_discoverStorageAccountsInResourceGroup_fails_with_invalid_id(t *testing.T) {
+	// Act
+	_, err := discoverStorageAccountsInResourceGroup("my-rg")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to parse resource group ID")
+}
+
+func Test_discoverStorageAccountsInSubscription_applies_filter(t *testing.T) {
+	// Arrange
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	discoveryFilter = storageAccountFilter{tags: map[string]string{"environment": "prod"}}
+	defer func() { discoveryFilter = storageAccountFilter{} }()
+
+	armstorageClient = &mockAccountsClient{
+		accounts: []*armstorage.Account{
+			{
+				ID:   to.Ptr("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Storage/storageAccounts/accountone"),
+				Tags: map[string]*string{"environment": to.Ptr("prod")},
+			},
+			{
+				ID:   to.Ptr("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Storage/storageAccounts/accounttwo"),
+				Tags: map[string]*string{"environment": to.Ptr("dev")},
+			},
+		},
+	}
+
+	// Act
+	ids, err := discoverStorageAccountsInSubscription("/subscriptions/00000000-0000-0000-0000-000000000000")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Storage/storageAccounts/accountone"}, ids)
+}
+
+func Test_discoverStorageAccountsInSubscription_fails_when_list_errors(t *testing.T) {
+	// Arrange
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	armstorageClient = &mockAccountsClient{listError: assert.AnError}
+
+	// Act
+	_, err := discoverStorageAccountsInSubscription("00000000-0000-0000-0000-000000000000")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to list storage accounts in subscription")
+}
+
+func Test_discoverSubscriptionsInManagementGroup_succeeds(t *testing.T) {
+	// Arrange
+	managementGroupsClient = &mockManagementGroupsClient{
+		descendants: []*armmanagementgroups.DescendantInfo{
+			{Name: to.Ptr("child-group"), Type: to.Ptr("Microsoft.Management/managementGroups")},
+			{Name: to.Ptr("00000000-0000-0000-0000-000000000000"), Type: to.Ptr("/subscriptions")},
+		},
+	}
+
+	// Act
+	subscriptionIds, err := discoverSubscriptionsInManagementGroup("/providers/Microsoft.Management/managementGroups/my-group")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"00000000-0000-0000-0000-000000000000"}, subscriptionIds)
+}
+
+func Test_discoverSubscriptionsInManagementGroup_fails_when_pager_errors(t *testing.T) {
+	// Arrange
+	managementGroupsClient = &mockManagementGroupsClient{pagerError: assert.AnError}
+
+	// Act
+	_, err := discoverSubscriptionsInManagementGroup("my-group")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to list descendants of management group")
+}
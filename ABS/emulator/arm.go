@@ -0,0 +1,831 @@
+package emulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/policyinsights/armpolicyinsights"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/security/armsecurity"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/google/uuid"
+)
+
+const (
+	accountPath       = `/subscriptions/([^/]+)/resourceGroups/([^/]+)/providers/Microsoft\.Storage/storageAccounts/([^/]+)`
+	resourceGroupPath = `/subscriptions/([^/]+)/resourceGroups/([^/]+)`
+	vaultsPath        = resourceGroupPath + `/providers/Microsoft\.RecoveryServices/vaults`
+)
+
+var (
+	correlationIdFilterRegex = regexp.MustCompile(`correlationId eq '([^']+)'`)
+	policyStateFilterRegex   = regexp.MustCompile(`policyAssignmentId eq '([^']+)'`)
+	containerNameFilterRegex = regexp.MustCompile(`startswith\(name, *'([^']*)'\)`)
+)
+
+// account is the state of an emulated storage account, which changes as the TestSets create and delete containers and blobs
+type account struct {
+	Account
+	resourceID string
+	containers map[string]*container
+}
+
+type container struct {
+	name         string
+	deleted      bool
+	deletedTime  time.Time
+	lastModified time.Time
+	blobs        map[string]*blob
+	// properties are those of a container in the scenario, the containers created by TestSets have none
+	properties armstorage.ContainerProperties
+	// storedAccessPolicies are those of a container in the scenario
+	storedAccessPolicies []StoredAccessPolicy
+}
+
+func (s *Server) addAccount(fixture Account) {
+	resourceGroup := fixture.ResourceGroup
+
+	if resourceGroup == "" {
+		resourceGroup = DefaultResourceGroup
+	}
+
+	a := &account{
+		Account:    fixture,
+		resourceID: fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s", s.scenario.SubscriptionID, resourceGroup, *fixture.Name),
+		containers: make(map[string]*container),
+	}
+
+	a.ResourceGroup = resourceGroup
+	a.ID = to.Ptr(a.resourceID)
+	a.Type = to.Ptr("Microsoft.Storage/storageAccounts")
+
+	if a.Properties == nil {
+		a.Properties = &armstorage.AccountProperties{}
+	}
+
+	a.Properties.ProvisioningState = to.Ptr(armstorage.ProvisioningStateSucceeded)
+	a.Properties.PrimaryLocation = a.Location
+	a.Properties.PrimaryEndpoints = &armstorage.Endpoints{Blob: to.Ptr(s.URL + "/" + *fixture.Name + "/")}
+
+	a.BlobService.ID = to.Ptr(a.resourceID + "/blobServices/default")
+	a.BlobService.Name = to.Ptr("default")
+	a.BlobService.Type = to.Ptr("Microsoft.Storage/storageAccounts/blobServices")
+
+	for _, setting := range a.DiagnosticSettings {
+		if setting.Type == nil {
+			setting.Type = to.Ptr("Microsoft.Insights/diagnosticSettings")
+		}
+
+		if setting.ID == nil && setting.Name != nil {
+			setting.ID = to.Ptr(a.resourceID + "/blobServices/default/providers/Microsoft.Insights/diagnosticSettings/" + *setting.Name)
+		}
+	}
+
+	for _, assignment := range s.scenario.PolicyAssignments {
+		if assignment.ID == nil && assignment.Name != nil {
+			assignment.ID = to.Ptr(fmt.Sprintf("/subscriptions/%s/providers/Microsoft.Authorization/policyAssignments/%s", s.scenario.SubscriptionID, *assignment.Name))
+		}
+	}
+
+	for name, properties := range fixture.Containers {
+		a.containers[name] = &container{
+			name:                 name,
+			lastModified:         time.Now().UTC(),
+			blobs:                make(map[string]*blob),
+			properties:           properties,
+			storedAccessPolicies: fixture.StoredAccessPolicies[name],
+		}
+	}
+
+	s.accounts[strings.ToLower(*fixture.Name)] = a
+}
+
+// getAccount returns the storage account named in the request, writing a Resource Manager error when there is none
+func (s *Server) getAccount(w http.ResponseWriter, name string) *account {
+	a, ok := s.accounts[strings.ToLower(name)]
+
+	if !ok {
+		writeARMError(w, http.StatusNotFound, "ResourceNotFound", fmt.Sprintf("The Resource 'Microsoft.Storage/storageAccounts/%s' was not found.", name))
+		return nil
+	}
+
+	return a
+}
+
+// getAccountResource returns the storage account as Resource Manager describes it at the time of the request
+func (a *account) getAccountResource() armstorage.Account {
+	resource := a.Account.Account
+	properties := *resource.Properties
+	resource.Properties = &properties
+
+	// The secondary of a geo-replicated account is always available and recently synced
+	if resource.SKU != nil && resource.SKU.Name != nil && (strings.Contains(string(*resource.SKU.Name), "GRS") || strings.Contains(string(*resource.SKU.Name), "GZRS")) {
+		properties.StatusOfSecondary = to.Ptr(armstorage.AccountStatusAvailable)
+		properties.GeoReplicationStats = &armstorage.GeoReplicationStats{
+			Status:       to.Ptr(armstorage.GeoReplicationStatusLive),
+			LastSyncTime: to.Ptr(time.Now().UTC().Add(-time.Minute)),
+		}
+	}
+
+	return resource
+}
+
+// recordActivity adds a Resource Manager write to the activity log, under the correlation ID of its response
+func (s *Server) recordActivity(w http.ResponseWriter, operationName string, resourceID string) {
+	s.activities = append(s.activities, activity{
+		correlationID: w.Header().Get("x-ms-correlation-request-id"),
+		operationName: operationName,
+		resourceID:    resourceID,
+		time:          time.Now().UTC(),
+	})
+}
+
+func (s *Server) armRoutes() []route {
+	return []route{
+		// Storage accounts
+		newRoute(http.MethodGet, accountPath, s.getStorageAccount),
+		newRoute(http.MethodPut, accountPath, s.createStorageAccount),
+		newRoute(http.MethodPatch, accountPath, s.updateStorageAccount),
+		newRoute(http.MethodDelete, accountPath, s.deleteStorageAccount),
+		newRoute(http.MethodGet, resourceGroupPath+`/providers/Microsoft\.Storage/storageAccounts`, s.listStorageAccounts),
+		newRoute(http.MethodGet, `/subscriptions/([^/]+)/providers/Microsoft\.Storage/storageAccounts`, s.listStorageAccounts),
+		newRoute(http.MethodPost, accountPath+`/regenerateKey`, s.regenerateKey),
+		newRoute(http.MethodGet, accountPath+`/blobServices/default`, s.getBlobServiceProperties),
+		newRoute(http.MethodPut, accountPath+`/blobServices/default`, s.setBlobServiceProperties),
+		newRoute(http.MethodGet, accountPath+`/blobServices/default/containers`, s.listContainers),
+		newRoute(http.MethodPut, accountPath+`/blobServices/default/containers/([^/]+)`, s.createContainer),
+		newRoute(http.MethodDelete, accountPath+`/blobServices/default/containers/([^/]+)`, s.deleteContainer),
+		newRoute(http.MethodGet, accountPath+`/encryptionScopes`, s.listEncryptionScopes),
+		newRoute(http.MethodGet, `/subscriptions/([^/]+)/providers/Microsoft\.Storage/skus`, s.listSKUs),
+
+		// Azure Monitor and Microsoft Defender for Cloud
+		newRoute(http.MethodGet, accountPath+`/blobServices/default/providers/Microsoft\.Insights/diagnosticSettings`, s.listDiagnosticSettings),
+		newRoute(http.MethodGet, `/subscriptions/([^/]+)/providers/Microsoft\.Insights/eventtypes/management/values`, s.listActivityLogs),
+		newRoute(http.MethodGet, accountPath+`/providers/Microsoft\.Security/defenderForStorageSettings/current`, s.getDefenderForStorage),
+
+		// Authorization
+		newRoute(http.MethodPut, `(/.+)/providers/Microsoft\.Authorization/roleAssignments/([^/]+)`, s.createRoleAssignment),
+		newRoute(http.MethodDelete, `(/.+)/providers/Microsoft\.Authorization/roleAssignments/([^/]+)`, s.deleteRoleAssignment),
+		newRoute(http.MethodGet, `(/.+)/providers/Microsoft\.Authorization/roleAssignments`, s.listRoleAssignments),
+		newRoute(http.MethodGet, accountPath+`/providers/Microsoft\.Authorization/permissions`, s.listPermissions),
+		newRoute(http.MethodGet, resourceGroupPath+`/providers/Microsoft\.Authorization/permissions`, s.listPermissions),
+
+		// Azure Policy
+		newRoute(http.MethodGet, accountPath+`/providers/Microsoft\.Authorization/policyAssignments`, s.listPolicyAssignments),
+		newRoute(http.MethodGet, `/providers/Microsoft\.Authorization/policyDefinitions/([^/]+)`, s.getPolicyDefinition),
+		newRoute(http.MethodPost, accountPath+`/providers/Microsoft\.PolicyInsights/policyStates/latest/queryResults`, s.queryPolicyStates),
+
+		// Subscriptions, Recovery Services and Key Vault
+		newRoute(http.MethodGet, `/subscriptions/([^/]+)/locations`, s.listLocations),
+		newRoute(http.MethodGet, vaultsPath, s.listVaults),
+		newRoute(http.MethodPut, vaultsPath+`/([^/]+)`, s.createVault),
+		newRoute(http.MethodDelete, vaultsPath+`/([^/]+)`, s.deleteVault),
+		newRoute(http.MethodGet, `/subscriptions/([^/]+)/providers/Microsoft\.KeyVault/vaults`, s.listKeyVaults),
+	}
+}
+
+func (s *Server) getStorageAccount(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if a := s.getAccount(w, match[3]); a != nil {
+		writeJSON(w, http.StatusOK, a.getAccountResource())
+	}
+}
+
+// createStorageAccount creates an account unless the Allowed locations policy denies its location, as Azure Policy would
+func (s *Server) createStorageAccount(w http.ResponseWriter, r *http.Request, match []string) {
+	var parameters armstorage.AccountCreateParameters
+
+	if err := json.NewDecoder(r.Body).Decode(&parameters); err != nil || parameters.Location == nil {
+		writeARMError(w, http.StatusBadRequest, "InvalidRequestContent", "The request content was invalid and could not be deserialized.")
+		return
+	}
+
+	if allowedLocations := s.getAllowedLocations(); allowedLocations != nil && !slices.Contains(allowedLocations, strings.ToLower(*parameters.Location)) {
+		writeARMError(w, http.StatusForbidden, "RequestDisallowedByPolicy", fmt.Sprintf("Resource '%s' was disallowed by policy. Location '%s' is not allowed.", match[3], *parameters.Location))
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	fixture := Account{
+		Account: armstorage.Account{
+			Name:     to.Ptr(match[3]),
+			Location: parameters.Location,
+			Kind:     parameters.Kind,
+			SKU:      parameters.SKU,
+			Tags:     parameters.Tags,
+			Properties: &armstorage.AccountProperties{
+				MinimumTLSVersion: to.Ptr(armstorage.MinimumTLSVersionTLS12),
+			},
+		},
+		ResourceGroup: match[2],
+	}
+
+	s.addAccount(fixture)
+
+	a := s.accounts[strings.ToLower(match[3])]
+	s.recordActivity(w, "Create/Update Storage Account", a.resourceID)
+
+	writeJSON(w, http.StatusOK, a.getAccountResource())
+}
+
+func (s *Server) deleteStorageAccount(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if _, ok := s.accounts[strings.ToLower(match[3])]; !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	delete(s.accounts, strings.ToLower(match[3]))
+	s.recordActivity(w, "Delete Storage Account", r.URL.Path)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listStorageAccounts(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	var accounts []*armstorage.Account
+
+	for _, a := range s.accounts {
+		if len(match) > 2 && !strings.EqualFold(a.ResourceGroup, match[2]) {
+			continue
+		}
+
+		resource := a.getAccountResource()
+		accounts = append(accounts, &resource)
+	}
+
+	slices.SortFunc(accounts, func(a, b *armstorage.Account) int {
+		return strings.Compare(*a.Name, *b.Name)
+	})
+
+	writeJSON(w, http.StatusOK, armstorage.AccountListResult{Value: accounts})
+}
+
+func (s *Server) regenerateKey(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	var parameters armstorage.AccountRegenerateKeyParameters
+
+	if err := json.NewDecoder(r.Body).Decode(&parameters); err != nil || parameters.KeyName == nil {
+		writeARMError(w, http.StatusBadRequest, "InvalidRequestContent", "The request content was invalid and could not be deserialized.")
+		return
+	}
+
+	if a.Properties.KeyCreationTime == nil {
+		a.Properties.KeyCreationTime = &armstorage.KeyCreationTime{}
+	}
+
+	switch strings.ToLower(*parameters.KeyName) {
+	case "key1":
+		a.Properties.KeyCreationTime.Key1 = to.Ptr(time.Now().UTC())
+	case "key2":
+		a.Properties.KeyCreationTime.Key2 = to.Ptr(time.Now().UTC())
+	}
+
+	s.recordActivity(w, "Regenerate Storage Account Keys", a.resourceID)
+
+	writeJSON(w, http.StatusOK, armstorage.AccountListKeysResult{
+		Keys: []*armstorage.AccountKey{
+			{KeyName: to.Ptr("key1"), Permissions: to.Ptr(armstorage.KeyPermissionFull), Value: to.Ptr(uuid.NewString())},
+			{KeyName: to.Ptr("key2"), Permissions: to.Ptr(armstorage.KeyPermissionFull), Value: to.Ptr(uuid.NewString())},
+		},
+	})
+}
+
+// updateStorageAccount applies the properties in the request to the account, those which are not in the request are left unchanged
+func (s *Server) updateStorageAccount(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	if err := mergePatch(&a.Account.Account, r); err != nil {
+		writeARMError(w, http.StatusBadRequest, "InvalidRequestContent", "The request content was invalid and could not be deserialized.")
+		return
+	}
+
+	s.recordActivity(w, "Create/Update Storage Account", a.resourceID)
+
+	writeJSON(w, http.StatusOK, a.getAccountResource())
+}
+
+// setBlobServiceProperties applies the properties in the request to the blob service, as Azure leaves those which are not in the request unchanged
+func (s *Server) setBlobServiceProperties(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	if err := mergePatch(&a.BlobService, r); err != nil {
+		writeARMError(w, http.StatusBadRequest, "InvalidRequestContent", "The request content was invalid and could not be deserialized.")
+		return
+	}
+
+	s.recordActivity(w, "Put blob service properties", a.resourceID)
+
+	writeJSON(w, http.StatusOK, a.BlobService)
+}
+
+// mergePatch merges the JSON body of the request into a model of the Azure SDK, in the same way as a JSON merge patch
+func mergePatch[T any](model *T, r *http.Request) error {
+	var patch map[string]any
+
+	if err := json.NewDecoder(r.Body).Decode(&patch); err != nil {
+		return err
+	}
+
+	current, err := json.Marshal(model)
+
+	if err != nil {
+		return err
+	}
+
+	var merged map[string]any
+
+	if err = json.Unmarshal(current, &merged); err != nil {
+		return err
+	}
+
+	mergeJSON(merged, patch)
+
+	contents, err := json.Marshal(merged)
+
+	if err != nil {
+		return err
+	}
+
+	var updated T
+
+	if err = json.Unmarshal(contents, &updated); err != nil {
+		return err
+	}
+
+	*model = updated
+
+	return nil
+}
+
+func mergeJSON(current map[string]any, patch map[string]any) {
+	for key, value := range patch {
+		patchObject, isObject := value.(map[string]any)
+		currentObject, currentIsObject := current[key].(map[string]any)
+
+		switch {
+		case value == nil:
+			delete(current, key)
+		case isObject && currentIsObject:
+			mergeJSON(currentObject, patchObject)
+		default:
+			current[key] = value
+		}
+	}
+}
+
+func (s *Server) getBlobServiceProperties(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if a := s.getAccount(w, match[3]); a != nil {
+		writeJSON(w, http.StatusOK, a.BlobService)
+	}
+}
+
+// listContainers lists the containers of an account, soft deleted containers are only included when requested
+func (s *Server) listContainers(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	includeDeleted := strings.EqualFold(r.URL.Query().Get("$include"), string(armstorage.ListContainersIncludeDeleted))
+	prefix := ""
+
+	if filter := containerNameFilterRegex.FindStringSubmatch(r.URL.Query().Get("$filter")); filter != nil {
+		prefix = filter[1]
+	} else if filter := r.URL.Query().Get("$filter"); filter != "" {
+		prefix = filter
+	}
+
+	var containers []*armstorage.ListContainerItem
+
+	for _, c := range a.containers {
+		if (c.deleted && !includeDeleted) || !strings.HasPrefix(c.name, prefix) {
+			continue
+		}
+
+		containers = append(containers, a.getContainerItem(c))
+	}
+
+	slices.SortFunc(containers, func(a, b *armstorage.ListContainerItem) int {
+		return strings.Compare(*a.Name, *b.Name)
+	})
+
+	writeJSON(w, http.StatusOK, armstorage.ListContainerItems{Value: containers})
+}
+
+func (a *account) getContainerItem(c *container) *armstorage.ListContainerItem {
+	item := &armstorage.ListContainerItem{
+		ID:         to.Ptr(a.resourceID + "/blobServices/default/containers/" + c.name),
+		Name:       to.Ptr(c.name),
+		Type:       to.Ptr("Microsoft.Storage/storageAccounts/blobServices/containers"),
+		Properties: to.Ptr(c.properties),
+	}
+
+	item.Properties.LastModifiedTime = to.Ptr(c.lastModified)
+	item.Properties.Deleted = to.Ptr(c.deleted)
+	item.Properties.HasImmutabilityPolicy = to.Ptr(c.properties.ImmutabilityPolicy != nil)
+
+	if item.Properties.PublicAccess == nil {
+		item.Properties.PublicAccess = to.Ptr(armstorage.PublicAccessNone)
+	}
+
+	if item.Properties.HasLegalHold == nil {
+		item.Properties.HasLegalHold = to.Ptr(false)
+	}
+
+	if c.deleted {
+		item.Properties.DeletedTime = to.Ptr(c.deletedTime)
+	}
+
+	return item
+}
+
+func (s *Server) createContainer(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	if c, ok := a.containers[match[4]]; ok && !c.deleted {
+		writeARMError(w, http.StatusConflict, "ContainerAlreadyExists", "The specified container already exists.")
+		return
+	}
+
+	c := &container{
+		name:         match[4],
+		lastModified: time.Now().UTC(),
+		blobs:        make(map[string]*blob),
+	}
+
+	a.containers[c.name] = c
+
+	writeJSON(w, http.StatusCreated, armstorage.BlobContainer{
+		ID:                  a.getContainerItem(c).ID,
+		Name:                to.Ptr(c.name),
+		ContainerProperties: a.getContainerItem(c).Properties,
+	})
+}
+
+// deleteContainer soft deletes the container when container soft delete is enabled on the account
+func (s *Server) deleteContainer(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	c, ok := a.containers[match[4]]
+
+	if !ok || c.deleted {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	retentionPolicy := a.BlobService.BlobServiceProperties.ContainerDeleteRetentionPolicy
+
+	if retentionPolicy != nil && retentionPolicy.Enabled != nil && *retentionPolicy.Enabled {
+		c.deleted = true
+		c.deletedTime = time.Now().UTC()
+	} else {
+		delete(a.containers, c.name)
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listEncryptionScopes(w http.ResponseWriter, r *http.Request, match []string) {
+	writeJSON(w, http.StatusOK, armstorage.EncryptionScopeListResult{Value: []*armstorage.EncryptionScope{}})
+}
+
+func (s *Server) listSKUs(w http.ResponseWriter, r *http.Request, match []string) {
+	writeJSON(w, http.StatusOK, armstorage.SKUListResult{Value: s.scenario.SKUs})
+}
+
+func (s *Server) listDiagnosticSettings(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if a := s.getAccount(w, match[3]); a != nil {
+		writeJSON(w, http.StatusOK, armmonitor.DiagnosticSettingsResourceCollection{Value: a.DiagnosticSettings})
+	}
+}
+
+// listActivityLogs returns the Resource Manager writes with the correlation ID in the filter
+func (s *Server) listActivityLogs(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	events := []*armmonitor.EventData{}
+	filter := correlationIdFilterRegex.FindStringSubmatch(r.URL.Query().Get("$filter"))
+
+	for _, activity := range s.activities {
+		if filter == nil || activity.correlationID != filter[1] {
+			continue
+		}
+
+		events = append(events, &armmonitor.EventData{
+			CorrelationID:  to.Ptr(activity.correlationID),
+			EventTimestamp: to.Ptr(activity.time),
+			OperationName:  &armmonitor.LocalizableString{Value: to.Ptr(activity.operationName), LocalizedValue: to.Ptr(activity.operationName)},
+			ResourceID:     to.Ptr(activity.resourceID),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, armmonitor.EventDataCollection{Value: events})
+}
+
+func (s *Server) getDefenderForStorage(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	writeJSON(w, http.StatusOK, armsecurity.DefenderForStorageSetting{
+		ID:   to.Ptr(a.resourceID + "/providers/Microsoft.Security/defenderForStorageSettings/current"),
+		Name: to.Ptr("current"),
+		Type: to.Ptr("Microsoft.Security/defenderForStorageSettings"),
+		Properties: &armsecurity.DefenderForStorageSettingProperties{
+			IsEnabled: to.Ptr(a.DefenderForStorage),
+		},
+	})
+}
+
+func (s *Server) createRoleAssignment(w http.ResponseWriter, r *http.Request, match []string) {
+	var parameters armauthorization.RoleAssignmentCreateParameters
+
+	if err := json.NewDecoder(r.Body).Decode(&parameters); err != nil || parameters.Properties == nil {
+		writeARMError(w, http.StatusBadRequest, "InvalidRequestContent", "The request content was invalid and could not be deserialized.")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := match[1] + "/providers/Microsoft.Authorization/roleAssignments/" + match[2]
+	parameters.Properties.Scope = to.Ptr(match[1])
+
+	s.roleAssignments[strings.ToLower(id)] = &armauthorization.RoleAssignment{
+		ID:         to.Ptr(id),
+		Name:       to.Ptr(match[2]),
+		Type:       to.Ptr("Microsoft.Authorization/roleAssignments"),
+		Properties: parameters.Properties,
+	}
+
+	s.recordActivity(w, "Create role assignment", id)
+
+	writeJSON(w, http.StatusCreated, s.roleAssignments[strings.ToLower(id)])
+}
+
+func (s *Server) deleteRoleAssignment(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := match[1] + "/providers/Microsoft.Authorization/roleAssignments/" + match[2]
+	roleAssignment, ok := s.roleAssignments[strings.ToLower(id)]
+
+	if !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	delete(s.roleAssignments, strings.ToLower(id))
+	s.recordActivity(w, "Delete role assignment", id)
+
+	writeJSON(w, http.StatusOK, roleAssignment)
+}
+
+func (s *Server) listRoleAssignments(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	roleAssignments := []*armauthorization.RoleAssignment{}
+
+	for id, roleAssignment := range s.roleAssignments {
+		if strings.HasPrefix(id, strings.ToLower(match[1])+"/") {
+			roleAssignments = append(roleAssignments, roleAssignment)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, armauthorization.RoleAssignmentListResult{Value: roleAssignments})
+}
+
+// listPermissions grants the emulator's identity every action, so that the preflight check passes
+func (s *Server) listPermissions(w http.ResponseWriter, r *http.Request, match []string) {
+	writeJSON(w, http.StatusOK, armauthorization.PermissionGetResult{
+		Value: []*armauthorization.Permission{
+			{Actions: []*string{to.Ptr("*")}, DataActions: []*string{to.Ptr("*")}},
+		},
+	})
+}
+
+func (s *Server) listPolicyAssignments(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if s.getAccount(w, match[3]) != nil {
+		writeJSON(w, http.StatusOK, armpolicy.AssignmentListResult{Value: s.scenario.PolicyAssignments})
+	}
+}
+
+// getPolicyDefinition returns the built-in definitions that the scenario assigns, they audit storage accounts as their rules are not evaluated by the emulator
+func (s *Server) getPolicyDefinition(w http.ResponseWriter, r *http.Request, match []string) {
+	definitionID := "/providers/Microsoft.Authorization/policyDefinitions/" + match[1]
+
+	if !slices.ContainsFunc(s.scenario.PolicyAssignments, func(assignment *armpolicy.Assignment) bool {
+		return assignment.Properties != nil && assignment.Properties.PolicyDefinitionID != nil && strings.EqualFold(*assignment.Properties.PolicyDefinitionID, definitionID)
+	}) {
+		writeARMError(w, http.StatusNotFound, "PolicyDefinitionNotFound", fmt.Sprintf("The policy definition '%s' could not be found.", match[1]))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, armpolicy.Definition{
+		ID:   to.Ptr(definitionID),
+		Name: to.Ptr(match[1]),
+		Type: to.Ptr("Microsoft.Authorization/policyDefinitions"),
+		Properties: &armpolicy.DefinitionProperties{
+			PolicyType: to.Ptr(armpolicy.PolicyTypeBuiltIn),
+			Mode:       to.Ptr("Indexed"),
+			PolicyRule: map[string]any{
+				"if":   map[string]any{"field": "type", "equals": "Microsoft.Storage/storageAccounts"},
+				"then": map[string]any{"effect": "audit"},
+			},
+		},
+	})
+}
+
+// queryPolicyStates returns the scenario's compliance state for the assignment in the filter
+func (s *Server) queryPolicyStates(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	a := s.getAccount(w, match[3])
+
+	if a == nil {
+		return
+	}
+
+	states := []*armpolicyinsights.PolicyState{}
+	filter := policyStateFilterRegex.FindStringSubmatch(r.URL.Query().Get("$filter"))
+
+	for _, assignment := range s.scenario.PolicyAssignments {
+		if filter == nil || assignment.ID == nil || !strings.EqualFold(*assignment.ID, filter[1]) {
+			continue
+		}
+
+		states = append(states, &armpolicyinsights.PolicyState{
+			ResourceID:         to.Ptr(a.resourceID),
+			PolicyAssignmentID: assignment.ID,
+			PolicyDefinitionID: assignment.Properties.PolicyDefinitionID,
+			ComplianceState:    to.Ptr(s.scenario.PolicyComplianceState),
+			Timestamp:          to.Ptr(time.Now().UTC().Add(-time.Hour)),
+		})
+	}
+
+	writeJSON(w, http.StatusOK, armpolicyinsights.PolicyStatesQueryResults{Value: states})
+}
+
+// getAllowedLocations returns the locations permitted by an Allowed locations policy assignment, or nil when there is none
+func (s *Server) getAllowedLocations() (allowedLocations []string) {
+	for _, assignment := range s.scenario.PolicyAssignments {
+		if assignment.Properties == nil || assignment.Properties.PolicyDefinitionID == nil || !strings.EqualFold(*assignment.Properties.PolicyDefinitionID, allowedLocationsPolicyDefinitionID) {
+			continue
+		}
+
+		if parameter, ok := assignment.Properties.Parameters["listOfAllowedLocations"]; ok && parameter != nil {
+			switch locations := parameter.Value.(type) {
+			case []string:
+				allowedLocations = append(allowedLocations, locations...)
+			case []any:
+				for _, location := range locations {
+					allowedLocations = append(allowedLocations, strings.ToLower(fmt.Sprint(location)))
+				}
+			}
+		}
+	}
+
+	return allowedLocations
+}
+
+func (s *Server) listLocations(w http.ResponseWriter, r *http.Request, match []string) {
+	writeJSON(w, http.StatusOK, map[string]any{"value": s.scenario.Locations})
+}
+
+func (s *Server) listVaults(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	vaults := []*armrecoveryservices.Vault{}
+
+	for id, vault := range s.vaults {
+		if strings.HasPrefix(id, strings.ToLower(strings.TrimSuffix(r.URL.Path, "/"))+"/") {
+			vaults = append(vaults, vault)
+		}
+	}
+
+	writeJSON(w, http.StatusOK, armrecoveryservices.VaultList{Value: vaults})
+}
+
+// createVault creates a Recovery Services vault unless the Allowed locations policy denies its location
+func (s *Server) createVault(w http.ResponseWriter, r *http.Request, match []string) {
+	var vault armrecoveryservices.Vault
+
+	if err := json.NewDecoder(r.Body).Decode(&vault); err != nil || vault.Location == nil {
+		writeARMError(w, http.StatusBadRequest, "InvalidRequestContent", "The request content was invalid and could not be deserialized.")
+		return
+	}
+
+	if allowedLocations := s.getAllowedLocations(); allowedLocations != nil && !slices.Contains(allowedLocations, strings.ToLower(*vault.Location)) {
+		writeARMError(w, http.StatusForbidden, "RequestDisallowedByPolicy", fmt.Sprintf("Resource '%s' was disallowed by policy. Location '%s' is not allowed.", match[3], *vault.Location))
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.RecoveryServices/vaults/%s", match[1], match[2], match[3])
+	vault.ID = to.Ptr(id)
+	vault.Name = to.Ptr(match[3])
+	vault.Type = to.Ptr("Microsoft.RecoveryServices/vaults")
+	s.vaults[strings.ToLower(id)] = &vault
+	s.recordActivity(w, "Create or Update vault", id)
+
+	writeJSON(w, http.StatusOK, vault)
+}
+
+func (s *Server) deleteVault(w http.ResponseWriter, r *http.Request, match []string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	id := fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.RecoveryServices/vaults/%s", match[1], match[2], match[3])
+
+	if _, ok := s.vaults[strings.ToLower(id)]; !ok {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	delete(s.vaults, strings.ToLower(id))
+	s.recordActivity(w, "Delete vault", id)
+
+	w.WriteHeader(http.StatusOK)
+}
+
+func (s *Server) listKeyVaults(w http.ResponseWriter, r *http.Request, match []string) {
+	writeJSON(w, http.StatusOK, map[string]any{"value": []any{}})
+}
@@ -0,0 +1,468 @@
+package emulator
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/google/uuid"
+)
+
+var (
+	correlationIdQueryRegex = regexp.MustCompile(`CorrelationId == '([^']+)'`)
+	statusCodeQueryRegex    = regexp.MustCompile(`StatusCode == (\d+)`)
+
+	// minimumTLSVersions are the TLS versions that each minimum TLS version setting of a storage account accepts from
+	minimumTLSVersions = map[armstorage.MinimumTLSVersion]uint16{
+		armstorage.MinimumTLSVersionTLS10: tls.VersionTLS10,
+		armstorage.MinimumTLSVersionTLS11: tls.VersionTLS11,
+		armstorage.MinimumTLSVersionTLS12: tls.VersionTLS12,
+		armstorage.MinimumTLSVersionTLS13: tls.VersionTLS13,
+	}
+)
+
+// blob is a blob in an emulated container, with every version of it when versioning is enabled on the account
+type blob struct {
+	// versions are oldest first, the last is the current version unless the blob is deleted
+	versions    []blobVersion
+	deleted     bool
+	uncommitted map[string][]byte
+}
+
+type blobVersion struct {
+	id           string
+	content      []byte
+	lastModified time.Time
+}
+
+// statusRecorder captures the status code of a response so that the request can be logged
+type statusRecorder struct {
+	http.ResponseWriter
+	statusCode int
+}
+
+func (r *statusRecorder) WriteHeader(statusCode int) {
+	r.statusCode = statusCode
+	r.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (s *Server) dataPlaneRoutes() []route {
+	return []route{
+		newRoute(http.MethodPost, logAnalyticsPath+accountPath+`(?:/.*)?/query`, s.queryLogs),
+		newRoute(http.MethodGet, `/([a-z0-9]+)/?`, s.withBlobService(s.listBlobContainers)),
+		newRoute(http.MethodGet, `/([a-z0-9]+)/([^/]+)/?`, s.withBlobService(s.readContainer)),
+		newRoute(http.MethodPut, `/([a-z0-9]+)/([^/]+)/(.+)`, s.withBlobService(s.putBlob)),
+		newRoute(http.MethodDelete, `/([a-z0-9]+)/([^/]+)/(.+)`, s.withBlobService(s.deleteBlob)),
+	}
+}
+
+// withBlobService enforces the TLS and authentication requirements of the account named in the path, logging the request if the account sends logs to a workspace
+func (s *Server) withBlobService(handler func(w http.ResponseWriter, r *http.Request, a *account, match []string)) func(w http.ResponseWriter, r *http.Request, match []string) {
+	return func(w http.ResponseWriter, r *http.Request, match []string) {
+		s.mutex.Lock()
+		defer s.mutex.Unlock()
+
+		a, ok := s.accounts[strings.ToLower(match[1])]
+
+		if !ok {
+			writeARMError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("The emulator does not serve %s %s.", r.Method, r.URL.Path))
+			return
+		}
+
+		// Azure Storage rejects connections below the minimum TLS version with a status line that names the problem, which net/http cannot write
+		if r.TLS != nil && r.TLS.Version < a.getMinimumTLSVersion() {
+			rejectRequest(w, "400 The TLS version of the connection is not permitted on this storage account.")
+			return
+		}
+
+		recorder := &statusRecorder{ResponseWriter: w, statusCode: http.StatusOK}
+		principalID := getPrincipalID(r)
+
+		if principalID == "" {
+			writeStorageError(recorder, http.StatusUnauthorized, "NoAuthenticationInformation", "Server failed to authenticate the request. Please refer to the information in the www-authenticate header.")
+		} else {
+			handler(recorder, r, a, match)
+		}
+
+		if a.sendsLogsToWorkspace() {
+			s.requests = append(s.requests, loggedRequest{
+				requestID:         w.Header().Get("x-ms-request-id"),
+				accountName:       *a.Name,
+				statusCode:        recorder.statusCode,
+				requesterObjectID: principalID,
+				time:              time.Now().UTC(),
+			})
+		}
+	}
+}
+
+func (a *account) getMinimumTLSVersion() uint16 {
+	if a.Properties.MinimumTLSVersion == nil {
+		return tls.VersionTLS10
+	}
+
+	return minimumTLSVersions[*a.Properties.MinimumTLSVersion]
+}
+
+func (a *account) sendsLogsToWorkspace() bool {
+	return slices.ContainsFunc(a.DiagnosticSettings, func(setting *armmonitor.DiagnosticSettingsResource) bool {
+		return setting.Properties != nil && setting.Properties.WorkspaceID != nil && *setting.Properties.WorkspaceID != ""
+	})
+}
+
+// rejectRequest writes a status line directly to the connection and closes it
+func rejectRequest(w http.ResponseWriter, status string) {
+	conn, buffer, err := http.NewResponseController(w).Hijack()
+
+	if err != nil {
+		http.Error(w, status, http.StatusBadRequest)
+		return
+	}
+
+	defer conn.Close()
+
+	fmt.Fprintf(buffer, "HTTP/1.1 %s\r\nx-ms-request-id: %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", status, uuid.NewString())
+	buffer.Flush()
+}
+
+func writeStorageError(w http.ResponseWriter, statusCode int, code string, message string) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.Header().Set("x-ms-error-code", code)
+	w.WriteHeader(statusCode)
+
+	fmt.Fprintf(w, `<?xml version="1.0" encoding="utf-8"?><Error><Code>%s</Code><Message>%s</Message></Error>`, code, message)
+}
+
+func writeXML(w http.ResponseWriter, body any) {
+	w.Header().Set("Content-Type", "application/xml")
+	w.WriteHeader(http.StatusOK)
+
+	_, _ = io.WriteString(w, xml.Header)
+	_ = xml.NewEncoder(w).Encode(body)
+}
+
+type containerList struct {
+	XMLName         xml.Name             `xml:"EnumerationResults"`
+	ServiceEndpoint string               `xml:"ServiceEndpoint,attr"`
+	Containers      []containerListEntry `xml:"Containers>Container"`
+	NextMarker      string               `xml:"NextMarker"`
+}
+
+type containerListEntry struct {
+	Name         string `xml:"Name"`
+	LastModified string `xml:"Properties>Last-Modified"`
+}
+
+type blobList struct {
+	XMLName         xml.Name        `xml:"EnumerationResults"`
+	ServiceEndpoint string          `xml:"ServiceEndpoint,attr"`
+	ContainerName   string          `xml:"ContainerName,attr"`
+	Blobs           []blobListEntry `xml:"Blobs>Blob"`
+	NextMarker      string          `xml:"NextMarker"`
+}
+
+type blobListEntry struct {
+	Name             string `xml:"Name"`
+	VersionID        string `xml:"VersionId,omitempty"`
+	IsCurrentVersion *bool  `xml:"IsCurrentVersion,omitempty"`
+	LastModified     string `xml:"Properties>Last-Modified"`
+	ContentLength    int    `xml:"Properties>Content-Length"`
+	BlobType         string `xml:"Properties>BlobType"`
+}
+
+func (s *Server) listBlobContainers(w http.ResponseWriter, r *http.Request, a *account, match []string) {
+	list := containerList{ServiceEndpoint: *a.Properties.PrimaryEndpoints.Blob}
+
+	for _, c := range a.containers {
+		if !c.deleted {
+			list.Containers = append(list.Containers, containerListEntry{Name: c.name, LastModified: c.lastModified.Format(http.TimeFormat)})
+		}
+	}
+
+	slices.SortFunc(list.Containers, func(a, b containerListEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	writeXML(w, list)
+}
+
+type signedIdentifierList struct {
+	XMLName           xml.Name                `xml:"SignedIdentifiers"`
+	SignedIdentifiers []signedIdentifierEntry `xml:"SignedIdentifier"`
+}
+
+type signedIdentifierEntry struct {
+	ID         string `xml:"Id"`
+	Start      string `xml:"AccessPolicy>Start,omitempty"`
+	Expiry     string `xml:"AccessPolicy>Expiry,omitempty"`
+	Permission string `xml:"AccessPolicy>Permission,omitempty"`
+}
+
+// readContainer handles the blob listings and stored access policy reads of a container
+func (s *Server) readContainer(w http.ResponseWriter, r *http.Request, a *account, match []string) {
+	if r.URL.Query().Get("comp") == "acl" {
+		s.getContainerACL(w, r, a, match)
+	} else {
+		s.listBlobs(w, r, a, match)
+	}
+}
+
+// getContainerACL lists the stored access policies of a container
+func (s *Server) getContainerACL(w http.ResponseWriter, r *http.Request, a *account, match []string) {
+	c := a.getContainer(w, match[2])
+
+	if c == nil {
+		return
+	}
+
+	list := signedIdentifierList{}
+
+	for _, policy := range c.storedAccessPolicies {
+		entry := signedIdentifierEntry{ID: policy.ID, Permission: policy.Permission}
+
+		if policy.Start != nil {
+			entry.Start = policy.Start.UTC().Format(time.RFC3339)
+		}
+
+		if policy.Expiry != nil {
+			entry.Expiry = policy.Expiry.UTC().Format(time.RFC3339)
+		}
+
+		list.SignedIdentifiers = append(list.SignedIdentifiers, entry)
+	}
+
+	writeXML(w, list)
+}
+
+// listBlobs lists the current version of each blob, or every version of them when versions are included
+func (s *Server) listBlobs(w http.ResponseWriter, r *http.Request, a *account, match []string) {
+	c := a.getContainer(w, match[2])
+
+	if c == nil {
+		return
+	}
+
+	includeVersions := slices.Contains(strings.Split(r.URL.Query().Get("include"), ","), "versions")
+	list := blobList{ServiceEndpoint: *a.Properties.PrimaryEndpoints.Blob, ContainerName: c.name}
+
+	for name, b := range c.blobs {
+		if !strings.HasPrefix(name, r.URL.Query().Get("prefix")) {
+			continue
+		}
+
+		for i, version := range b.versions {
+			current := i == len(b.versions)-1 && !b.deleted
+
+			if !includeVersions && !current {
+				continue
+			}
+
+			entry := blobListEntry{
+				Name:          name,
+				LastModified:  version.lastModified.Format(http.TimeFormat),
+				ContentLength: len(version.content),
+				BlobType:      "BlockBlob",
+			}
+
+			if includeVersions {
+				entry.VersionID = version.id
+				entry.IsCurrentVersion = &current
+			}
+
+			list.Blobs = append(list.Blobs, entry)
+		}
+	}
+
+	slices.SortStableFunc(list.Blobs, func(a, b blobListEntry) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	writeXML(w, list)
+}
+
+// putBlob handles the block uploads, block list commits, whole blob uploads and undeletes of block blobs
+func (s *Server) putBlob(w http.ResponseWriter, r *http.Request, a *account, match []string) {
+	c := a.getContainer(w, match[2])
+
+	if c == nil {
+		return
+	}
+
+	b, exists := c.blobs[match[3]]
+
+	if !exists {
+		b = &blob{uncommitted: make(map[string][]byte)}
+	}
+
+	switch r.URL.Query().Get("comp") {
+	case "block":
+		content, _ := io.ReadAll(r.Body)
+		b.uncommitted[r.URL.Query().Get("blockid")] = content
+		c.blobs[match[3]] = b
+
+		w.WriteHeader(http.StatusCreated)
+	case "blocklist":
+		var blockList struct {
+			Committed   []string `xml:"Committed"`
+			Latest      []string `xml:"Latest"`
+			Uncommitted []string `xml:"Uncommitted"`
+		}
+
+		if err := xml.NewDecoder(r.Body).Decode(&blockList); err != nil {
+			writeStorageError(w, http.StatusBadRequest, "InvalidXmlDocument", "XML specified is not syntactically valid.")
+			return
+		}
+
+		var content []byte
+
+		for _, blockID := range append(append(blockList.Committed, blockList.Uncommitted...), blockList.Latest...) {
+			content = append(content, b.uncommitted[blockID]...)
+		}
+
+		b.uncommitted = make(map[string][]byte)
+		c.blobs[match[3]] = b
+		a.writeBlobVersion(w, b, content)
+	case "undelete":
+		if !exists {
+			writeStorageError(w, http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+			return
+		}
+
+		// Only soft delete keeps a deleted blob, a blob deleted while versioning is enabled is restored by copying a version over it
+		if a.isBlobSoftDeleteEnabled() {
+			b.deleted = false
+		}
+
+		w.WriteHeader(http.StatusOK)
+	case "":
+		content, _ := io.ReadAll(r.Body)
+		c.blobs[match[3]] = b
+		a.writeBlobVersion(w, b, content)
+	default:
+		writeStorageError(w, http.StatusBadRequest, "UnsupportedQueryParameter", "One of the query parameters specified in the request URI is not supported.")
+	}
+}
+
+// writeBlobVersion replaces the blob's content, keeping its previous content as a version when versioning is enabled
+func (a *account) writeBlobVersion(w http.ResponseWriter, b *blob, content []byte) {
+	version := blobVersion{
+		id:           time.Now().UTC().Format("2006-01-02T15:04:05.0000000Z"),
+		content:      content,
+		lastModified: time.Now().UTC(),
+	}
+
+	if a.isVersioningEnabled() {
+		b.versions = append(b.versions, version)
+		w.Header().Set("x-ms-version-id", version.id)
+	} else {
+		b.versions = []blobVersion{version}
+	}
+
+	b.deleted = false
+
+	w.Header().Set("ETag", `"`+strconv.FormatInt(version.lastModified.UnixNano(), 16)+`"`)
+	w.Header().Set("Last-Modified", version.lastModified.Format(http.TimeFormat))
+	w.Header().Set("x-ms-request-server-encrypted", "true")
+	w.WriteHeader(http.StatusCreated)
+}
+
+// deleteBlob deletes the current version of a blob, which is kept as a previous version with versioning or soft deleted with blob soft delete
+func (s *Server) deleteBlob(w http.ResponseWriter, r *http.Request, a *account, match []string) {
+	c := a.getContainer(w, match[2])
+
+	if c == nil {
+		return
+	}
+
+	b, exists := c.blobs[match[3]]
+
+	if !exists || b.deleted {
+		writeStorageError(w, http.StatusNotFound, "BlobNotFound", "The specified blob does not exist.")
+		return
+	}
+
+	if a.isVersioningEnabled() || a.isBlobSoftDeleteEnabled() {
+		b.deleted = true
+	} else {
+		delete(c.blobs, match[3])
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// getContainer returns the container named in the request, writing a Blob Storage error when it does not exist
+func (a *account) getContainer(w http.ResponseWriter, name string) *container {
+	c, ok := a.containers[name]
+
+	if !ok || c.deleted {
+		writeStorageError(w, http.StatusNotFound, "ContainerNotFound", "The specified container does not exist.")
+		return nil
+	}
+
+	return c
+}
+
+func (a *account) isVersioningEnabled() bool {
+	properties := a.BlobService.BlobServiceProperties
+
+	return properties != nil && properties.IsVersioningEnabled != nil && *properties.IsVersioningEnabled
+}
+
+func (a *account) isBlobSoftDeleteEnabled() bool {
+	properties := a.BlobService.BlobServiceProperties
+
+	return properties != nil && properties.DeleteRetentionPolicy != nil && properties.DeleteRetentionPolicy.Enabled != nil && *properties.DeleteRetentionPolicy.Enabled
+}
+
+// queryLogs answers the StorageBlobLogs queries of the logging TestSets with the logged requests matching the query's correlation ID and status code
+func (s *Server) queryLogs(w http.ResponseWriter, r *http.Request, match []string) {
+	var body struct {
+		Query string `json:"query"`
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeARMError(w, http.StatusBadRequest, "BadArgumentError", "The request had some invalid properties.")
+		return
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	correlationID := correlationIdQueryRegex.FindStringSubmatch(body.Query)
+	statusCode := statusCodeQueryRegex.FindStringSubmatch(body.Query)
+	rows := [][]any{}
+
+	for _, request := range s.requests {
+		if !strings.EqualFold(request.accountName, match[3]) ||
+			correlationID != nil && request.requestID != correlationID[1] ||
+			statusCode != nil && strconv.Itoa(request.statusCode) != statusCode[1] {
+			continue
+		}
+
+		rows = append(rows, []any{request.time.Format(time.RFC3339Nano), request.requesterObjectID, request.statusCode})
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"tables": []map[string]any{
+			{
+				"name": "PrimaryResult",
+				"columns": []map[string]string{
+					{"name": "TimeGenerated", "type": "datetime"},
+					{"name": "RequesterObjectId", "type": "string"},
+					{"name": "StatusCode", "type": "int"},
+				},
+				"rows": rows,
+			},
+		},
+	})
+}
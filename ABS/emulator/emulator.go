@@ -0,0 +1,330 @@
+// Package emulator is an in-process fake of the Azure Resource Manager, Blob Storage, Azure Monitor, Azure Policy and authorization
+// endpoints that the ABS TestSets call, so that the suite can be run end-to-end against configurable storage accounts without a subscription
+package emulator
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/policy"
+	"github.com/Azure/azure-sdk-for-go/sdk/monitor/azquery"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/recoveryservices/armrecoveryservices"
+	"github.com/google/uuid"
+)
+
+// logAnalyticsPath is where the emulated Log Analytics query API is served, as it shares the server with Resource Manager and Blob Storage
+const logAnalyticsPath = "/loganalytics/v1"
+
+// Server serves a scenario over HTTPS, every endpoint shares the one address and blob endpoints use the IP style path /{account}/{container}/{blob}
+type Server struct {
+	*httptest.Server
+
+	scenario Scenario
+	routes   []route
+
+	mutex           sync.Mutex
+	accounts        map[string]*account
+	roleAssignments map[string]*armauthorization.RoleAssignment
+	vaults          map[string]*armrecoveryservices.Vault
+	// requests are the blob requests made to each account, which Log Analytics queries find when the account sends its logs to a workspace
+	requests []loggedRequest
+	// activities are the Resource Manager writes, which the activity log returns by correlation ID
+	activities []activity
+}
+
+// route is a handler for the requests whose method and path match, the path is matched case-insensitively as Resource Manager does
+type route struct {
+	method  string
+	path    *regexp.Regexp
+	handler func(w http.ResponseWriter, r *http.Request, match []string)
+}
+
+type loggedRequest struct {
+	requestID         string
+	accountName       string
+	statusCode        int
+	requesterObjectID string
+	time              time.Time
+}
+
+type activity struct {
+	correlationID string
+	operationName string
+	resourceID    string
+	time          time.Time
+}
+
+// NewServer starts a server for the scenario, it must be closed when no longer needed
+func NewServer(scenario Scenario) *Server {
+	if scenario.SubscriptionID == "" {
+		scenario.SubscriptionID = DefaultSubscriptionID
+	}
+
+	if scenario.PolicyComplianceState == "" {
+		scenario.PolicyComplianceState = "Compliant"
+	}
+
+	s := &Server{
+		scenario:        scenario,
+		accounts:        make(map[string]*account),
+		roleAssignments: make(map[string]*armauthorization.RoleAssignment),
+		vaults:          make(map[string]*armrecoveryservices.Vault),
+	}
+
+	s.Server = httptest.NewUnstartedServer(http.HandlerFunc(s.serveHTTP))
+
+	// TLS 1.0 and 1.1 are accepted so that the storage account, rather than the handshake, can reject them as Azure Storage does
+	s.Server.TLS = &tls.Config{MinVersion: tls.VersionTLS10, GetConfigForClient: s.getTLSConfig}
+	s.Server.Listener = &plainHTTPListener{Listener: s.Server.Listener}
+	s.Server.StartTLS()
+
+	for _, fixture := range scenario.Accounts {
+		s.addAccount(fixture)
+	}
+
+	s.routes = append(s.armRoutes(), s.dataPlaneRoutes()...)
+
+	return s
+}
+
+// getTLSConfig only accepts forward secret cipher suites with authenticated encryption from clients which support TLS 1.2,
+// older clients are still accepted with any cipher suite so that their TLS version can be rejected
+func (s *Server) getTLSConfig(hello *tls.ClientHelloInfo) (*tls.Config, error) {
+	if len(hello.SupportedVersions) == 0 || slices.Max(hello.SupportedVersions) < tls.VersionTLS12 {
+		return nil, nil
+	}
+
+	config := s.Server.TLS.Clone()
+	config.GetConfigForClient = nil
+	config.CipherSuites = []uint16{
+		tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+		tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+		tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	}
+
+	return config, nil
+}
+
+// Credential returns a credential whose tokens the emulator accepts, they are unsigned JWTs for PrincipalID
+func (s *Server) Credential() azcore.TokenCredential {
+	return credential{}
+}
+
+// ClientOptions point the Azure SDK clients at the emulator
+func (s *Server) ClientOptions() azcore.ClientOptions {
+	return azcore.ClientOptions{
+		Cloud: cloud.Configuration{
+			Services: map[cloud.ServiceName]cloud.ServiceConfiguration{
+				cloud.ResourceManager:   {Endpoint: s.URL, Audience: s.URL},
+				azquery.ServiceNameLogs: {Endpoint: s.URL + logAnalyticsPath, Audience: s.URL},
+			},
+		},
+		Transport: s.Client(),
+		Retry:     policy.RetryOptions{MaxRetries: -1},
+	}
+}
+
+// RootCAs trusts the emulator's certificate
+func (s *Server) RootCAs() *x509.CertPool {
+	rootCAs := x509.NewCertPool()
+	rootCAs.AddCert(s.Certificate())
+
+	return rootCAs
+}
+
+// ResourceID returns the resource ID of an emulated storage account
+func (s *Server) ResourceID(accountName string) string {
+	resourceGroup := DefaultResourceGroup
+
+	for _, fixture := range s.scenario.Accounts {
+		if strings.EqualFold(*fixture.Name, accountName) && fixture.ResourceGroup != "" {
+			resourceGroup = fixture.ResourceGroup
+		}
+	}
+
+	return fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Storage/storageAccounts/%s", s.scenario.SubscriptionID, resourceGroup, accountName)
+}
+
+// ResourceIDs returns the resource IDs of every storage account in the scenario
+func (s *Server) ResourceIDs() (resourceIds []string) {
+	for _, fixture := range s.scenario.Accounts {
+		resourceIds = append(resourceIds, s.ResourceID(*fixture.Name))
+	}
+
+	return resourceIds
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	path := r.URL.Path
+
+	// Resource IDs are joined onto paths by the SDK, so some requests have an empty segment where a leading slash was
+	for strings.Contains(path, "//") {
+		path = strings.ReplaceAll(path, "//", "/")
+	}
+
+	// Every Azure service identifies its responses, which is how the TestSets find their requests in the logs
+	w.Header().Set("x-ms-request-id", uuid.NewString())
+	w.Header().Set("x-ms-correlation-request-id", uuid.NewString())
+
+	for _, route := range s.routes {
+		if route.method != r.Method {
+			continue
+		}
+
+		if match := route.path.FindStringSubmatch(path); match != nil {
+			route.handler(w, r, match)
+			return
+		}
+	}
+
+	writeARMError(w, http.StatusNotFound, "NotFound", fmt.Sprintf("The emulator does not serve %s %s.", r.Method, r.URL.Path))
+}
+
+// newRoute compiles a case-insensitive path pattern, which must match the whole path
+func newRoute(method string, pattern string, handler func(w http.ResponseWriter, r *http.Request, match []string)) route {
+	return route{
+		method:  method,
+		path:    regexp.MustCompile("(?i)^" + pattern + "$"),
+		handler: handler,
+	}
+}
+
+// writeJSON writes a JSON response, models of the Azure SDK marshal to the wire format of the service
+func writeJSON(w http.ResponseWriter, statusCode int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+func writeARMError(w http.ResponseWriter, statusCode int, code string, message string) {
+	writeJSON(w, statusCode, map[string]any{
+		"error": map[string]string{
+			"code":    code,
+			"message": message,
+		},
+	})
+}
+
+// getPrincipalID returns the object ID claim of the request's bearer token, or an empty string when the request is not authenticated
+func getPrincipalID(r *http.Request) string {
+	token, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+
+	if !found {
+		return ""
+	}
+
+	parts := strings.Split(token, ".")
+
+	if len(parts) < 2 {
+		return ""
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+
+	if err != nil {
+		return ""
+	}
+
+	var claims struct {
+		ObjectID string `json:"oid"`
+	}
+
+	if json.Unmarshal(payload, &claims) != nil {
+		return ""
+	}
+
+	return claims.ObjectID
+}
+
+// credential issues unsigned tokens which only the emulator accepts
+type credential struct{}
+
+func (credential) GetToken(ctx context.Context, options policy.TokenRequestOptions) (azcore.AccessToken, error) {
+	expiresOn := time.Now().Add(time.Hour)
+
+	header, _ := json.Marshal(map[string]string{"alg": "none", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]any{
+		"oid": PrincipalID,
+		"scp": strings.Join(options.Scopes, " "),
+		"exp": expiresOn.Unix(),
+	})
+
+	return azcore.AccessToken{
+		Token:     base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims) + ".",
+		ExpiresOn: expiresOn,
+	}, nil
+}
+
+// plainHTTPListener answers requests sent without TLS the way Azure Storage does, rather than with the TLS handshake error of the Go server
+type plainHTTPListener struct {
+	net.Listener
+}
+
+func (l *plainHTTPListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+
+		if err != nil {
+			return nil, err
+		}
+
+		reader := bufio.NewReader(conn)
+
+		// Every client of the emulator writes as soon as it connects, so a deadline only guards against a stalled connection holding up the others
+		_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		firstByte, err := reader.Peek(1)
+		_ = conn.SetReadDeadline(time.Time{})
+
+		if err != nil {
+			conn.Close()
+			continue
+		}
+
+		// A TLS connection starts with a handshake record
+		if firstByte[0] == 0x16 {
+			return &peekedConn{Conn: conn, reader: reader}, nil
+		}
+
+		go rejectPlainHTTP(conn, reader)
+	}
+}
+
+func rejectPlainHTTP(conn net.Conn, reader *bufio.Reader) {
+	defer conn.Close()
+
+	if _, err := http.ReadRequest(reader); err != nil {
+		return
+	}
+
+	fmt.Fprintf(conn, "HTTP/1.1 400 The account being accessed does not support http.\r\nx-ms-request-id: %s\r\nContent-Length: 0\r\nConnection: close\r\n\r\n", uuid.NewString())
+}
+
+// peekedConn is a connection whose first bytes have been read into a buffer
+type peekedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.reader.Read(b)
+}
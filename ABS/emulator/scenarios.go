@@ -0,0 +1,284 @@
+package emulator
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/monitor/armmonitor"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armsubscriptions"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+const (
+	// DefaultSubscriptionID is the subscription of the emulated storage accounts when the scenario does not set one
+	DefaultSubscriptionID = "00000000-0000-0000-0000-000000000000"
+
+	// DefaultResourceGroup is the resource group of the emulated storage accounts when the account does not set one
+	DefaultResourceGroup = "privateer-emulator"
+
+	// PrincipalID is the object ID of the identity that the emulator's credential signs in as
+	PrincipalID = "11111111-1111-1111-1111-111111111111"
+
+	allowedLocationsPolicyDefinitionID   = "/providers/Microsoft.Authorization/policyDefinitions/e56962a6-4747-49cd-b67b-bf8b01975c4c"
+	keyRotationPolicyDefinitionID        = "/providers/Microsoft.Authorization/policyDefinitions/d8cf8476-a2ec-4916-896e-992351803c44"
+	customerManagedKeyPolicyDefinitionID = "/providers/Microsoft.Authorization/policyDefinitions/6fac406b-40ca-413b-bf8e-0bf964659c25"
+)
+
+// AllowedLocations are the regions permitted by the Allowed locations policy of the built-in scenarios
+var AllowedLocations = []string{"eastus", "westus"}
+
+// ApprovedCidrs are the address ranges the IP rules of the built-in scenarios are approved by
+var ApprovedCidrs = []string{"203.0.113.0/24"}
+
+// Account is an emulated storage account, the emulator fills in its ID, type and endpoints
+type Account struct {
+	armstorage.Account
+	ResourceGroup string
+	BlobService   armstorage.BlobServiceProperties
+	// DiagnosticSettings are those of the blob service, requests to the account are only found by Log Analytics queries when one sends logs to a workspace
+	DiagnosticSettings []*armmonitor.DiagnosticSettingsResource
+	// DefenderForStorage is whether Microsoft Defender for Storage is enabled on the account
+	DefenderForStorage bool
+	// Containers exist in the account before any TestSet is run, keyed by name
+	Containers map[string]armstorage.ContainerProperties
+	// StoredAccessPolicies are those of the containers, keyed by container name
+	StoredAccessPolicies map[string][]StoredAccessPolicy
+}
+
+// StoredAccessPolicy is a stored access policy of a container, which the service SAS tokens that refer to it take their lifetime from
+type StoredAccessPolicy struct {
+	ID         string
+	Start      *time.Time
+	Expiry     *time.Time
+	Permission string
+}
+
+// Scenario is the Azure environment served by the emulator
+type Scenario struct {
+	Name           string
+	SubscriptionID string
+	Accounts       []Account
+	// PolicyAssignments apply to every storage account in the subscription
+	PolicyAssignments []*armpolicy.Assignment
+	// PolicyComplianceState is the latest compliance state of every storage account with each policy assigned to it
+	PolicyComplianceState string
+	Locations             []*armsubscriptions.Location
+	SKUs                  []*armstorage.SKUInformation
+}
+
+// Compliant is a storage account configured to pass every TestSet that a Microsoft-managed key can pass
+func Compliant() Scenario {
+	return newScenario("compliant", CompliantAccount("compliantaccount"))
+}
+
+// Public is a storage account that allows anonymous blob access and network access from anywhere
+func Public() Scenario {
+	account := CompliantAccount("publicaccount")
+	account.Properties.AllowBlobPublicAccess = to.Ptr(true)
+	account.Properties.PublicNetworkAccess = to.Ptr(armstorage.PublicNetworkAccessEnabled)
+	account.Properties.NetworkRuleSet = &armstorage.NetworkRuleSet{
+		DefaultAction: to.Ptr(armstorage.DefaultActionAllow),
+		Bypass:        to.Ptr(armstorage.BypassAzureServices),
+	}
+	account.Containers = map[string]armstorage.ContainerProperties{
+		"website": {PublicAccess: to.Ptr(armstorage.PublicAccessBlob)},
+		"private": {PublicAccess: to.Ptr(armstorage.PublicAccessNone)},
+	}
+
+	return newScenario("public", account)
+}
+
+// ContainerWorm is a storage account without account-level immutability, whose every container has a locked time-based retention policy
+func ContainerWorm() Scenario {
+	account := CompliantAccount("containerwormaccount")
+	account.Properties.ImmutableStorageWithVersioning = nil
+	account.Containers = map[string]armstorage.ContainerProperties{
+		"records": {ImmutabilityPolicy: lockedImmutabilityPolicy(365)},
+		"audit":   {ImmutabilityPolicy: lockedImmutabilityPolicy(2555), HasLegalHold: to.Ptr(true)},
+	}
+
+	return newScenario("container-worm", account)
+}
+
+func lockedImmutabilityPolicy(days int32) *armstorage.ImmutabilityPolicyProperties {
+	return &armstorage.ImmutabilityPolicyProperties{
+		Properties: &armstorage.ImmutabilityPolicyProperty{
+			State:                                 to.Ptr(armstorage.ImmutabilityPolicyStateLocked),
+			ImmutabilityPeriodSinceCreationInDays: to.Ptr(days),
+		},
+	}
+}
+
+// SharedKey is a storage account that allows Shared Key access without SAS or key expiration policies, whose keys have never been rotated
+func SharedKey() Scenario {
+	created := time.Now().UTC().AddDate(-1, 0, 0)
+
+	account := CompliantAccount("sharedkeyaccount")
+	account.Properties.AllowSharedKeyAccess = to.Ptr(true)
+	account.Properties.SasPolicy = nil
+	account.Properties.KeyPolicy = nil
+	account.Properties.CreationTime = to.Ptr(created)
+	account.Properties.KeyCreationTime = &armstorage.KeyCreationTime{Key1: to.Ptr(created), Key2: to.Ptr(created)}
+	account.Containers = map[string]armstorage.ContainerProperties{
+		"exports": {},
+	}
+	account.StoredAccessPolicies = map[string][]StoredAccessPolicy{
+		"exports": {{ID: "partner-read", Permission: "rl"}},
+	}
+
+	return newScenario("shared-key", account)
+}
+
+// LRS is a storage account whose data is only replicated within a single datacenter
+func LRS() Scenario {
+	account := CompliantAccount("lrsaccount")
+	account.SKU = &armstorage.SKU{Name: to.Ptr(armstorage.SKUNameStandardLRS)}
+
+	return newScenario("lrs", account)
+}
+
+// NoLogging is a storage account without a diagnostic setting, so none of its requests are logged
+func NoLogging() Scenario {
+	account := CompliantAccount("nologgingaccount")
+	account.DiagnosticSettings = nil
+
+	return newScenario("no-logging", account)
+}
+
+// CompliantAccount returns a storage account that the other account fixtures are variations of
+func CompliantAccount(name string) Account {
+	keysRotated := time.Now().UTC().AddDate(0, 0, -30)
+
+	return Account{
+		Account: armstorage.Account{
+			Name:     to.Ptr(name),
+			Location: to.Ptr(AllowedLocations[0]),
+			Kind:     to.Ptr(armstorage.KindStorageV2),
+			SKU:      &armstorage.SKU{Name: to.Ptr(armstorage.SKUNameStandardGZRS)},
+			Properties: &armstorage.AccountProperties{
+				MinimumTLSVersion:      to.Ptr(armstorage.MinimumTLSVersionTLS12),
+				EnableHTTPSTrafficOnly: to.Ptr(true),
+				AllowBlobPublicAccess:  to.Ptr(false),
+				AllowSharedKeyAccess:   to.Ptr(false),
+				PublicNetworkAccess:    to.Ptr(armstorage.PublicNetworkAccessEnabled),
+				NetworkRuleSet: &armstorage.NetworkRuleSet{
+					DefaultAction: to.Ptr(armstorage.DefaultActionDeny),
+					Bypass:        to.Ptr(armstorage.BypassNone),
+					IPRules: []*armstorage.IPRule{
+						{IPAddressOrRange: to.Ptr(ApprovedCidrs[0]), Action: to.Ptr("Allow")},
+					},
+				},
+				Encryption: &armstorage.Encryption{
+					KeySource: to.Ptr(armstorage.KeySourceMicrosoftStorage),
+					Services: &armstorage.EncryptionServices{
+						Blob: &armstorage.EncryptionService{Enabled: to.Ptr(true), KeyType: to.Ptr(armstorage.KeyTypeAccount)},
+					},
+				},
+				ImmutableStorageWithVersioning: &armstorage.ImmutableStorageAccount{
+					Enabled: to.Ptr(true),
+					ImmutabilityPolicy: &armstorage.AccountImmutabilityPolicyProperties{
+						State:                                 to.Ptr(armstorage.AccountImmutabilityPolicyStateLocked),
+						ImmutabilityPeriodSinceCreationInDays: to.Ptr(int32(7)),
+						AllowProtectedAppendWrites:            to.Ptr(false),
+					},
+				},
+				SasPolicy: &armstorage.SasPolicy{
+					SasExpirationPeriod: to.Ptr("0.08:00:00"),
+					ExpirationAction:    to.Ptr(armstorage.ExpirationActionBlock),
+				},
+				KeyPolicy:       &armstorage.KeyPolicy{KeyExpirationPeriodInDays: to.Ptr(int32(90))},
+				CreationTime:    to.Ptr(time.Now().UTC().AddDate(-1, 0, 0)),
+				KeyCreationTime: &armstorage.KeyCreationTime{Key1: to.Ptr(keysRotated), Key2: to.Ptr(keysRotated)},
+			},
+		},
+		ResourceGroup: DefaultResourceGroup,
+		BlobService: armstorage.BlobServiceProperties{
+			BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+				IsVersioningEnabled: to.Ptr(true),
+				DeleteRetentionPolicy: &armstorage.DeleteRetentionPolicy{
+					Enabled:              to.Ptr(true),
+					Days:                 to.Ptr(int32(7)),
+					AllowPermanentDelete: to.Ptr(false),
+				},
+				ContainerDeleteRetentionPolicy: &armstorage.DeleteRetentionPolicy{
+					Enabled: to.Ptr(true),
+					Days:    to.Ptr(int32(7)),
+				},
+			},
+		},
+		DiagnosticSettings: []*armmonitor.DiagnosticSettingsResource{
+			{
+				Name: to.Ptr("send-to-log-analytics"),
+				Properties: &armmonitor.DiagnosticSettings{
+					WorkspaceID: to.Ptr(fmt.Sprintf("/subscriptions/%s/resourceGroups/%s/providers/Microsoft.OperationalInsights/workspaces/privateer-logs", DefaultSubscriptionID, DefaultResourceGroup)),
+					Logs: []*armmonitor.LogSettings{
+						{CategoryGroup: to.Ptr("allLogs"), Enabled: to.Ptr(true)},
+					},
+				},
+			},
+		},
+		DefenderForStorage: true,
+	}
+}
+
+// newScenario returns a scenario with the given accounts, in which the Allowed locations, key rotation and customer-managed key policies are assigned
+func newScenario(name string, accounts ...Account) Scenario {
+	return Scenario{
+		Name:           name,
+		SubscriptionID: DefaultSubscriptionID,
+		Accounts:       accounts,
+		PolicyAssignments: []*armpolicy.Assignment{
+			newPolicyAssignment("allowed-locations", "Allowed locations", allowedLocationsPolicyDefinitionID, map[string]any{"listOfAllowedLocations": AllowedLocations}),
+			newPolicyAssignment("key-rotation", "Keys should have a rotation policy", keyRotationPolicyDefinitionID, map[string]any{"maximumDaysToRotate": 90}),
+			newPolicyAssignment("customer-managed-keys", "Storage accounts should use customer-managed key for encryption", customerManagedKeyPolicyDefinitionID, nil),
+		},
+		PolicyComplianceState: "Compliant",
+		Locations: []*armsubscriptions.Location{
+			newLocation("eastus", "westus"),
+			newLocation("westus", "eastus"),
+			newLocation("northeurope", "westeurope"),
+			newLocation("westeurope", "northeurope"),
+		},
+		SKUs: []*armstorage.SKUInformation{
+			{
+				Name:         to.Ptr(armstorage.SKUNameStandardLRS),
+				ResourceType: to.Ptr("storageAccounts"),
+				Locations:    []*string{to.Ptr("eastus"), to.Ptr("westus"), to.Ptr("northeurope"), to.Ptr("westeurope")},
+			},
+			{
+				Name:         to.Ptr(armstorage.SKUNameStandardGZRS),
+				ResourceType: to.Ptr("storageAccounts"),
+				Locations:    []*string{to.Ptr("eastus"), to.Ptr("westus"), to.Ptr("northeurope"), to.Ptr("westeurope")},
+			},
+		},
+	}
+}
+
+func newPolicyAssignment(name string, displayName string, policyDefinitionID string, parameters map[string]any) *armpolicy.Assignment {
+	assignment := &armpolicy.Assignment{
+		Name: to.Ptr(name),
+		Properties: &armpolicy.AssignmentProperties{
+			DisplayName:        to.Ptr(displayName),
+			PolicyDefinitionID: to.Ptr(policyDefinitionID),
+			EnforcementMode:    to.Ptr(armpolicy.EnforcementModeDefault),
+			Parameters:         make(map[string]*armpolicy.ParameterValuesValue),
+		},
+	}
+
+	for parameterName, value := range parameters {
+		assignment.Properties.Parameters[parameterName] = &armpolicy.ParameterValuesValue{Value: value}
+	}
+
+	return assignment
+}
+
+func newLocation(name string, pairedRegion string) *armsubscriptions.Location {
+	return &armsubscriptions.Location{
+		Name: to.Ptr(name),
+		Metadata: &armsubscriptions.LocationMetadata{
+			PairedRegion: []*armsubscriptions.PairedRegion{{Name: to.Ptr(pairedRegion)}},
+		},
+	}
+}
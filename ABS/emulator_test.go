@@ -0,0 +1,186 @@
+package abs
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/azure/finos-azure-blob-storage-raid/ABS/emulator"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+// runEmulatedTestSuite runs the tlp_red TestSets against the scenario served by the emulator, returning the result of each TestSet by name
+func runEmulatedTestSuite(t *testing.T, scenario emulator.Scenario) map[string]pluginkit.TestSetResult {
+	server := emulator.NewServer(scenario)
+	t.Cleanup(server.Close)
+
+	return runTestSuite(t, server, nil)
+}
+
+// runTestSuite runs the tlp_red TestSets against the storage accounts of the emulator, with any additional config vars
+func runTestSuite(t *testing.T, server *emulator.Server, vars map[string]interface{}) map[string]pluginkit.TestSetResult {
+	// Earlier tests leave mocks in place of the Azure clients and helper functions
+	previousTestSuites, previousConfig, previousLoggingVariables := Armory.TestSuites, Armory.Config, loggingVariables
+	Armory.TestSuites = map[string][]pluginkit.TestSet{"tlp_red": Armory.TestSuites["tlp_red"]}
+	Armory.Config = &config.Config{
+		ServiceName:    "emulator",
+		WriteDirectory: t.TempDir(),
+		Vars: map[string]interface{}{
+			"storageaccountresourceids": toConfigList(server.ResourceIDs()),
+			"allowedregions":            toConfigList(emulator.AllowedLocations),
+			"approvedcidrs":             toConfigList(emulator.ApprovedCidrs),
+		},
+	}
+
+	for key, value := range vars {
+		Armory.Config.Vars[key] = value
+	}
+
+	ArmoryCommonFunctions = &commonFunctions{}
+	ArmoryAzureUtils = &azureUtils{}
+	ArmoryTlsFunctions = &tlsFunctions{}
+	ArmoryLoggingFunctions = &loggingFunctions{}
+	ArmoryBlobVersioningFunctions = &blobVersioningFunctions{}
+	ArmoryRestrictedRegionsFunctions = &restrictedRegionsFunctions{}
+	loggingVariables = logPollingVariables{
+		minimumIngestionTime: time.Millisecond,
+		maximumIngestionTime: 10 * time.Millisecond,
+		pollingDelay:         time.Millisecond,
+	}
+	token = azcore.AccessToken{}
+	testArtifacts = &cleanupRegistry{}
+
+	SetAzureEnvironment(server.Credential(), server.ClientOptions(), server.RootCAs())
+
+	t.Cleanup(func() {
+		Armory.TestSuites, Armory.Config, loggingVariables = previousTestSuites, previousConfig, previousLoggingVariables
+		SetAzureEnvironment(nil, azcore.ClientOptions{}, nil)
+		token = azcore.AccessToken{}
+		testArtifacts = &cleanupRegistry{}
+		cleanupLedgerPath = ""
+		activeCassette = nil
+	})
+
+	err := Initialize()
+	assert.NoError(t, err)
+	StartRemediationFile()
+
+	results := make(map[string]pluginkit.TestSetResult)
+
+	for _, testSet := range Armory.TestSuites["tlp_red"] {
+		testSetName, result := testSet()
+		results[testSetName] = result
+		t.Logf("%s %v: %s", testSetName, result.Passed, result.Message)
+	}
+
+	return results
+}
+
+func toConfigList(values []string) (list []interface{}) {
+	for _, value := range values {
+		list = append(list, value)
+	}
+
+	return list
+}
+
+func Test_emulated_scenarios(t *testing.T) {
+	tests := []struct {
+		name           string
+		scenario       emulator.Scenario
+		expectedPassed []string
+		expectedFailed []string
+	}{
+		{
+			name:     "compliant",
+			scenario: emulator.Compliant(),
+			expectedPassed: []string{
+				"CCC_C01_TR01",
+				"CCC_C03_TR02",
+				"CCC_C03_TR05",
+				"CCC_C04_TR01",
+				"CCC_C04_TR02",
+				"CCC_C05_TR01",
+				"CCC_C06_TR01",
+				"CCC_C06_TR02",
+				"CCC_C07_TR01",
+				"CCC_C08_TR01",
+				"CCC_C08_TR02",
+				"CCC_C09_TR01",
+				"CCC_F05_TR01",
+				"CCC_ObjStor_C03_TR01",
+				"CCC_ObjStor_C05_TR04",
+			},
+		},
+		{
+			name:           "public",
+			scenario:       emulator.Public(),
+			expectedPassed: []string{"CCC_C01_TR01", "CCC_C08_TR01"},
+			expectedFailed: []string{"CCC_C03_TR02", "CCC_C05_TR01"},
+		},
+		{
+			name:           "lrs",
+			scenario:       emulator.LRS(),
+			expectedPassed: []string{"CCC_C01_TR01", "CCC_C03_TR02"},
+			expectedFailed: []string{"CCC_C08_TR01", "CCC_C08_TR02"},
+		},
+		{
+			name:           "no logging",
+			scenario:       emulator.NoLogging(),
+			expectedPassed: []string{"CCC_C01_TR01", "CCC_C08_TR01"},
+			expectedFailed: []string{"CCC_C04_TR01", "CCC_C09_TR01"},
+		},
+		{
+			name:           "container worm",
+			scenario:       emulator.ContainerWorm(),
+			expectedPassed: []string{"CCC_C03_TR02", "CCC_ObjStor_C03_TR02", "CCC_ObjStor_C04_TR01"},
+		},
+		{
+			name:           "shared key",
+			scenario:       emulator.SharedKey(),
+			expectedPassed: []string{"CCC_C01_TR01", "CCC_C08_TR01"},
+			expectedFailed: []string{"CCC_C03_TR02", "CCC_F05_TR01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			results := runEmulatedTestSuite(t, tt.scenario)
+
+			// Assert
+			assert.Len(t, results, len(Armory.TestSuites["tlp_red"]))
+
+			for _, testSetName := range tt.expectedPassed {
+				assert.True(t, results[testSetName].Passed, "%s should pass: %s %v", testSetName, results[testSetName].Message, results[testSetName].Tests)
+			}
+
+			for _, testSetName := range tt.expectedFailed {
+				assert.False(t, results[testSetName].Passed, "%s should fail", testSetName)
+			}
+		})
+	}
+}
+
+func Test_Initialize_assesses_remaining_storage_accounts_when_an_id_cannot_be_parsed(t *testing.T) {
+	// Arrange
+	server := emulator.NewServer(emulator.Compliant())
+	t.Cleanup(server.Close)
+
+	invalidResourceId := "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/Invalid_Name"
+
+	// Act
+	results := runTestSuite(t, server, map[string]interface{}{
+		"storageaccountresourceids": toConfigList(append(server.ResourceIDs(), invalidResourceId)),
+	})
+
+	// Assert
+	assert.True(t, results["CCC_C01_TR01"].Passed, results["CCC_C01_TR01"].Message)
+
+	failed := initErrors.forComponents(componentDiscovery)
+	assert.Len(t, failed, 1)
+	assert.ErrorContains(t, failed, "failed to parse storage account resource ID "+invalidResourceId)
+	assert.Len(t, targets, len(server.ResourceIDs()))
+}
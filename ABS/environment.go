@@ -0,0 +1,37 @@
+package abs
+
+import (
+	"crypto/x509"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/arm"
+)
+
+var (
+	// environmentCredential is used instead of the default Azure credential when it is set
+	environmentCredential azcore.TokenCredential
+
+	// environmentClientOptions configure the Azure SDK clients, the zero value targets the Azure public cloud
+	environmentClientOptions azcore.ClientOptions
+
+	// clientOptions are those every Azure SDK client is created with, the environment's options with the transport of the active cassette
+	clientOptions    azcore.ClientOptions
+	armClientOptions *arm.ClientOptions
+
+	// trustedRootCAs verify the storage endpoints which are requested without the Azure SDK, the system roots are used when it is nil
+	trustedRootCAs *x509.CertPool
+)
+
+// SetAzureEnvironment points the plugin at an environment other than the Azure public cloud, such as the emulator used by the end-to-end tests
+func SetAzureEnvironment(credential azcore.TokenCredential, options azcore.ClientOptions, rootCAs *x509.CertPool) {
+	environmentCredential = credential
+	environmentClientOptions = options
+	trustedRootCAs = rootCAs
+}
+
+// loadClientOptions sets the options that the Azure SDK clients are created with
+func loadClientOptions() {
+	clientOptions = environmentClientOptions
+	clientOptions.Transport = withCassetteTransporter(environmentClientOptions.Transport)
+	armClientOptions = &arm.ClientOptions{ClientOptions: clientOptions}
+}
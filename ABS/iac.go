@@ -0,0 +1,630 @@
+package abs
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+const (
+	terraformStorageAccountType = "azurerm_storage_account"
+
+	// defaultRetentionDays is the retention period Azure applies when soft delete is enabled without one
+	defaultRetentionDays = 7
+)
+
+var (
+	// deployedStateTestSets assess the state of a deployed storage account, such as its replication status, so cannot be run before deployment
+	deployedStateTestSets = []string{"CCC_C08_TR02"}
+
+	// templateReferenceRegex matches an ARM template expression which only references a parameter or variable
+	templateReferenceRegex = regexp.MustCompile(`^\[\s*(parameters|variables)\(\s*'([^']+)'\s*\)\s*\]$`)
+
+	// templatePropertyTestSets are the properties of an ARM template's storage account, and of its blob services, each offline TestSet reads
+	templatePropertyTestSets = map[string][]string{
+		"CCC_C02_TR01":         {"properties.encryption"},
+		"CCC_C03_TR02":         {"properties.allowBlobPublicAccess", "properties.allowSharedKeyAccess"},
+		"CCC_C05_TR01":         {"properties.publicNetworkAccess", "properties.networkAcls", "properties.privateEndpointConnections"},
+		"CCC_C08_TR01":         {"sku.name"},
+		"CCC_ObjStor_C02_TR01": {"properties.allowSharedKeyAccess"},
+		"CCC_ObjStor_C02_TR02": {"properties.allowSharedKeyAccess"},
+		"CCC_ObjStor_C03_TR01": {"blobServices.properties.deleteRetentionPolicy", "blobServices.properties.containerDeleteRetentionPolicy"},
+		"CCC_ObjStor_C03_TR02": {"properties.immutableStorageWithVersioning"},
+		"CCC_ObjStor_C04_TR01": {"properties.immutableStorageWithVersioning"},
+		"CCC_ObjStor_C05_TR01": {"blobServices.properties.isVersioningEnabled"},
+	}
+)
+
+// terraformPlan is the output of terraform show -json, for a plan or for state
+type terraformPlan struct {
+	PlannedValues *terraformValues `json:"planned_values"`
+	Values        *terraformValues `json:"values"`
+}
+
+type terraformValues struct {
+	RootModule terraformModule `json:"root_module"`
+}
+
+type terraformModule struct {
+	Resources    []terraformResource `json:"resources"`
+	ChildModules []terraformModule   `json:"child_modules"`
+}
+
+type terraformResource struct {
+	Address string                 `json:"address"`
+	Type    string                 `json:"type"`
+	Values  map[string]interface{} `json:"values"`
+}
+
+// armTemplate is a compiled ARM template, such as one built from Bicep
+type armTemplate struct {
+	Parameters map[string]struct {
+		DefaultValue interface{} `json:"defaultValue"`
+	} `json:"parameters"`
+	Variables map[string]interface{} `json:"variables"`
+	// Resources is an array, or an object keyed by symbolic name when the template uses languageVersion 2.0
+	Resources json.RawMessage `json:"resources"`
+}
+
+// loadTerraformPlans reads the storage accounts which would be deployed from the output of terraform show -json
+func loadTerraformPlans(planFiles []string) (planTargets []*storageAccountTarget, err error) {
+	for _, planFile := range planFiles {
+		contents, err := os.ReadFile(planFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Terraform plan %s: %v", planFile, err)
+		}
+
+		var plan terraformPlan
+
+		err = json.Unmarshal(contents, &plan)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse Terraform plan %s: %v", planFile, err)
+		}
+
+		values := plan.PlannedValues
+
+		if values == nil {
+			values = plan.Values
+		}
+
+		if values == nil {
+			return nil, fmt.Errorf("failed to parse Terraform plan %s: no planned_values or values were found, create it with terraform show -json", planFile)
+		}
+
+		for _, resource := range values.RootModule.storageAccounts() {
+			planTargets = append(planTargets, newTerraformTarget(resource))
+		}
+	}
+
+	return planTargets, nil
+}
+
+// storageAccounts returns the storage accounts in the module and every module it contains
+func (module terraformModule) storageAccounts() (resources []terraformResource) {
+	for _, resource := range module.Resources {
+		if resource.Type == terraformStorageAccountType {
+			resources = append(resources, resource)
+		}
+	}
+
+	for _, childModule := range module.ChildModules {
+		resources = append(resources, childModule.storageAccounts()...)
+	}
+
+	return resources
+}
+
+// newTerraformTarget maps an azurerm_storage_account to the storage account and blob service properties Azure would deploy
+func newTerraformTarget(resource terraformResource) *storageAccountTarget {
+	values := resource.Values
+
+	target := &storageAccountTarget{
+		iacAddress: resource.Address,
+		resourceId: resourceIdentifier{
+			resourceGroupName:  tfString(values, "resource_group_name"),
+			storageAccountName: tfString(values, "name"),
+		},
+	}
+
+	properties := &armstorage.AccountProperties{
+		AllowBlobPublicAccess:  tfBool(values, "allow_nested_items_to_be_public"),
+		AllowSharedKeyAccess:   tfBool(values, "shared_access_key_enabled"),
+		EnableHTTPSTrafficOnly: tfBool(values, "https_traffic_only_enabled"),
+		Encryption: &armstorage.Encryption{
+			KeySource:                       to.Ptr(armstorage.KeySourceMicrosoftStorage),
+			RequireInfrastructureEncryption: tfBool(values, "infrastructure_encryption_enabled"),
+		},
+	}
+
+	// Earlier versions of the azurerm provider name this enable_https_traffic_only
+	if properties.EnableHTTPSTrafficOnly == nil {
+		properties.EnableHTTPSTrafficOnly = tfBool(values, "enable_https_traffic_only")
+	}
+
+	if minimumTlsVersion := tfString(values, "min_tls_version"); minimumTlsVersion != "" {
+		properties.MinimumTLSVersion = to.Ptr(armstorage.MinimumTLSVersion(minimumTlsVersion))
+	}
+
+	if publicNetworkAccessEnabled := tfBool(values, "public_network_access_enabled"); publicNetworkAccessEnabled != nil {
+		if *publicNetworkAccessEnabled {
+			properties.PublicNetworkAccess = to.Ptr(armstorage.PublicNetworkAccessEnabled)
+		} else {
+			properties.PublicNetworkAccess = to.Ptr(armstorage.PublicNetworkAccessDisabled)
+		}
+	}
+
+	if customerManagedKey := tfBlock(values, "customer_managed_key"); customerManagedKey != nil {
+		properties.Encryption.KeySource = to.Ptr(armstorage.KeySourceMicrosoftKeyvault)
+	}
+
+	if networkRules := tfBlock(values, "network_rules"); networkRules != nil {
+		properties.NetworkRuleSet = &armstorage.NetworkRuleSet{
+			DefaultAction: to.Ptr(armstorage.DefaultAction(tfString(networkRules, "default_action"))),
+		}
+
+		if bypass := tfStrings(networkRules, "bypass"); len(bypass) > 0 {
+			properties.NetworkRuleSet.Bypass = to.Ptr(armstorage.Bypass(strings.Join(bypass, ", ")))
+		}
+
+		for _, ipRule := range tfStrings(networkRules, "ip_rules") {
+			properties.NetworkRuleSet.IPRules = append(properties.NetworkRuleSet.IPRules, &armstorage.IPRule{
+				IPAddressOrRange: to.Ptr(ipRule),
+				Action:           to.Ptr("Allow"),
+			})
+		}
+
+		for _, subnetId := range tfStrings(networkRules, "virtual_network_subnet_ids") {
+			properties.NetworkRuleSet.VirtualNetworkRules = append(properties.NetworkRuleSet.VirtualNetworkRules, &armstorage.VirtualNetworkRule{
+				VirtualNetworkResourceID: to.Ptr(subnetId),
+				Action:                   to.Ptr("Allow"),
+			})
+		}
+	}
+
+	if immutabilityPolicy := tfBlock(values, "immutability_policy"); immutabilityPolicy != nil {
+		properties.ImmutableStorageWithVersioning = &armstorage.ImmutableStorageAccount{
+			Enabled: to.Ptr(true),
+			ImmutabilityPolicy: &armstorage.AccountImmutabilityPolicyProperties{
+				State:                                 to.Ptr(armstorage.AccountImmutabilityPolicyState(tfString(immutabilityPolicy, "state"))),
+				ImmutabilityPeriodSinceCreationInDays: tfInt32(immutabilityPolicy, "period_since_creation_in_days"),
+				AllowProtectedAppendWrites:            tfBool(immutabilityPolicy, "allow_protected_append_writes"),
+			},
+		}
+	}
+
+	target.storageAccountResource = armstorage.Account{
+		Name:       to.Ptr(target.resourceId.storageAccountName),
+		Location:   to.Ptr(tfString(values, "location")),
+		Kind:       to.Ptr(armstorage.Kind(tfString(values, "account_kind"))),
+		Properties: properties,
+	}
+
+	if accountTier, replicationType := tfString(values, "account_tier"), tfString(values, "account_replication_type"); accountTier != "" && replicationType != "" {
+		target.storageAccountResource.SKU = &armstorage.SKU{Name: to.Ptr(armstorage.SKUName(accountTier + "_" + replicationType))}
+	}
+
+	if blobProperties := tfBlock(values, "blob_properties"); blobProperties != nil {
+		target.blobServiceProperties = &armstorage.BlobServiceProperties{
+			BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+				IsVersioningEnabled: tfBool(blobProperties, "versioning_enabled"),
+			},
+		}
+
+		if deleteRetentionPolicy := tfBlock(blobProperties, "delete_retention_policy"); deleteRetentionPolicy != nil {
+			target.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy = &armstorage.DeleteRetentionPolicy{
+				Enabled:              to.Ptr(true),
+				Days:                 tfInt32(deleteRetentionPolicy, "days"),
+				AllowPermanentDelete: tfBool(deleteRetentionPolicy, "permanent_delete_enabled"),
+			}
+		}
+
+		if containerDeleteRetentionPolicy := tfBlock(blobProperties, "container_delete_retention_policy"); containerDeleteRetentionPolicy != nil {
+			target.blobServiceProperties.BlobServiceProperties.ContainerDeleteRetentionPolicy = &armstorage.DeleteRetentionPolicy{
+				Enabled: to.Ptr(true),
+				Days:    tfInt32(containerDeleteRetentionPolicy, "days"),
+			}
+		}
+	}
+
+	applyDeploymentDefaults(target)
+
+	return target
+}
+
+func tfString(values map[string]interface{}, key string) string {
+	value, _ := values[key].(string)
+	return value
+}
+
+func tfBool(values map[string]interface{}, key string) *bool {
+	if value, ok := values[key].(bool); ok {
+		return to.Ptr(value)
+	}
+
+	return nil
+}
+
+func tfInt32(values map[string]interface{}, key string) *int32 {
+	if value, ok := values[key].(float64); ok {
+		return to.Ptr(int32(value))
+	}
+
+	return nil
+}
+
+func tfStrings(values map[string]interface{}, key string) (strs []string) {
+	list, _ := values[key].([]interface{})
+
+	for _, item := range list {
+		if str, ok := item.(string); ok {
+			strs = append(strs, str)
+		}
+	}
+
+	return strs
+}
+
+// tfBlock returns the first of a nested block, which Terraform represents as a list, or nil if the block is not set
+func tfBlock(values map[string]interface{}, key string) map[string]interface{} {
+	list, _ := values[key].([]interface{})
+
+	if len(list) == 0 {
+		return nil
+	}
+
+	block, _ := list[0].(map[string]interface{})
+	return block
+}
+
+// loadArmTemplates reads the storage accounts, and their blob services, which would be deployed by compiled ARM templates
+func loadArmTemplates(templateFiles []string) (templateTargets []*storageAccountTarget, err error) {
+	for _, templateFile := range templateFiles {
+		contents, err := os.ReadFile(templateFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read ARM template %s: %v", templateFile, err)
+		}
+
+		var template armTemplate
+
+		err = json.Unmarshal(contents, &template)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse ARM template %s: %v", templateFile, err)
+		}
+
+		addresses, resources, err := template.resources()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse the resources of ARM template %s: %v", templateFile, err)
+		}
+
+		var fileTargets []*storageAccountTarget
+		var blobServices []map[string]interface{}
+
+		for i, resource := range resources {
+			resourceType, _ := resource["type"].(string)
+
+			switch strings.ToLower(resourceType) {
+			case storageAccountResourceType:
+				target, err := template.newTarget(addresses[i], resource)
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to load %s from ARM template %s: %v", addresses[i], templateFile, err)
+				}
+
+				// Blob services may be nested in the storage account
+				nestedResources, _ := resource["resources"].([]interface{})
+
+				for _, nestedResource := range nestedResources {
+					if nested, ok := nestedResource.(map[string]interface{}); ok && isBlobServicesResource(nested) {
+						err = template.loadBlobServices(target, nested)
+
+						if err != nil {
+							return nil, fmt.Errorf("failed to load the blob services of %s from ARM template %s: %v", addresses[i], templateFile, err)
+						}
+					}
+				}
+
+				fileTargets = append(fileTargets, target)
+
+			case blobServicesResourceType:
+				blobServices = append(blobServices, resource)
+			}
+		}
+
+		// Top-level blob services are named after their storage account, when that cannot be resolved a template with one storage account is assumed to be its parent
+		for _, blobService := range blobServices {
+			name, _ := template.resolve(blobService["name"], "", nil)
+			accountName, _, _ := strings.Cut(fmt.Sprint(name), "/")
+
+			index := slices.IndexFunc(fileTargets, func(target *storageAccountTarget) bool {
+				return strings.EqualFold(target.resourceId.storageAccountName, accountName)
+			})
+
+			if index < 0 && len(fileTargets) == 1 {
+				index = 0
+			}
+
+			if index < 0 {
+				continue
+			}
+
+			err = template.loadBlobServices(fileTargets[index], blobService)
+
+			if err != nil {
+				return nil, fmt.Errorf("failed to load the blob services of %s from ARM template %s: %v", fileTargets[index].iacAddress, templateFile, err)
+			}
+		}
+
+		for _, target := range fileTargets {
+			applyDeploymentDefaults(target)
+		}
+
+		templateTargets = append(templateTargets, fileTargets...)
+	}
+
+	return templateTargets, nil
+}
+
+// resources returns the resources of the template along with their addresses, the symbolic name if the template has them, otherwise their index
+func (template *armTemplate) resources() (addresses []string, resources []map[string]interface{}, err error) {
+	var resourceList []map[string]interface{}
+
+	if err = json.Unmarshal(template.Resources, &resourceList); err == nil {
+		for i, resource := range resourceList {
+			addresses = append(addresses, fmt.Sprintf("resources[%d]", i))
+			resources = append(resources, resource)
+		}
+
+		return addresses, resources, nil
+	}
+
+	var symbolicResources map[string]map[string]interface{}
+
+	if err = json.Unmarshal(template.Resources, &symbolicResources); err != nil {
+		return nil, nil, err
+	}
+
+	for _, symbolicName := range slices.Sorted(maps.Keys(symbolicResources)) {
+		addresses = append(addresses, symbolicName)
+		resources = append(resources, symbolicResources[symbolicName])
+	}
+
+	return addresses, resources, nil
+}
+
+// newTarget maps a Microsoft.Storage/storageAccounts resource of the template to the storage account Azure would deploy
+func (template *armTemplate) newTarget(address string, resource map[string]interface{}) (*storageAccountTarget, error) {
+	target := &storageAccountTarget{iacAddress: address}
+
+	// Nested resources, such as the blob services, are loaded separately
+	accountResource := maps.Clone(resource)
+	delete(accountResource, "resources")
+
+	resolved, _ := template.resolve(accountResource, "", &target.unresolvedProperties)
+	resolvedResource, _ := resolved.(map[string]interface{})
+
+	err := unmarshalSnapshotResource(resolvedResource, &target.storageAccountResource)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if target.storageAccountResource.Name != nil {
+		target.resourceId.storageAccountName = *target.storageAccountResource.Name
+	}
+
+	return target, nil
+}
+
+func (template *armTemplate) loadBlobServices(target *storageAccountTarget, resource map[string]interface{}) error {
+	resolved, _ := template.resolve(resource, "blobServices", &target.unresolvedProperties)
+	resolvedResource, _ := resolved.(map[string]interface{})
+
+	target.blobServiceProperties = &armstorage.BlobServiceProperties{}
+
+	return unmarshalSnapshotResource(resolvedResource, target.blobServiceProperties)
+}
+
+// resolve evaluates expressions which reference a parameter's default value or a variable, others are dropped and the path of the
+// property they set, such as properties.networkAcls.ipRules[0], is added to unresolved so that it is not mistaken for Azure's default
+func (template *armTemplate) resolve(value interface{}, path string, unresolved *[]string) (interface{}, bool) {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		resolved := make(map[string]interface{}, len(typedValue))
+
+		for key, nestedValue := range typedValue {
+			nestedPath := key
+
+			if path != "" {
+				nestedPath = path + "." + key
+			}
+
+			if resolvedValue, ok := template.resolve(nestedValue, nestedPath, unresolved); ok {
+				resolved[key] = resolvedValue
+			} else if unresolved != nil {
+				*unresolved = append(*unresolved, nestedPath)
+			}
+		}
+
+		return resolved, true
+	case []interface{}:
+		var resolved []interface{}
+
+		for i, nestedValue := range typedValue {
+			nestedPath := fmt.Sprintf("%s[%d]", path, i)
+
+			if resolvedValue, ok := template.resolve(nestedValue, nestedPath, unresolved); ok {
+				resolved = append(resolved, resolvedValue)
+			} else if unresolved != nil {
+				*unresolved = append(*unresolved, nestedPath)
+			}
+		}
+
+		return resolved, true
+	case string:
+		// A string starting with [[ is a literal which starts with [
+		if strings.HasPrefix(typedValue, "[[") {
+			return typedValue[1:], true
+		}
+
+		if !strings.HasPrefix(typedValue, "[") {
+			return typedValue, true
+		}
+
+		match := templateReferenceRegex.FindStringSubmatch(typedValue)
+
+		if len(match) == 0 {
+			return nil, false
+		}
+
+		if match[1] == "parameters" {
+			parameter, ok := template.Parameters[match[2]]
+
+			if !ok || parameter.DefaultValue == nil {
+				return nil, false
+			}
+
+			return template.resolve(parameter.DefaultValue, path, unresolved)
+		}
+
+		variable, ok := template.Variables[match[2]]
+
+		if !ok {
+			return nil, false
+		}
+
+		return template.resolve(variable, path, unresolved)
+	default:
+		return value, true
+	}
+}
+
+// getUnresolvedProperties returns the properties the ARM template sets with expressions which cannot be resolved, that are, contain or are part of any of the given properties
+func (target *storageAccountTarget) getUnresolvedProperties(properties []string) (unresolved []string) {
+	for _, unresolvedProperty := range target.unresolvedProperties {
+		for _, property := range properties {
+			if isPartOfProperty(unresolvedProperty, property) || isPartOfProperty(property, unresolvedProperty) {
+				unresolved = append(unresolved, unresolvedProperty)
+				break
+			}
+		}
+	}
+
+	slices.Sort(unresolved)
+
+	return unresolved
+}
+
+// isPartOfProperty is whether property is parent, or is part of it, property names being case-insensitive in ARM
+func isPartOfProperty(property string, parent string) bool {
+	property, parent = strings.ToLower(property), strings.ToLower(parent)
+	return property == parent || strings.HasPrefix(property, parent+".") || strings.HasPrefix(property, parent+"[")
+}
+
+func isBlobServicesResource(resource map[string]interface{}) bool {
+	resourceType, _ := resource["type"].(string)
+	return strings.EqualFold(resourceType, "blobServices") || strings.EqualFold(resourceType, blobServicesResourceType)
+}
+
+// applyDeploymentDefaults fills in the properties the TestSets read with the values Azure applies when they are not set at deployment,
+// those an ARM template sets with expressions which cannot be resolved are left unset, as the TestSets which read them are not run
+func applyDeploymentDefaults(target *storageAccountTarget) {
+	if target.storageAccountResource.Properties == nil {
+		target.storageAccountResource.Properties = &armstorage.AccountProperties{}
+	}
+
+	properties := target.storageAccountResource.Properties
+
+	if target.storageAccountResource.SKU == nil || target.storageAccountResource.SKU.Name == nil {
+		// The SKU is required, when it is missing the replication type is reported as unknown, unless an ARM template sets it with an expression which cannot be resolved
+		target.storageAccountResource.SKU = &armstorage.SKU{Name: to.Ptr(armstorage.SKUName(""))}
+	}
+
+	if properties.AllowBlobPublicAccess == nil && !target.isUnresolved("properties.allowBlobPublicAccess") {
+		properties.AllowBlobPublicAccess = to.Ptr(false)
+	}
+
+	if properties.AllowSharedKeyAccess == nil && !target.isUnresolved("properties.allowSharedKeyAccess") {
+		properties.AllowSharedKeyAccess = to.Ptr(true)
+	}
+
+	if properties.PublicNetworkAccess == nil && !target.isUnresolved("properties.publicNetworkAccess") {
+		properties.PublicNetworkAccess = to.Ptr(armstorage.PublicNetworkAccessEnabled)
+	}
+
+	if properties.NetworkRuleSet == nil {
+		properties.NetworkRuleSet = &armstorage.NetworkRuleSet{}
+	}
+
+	if (properties.NetworkRuleSet.DefaultAction == nil || *properties.NetworkRuleSet.DefaultAction == "") && !target.isUnresolved("properties.networkAcls.defaultAction") {
+		properties.NetworkRuleSet.DefaultAction = to.Ptr(armstorage.DefaultActionAllow)
+	}
+
+	// Encryption at rest cannot be disabled
+	if properties.Encryption == nil {
+		properties.Encryption = &armstorage.Encryption{}
+	}
+
+	if properties.Encryption.KeySource == nil && !target.isUnresolved("properties.encryption.keySource") {
+		properties.Encryption.KeySource = to.Ptr(armstorage.KeySourceMicrosoftStorage)
+	}
+
+	properties.Encryption.Services = &armstorage.EncryptionServices{
+		Blob: &armstorage.EncryptionService{Enabled: to.Ptr(true)},
+	}
+
+	// Every storage account has a blob service, soft delete is disabled unless it is configured
+	if target.blobServiceProperties == nil {
+		target.blobServiceProperties = &armstorage.BlobServiceProperties{}
+	}
+
+	if target.blobServiceProperties.BlobServiceProperties == nil {
+		target.blobServiceProperties.BlobServiceProperties = &armstorage.BlobServicePropertiesProperties{}
+	}
+
+	blobServiceProperties := target.blobServiceProperties.BlobServiceProperties
+
+	if !target.isUnresolved("blobServices.properties.deleteRetentionPolicy") {
+		blobServiceProperties.DeleteRetentionPolicy = withRetentionDefaults(blobServiceProperties.DeleteRetentionPolicy)
+	}
+
+	if !target.isUnresolved("blobServices.properties.containerDeleteRetentionPolicy") {
+		blobServiceProperties.ContainerDeleteRetentionPolicy = withRetentionDefaults(blobServiceProperties.ContainerDeleteRetentionPolicy)
+	}
+}
+
+// isUnresolved is whether the ARM template sets the property, or any part of it, with an expression which cannot be resolved
+func (target *storageAccountTarget) isUnresolved(property string) bool {
+	return len(target.getUnresolvedProperties([]string{property})) > 0
+}
+
+func withRetentionDefaults(policy *armstorage.DeleteRetentionPolicy) *armstorage.DeleteRetentionPolicy {
+	if policy == nil {
+		policy = &armstorage.DeleteRetentionPolicy{}
+	}
+
+	if policy.Enabled == nil {
+		policy.Enabled = to.Ptr(false)
+	}
+
+	if *policy.Enabled && policy.Days == nil {
+		policy.Days = to.Ptr(int32(defaultRetentionDays))
+	}
+
+	if policy.AllowPermanentDelete == nil {
+		policy.AllowPermanentDelete = to.Ptr(false)
+	}
+
+	return policy
+}
@@ -0,0 +1,268 @@
+package abs
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	terraformPlanJSON = `{
+		"format_version": "1.2",
+		"planned_values": {"root_module": {
+			"resources": [
+				{
+					"address": "azurerm_storage_account.logs",
+					"type": "azurerm_storage_account",
+					"values": {
+						"name": "logs",
+						"resource_group_name": "rg",
+						"account_tier": "Standard",
+						"account_replication_type": "LRS",
+						"allow_nested_items_to_be_public": true,
+						"shared_access_key_enabled": true,
+						"public_network_access_enabled": true,
+						"network_rules": [{"default_action": "Deny", "ip_rules": ["203.0.113.0/24"], "bypass": ["AzureServices", "Logging"]}],
+						"blob_properties": []
+					}
+				},
+				{"address": "azurerm_resource_group.rg", "type": "azurerm_resource_group", "values": {"name": "rg"}}
+			],
+			"child_modules": [{"resources": [
+				{
+					"address": "module.data.azurerm_storage_account.this",
+					"type": "azurerm_storage_account",
+					"values": {
+						"account_tier": "Standard",
+						"account_replication_type": "GZRS",
+						"allow_nested_items_to_be_public": false,
+						"shared_access_key_enabled": false,
+						"public_network_access_enabled": false,
+						"immutability_policy": [{"state": "Locked", "period_since_creation_in_days": 30, "allow_protected_append_writes": false}],
+						"blob_properties": [{
+							"versioning_enabled": true,
+							"delete_retention_policy": [{"days": 14, "permanent_delete_enabled": false}],
+							"container_delete_retention_policy": [{"days": 14}]
+						}]
+					}
+				}
+			]}]
+		}}
+	}`
+
+	armTemplateJSON = `{
+		"$schema": "https://schema.management.azure.com/schemas/2019-04-01/deploymentTemplate.json#",
+		"parameters": {
+			"storageAccountName": {"type": "string", "defaultValue": "templated"},
+			"skuName": {"type": "string"}
+		},
+		"variables": {"publicNetworkAccess": "Disabled"},
+		"resources": [{
+			"type": "Microsoft.Storage/storageAccounts",
+			"name": "[parameters('storageAccountName')]",
+			"sku": {"name": "[parameters('skuName')]"},
+			"properties": {
+				"allowSharedKeyAccess": false,
+				"publicNetworkAccess": "[variables('publicNetworkAccess')]",
+				"minimumTlsVersion": "[if(parameters('legacy'), 'TLS1_0', 'TLS1_2')]"
+			},
+			"resources": [{
+				"type": "blobServices",
+				"name": "default",
+				"properties": {"deleteRetentionPolicy": {"enabled": true}}
+			}]
+		}]
+	}`
+
+	bicepTemplate = `{
+		"languageVersion": "2.0",
+		"resources": {
+			"account": {
+				"type": "Microsoft.Storage/storageAccounts",
+				"name": "bicepaccount",
+				"sku": {"name": "Standard_RAGRS"},
+				"properties": {"allowBlobPublicAccess": true}
+			},
+			"blobs": {
+				"type": "Microsoft.Storage/storageAccounts/blobServices",
+				"name": "[format('{0}/{1}', 'bicepaccount', 'default')]",
+				"properties": {"isVersioningEnabled": true}
+			}
+		}
+	}`
+)
+
+func Test_loadTerraformPlans(t *testing.T) {
+	// Act
+	planTargets, err := loadTerraformPlans([]string{writeSnapshotFile(t, "plan.json", terraformPlanJSON)})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, planTargets, 2)
+
+	logs := planTargets[0]
+	assert.Equal(t, "azurerm_storage_account.logs", logs.label())
+	assert.Equal(t, armstorage.SKUNameStandardLRS, *logs.storageAccountResource.SKU.Name)
+	assert.True(t, *logs.storageAccountResource.Properties.AllowBlobPublicAccess)
+	assert.Equal(t, armstorage.DefaultActionDeny, *logs.storageAccountResource.Properties.NetworkRuleSet.DefaultAction)
+	assert.Equal(t, "203.0.113.0/24", *logs.storageAccountResource.Properties.NetworkRuleSet.IPRules[0].IPAddressOrRange)
+	assert.Equal(t, armstorage.Bypass("AzureServices, Logging"), *logs.storageAccountResource.Properties.NetworkRuleSet.Bypass)
+	assert.False(t, *logs.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.Enabled)
+
+	data := planTargets[1]
+	assert.Equal(t, "module.data.azurerm_storage_account.this", data.label())
+	assert.Equal(t, armstorage.PublicNetworkAccessDisabled, *data.storageAccountResource.Properties.PublicNetworkAccess)
+	assert.Equal(t, armstorage.AccountImmutabilityPolicyStateLocked, *data.storageAccountResource.Properties.ImmutableStorageWithVersioning.ImmutabilityPolicy.State)
+	assert.Equal(t, int32(14), *data.blobServiceProperties.BlobServiceProperties.ContainerDeleteRetentionPolicy.Days)
+	assert.True(t, *data.blobServiceProperties.BlobServiceProperties.IsVersioningEnabled)
+}
+
+func Test_loadArmTemplates(t *testing.T) {
+	// Act
+	templateTargets, err := loadArmTemplates([]string{
+		writeSnapshotFile(t, "template.json", armTemplateJSON),
+		writeSnapshotFile(t, "bicep.json", bicepTemplate),
+	})
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, templateTargets, 2)
+
+	templated := templateTargets[0]
+	assert.Equal(t, "resources[0]", templated.label())
+	assert.Equal(t, "templated", templated.resourceId.storageAccountName)
+	assert.Equal(t, armstorage.SKUName(""), *templated.storageAccountResource.SKU.Name)
+	assert.False(t, *templated.storageAccountResource.Properties.AllowSharedKeyAccess)
+	assert.Equal(t, armstorage.PublicNetworkAccessDisabled, *templated.storageAccountResource.Properties.PublicNetworkAccess)
+	assert.Nil(t, templated.storageAccountResource.Properties.MinimumTLSVersion)
+	assert.ElementsMatch(t, []string{"sku.name", "properties.minimumTlsVersion"}, templated.unresolvedProperties)
+	assert.Equal(t, int32(defaultRetentionDays), *templated.blobServiceProperties.BlobServiceProperties.DeleteRetentionPolicy.Days)
+
+	bicep := templateTargets[1]
+	assert.Equal(t, "account", bicep.label())
+	assert.True(t, *bicep.storageAccountResource.Properties.AllowBlobPublicAccess)
+	assert.True(t, *bicep.blobServiceProperties.BlobServiceProperties.IsVersioningEnabled)
+	assert.Equal(t, []string{"blobServices.name"}, bicep.unresolvedProperties)
+}
+
+func Test_armTemplate_resolve(t *testing.T) {
+	template := armTemplate{
+		Variables: map[string]interface{}{"tier": "[parameters('tier')]"},
+	}
+	template.Parameters = map[string]struct {
+		DefaultValue interface{} `json:"defaultValue"`
+	}{"tier": {DefaultValue: "Hot"}}
+
+	tests := []struct {
+		name               string
+		value              interface{}
+		expected           interface{}
+		expectedOk         bool
+		expectedUnresolved []string
+	}{
+		{name: "literal", value: "Hot", expected: "Hot", expectedOk: true},
+		{name: "escaped literal", value: "[[brackets]", expected: "[brackets]", expectedOk: true},
+		{name: "variable referencing a parameter", value: "[variables('tier')]", expected: "Hot", expectedOk: true},
+		{name: "unknown parameter", value: "[parameters('missing')]", expected: nil, expectedOk: false},
+		{name: "function", value: "[resourceGroup().location]", expected: nil, expectedOk: false},
+		{
+			name: "nested expressions which cannot be resolved",
+			value: map[string]interface{}{"properties": map[string]interface{}{
+				"accessTier":  "[variables('tier')]",
+				"networkAcls": map[string]interface{}{"ipRules": []interface{}{map[string]interface{}{"value": "[parameters('ipRange')]"}}},
+			}},
+			expected: map[string]interface{}{"properties": map[string]interface{}{
+				"accessTier":  "Hot",
+				"networkAcls": map[string]interface{}{"ipRules": []interface{}{map[string]interface{}{}}},
+			}},
+			expectedOk:         true,
+			expectedUnresolved: []string{"properties.networkAcls.ipRules[0].value"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			var unresolved []string
+
+			// Act
+			resolved, ok := template.resolve(tt.value, "", &unresolved)
+
+			// Assert
+			assert.Equal(t, tt.expectedOk, ok)
+			assert.Equal(t, tt.expected, resolved)
+			assert.Equal(t, tt.expectedUnresolved, unresolved)
+		})
+	}
+}
+
+func Test_Initialize_assesses_terraform_plans_by_address(t *testing.T) {
+	// Arrange
+	previousTestSuites, previousConfig := Armory.TestSuites, Armory.Config
+	Armory.TestSuites = map[string][]pluginkit.TestSet{"tlp_red": {CCC_C03_TR02, CCC_C08_TR02}}
+	Armory.Config = &config.Config{Vars: map[string]interface{}{
+		"terraformplanfiles": []interface{}{writeSnapshotFile(t, "plan.json", terraformPlanJSON)},
+	}}
+
+	defer func() {
+		Armory.TestSuites, Armory.Config = previousTestSuites, previousConfig
+		assessingSnapshots = false
+	}()
+
+	// Act
+	err := Initialize()
+
+	// Assert
+	assert.NoError(t, err)
+
+	_, publicAccessResult := Armory.TestSuites["tlp_red"][0]()
+	assert.False(t, publicAccessResult.Passed)
+	assert.Contains(t, publicAccessResult.Message, "[module.data.azurerm_storage_account.this]")
+	assert.False(t, publicAccessResult.Tests["azurerm_storage_account.logs/CCC_C03_TR02_T01"].Passed)
+	assert.True(t, publicAccessResult.Tests["module.data.azurerm_storage_account.this/CCC_C03_TR02_T01"].Passed)
+
+	_, replicationStateResult := Armory.TestSuites["tlp_red"][1]()
+	assert.Contains(t, replicationStateResult.Message, "TestSet was not run: it assesses the state of a deployed storage account")
+}
+
+func Test_Initialize_does_not_assess_properties_an_arm_template_cannot_resolve(t *testing.T) {
+	// Arrange
+	previousTestSuites, previousConfig := Armory.TestSuites, Armory.Config
+	Armory.TestSuites = map[string][]pluginkit.TestSet{"tlp_red": {CCC_C03_TR02, CCC_C08_TR01, CCC_ObjStor_C02_TR01}}
+	Armory.Config = &config.Config{Vars: map[string]interface{}{
+		"armtemplatefiles": []interface{}{writeSnapshotFile(t, "template.json", `{
+			"parameters": {"allowBlobPublicAccess": {"type": "bool"}},
+			"resources": [{
+				"type": "Microsoft.Storage/storageAccounts",
+				"name": "templated",
+				"sku": {"name": "[concat('Standard_', 'GRS')]"},
+				"properties": {"allowBlobPublicAccess": "[parameters('allowBlobPublicAccess')]", "allowSharedKeyAccess": false}
+			}]
+		}`)},
+	}}
+
+	defer func() {
+		Armory.TestSuites, Armory.Config = previousTestSuites, previousConfig
+		assessingSnapshots = false
+	}()
+
+	// Act
+	err := Initialize()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Nil(t, currentTarget.storageAccountResource.Properties.AllowBlobPublicAccess)
+
+	_, publicAccessResult := Armory.TestSuites["tlp_red"][0]()
+	assert.False(t, publicAccessResult.Passed)
+	assert.Contains(t, publicAccessResult.Message, "TestSet was not run: the ARM template sets properties it assesses with expressions which cannot be resolved before deployment: properties.allowBlobPublicAccess")
+
+	_, replicationResult := Armory.TestSuites["tlp_red"][1]()
+	assert.Contains(t, replicationResult.Message, "cannot be resolved before deployment: sku.name")
+
+	_, sharedKeyResult := Armory.TestSuites["tlp_red"][2]()
+	assert.True(t, sharedKeyResult.Passed, sharedKeyResult.Message)
+}
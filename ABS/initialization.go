@@ -0,0 +1,192 @@
+package abs
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"runtime"
+	"strings"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+// initComponent is a client or resource which is set up during initialization and that TestSets depend on
+type initComponent string
+
+const (
+	componentStorageAccount           initComponent = "storage account properties"
+	componentBlobServiceProperties    initComponent = "blob service properties"
+	componentLogsClient               initComponent = "logs client"
+	componentDefenderForStorageClient initComponent = "Defender for Storage client"
+	componentSubscriptionsClient      initComponent = "subscriptions client"
+	componentManagementGroupsClient   initComponent = "management groups client"
+	componentStorageAccountsClient    initComponent = "storage accounts client"
+	componentDiagnosticSettingsClient initComponent = "diagnostic settings client"
+	componentActivityLogsClient       initComponent = "activity logs client"
+	componentBlobServicesClient       initComponent = "blob services client"
+	componentBlobContainersClient     initComponent = "blob containers client"
+	componentEncryptionScopesClient   initComponent = "encryption scopes client"
+	componentPerimeterConfigsClient   initComponent = "network security perimeter client"
+	componentRoleAssignmentsClient    initComponent = "role assignments client"
+	componentRoleDefinitionsClient    initComponent = "role definitions client"
+	componentPolicyClient             initComponent = "policy client"
+	componentPolicyInsightsClient     initComponent = "policy insights client"
+	componentStorageSkusClient        initComponent = "storage SKUs client"
+	componentVaultsClient             initComponent = "recovery services vaults client"
+	componentKeyVaultsClient          initComponent = "key vaults client"
+	componentPermissionsClient        initComponent = "permissions client"
+	componentDiscovery                initComponent = "storage account discovery"
+)
+
+// initializationError records a component which could not be set up, and the scope it was being set up for
+type initializationError struct {
+	component initComponent
+	scope     string
+	err       error
+}
+
+func (e *initializationError) Error() string {
+	if e.scope == "" {
+		return fmt.Sprintf("failed to initialize %s: %v", e.component, e.err)
+	}
+
+	return fmt.Sprintf("failed to initialize %s for %s: %v", e.component, e.scope, e.err)
+}
+
+func (e *initializationError) Unwrap() error {
+	return e.err
+}
+
+// initializationErrors aggregates every failure seen during initialization so that unaffected TestSets can still run
+type initializationErrors []*initializationError
+
+func (errs initializationErrors) Error() string {
+	messages := make([]string, len(errs))
+
+	for i, err := range errs {
+		messages[i] = err.Error()
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (errs initializationErrors) Unwrap() []error {
+	unwrapped := make([]error, len(errs))
+
+	for i, err := range errs {
+		unwrapped[i] = err
+	}
+
+	return unwrapped
+}
+
+// add records a failure to initialize a component, errors which are nil are ignored
+func (errs *initializationErrors) add(component initComponent, scope string, err error) {
+	if err != nil {
+		*errs = append(*errs, &initializationError{component: component, scope: scope, err: err})
+	}
+}
+
+// forComponents returns the errors for any of the given components
+func (errs initializationErrors) forComponents(components ...initComponent) (matching initializationErrors) {
+	for _, err := range errs {
+		for _, component := range components {
+			if err.component == component {
+				matching = append(matching, err)
+				break
+			}
+		}
+	}
+
+	return matching
+}
+
+var (
+	// initErrors holds failures of components which are shared by every storage account
+	initErrors initializationErrors
+
+	// subscriptionInitErrors holds failures of the subscription-scoped clients, keyed by subscription ID
+	subscriptionInitErrors = make(map[string]initializationErrors)
+
+	// testSetDependencies lists the components that each TestSet needs in order to run
+	testSetDependencies = map[string][]initComponent{
+		"CCC_C01_TR01":         {componentStorageAccount},
+		"CCC_C02_TR01":         {componentStorageAccount},
+		"CCC_C03_TR02":         {componentStorageAccount},
+		"CCC_C03_TR05":         {componentStorageAccount},
+		"CCC_C04_TR01":         {componentStorageAccount, componentLogsClient, componentDiagnosticSettingsClient},
+		"CCC_C04_TR02":         {componentStorageAccount, componentLogsClient, componentDiagnosticSettingsClient},
+		"CCC_C04_TR03":         {componentStorageAccount, componentStorageAccountsClient, componentActivityLogsClient, componentRoleAssignmentsClient},
+		"CCC_C05_TR01":         {componentStorageAccount},
+		"CCC_C05_TR04":         {componentDiagnosticSettingsClient},
+		"CCC_C06_TR01":         {componentStorageAccountsClient, componentPolicyClient, componentPolicyInsightsClient, componentStorageSkusClient},
+		"CCC_C06_TR02":         {componentStorageSkusClient, componentSubscriptionsClient, componentVaultsClient},
+		"CCC_C07_TR01":         {componentDefenderForStorageClient},
+		"CCC_C07_TR02":         {componentDefenderForStorageClient},
+		"CCC_C08_TR01":         {componentStorageAccount},
+		"CCC_C08_TR02":         {componentStorageAccount},
+		"CCC_C09_TR01":         {componentDiagnosticSettingsClient},
+		"CCC_C09_TR02":         {componentDiagnosticSettingsClient},
+		"CCC_C09_TR03":         {componentDiagnosticSettingsClient},
+		"CCC_C11_TR02":         {componentStorageAccount, componentPolicyClient, componentKeyVaultsClient},
+		"CCC_C11_TR03":         {componentPolicyClient, componentPolicyInsightsClient},
+		"CCC_C11_TR04":         {componentStorageAccount, componentKeyVaultsClient, componentRoleAssignmentsClient, componentRoleDefinitionsClient},
+		"CCC_F05_TR01":         {componentStorageAccount, componentBlobContainersClient},
+		"CCC_ObjStor_C01_TR01": {componentStorageAccount, componentEncryptionScopesClient, componentBlobContainersClient},
+		"CCC_ObjStor_C01_TR02": {componentStorageAccount, componentEncryptionScopesClient, componentBlobContainersClient},
+		"CCC_ObjStor_C01_TR03": {componentStorageAccount, componentEncryptionScopesClient, componentBlobContainersClient},
+		"CCC_ObjStor_C01_TR04": {componentStorageAccount, componentEncryptionScopesClient, componentBlobContainersClient},
+		"CCC_ObjStor_C02_TR01": {componentStorageAccount},
+		"CCC_ObjStor_C02_TR02": {componentStorageAccount},
+		"CCC_ObjStor_C03_TR01": {componentStorageAccount, componentBlobServiceProperties, componentBlobContainersClient},
+		"CCC_ObjStor_C03_TR02": {componentStorageAccount},
+		"CCC_ObjStor_C04_TR01": {componentStorageAccount},
+		"CCC_ObjStor_C04_TR02": {componentStorageAccount, componentLogsClient, componentActivityLogsClient, componentBlobContainersClient},
+		"CCC_ObjStor_C05_TR01": {componentStorageAccount, componentBlobServiceProperties, componentBlobContainersClient},
+		"CCC_ObjStor_C05_TR02": {componentStorageAccount, componentBlobContainersClient},
+		"CCC_ObjStor_C05_TR03": {componentStorageAccount, componentBlobContainersClient},
+		"CCC_ObjStor_C05_TR04": {componentStorageAccount, componentBlobServiceProperties, componentBlobContainersClient},
+		"CCC_ObjStor_C06_TR01": {componentDiagnosticSettingsClient},
+	}
+)
+
+// logInitializationErrors reports every failure seen during initialization
+func logInitializationErrors() {
+	for _, err := range initErrors {
+		log.Printf("[ERROR] %v", err)
+	}
+
+	for _, errs := range subscriptionInitErrors {
+		for _, err := range errs {
+			log.Printf("[ERROR] %v", err)
+		}
+	}
+
+	for _, target := range targets {
+		for _, err := range target.initErrors {
+			log.Printf("[ERROR] %v", err)
+		}
+	}
+}
+
+// getTestSetName returns the function name of a TestSet, in the same way the SDK names tests
+func getTestSetName(testSet pluginkit.TestSet) string {
+	testSetFuncName := runtime.FuncForPC(reflect.ValueOf(testSet).Pointer()).Name()
+	return testSetFuncName[strings.LastIndex(testSetFuncName, ".")+1:]
+}
+
+// withInitializationCheck wraps a TestSet so that it is marked as errored, rather than run, when a component it depends on failed to initialize
+func withInitializationCheck(testSet pluginkit.TestSet) pluginkit.TestSet {
+	testSetName := getTestSetName(testSet)
+	dependencies := testSetDependencies[testSetName]
+
+	return func() (string, pluginkit.TestSetResult) {
+		failedDependencies := currentTarget.getInitErrors().forComponents(dependencies...)
+
+		if len(failedDependencies) == 0 {
+			return testSet()
+		}
+
+		return testSetName, newNotRunResult(testSetName, fmt.Sprintf("TestSet errored and was not run: %s", failedDependencies.Error()))
+	}
+}
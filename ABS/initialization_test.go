@@ -0,0 +1,64 @@
+package abs
+
+import (
+	"testing"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_initializationErrors_forComponents(t *testing.T) {
+	// Arrange
+	var errs initializationErrors
+	errs.add(componentPolicyClient, "subscription 00000000-0000-0000-0000-000000000000", assert.AnError)
+	errs.add(componentLogsClient, "", nil)
+	errs.add(componentVaultsClient, "", assert.AnError)
+
+	// Act
+	matching := errs.forComponents(componentPolicyClient, componentLogsClient)
+
+	// Assert
+	assert.Len(t, errs, 2)
+	assert.Len(t, matching, 1)
+	assert.Equal(t, "failed to initialize policy client for subscription 00000000-0000-0000-0000-000000000000: "+assert.AnError.Error(), matching.Error())
+}
+
+func Test_getTestSetName(t *testing.T) {
+	assert.Equal(t, "CCC_C11_TR02", getTestSetName(CCC_C11_TR02))
+}
+
+func Test_withInitializationCheck_marks_dependent_test_set_as_errored(t *testing.T) {
+	// Arrange
+	initErrors = initializationErrors{{component: componentPolicyClient, err: assert.AnError}}
+	defer func() { initErrors = nil }()
+
+	// Act
+	testSetName, result := withInitializationCheck(CCC_C11_TR02)()
+
+	// Assert
+	assert.Equal(t, "CCC_C11_TR02", testSetName)
+	assert.Equal(t, false, result.Passed)
+	assert.Contains(t, result.Message, "TestSet errored and was not run: failed to initialize policy client")
+	assert.Equal(t, "CCC.C11.TR02", result.ControlID)
+	assert.Equal(t, testSetMetadata["CCC_C11_TR02"].Description, result.Description)
+	assert.Equal(t, "https://maintainer.com/docs/raids/ABS", result.DocsURL)
+}
+
+func Test_withInitializationCheck_runs_independent_test_set(t *testing.T) {
+	// Arrange
+	initErrors = initializationErrors{{component: componentPolicyClient, err: assert.AnError}}
+	defer func() { initErrors = nil }()
+
+	testSetRan := false
+	testSet := func() (string, pluginkit.TestSetResult) {
+		testSetRan = true
+		return "CCC_Test_TR01", pluginkit.TestSetResult{Passed: true}
+	}
+
+	// Act
+	_, result := withInitializationCheck(testSet)()
+
+	// Assert
+	assert.Equal(t, true, testSetRan)
+	assert.Equal(t, true, result.Passed)
+}
@@ -0,0 +1,247 @@
+package abs
+
+import "github.com/privateerproj/privateer-sdk/pluginkit"
+
+// testSetMetadata describes each TestSet, so that a TestSet which is not run is still reported against its control
+var testSetMetadata = map[string]pluginkit.TestSetResult{
+	"CCC_C01_TR01": {
+		Description: "When a port is exposed for non-SSH network traffic, all traffic MUST include a TLS handshake AND be encrypted using TLS 1.2 or higher.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C01",
+	},
+	"CCC_C01_TR02": {
+		Description: "When a port is exposed for SSH network traffic, all traffic MUST include a SSH handshake AND be encrypted using SSHv2 or higher.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C01",
+	},
+	"CCC_C02_TR01": {
+		Description: "When data is stored at rest, the service MUST be configured to encrypt data at rest using the latest industry-standard encryption methods.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C02",
+	},
+	"CCC_C03_TR01": {
+		Description: "When an entity attempts to modify the service, the service MUST attempt to verify the client's identity through an authentication process.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C03",
+	},
+	"CCC_C03_TR02": {
+		Description: "When an entity attempts to view information presented by the service, the service MUST attempt to verify the client's identity through an authentication process.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C03",
+	},
+	"CCC_C03_TR03": {
+		Description: "When an entity attempts to view information on the service through a user interface, the authentication process MUST require multiple identifying factors from the user.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C03",
+	},
+	"CCC_C03_TR04": {
+		Description: "When an entity attempts to modify the service through an API endpoint, the authentication process MUST be limited to a specific allowed network.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C03",
+	},
+	"CCC_C03_TR05": {
+		Description: "When an entity attempts to view information on the service through an API endpoint, the authentication process MUST be limited to a specific allowed network.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C03",
+	},
+	"CCC_C03_TR06": {
+		Description: "When an entity attempts to modify the service through a user interface, the authentication process MUST require multiple identifying factors from the user.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C03",
+	},
+	"CCC_C04_TR01": {
+		Description: "When any access attempt is made to the service, the service MUST log the client identity, time, and result of the attempt.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C04",
+	},
+	"CCC_C04_TR02": {
+		Description: "When any access attempt is made to the view sensitive information, the service MUST log the client identity, time, and result of the attempt.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C04",
+	},
+	"CCC_C04_TR03": {
+		Description: "When any change is made to the service configuration, the service MUST log the change, including the client, time, previous state, and the new state following the change.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C04",
+	},
+	"CCC_C05_TR01": {
+		Description: "When access to sensitive resources is attempted, the service MUST block requests from untrusted sources, including IP addresses, domains, or networks that are not explicitly included in a pre-approved allowlist.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C05",
+	},
+	"CCC_C05_TR02": {
+		Description: "When administrative access is attempted, the service MUST validate that the request originates from an explicitly allowed source as defined in the allowlist.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C05",
+	},
+	"CCC_C05_TR03": {
+		Description: "When resources are accessed in a multi-tenant environment, the service MUST enforce isolation by allowing access only to explicitly allowlisted tenants.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C05",
+	},
+	"CCC_C05_TR04": {
+		Description: "When an access attempt from an untrusted source is blocked, the service MUST log the event, including the source details, time, and reason for denial.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C05",
+	},
+	"CCC_C06_TR01": {
+		Description: "When a deployment request is made, the service MUST validate that the deployment region is not to a restricted or regions or availability zones.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C06",
+	},
+	"CCC_C06_TR02": {
+		Description: "When a deployment request is made, the service MUST validate that replication of data, backups, and disaster recovery operations will not occur in restricted regions or availability zones.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C06",
+	},
+	"CCC_C07_TR01": {
+		Description: "When suspicious enumeration activities are detected, the service MUST generate real-time alerts to notify security personnel.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C07",
+	},
+	"CCC_C07_TR02": {
+		Description: "When suspicious enumeration activities are detected, the service MUST log the event, including the source details, time, and nature of the activity.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C07",
+	},
+	"CCC_C08_TR01": {
+		Description: "When data is stored, the service MUST ensure that data is replicated across multiple availability zones or regions.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C08",
+	},
+	"CCC_C08_TR02": {
+		Description: "When data is replicated across multiple zones or regions, the service MUST be able to verify the replication state, including the replication locations and data synchronization status.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C08",
+	},
+	"CCC_C09_TR01": {
+		Description: "When access logs are stored, the service MUST ensure that access logs cannot be accessed without proper authorization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C09.TR01",
+	},
+	"CCC_C09_TR02": {
+		Description: "When access logs are stored, the service MUST ensure that access logs cannot be modified without proper authorization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C09.TR02",
+	},
+	"CCC_C09_TR03": {
+		Description: "When access logs are stored, the service MUST ensure that access logs cannot be deleted without proper authorization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C09.TR03",
+	},
+	"CCC_C10_TR01": {
+		Description: "Prevent replication of data to untrusted destinations outside the organization's defined trust perimeter.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C10.TR01",
+	},
+	"CCC_C11_TR01": {
+		Description: "When encryption keys are used, the service MUST verify that all encryption keys use approved cryptographic algorithms as per organizational standards.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C11.TR01",
+	},
+	"CCC_C11_TR02": {
+		Description: "When encryption keys are used, the service MUST verify that encryption keys are rotated at a frequency compliant with organizational policies.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C11.TR02",
+	},
+	"CCC_C11_TR03": {
+		Description: "When encrypting data, the service MUST verify that customer-managed encryption keys (CMEKs) are used.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C11.TR03",
+	},
+	"CCC_C11_TR04": {
+		Description: "When encryption keys are accessed, the service MUST verify that access to encryption keys is restricted to authorized personnel and services, following the principle of least privilege.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.C11.TR04",
+	},
+	"CCC_F05_TR01": {
+		Description: "When signed URLs are used to grant temporary access, the service MUST limit how long they remain valid and the keys which sign them MUST be rotated.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.F05",
+	},
+	"CCC_ObjStor_C01_TR01": {
+		Description: "When a request is made to read a protected bucket, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+	},
+	"CCC_ObjStor_C01_TR02": {
+		Description: "When a request is made to read a protected object, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+	},
+	"CCC_ObjStor_C01_TR03": {
+		Description: "When a request is made to write to a bucket, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+	},
+	"CCC_ObjStor_C01_TR04": {
+		Description: "When a request is made to write to an object, the service MUST prevent any request using KMS keys not listed as trusted by the organization.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C01",
+	},
+	"CCC_ObjStor_C02_TR01": {
+		Description: "When a permission set is allowed for an object in a bucket, the service MUST allow the same permission set to access all objects in the same bucket.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C02",
+	},
+	"CCC_ObjStor_C02_TR02": {
+		Description: "When a permission set is denied for an object in a bucket, the service MUST deny the same permission set to access all objects in the same bucket.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C02",
+	},
+	"CCC_ObjStor_C03_TR01": {
+		Description: "When an object storage bucket deletion is attempted, the bucket MUST be fully recoverable for a set time-frame after deletion is requested.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C03",
+	},
+	"CCC_ObjStor_C03_TR02": {
+		Description: "When an attempt is made to modify the retention policy for an object storage bucket, the service MUST prevent the policy from being modified.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C03",
+	},
+	"CCC_ObjStor_C04_TR01": {
+		Description: "When an object is uploaded to the object storage system, the object MUST automatically receive a default retention policy that prevents premature deletion or modification.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C04",
+	},
+	"CCC_ObjStor_C04_TR02": {
+		Description: "When an attempt is made to delete or modify an object that is subject to an active retention policy, the service MUST prevent the action from being completed.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C05",
+	},
+	"CCC_ObjStor_C05_TR01": {
+		Description: "When an object is uploaded to the object storage bucket, the object MUST be stored with a unique identifier.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C05",
+	},
+	"CCC_ObjStor_C05_TR02": {
+		Description: "When an object is modified, the service MUST assign a new unique identifier to the modified object to differentiate it from the previous version.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C05",
+	},
+	"CCC_ObjStor_C05_TR03": {
+		Description: "When an object is modified, the service MUST allow for recovery of previous versions of the object.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C05",
+	},
+	"CCC_ObjStor_C05_TR04": {
+		Description: "When an object is deleted, the service MUST retain other versions of the object to allow for recovery of previous versions.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C05",
+	},
+	"CCC_ObjStor_C06_TR01": {
+		Description: "When an object storage bucket is accessed, the service MUST store access logs in a separate data store.",
+		DocsURL:     "https://maintainer.com/docs/raids/ABS",
+		ControlID:   "CCC.ObjStor.C06",
+	},
+}
+
+// newNotRunResult creates the result of a TestSet which was not run, with the description and control of the TestSet
+func newNotRunResult(testSetName string, message string) pluginkit.TestSetResult {
+	result := testSetMetadata[testSetName]
+	result.Passed = false
+	result.Message = message
+	result.Tests = make(map[string]pluginkit.TestResult)
+
+	return result
+}
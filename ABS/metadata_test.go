@@ -0,0 +1,32 @@
+package abs
+
+import (
+	"testing"
+
+	"github.com/azure/finos-azure-blob-storage-raid/ABS/emulator"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_testSetMetadata_matches_the_test_sets(t *testing.T) {
+	// Arrange
+	testSuites := Armory.TestSuites
+
+	// Act
+	results := runEmulatedTestSuite(t, emulator.Compliant())
+
+	// Assert
+	for _, testSets := range testSuites {
+		for _, testSet := range testSets {
+			assert.Contains(t, testSetMetadata, getTestSetName(testSet))
+		}
+	}
+
+	assert.NotEmpty(t, results)
+
+	for testSetName, result := range results {
+		metadata := testSetMetadata[testSetName]
+		assert.Equal(t, metadata.Description, result.Description, testSetName)
+		assert.Equal(t, metadata.ControlID, result.ControlID, testSetName)
+		assert.Equal(t, metadata.DocsURL, result.DocsURL, testSetName)
+	}
+}
@@ -0,0 +1,449 @@
+package abs
+
+import (
+	"fmt"
+	"net/netip"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+// defaultMinCidrPrefixLength is used when minCidrPrefixLength is not configured, an IP rule for a range of more than 65,536 addresses is overly broad
+const defaultMinCidrPrefixLength = 16
+
+var (
+	// approvedCidrs are the address ranges the organization approves for the IP rules of a storage account, IP rules are only checked against them when any are configured
+	approvedCidrs []netip.Prefix
+
+	// minCidrPrefixLength is the shortest prefix length an IP rule may have before it is flagged as overly broad, such as a cloud provider's whole range
+	minCidrPrefixLength = defaultMinCidrPrefixLength
+
+	// azureServicesBypassForbidden is set when trusted Azure services are explicitly not allowed to bypass the network rules of a storage account,
+	// which Azure allows by default
+	azureServicesBypassForbidden bool
+)
+
+// NetworkExposureReport is every route by which the data plane of a storage account can be reached
+type NetworkExposureReport struct {
+	PublicNetworkAccess       string
+	DefaultAction             string
+	Bypass                    []string
+	IPRules                   []IPRuleReport
+	VirtualNetworkRules       []VirtualNetworkRuleReport
+	ResourceAccessRules       []ResourceAccessRuleReport
+	PrivateEndpoints          []PrivateEndpointReport
+	NetworkSecurityPerimeters []NetworkSecurityPerimeterReport
+	// NetworkSecurityPerimeterError is set when the perimeter associations of the storage account could not be read
+	NetworkSecurityPerimeterError string
+}
+
+// IPRuleReport is an address or range from which the storage account accepts requests, and the approved CIDR which contains it
+type IPRuleReport struct {
+	AddressOrRange string
+	ApprovedBy     string
+	Broad          bool
+}
+
+// VirtualNetworkRuleReport is a subnet from which the storage account accepts requests through a service endpoint
+type VirtualNetworkRuleReport struct {
+	SubnetID string
+	State    string
+}
+
+// ResourceAccessRuleReport is a resource instance which can reach the storage account with its managed identity
+type ResourceAccessRuleReport struct {
+	ResourceID string
+	TenantID   string
+}
+
+// PrivateEndpointReport is a private endpoint connection, only an approved connection can reach the storage account
+type PrivateEndpointReport struct {
+	Name              string
+	PrivateEndpointID string
+	Status            string
+}
+
+// NetworkSecurityPerimeterReport is an association of the storage account with a Network Security Perimeter and the inbound access rules of its profile
+type NetworkSecurityPerimeterReport struct {
+	PerimeterID            string
+	Profile                string
+	AccessMode             string
+	ProvisioningState      string
+	InboundAddressPrefixes []string
+	InboundSubscriptions   []string
+}
+
+// enforced is whether the perimeter's access rules replace those of the storage account, rather than only being logged or evaluated alongside them
+func (perimeter NetworkSecurityPerimeterReport) enforced() bool {
+	return strings.EqualFold(perimeter.AccessMode, string(armstorage.ResourceAssociationAccessModeEnforced))
+}
+
+// approvedPrivateEndpoints returns the number of private endpoint connections which can reach the storage account, and those pending approval
+func (report NetworkExposureReport) approvedPrivateEndpoints() (approved int, pending int) {
+	for _, privateEndpoint := range report.PrivateEndpoints {
+		switch privateEndpoint.Status {
+		case string(armstorage.PrivateEndpointServiceConnectionStatusApproved):
+			approved++
+		case string(armstorage.PrivateEndpointServiceConnectionStatusPending):
+			pending++
+		}
+	}
+
+	return approved, pending
+}
+
+// describeAllowlist summarises the rules which let sources outside of private endpoints reach the storage account
+func (report NetworkExposureReport) describeAllowlist() string {
+	approved, pending := report.approvedPrivateEndpoints()
+	description := fmt.Sprintf("%d IP rules, %d virtual network rules, %d resource instance rules and %d approved private endpoints", len(report.IPRules), len(report.VirtualNetworkRules), len(report.ResourceAccessRules), approved)
+
+	if pending > 0 {
+		description += fmt.Sprintf(", with %d private endpoints pending approval", pending)
+	}
+
+	if len(report.Bypass) > 0 {
+		description += fmt.Sprintf(", bypassed by %s", strings.Join(report.Bypass, ", "))
+	}
+
+	return description
+}
+
+// loadNetworkAllowlist reads the approved CIDRs, the shortest prefix length an IP rule may have and whether trusted Azure services may bypass the network rules from the config
+func loadNetworkAllowlist() error {
+	approvedCidrs = nil
+
+	for _, value := range getConfigStringSlice("approvedcidrs") {
+		prefix, err := parseCidr(value)
+
+		if err != nil {
+			return fmt.Errorf("failed to parse approved CIDR %s: %v", value, err)
+		}
+
+		approvedCidrs = append(approvedCidrs, prefix)
+	}
+
+	minCidrPrefixLength = Armory.Config.GetInt("mincidrprefixlength")
+
+	if minCidrPrefixLength <= 0 {
+		minCidrPrefixLength = defaultMinCidrPrefixLength
+	}
+
+	_, bypassType := Armory.Config.GetVar("allowazureservicesbypass")
+	azureServicesBypassForbidden = bypassType == "bool" && !Armory.Config.GetBool("allowazureservicesbypass")
+
+	return nil
+}
+
+// parseCidr parses a CIDR, or a single address as the range of only that address, as IP rules allow either
+func parseCidr(value string) (netip.Prefix, error) {
+	value = strings.TrimSpace(value)
+
+	if !strings.Contains(value, "/") {
+		address, err := netip.ParseAddr(value)
+
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+
+		return netip.PrefixFrom(address, address.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(value)
+
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+
+	return prefix.Masked(), nil
+}
+
+// newIPRuleReport finds the approved CIDR which contains an IP rule, and whether the rule is overly broad
+func newIPRuleReport(addressOrRange string) (ipRule IPRuleReport) {
+	ipRule.AddressOrRange = addressOrRange
+
+	prefix, err := parseCidr(addressOrRange)
+
+	// An IP rule which cannot be parsed is reported as neither approved nor broad, so that it is not approved
+	if err != nil {
+		return ipRule
+	}
+
+	ipRule.Broad = prefix.Bits() < minCidrPrefixLength
+
+	for _, approvedCidr := range approvedCidrs {
+		if approvedCidr.Bits() <= prefix.Bits() && approvedCidr.Contains(prefix.Addr()) {
+			ipRule.ApprovedBy = approvedCidr.String()
+			break
+		}
+	}
+
+	return ipRule
+}
+
+// allowlistViolations lists the IP rules outside of the approved CIDRs when any are configured, the overly broad IP rules and a bypass for trusted Azure services when it is forbidden
+func (report NetworkExposureReport) allowlistViolations() (violations []string) {
+	var unapproved, broad []string
+
+	for _, ipRule := range report.IPRules {
+		if len(approvedCidrs) > 0 && ipRule.ApprovedBy == "" {
+			unapproved = append(unapproved, ipRule.AddressOrRange)
+		}
+
+		if ipRule.Broad {
+			broad = append(broad, ipRule.AddressOrRange)
+		}
+	}
+
+	if len(unapproved) > 0 {
+		violations = append(violations, fmt.Sprintf("IP rules %s are outside of the approved CIDRs", strings.Join(unapproved, ", ")))
+	}
+
+	if len(broad) > 0 {
+		violations = append(violations, fmt.Sprintf("IP rules %s are broader than /%d", strings.Join(broad, ", "), minCidrPrefixLength))
+	}
+
+	if azureServicesBypassForbidden && slices.Contains(report.Bypass, string(armstorage.BypassAzureServices)) {
+		violations = append(violations, "trusted Azure services bypass the network rules, which is not permitted")
+	}
+
+	return violations
+}
+
+// splitBypass lists the services which may bypass the network rules, a bypass is a comma-separated combination of Logging, Metrics and AzureServices
+func splitBypass(bypass *armstorage.Bypass) (services []string) {
+	if bypass == nil {
+		return nil
+	}
+
+	for _, service := range strings.Split(string(*bypass), ",") {
+		if service = strings.TrimSpace(service); service != "" && service != string(armstorage.BypassNone) {
+			services = append(services, service)
+		}
+	}
+
+	return services
+}
+
+// getNetworkExposureReport collects the network rules, private endpoint connections and, when public access is secured by a perimeter, the perimeter associations of the storage account
+func getNetworkExposureReport() (report NetworkExposureReport) {
+	properties := currentTarget.storageAccountResource.Properties
+
+	// Azure treats a storage account which public network access has never been set on as enabled
+	report.PublicNetworkAccess = string(armstorage.PublicNetworkAccessEnabled)
+
+	if properties.PublicNetworkAccess != nil {
+		report.PublicNetworkAccess = string(*properties.PublicNetworkAccess)
+	}
+
+	if networkRuleSet := properties.NetworkRuleSet; networkRuleSet != nil {
+		if networkRuleSet.DefaultAction != nil {
+			report.DefaultAction = string(*networkRuleSet.DefaultAction)
+		}
+
+		report.Bypass = splitBypass(networkRuleSet.Bypass)
+
+		for _, ipRule := range networkRuleSet.IPRules {
+			if ipRule != nil && ipRule.IPAddressOrRange != nil {
+				report.IPRules = append(report.IPRules, newIPRuleReport(*ipRule.IPAddressOrRange))
+			}
+		}
+
+		for _, virtualNetworkRule := range networkRuleSet.VirtualNetworkRules {
+			if virtualNetworkRule == nil || virtualNetworkRule.VirtualNetworkResourceID == nil {
+				continue
+			}
+
+			rule := VirtualNetworkRuleReport{SubnetID: *virtualNetworkRule.VirtualNetworkResourceID}
+
+			if virtualNetworkRule.State != nil {
+				rule.State = string(*virtualNetworkRule.State)
+			}
+
+			report.VirtualNetworkRules = append(report.VirtualNetworkRules, rule)
+		}
+
+		for _, resourceAccessRule := range networkRuleSet.ResourceAccessRules {
+			if resourceAccessRule == nil || resourceAccessRule.ResourceID == nil {
+				continue
+			}
+
+			rule := ResourceAccessRuleReport{ResourceID: *resourceAccessRule.ResourceID}
+
+			if resourceAccessRule.TenantID != nil {
+				rule.TenantID = *resourceAccessRule.TenantID
+			}
+
+			report.ResourceAccessRules = append(report.ResourceAccessRules, rule)
+		}
+	}
+
+	for _, connection := range properties.PrivateEndpointConnections {
+		if connection == nil {
+			continue
+		}
+
+		privateEndpoint := PrivateEndpointReport{}
+
+		if connection.Name != nil {
+			privateEndpoint.Name = *connection.Name
+		}
+
+		if connection.Properties != nil {
+			if connection.Properties.PrivateEndpoint != nil && connection.Properties.PrivateEndpoint.ID != nil {
+				privateEndpoint.PrivateEndpointID = *connection.Properties.PrivateEndpoint.ID
+			}
+
+			if state := connection.Properties.PrivateLinkServiceConnectionState; state != nil && state.Status != nil {
+				privateEndpoint.Status = string(*state.Status)
+			}
+		}
+
+		report.PrivateEndpoints = append(report.PrivateEndpoints, privateEndpoint)
+	}
+
+	if report.PublicNetworkAccess == string(armstorage.PublicNetworkAccessSecuredByPerimeter) {
+		perimeters, err := getNetworkSecurityPerimeters()
+
+		if err != nil {
+			report.NetworkSecurityPerimeterError = err.Error()
+		}
+
+		report.NetworkSecurityPerimeters = perimeters
+	}
+
+	return report
+}
+
+// getNetworkSecurityPerimeters lists the perimeters the storage account is associated with, and the inbound access rules of the profile of each
+func getNetworkSecurityPerimeters() (perimeters []NetworkSecurityPerimeterReport, err error) {
+	if assessingSnapshots {
+		return nil, fmt.Errorf("the Network Security Perimeter associations of a snapshot, Terraform plan or ARM template cannot be read")
+	}
+
+	if failed := currentTarget.getInitErrors().forComponents(componentPerimeterConfigsClient); len(failed) > 0 {
+		return nil, failed
+	}
+
+	pager := perimeterConfigsClient.NewListPager(currentTarget.resourceId.resourceGroupName, currentTarget.resourceId.storageAccountName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list Network Security Perimeter configurations: %v", err)
+		}
+
+		for _, configuration := range page.Value {
+			if configuration == nil || configuration.Properties == nil {
+				continue
+			}
+
+			perimeters = append(perimeters, newNetworkSecurityPerimeterReport(configuration.Properties))
+		}
+	}
+
+	return perimeters, nil
+}
+
+func newNetworkSecurityPerimeterReport(properties *armstorage.NetworkSecurityPerimeterConfigurationProperties) (perimeter NetworkSecurityPerimeterReport) {
+	if properties.NetworkSecurityPerimeter != nil && properties.NetworkSecurityPerimeter.ID != nil {
+		perimeter.PerimeterID = *properties.NetworkSecurityPerimeter.ID
+	}
+
+	if properties.ResourceAssociation != nil && properties.ResourceAssociation.AccessMode != nil {
+		perimeter.AccessMode = string(*properties.ResourceAssociation.AccessMode)
+	}
+
+	if properties.ProvisioningState != nil {
+		perimeter.ProvisioningState = string(*properties.ProvisioningState)
+	}
+
+	if properties.Profile == nil {
+		return perimeter
+	}
+
+	if properties.Profile.Name != nil {
+		perimeter.Profile = *properties.Profile.Name
+	}
+
+	for _, accessRule := range properties.Profile.AccessRules {
+		if accessRule == nil || accessRule.Properties == nil || accessRule.Properties.Direction == nil || *accessRule.Properties.Direction != armstorage.NspAccessRuleDirectionInbound {
+			continue
+		}
+
+		for _, addressPrefix := range accessRule.Properties.AddressPrefixes {
+			if addressPrefix != nil {
+				perimeter.InboundAddressPrefixes = append(perimeter.InboundAddressPrefixes, *addressPrefix)
+			}
+		}
+
+		for _, subscription := range accessRule.Properties.Subscriptions {
+			if subscription != nil && subscription.ID != nil {
+				perimeter.InboundSubscriptions = append(perimeter.InboundSubscriptions, *subscription.ID)
+			}
+		}
+	}
+
+	return perimeter
+}
+
+// assessNetworkExposure passes when the data plane of the storage account can only be reached from allowlisted networks, setting the network exposure report as the result value
+func assessNetworkExposure(result *pluginkit.TestResult) {
+	report := getNetworkExposureReport()
+	result.Value = report
+
+	switch report.PublicNetworkAccess {
+	case string(armstorage.PublicNetworkAccessDisabled):
+		approved, _ := report.approvedPrivateEndpoints()
+		result.Passed = true
+
+		if approved == 0 {
+			result.Message = "Public network access is disabled for the storage account, and it has no approved private endpoints to be reached through."
+		} else {
+			result.Message = fmt.Sprintf("Public network access is disabled for the storage account, it can only be reached through its %d approved private endpoints.", approved)
+		}
+	case string(armstorage.PublicNetworkAccessEnabled):
+		assessNetworkRuleSet(result, report, "Public network access is enabled for the storage account")
+	case string(armstorage.PublicNetworkAccessSecuredByPerimeter):
+		if report.NetworkSecurityPerimeterError != "" {
+			SetResultFailure(result, fmt.Sprintf("Public network access to the storage account is secured by Network Security Perimeter, but its perimeter associations could not be read: %s", report.NetworkSecurityPerimeterError))
+			return
+		}
+
+		if len(report.NetworkSecurityPerimeters) == 0 {
+			SetResultFailure(result, "Public network access to the storage account is secured by Network Security Perimeter, but it is not associated with any perimeter.")
+			return
+		}
+
+		// A perimeter in learning or audit mode lets requests through which the storage account's own network rules allow
+		for _, perimeter := range report.NetworkSecurityPerimeters {
+			if !perimeter.enforced() {
+				assessNetworkRuleSet(result, report, fmt.Sprintf("Public network access to the storage account is secured by Network Security Perimeter %s in %s mode", perimeter.PerimeterID, perimeter.AccessMode))
+				return
+			}
+		}
+
+		result.Passed = true
+		result.Message = fmt.Sprintf("Public network access to the storage account is secured by %d enforced Network Security Perimeter associations, which only allow their inbound access rules (see result value).", len(report.NetworkSecurityPerimeters))
+	default:
+		SetResultFailure(result, fmt.Sprintf("Public network access status of %s unclear.", report.PublicNetworkAccess))
+	}
+}
+
+// assessNetworkRuleSet passes when the storage account's network rules deny sources outside of the allowlist, and the allowlist only holds approved, narrow IP rules
+func assessNetworkRuleSet(result *pluginkit.TestResult, report NetworkExposureReport, publicAccess string) {
+	if report.DefaultAction != string(armstorage.DefaultActionDeny) {
+		SetResultFailure(result, publicAccess+" and the default action is not set to deny for sources outside of the allowlist.")
+		return
+	}
+
+	if violations := report.allowlistViolations(); len(violations) > 0 {
+		SetResultFailure(result, fmt.Sprintf("%s and the default action is set to deny for sources outside of the allowlist, but %s (see result value).", publicAccess, strings.Join(violations, "; ")))
+		return
+	}
+
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s, but the default action is set to deny for sources outside of the allowlist of %s (see result value).", publicAccess, report.describeAllowlist())
+}
@@ -0,0 +1,149 @@
+package abs
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+const (
+	// runnerAccessAllowed is set when the plugin runs from inside the allowlist, so its requests are expected to reach the storage account
+	runnerAccessAllowed = "allowed"
+
+	// runnerAccessDenied is set when the plugin runs from outside the allowlist, so its requests are expected to be blocked by the network rules
+	runnerAccessDenied = "denied"
+
+	// networkRulesErrorCode is returned by the blob endpoint when the network rules block a request, before it is authenticated
+	networkRulesErrorCode = "AuthorizationFailure"
+)
+
+// runnerNetworkAccess is whether the runner is expected to be allowed or denied by the network rules, the reachability probe is not run when it is empty
+var runnerNetworkAccess string
+
+// NetworkProbeOutcome is how the blob endpoint responded to a request from the runner
+type NetworkProbeOutcome string
+
+const (
+	NetworkProbeBlocked     NetworkProbeOutcome = "BlockedByNetworkRules"
+	NetworkProbeUnreachable NetworkProbeOutcome = "Unreachable"
+	NetworkProbeRejected    NetworkProbeOutcome = "ReachedButNotAuthorized"
+	NetworkProbeReached     NetworkProbeOutcome = "Reached"
+	NetworkProbeUnexpected  NetworkProbeOutcome = "Unexpected"
+)
+
+// NetworkProbeReport is the response of the blob endpoint to an unauthenticated and an authenticated request to list its containers from the runner
+type NetworkProbeReport struct {
+	ExpectedAccess  string
+	Endpoint        string
+	Unauthenticated NetworkProbeResult
+	Authenticated   NetworkProbeResult
+}
+
+// NetworkProbeResult is the response to a single request of the reachability probe
+type NetworkProbeResult struct {
+	Outcome    NetworkProbeOutcome
+	StatusCode int
+	ErrorCode  string
+	Error      string
+}
+
+// blocked is whether the request did not reach the storage account, either because the network rules rejected it or because the endpoint could not be connected to
+func (probe NetworkProbeResult) blocked() bool {
+	return probe.Outcome == NetworkProbeBlocked || probe.Outcome == NetworkProbeUnreachable
+}
+
+// reached is whether the request got past the network rules, whether or not it was then authorized
+func (probe NetworkProbeResult) reached() bool {
+	return probe.Outcome == NetworkProbeReached || probe.Outcome == NetworkProbeRejected
+}
+
+func (probe NetworkProbeResult) describe() string {
+	switch probe.Outcome {
+	case NetworkProbeBlocked:
+		return fmt.Sprintf("blocked by the network rules (%d %s)", probe.StatusCode, probe.ErrorCode)
+	case NetworkProbeUnreachable:
+		return fmt.Sprintf("unable to connect (%s)", probe.Error)
+	case NetworkProbeRejected:
+		return fmt.Sprintf("not authorized after passing the network rules (%d %s)", probe.StatusCode, probe.ErrorCode)
+	case NetworkProbeReached:
+		return fmt.Sprintf("answered (%d)", probe.StatusCode)
+	default:
+		return fmt.Sprintf("answered unexpectedly (%d %s)", probe.StatusCode, probe.ErrorCode)
+	}
+}
+
+// loadNetworkProbe reads whether the runner is expected to be allowed or denied by the network rules from the config
+func loadNetworkProbe() error {
+	runnerNetworkAccess = strings.ToLower(strings.TrimSpace(Armory.Config.GetString("runnernetworkaccess")))
+
+	if runnerNetworkAccess != "" && runnerNetworkAccess != runnerAccessAllowed && runnerNetworkAccess != runnerAccessDenied {
+		return fmt.Errorf("runnerNetworkAccess must be %s or %s, not %s", runnerAccessAllowed, runnerAccessDenied, runnerNetworkAccess)
+	}
+
+	return nil
+}
+
+// probeNetworkReachability lists the containers of the storage account without and with a token, passing when the responses match whether the runner is expected to be allowed or denied by the network rules
+func probeNetworkReachability(result *pluginkit.TestResult) {
+	report := NetworkProbeReport{ExpectedAccess: runnerNetworkAccess, Endpoint: currentTarget.storageAccountUri}
+	report.Unauthenticated = sendNetworkProbe("")
+
+	token := ArmoryAzureUtils.GetToken(result)
+	if token == "" {
+		return
+	}
+
+	report.Authenticated = sendNetworkProbe(token)
+	result.Value = report
+
+	responses := fmt.Sprintf("the unauthenticated request was %s and the authenticated request was %s", report.Unauthenticated.describe(), report.Authenticated.describe())
+
+	switch runnerNetworkAccess {
+	case runnerAccessDenied:
+		if !report.Unauthenticated.blocked() || !report.Authenticated.blocked() {
+			SetResultFailure(result, "The runner is expected to be outside of the allowlist, but its requests to the blob endpoint were not all blocked: "+responses+".")
+			return
+		}
+
+		result.Passed = true
+		result.Message = "The runner is expected to be outside of the allowlist and its requests to the blob endpoint were blocked: " + responses + "."
+	case runnerAccessAllowed:
+		if !report.Unauthenticated.reached() || !report.Authenticated.reached() {
+			SetResultFailure(result, "The runner is expected to be inside of the allowlist, but its requests to the blob endpoint did not all pass the network rules: "+responses+".")
+			return
+		}
+
+		result.Passed = true
+		result.Message = "The runner is expected to be inside of the allowlist and its requests to the blob endpoint passed the network rules: " + responses + "."
+	}
+}
+
+// sendNetworkProbe makes a list request to the blob endpoint, a failure to connect is recorded in the probe result rather than failing the test
+func sendNetworkProbe(token string) (probe NetworkProbeResult) {
+	var requestResult pluginkit.TestResult
+	response := ArmoryCommonFunctions.MakeGETRequest(currentTarget.storageAccountUri, token, &requestResult, nil, nil)
+
+	if response == nil {
+		probe.Outcome = NetworkProbeUnreachable
+		probe.Error = requestResult.Message
+		return probe
+	}
+
+	probe.StatusCode = response.StatusCode
+	probe.ErrorCode = response.Header.Get("x-ms-error-code")
+
+	switch {
+	case response.StatusCode == http.StatusForbidden && probe.ErrorCode == networkRulesErrorCode:
+		probe.Outcome = NetworkProbeBlocked
+	case response.StatusCode == http.StatusUnauthorized || response.StatusCode == http.StatusForbidden:
+		probe.Outcome = NetworkProbeRejected
+	case response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices:
+		probe.Outcome = NetworkProbeReached
+	default:
+		probe.Outcome = NetworkProbeUnexpected
+	}
+
+	return probe
+}
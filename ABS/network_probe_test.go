@@ -0,0 +1,134 @@
+package abs
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/azure/finos-azure-blob-storage-raid/ABS/emulator"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func newStorageErrorResponse(statusCode int, errorCode string) *http.Response {
+	response := &http.Response{StatusCode: statusCode, Header: http.Header{}}
+
+	if errorCode != "" {
+		response.Header.Set("x-ms-error-code", errorCode)
+	}
+
+	return response
+}
+
+func Test_probeNetworkReachability(t *testing.T) {
+	tests := []struct {
+		name            string
+		expectedAccess  string
+		anonResponse    *http.Response
+		httpResponse    *http.Response
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			name:            "denied runner is blocked by the network rules",
+			expectedAccess:  runnerAccessDenied,
+			anonResponse:    newStorageErrorResponse(http.StatusForbidden, "AuthorizationFailure"),
+			httpResponse:    newStorageErrorResponse(http.StatusForbidden, "AuthorizationFailure"),
+			expectedPassed:  true,
+			expectedMessage: "The runner is expected to be outside of the allowlist and its requests to the blob endpoint were blocked: the unauthenticated request was blocked by the network rules (403 AuthorizationFailure) and the authenticated request was blocked by the network rules (403 AuthorizationFailure).",
+		},
+		{
+			name:            "denied runner cannot connect",
+			expectedAccess:  runnerAccessDenied,
+			expectedPassed:  true,
+			expectedMessage: "The runner is expected to be outside of the allowlist and its requests to the blob endpoint were blocked: the unauthenticated request was unable to connect (Mocked MakeGETRequest Error) and the authenticated request was unable to connect (Mocked MakeGETRequest Error).",
+		},
+		{
+			name:            "denied runner reaches the storage account",
+			expectedAccess:  runnerAccessDenied,
+			anonResponse:    newStorageErrorResponse(http.StatusUnauthorized, "NoAuthenticationInformation"),
+			httpResponse:    newStorageErrorResponse(http.StatusOK, ""),
+			expectedPassed:  false,
+			expectedMessage: "The runner is expected to be outside of the allowlist, but its requests to the blob endpoint were not all blocked: the unauthenticated request was not authorized after passing the network rules (401 NoAuthenticationInformation) and the authenticated request was answered (200).",
+		},
+		{
+			name:            "allowed runner passes the network rules without being granted access",
+			expectedAccess:  runnerAccessAllowed,
+			anonResponse:    newStorageErrorResponse(http.StatusUnauthorized, "NoAuthenticationInformation"),
+			httpResponse:    newStorageErrorResponse(http.StatusForbidden, "AuthorizationPermissionMismatch"),
+			expectedPassed:  true,
+			expectedMessage: "The runner is expected to be inside of the allowlist and its requests to the blob endpoint passed the network rules: the unauthenticated request was not authorized after passing the network rules (401 NoAuthenticationInformation) and the authenticated request was not authorized after passing the network rules (403 AuthorizationPermissionMismatch).",
+		},
+		{
+			name:            "allowed runner is blocked by the network rules",
+			expectedAccess:  runnerAccessAllowed,
+			anonResponse:    newStorageErrorResponse(http.StatusForbidden, "AuthorizationFailure"),
+			httpResponse:    newStorageErrorResponse(http.StatusForbidden, "AuthorizationFailure"),
+			expectedPassed:  false,
+			expectedMessage: "The runner is expected to be inside of the allowlist, but its requests to the blob endpoint did not all pass the network rules: the unauthenticated request was blocked by the network rules (403 AuthorizationFailure) and the authenticated request was blocked by the network rules (403 AuthorizationFailure).",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			runnerNetworkAccess = tt.expectedAccess
+			defer func() { runnerNetworkAccess = "" }()
+
+			ArmoryAzureUtils = &azureUtilsMock{tokenResult: "mocked token"}
+			ArmoryCommonFunctions = &commonFunctionsMock{httpResponse: tt.httpResponse, anonResponse: tt.anonResponse}
+
+			var result pluginkit.TestResult
+
+			// Act
+			probeNetworkReachability(&result)
+
+			// Assert
+			assert.Equal(t, tt.expectedPassed, result.Passed)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+			assert.Equal(t, tt.expectedAccess, result.Value.(NetworkProbeReport).ExpectedAccess)
+		})
+	}
+}
+
+func Test_loadNetworkProbe_rejects_an_unknown_expectation(t *testing.T) {
+	// Arrange
+	previousConfig := Armory.Config
+	Armory.Config = &config.Config{Vars: map[string]interface{}{"runnernetworkaccess": "sometimes"}}
+	defer func() { Armory.Config = previousConfig }()
+
+	// Act
+	err := loadNetworkProbe()
+
+	// Assert
+	assert.EqualError(t, err, "runnerNetworkAccess must be allowed or denied, not sometimes")
+}
+
+func Test_network_probe_against_the_emulator(t *testing.T) {
+	tests := []struct {
+		name           string
+		expectedAccess string
+		expectedPassed bool
+	}{
+		{name: "runner expected to be allowed", expectedAccess: "Allowed", expectedPassed: true},
+		{name: "runner expected to be denied", expectedAccess: "Denied", expectedPassed: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			server := emulator.NewServer(emulator.Compliant())
+			t.Cleanup(server.Close)
+			defer func() { runnerNetworkAccess = "" }()
+
+			// Act
+			results := runTestSuite(t, server, map[string]interface{}{"runnernetworkaccess": tt.expectedAccess})
+
+			// Assert
+			probe := results["CCC_C05_TR01"].Tests["CCC_C05_TR01_T02"]
+			assert.Equal(t, tt.expectedPassed, probe.Passed, probe.Message)
+			assert.Equal(t, tt.expectedPassed, results["CCC_C05_TR01"].Passed)
+			assert.Equal(t, tt.expectedPassed, results["CCC_C03_TR05"].Tests["CCC_C03_TR05_T02"].Passed)
+		})
+	}
+}
@@ -0,0 +1,356 @@
+package abs
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+type perimeterConfigsClientMock struct {
+	configurations []*armstorage.NetworkSecurityPerimeterConfiguration
+	listError      error
+}
+
+func (mock *perimeterConfigsClientMock) NewListPager(resourceGroupName string, accountName string, options *armstorage.NetworkSecurityPerimeterConfigurationsClientListOptions) *runtime.Pager[armstorage.NetworkSecurityPerimeterConfigurationsClientListResponse] {
+	if mock.listError != nil {
+		return CreatePager([]armstorage.NetworkSecurityPerimeterConfigurationsClientListResponse{}, mock.listError)
+	}
+
+	return CreatePager([]armstorage.NetworkSecurityPerimeterConfigurationsClientListResponse{
+		{
+			NetworkSecurityPerimeterConfigurationList: armstorage.NetworkSecurityPerimeterConfigurationList{
+				Value: mock.configurations,
+			},
+		},
+	}, nil)
+}
+
+func newPerimeterConfiguration(accessMode armstorage.ResourceAssociationAccessMode, addressPrefixes ...string) *armstorage.NetworkSecurityPerimeterConfiguration {
+	return &armstorage.NetworkSecurityPerimeterConfiguration{
+		Properties: &armstorage.NetworkSecurityPerimeterConfigurationProperties{
+			NetworkSecurityPerimeter: &armstorage.NetworkSecurityPerimeter{ID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityPerimeters/perimeter")},
+			ResourceAssociation:      &armstorage.NetworkSecurityPerimeterConfigurationPropertiesResourceAssociation{AccessMode: to.Ptr(accessMode)},
+			Profile: &armstorage.NetworkSecurityPerimeterConfigurationPropertiesProfile{
+				Name: to.Ptr("default"),
+				AccessRules: []*armstorage.NspAccessRule{
+					{Properties: &armstorage.NspAccessRuleProperties{Direction: to.Ptr(armstorage.NspAccessRuleDirectionInbound), AddressPrefixes: to.SliceOfPtrs(addressPrefixes...)}},
+					{Properties: &armstorage.NspAccessRuleProperties{Direction: to.Ptr(armstorage.NspAccessRuleDirectionOutbound), AddressPrefixes: to.SliceOfPtrs("0.0.0.0/0")}},
+				},
+			},
+		},
+	}
+}
+
+func Test_getNetworkExposureReport(t *testing.T) {
+	// Arrange
+	approvedCidrs = []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24")}
+	minCidrPrefixLength = defaultMinCidrPrefixLength
+	defer func() { approvedCidrs = nil }()
+
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		PublicNetworkAccess: to.Ptr(armstorage.PublicNetworkAccessEnabled),
+		NetworkRuleSet: &armstorage.NetworkRuleSet{
+			DefaultAction: to.Ptr(armstorage.DefaultActionDeny),
+			Bypass:        to.Ptr(armstorage.Bypass("Logging, AzureServices")),
+			IPRules:       []*armstorage.IPRule{{IPAddressOrRange: to.Ptr("203.0.113.0/24")}},
+			VirtualNetworkRules: []*armstorage.VirtualNetworkRule{
+				{VirtualNetworkResourceID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/virtualNetworks/vnet/subnets/app"), State: to.Ptr(armstorage.StateSucceeded)},
+			},
+			ResourceAccessRules: []*armstorage.ResourceAccessRule{
+				{ResourceID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Synapse/workspaces/analytics"), TenantID: to.Ptr("tenant")},
+			},
+		},
+		PrivateEndpointConnections: []*armstorage.PrivateEndpointConnection{
+			{Name: to.Ptr("approved"), Properties: &armstorage.PrivateEndpointConnectionProperties{
+				PrivateEndpoint:                   &armstorage.PrivateEndpoint{ID: to.Ptr("/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/privateEndpoints/approved")},
+				PrivateLinkServiceConnectionState: &armstorage.PrivateLinkServiceConnectionState{Status: to.Ptr(armstorage.PrivateEndpointServiceConnectionStatusApproved)},
+			}},
+			{Name: to.Ptr("pending"), Properties: &armstorage.PrivateEndpointConnectionProperties{
+				PrivateLinkServiceConnectionState: &armstorage.PrivateLinkServiceConnectionState{Status: to.Ptr(armstorage.PrivateEndpointServiceConnectionStatusPending)},
+			}},
+		},
+	}}
+
+	var result pluginkit.TestResult
+
+	// Act
+	assessNetworkExposure(&result)
+
+	// Assert
+	report := result.Value.(NetworkExposureReport)
+	assert.True(t, result.Passed)
+	assert.Equal(t, "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist of 1 IP rules, 1 virtual network rules, 1 resource instance rules and 1 approved private endpoints, with 1 private endpoints pending approval, bypassed by Logging, AzureServices (see result value).", result.Message)
+	assert.Equal(t, []string{"Logging", "AzureServices"}, report.Bypass)
+	assert.Equal(t, []IPRuleReport{{AddressOrRange: "203.0.113.0/24", ApprovedBy: "203.0.113.0/24"}}, report.IPRules)
+	assert.Equal(t, "Succeeded", report.VirtualNetworkRules[0].State)
+	assert.Equal(t, "tenant", report.ResourceAccessRules[0].TenantID)
+	assert.Equal(t, []PrivateEndpointReport{
+		{Name: "approved", PrivateEndpointID: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/privateEndpoints/approved", Status: "Approved"},
+		{Name: "pending", Status: "Pending"},
+	}, report.PrivateEndpoints)
+	assert.Empty(t, report.NetworkSecurityPerimeters)
+}
+
+func Test_assessNetworkExposure_secured_by_perimeter(t *testing.T) {
+	tests := []struct {
+		name            string
+		defaultAction   armstorage.DefaultAction
+		client          *perimeterConfigsClientMock
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			name:            "enforced perimeter",
+			defaultAction:   armstorage.DefaultActionAllow,
+			client:          &perimeterConfigsClientMock{configurations: []*armstorage.NetworkSecurityPerimeterConfiguration{newPerimeterConfiguration(armstorage.ResourceAssociationAccessModeEnforced, "198.51.100.0/24")}},
+			expectedPassed:  true,
+			expectedMessage: "Public network access to the storage account is secured by 1 enforced Network Security Perimeter associations, which only allow their inbound access rules (see result value).",
+		},
+		{
+			name:            "learning perimeter with network rules which allow any source",
+			defaultAction:   armstorage.DefaultActionAllow,
+			client:          &perimeterConfigsClientMock{configurations: []*armstorage.NetworkSecurityPerimeterConfiguration{newPerimeterConfiguration(armstorage.ResourceAssociationAccessModeLearning)}},
+			expectedPassed:  false,
+			expectedMessage: "Public network access to the storage account is secured by Network Security Perimeter /subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityPerimeters/perimeter in Learning mode and the default action is not set to deny for sources outside of the allowlist.",
+		},
+		{
+			name:            "learning perimeter with network rules which deny unlisted sources",
+			defaultAction:   armstorage.DefaultActionDeny,
+			client:          &perimeterConfigsClientMock{configurations: []*armstorage.NetworkSecurityPerimeterConfiguration{newPerimeterConfiguration(armstorage.ResourceAssociationAccessModeLearning)}},
+			expectedPassed:  true,
+			expectedMessage: "Public network access to the storage account is secured by Network Security Perimeter /subscriptions/sub/resourceGroups/rg/providers/Microsoft.Network/networkSecurityPerimeters/perimeter in Learning mode, but the default action is set to deny for sources outside of the allowlist of 0 IP rules, 0 virtual network rules, 0 resource instance rules and 0 approved private endpoints (see result value).",
+		},
+		{
+			name:            "perimeter associations cannot be listed",
+			defaultAction:   armstorage.DefaultActionDeny,
+			client:          &perimeterConfigsClientMock{listError: errors.New("forbidden")},
+			expectedPassed:  false,
+			expectedMessage: "Public network access to the storage account is secured by Network Security Perimeter, but its perimeter associations could not be read: failed to list Network Security Perimeter configurations: forbidden",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			myMock := storageAccountMock{
+				publicNetworkAccess: armstorage.PublicNetworkAccessSecuredByPerimeter,
+				defaultAction:       tt.defaultAction,
+			}
+			currentTarget.storageAccountResource = myMock.SetStorageAccount()
+			perimeterConfigsClient = tt.client
+
+			var result pluginkit.TestResult
+
+			// Act
+			assessNetworkExposure(&result)
+
+			// Assert
+			assert.Equal(t, tt.expectedPassed, result.Passed)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+		})
+	}
+}
+
+func Test_newNetworkSecurityPerimeterReport_only_reports_inbound_rules(t *testing.T) {
+	// Act
+	perimeter := newNetworkSecurityPerimeterReport(newPerimeterConfiguration(armstorage.ResourceAssociationAccessModeEnforced, "198.51.100.0/24").Properties)
+
+	// Assert
+	assert.Equal(t, "default", perimeter.Profile)
+	assert.Equal(t, []string{"198.51.100.0/24"}, perimeter.InboundAddressPrefixes)
+	assert.True(t, perimeter.enforced())
+}
+
+func Test_assessNetworkExposure_validates_the_allowlist(t *testing.T) {
+	tests := []struct {
+		name            string
+		ipRules         []string
+		bypass          armstorage.Bypass
+		bypassForbidden bool
+		expectedPassed  bool
+		expectedMessage string
+	}{
+		{
+			name:            "IP rules within the approved CIDRs",
+			ipRules:         []string{"203.0.113.0/25", "198.51.100.7"},
+			bypass:          armstorage.BypassLogging,
+			expectedPassed:  true,
+			expectedMessage: "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist of 2 IP rules, 0 virtual network rules, 0 resource instance rules and 0 approved private endpoints, bypassed by Logging (see result value).",
+		},
+		{
+			name:            "IP rules outside of the approved CIDRs",
+			ipRules:         []string{"203.0.113.0/23", "192.0.2.1", "not an address"},
+			bypass:          armstorage.BypassNone,
+			expectedPassed:  false,
+			expectedMessage: "Public network access is enabled for the storage account and the default action is set to deny for sources outside of the allowlist, but IP rules 203.0.113.0/23, 192.0.2.1, not an address are outside of the approved CIDRs (see result value).",
+		},
+		{
+			name:            "overly broad IP rule",
+			ipRules:         []string{"20.0.0.0/8"},
+			bypass:          armstorage.BypassNone,
+			expectedPassed:  false,
+			expectedMessage: "Public network access is enabled for the storage account and the default action is set to deny for sources outside of the allowlist, but IP rules 20.0.0.0/8 are outside of the approved CIDRs; IP rules 20.0.0.0/8 are broader than /16 (see result value).",
+		},
+		{
+			name:            "Azure services bypass is forbidden",
+			bypass:          armstorage.BypassAzureServices,
+			bypassForbidden: true,
+			expectedPassed:  false,
+			expectedMessage: "Public network access is enabled for the storage account and the default action is set to deny for sources outside of the allowlist, but trusted Azure services bypass the network rules, which is not permitted (see result value).",
+		},
+		{
+			name:            "Azure services bypass is not forbidden",
+			bypass:          armstorage.BypassAzureServices,
+			expectedPassed:  true,
+			expectedMessage: "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist of 0 IP rules, 0 virtual network rules, 0 resource instance rules and 0 approved private endpoints, bypassed by AzureServices (see result value).",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			approvedCidrs = []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24"), netip.MustParsePrefix("198.51.100.0/24")}
+			minCidrPrefixLength = defaultMinCidrPrefixLength
+			azureServicesBypassForbidden = tt.bypassForbidden
+			defer func() { approvedCidrs, azureServicesBypassForbidden = nil, false }()
+
+			networkRuleSet := &armstorage.NetworkRuleSet{DefaultAction: to.Ptr(armstorage.DefaultActionDeny), Bypass: to.Ptr(tt.bypass)}
+
+			for _, ipRule := range tt.ipRules {
+				networkRuleSet.IPRules = append(networkRuleSet.IPRules, &armstorage.IPRule{IPAddressOrRange: to.Ptr(ipRule)})
+			}
+
+			currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+				PublicNetworkAccess: to.Ptr(armstorage.PublicNetworkAccessEnabled),
+				NetworkRuleSet:      networkRuleSet,
+			}}
+
+			var result pluginkit.TestResult
+
+			// Act
+			assessNetworkExposure(&result)
+
+			// Assert
+			assert.Equal(t, tt.expectedPassed, result.Passed)
+			assert.Equal(t, tt.expectedMessage, result.Message)
+		})
+	}
+}
+
+func Test_loadNetworkAllowlist(t *testing.T) {
+	// Arrange
+	previousConfig := Armory.Config
+	Armory.Config = &config.Config{Vars: map[string]interface{}{
+		"approvedcidrs":            []interface{}{"203.0.113.7/24", "198.51.100.1"},
+		"allowazureservicesbypass": true,
+	}}
+	defer func() {
+		Armory.Config = previousConfig
+		approvedCidrs, azureServicesBypassForbidden = nil, false
+	}()
+
+	// Act
+	err := loadNetworkAllowlist()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{netip.MustParsePrefix("203.0.113.0/24"), netip.MustParsePrefix("198.51.100.1/32")}, approvedCidrs)
+	assert.Equal(t, defaultMinCidrPrefixLength, minCidrPrefixLength)
+	assert.False(t, azureServicesBypassForbidden)
+}
+
+func Test_assessNetworkExposure_passes_when_the_allowlist_is_not_configured(t *testing.T) {
+	// Arrange
+	approvedCidrs, azureServicesBypassForbidden = nil, false
+	minCidrPrefixLength = defaultMinCidrPrefixLength
+
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		PublicNetworkAccess: to.Ptr(armstorage.PublicNetworkAccessEnabled),
+		NetworkRuleSet: &armstorage.NetworkRuleSet{
+			DefaultAction: to.Ptr(armstorage.DefaultActionDeny),
+			Bypass:        to.Ptr(armstorage.BypassAzureServices),
+			IPRules:       []*armstorage.IPRule{{IPAddressOrRange: to.Ptr("192.0.2.1")}},
+		},
+	}}
+
+	var result pluginkit.TestResult
+
+	// Act
+	assessNetworkExposure(&result)
+
+	// Assert
+	assert.True(t, result.Passed)
+	assert.Equal(t, "Public network access is enabled for the storage account, but the default action is set to deny for sources outside of the allowlist of 1 IP rules, 0 virtual network rules, 0 resource instance rules and 0 approved private endpoints, bypassed by AzureServices (see result value).", result.Message)
+}
+
+func Test_assessNetworkExposure_treats_unset_public_network_access_as_enabled(t *testing.T) {
+	// Arrange
+	approvedCidrs, azureServicesBypassForbidden = nil, false
+	minCidrPrefixLength = defaultMinCidrPrefixLength
+
+	currentTarget.storageAccountResource = armstorage.Account{Properties: &armstorage.AccountProperties{
+		NetworkRuleSet: &armstorage.NetworkRuleSet{DefaultAction: to.Ptr(armstorage.DefaultActionAllow)},
+	}}
+
+	var result pluginkit.TestResult
+
+	// Act
+	assessNetworkExposure(&result)
+
+	// Assert
+	assert.False(t, result.Passed)
+	assert.Equal(t, "Enabled", result.Value.(NetworkExposureReport).PublicNetworkAccess)
+	assert.Equal(t, "Public network access is enabled for the storage account and the default action is not set to deny for sources outside of the allowlist.", result.Message)
+}
+
+func Test_loadNetworkAllowlist_forbids_the_Azure_services_bypass_only_when_explicitly_disallowed(t *testing.T) {
+	tests := []struct {
+		name              string
+		vars              map[string]interface{}
+		expectedForbidden bool
+	}{
+		{name: "not configured", vars: map[string]interface{}{}},
+		{name: "bypass left empty", vars: map[string]interface{}{"approvedcidrs": []interface{}{}, "allowazureservicesbypass": nil}},
+		{name: "bypass explicitly not allowed", vars: map[string]interface{}{"allowazureservicesbypass": false}, expectedForbidden: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			previousConfig := Armory.Config
+			Armory.Config = &config.Config{Vars: tt.vars}
+			defer func() {
+				Armory.Config = previousConfig
+				approvedCidrs, azureServicesBypassForbidden = nil, false
+			}()
+
+			// Act
+			err := loadNetworkAllowlist()
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Empty(t, approvedCidrs)
+			assert.Equal(t, tt.expectedForbidden, azureServicesBypassForbidden)
+		})
+	}
+}
+
+func Test_loadNetworkAllowlist_rejects_an_invalid_cidr(t *testing.T) {
+	// Arrange
+	previousConfig := Armory.Config
+	Armory.Config = &config.Config{Vars: map[string]interface{}{"approvedcidrs": []interface{}{"203.0.113.0/33"}}}
+	defer func() { Armory.Config = previousConfig }()
+
+	// Act
+	err := loadNetworkAllowlist()
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to parse approved CIDR 203.0.113.0/33")
+}
@@ -0,0 +1,569 @@
+package abs
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/policyinsights/armpolicyinsights"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+)
+
+// effectivePolicy is a single policy definition that applies to the storage account, assigned either directly or as part of an initiative
+type effectivePolicy struct {
+	// assignmentName is the display name of the assignment, or its name when it has no display name
+	assignmentName string
+	assignmentId   string
+	definitionId   string
+	// definition is nil when the policy was recognised as a built-in policy by name, without fetching it
+	definition *armpolicy.DefinitionProperties
+	// parameters are the values of the definition's parameters, after resolving initiative parameters and defaults
+	parameters map[string]any
+}
+
+// policyRequirement describes a requirement that can be enforced by a built-in policy, or by a custom policy with an equivalent rule
+type policyRequirement struct {
+	// builtInDefinitionName is the name (GUID) of the built-in policy definition that enforces the requirement
+	builtInDefinitionName string
+	// matches checks whether a policy enforces the requirement, returning the value it enforces such as the allowed locations
+	matches func(policy effectivePolicy) (value any, ok bool)
+}
+
+// PolicyCompliance is the latest evaluation by Azure Policy of the storage account against a policy
+type PolicyCompliance struct {
+	AssignmentName     string
+	PolicyDefinitionID string
+	// ComplianceState is empty when the policy has not yet been evaluated against the storage account
+	ComplianceState     string
+	EvaluatedAt         *time.Time
+	NonCompliantReasons []string
+}
+
+// policyCondition is a single field condition from the if block of a policy rule
+type policyCondition struct {
+	field    string
+	operator string
+	value    any
+}
+
+var (
+	policyDefinitionIdRegex = regexp.MustCompile(`(?i)^(?:/providers/Microsoft\.Management/managementGroups/([^/]+)|/subscriptions/([^/]+))?/providers/Microsoft\.Authorization/(policyDefinitions|policySetDefinitions)/([^/]+)$`)
+	policyParameterRegex    = regexp.MustCompile(`(?i)^\[parameters\('([^']+)'\)\]$`)
+	policyOperators         = []string{"equals", "notequals", "in", "notin", "like", "notlike", "contains", "notcontains", "exists", "greater", "greaterorequals", "less", "lessorequals"}
+	// negatedPolicyOperators maps each operator to its opposite, for conditions under a not
+	negatedPolicyOperators = map[string]string{
+		"equals":          "notequals",
+		"notequals":       "equals",
+		"in":              "notin",
+		"notin":           "in",
+		"like":            "notlike",
+		"notlike":         "like",
+		"contains":        "notcontains",
+		"notcontains":     "contains",
+		"greater":         "lessorequals",
+		"lessorequals":    "greater",
+		"less":            "greaterorequals",
+		"greaterorequals": "less",
+	}
+
+	// Definitions are cached as initiatives often share policies, and each TestSet evaluates the same assignments
+	policyDefinitionCache    = make(map[string]*armpolicy.DefinitionProperties)
+	policySetDefinitionCache = make(map[string]*armpolicy.SetDefinitionProperties)
+)
+
+// findEnforcingPolicy searches the policies assigned to the storage account, including those in initiatives, for one that enforces the requirement
+func findEnforcingPolicy(requirement policyRequirement) (policy effectivePolicy, value any, found bool, err error) {
+	pager := policyClient.NewListForResourcePager(currentTarget.resourceId.resourceGroupName, "Microsoft.Storage", "", "storageAccounts", currentTarget.resourceId.storageAccountName, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return policy, nil, false, fmt.Errorf("Could not get next page of policies: %v", err)
+		}
+
+		for _, assignment := range page.Value {
+			if assignment.Properties == nil || assignment.Properties.PolicyDefinitionID == nil {
+				continue
+			}
+
+			// Policies which are not enforced do not prevent anything
+			if assignment.Properties.EnforcementMode != nil && *assignment.Properties.EnforcementMode == armpolicy.EnforcementModeDoNotEnforce {
+				continue
+			}
+
+			policies, err := expandAssignment(assignment)
+
+			if err != nil {
+				return policy, nil, false, err
+			}
+
+			for _, policy := range policies {
+				if !isBuiltInPolicy(policy.definitionId, requirement.builtInDefinitionName) && policy.definition == nil {
+					policy.definition, err = getPolicyDefinition(policy.definitionId)
+
+					if err != nil {
+						return policy, nil, false, err
+					}
+
+					if policy.definition == nil {
+						continue
+					}
+
+					policy.parameters = withParameterDefaults(policy.parameters, policy.definition.Parameters)
+				}
+
+				if value, ok := requirement.matches(policy); ok {
+					return policy, value, true, nil
+				}
+			}
+		}
+	}
+
+	return policy, nil, false, nil
+}
+
+// expandAssignment returns the policies of an assignment, an initiative assignment is expanded into each of the policies it references
+func expandAssignment(assignment *armpolicy.Assignment) (policies []effectivePolicy, err error) {
+	assignmentName, assignmentId := "", ""
+
+	if assignment.ID != nil {
+		assignmentId = *assignment.ID
+	}
+
+	if assignment.Properties.DisplayName != nil && *assignment.Properties.DisplayName != "" {
+		assignmentName = *assignment.Properties.DisplayName
+	} else if assignment.Name != nil {
+		assignmentName = *assignment.Name
+	}
+
+	assignmentParameters := make(map[string]any)
+
+	for name, parameter := range assignment.Properties.Parameters {
+		if parameter != nil {
+			assignmentParameters[name] = parameter.Value
+		}
+	}
+
+	match := policyDefinitionIdRegex.FindStringSubmatch(*assignment.Properties.PolicyDefinitionID)
+
+	if match == nil || !strings.EqualFold(match[3], "policySetDefinitions") {
+		return []effectivePolicy{{
+			assignmentName: assignmentName,
+			assignmentId:   assignmentId,
+			definitionId:   *assignment.Properties.PolicyDefinitionID,
+			parameters:     assignmentParameters,
+		}}, nil
+	}
+
+	setDefinition, err := getPolicySetDefinition(*assignment.Properties.PolicyDefinitionID)
+
+	if err != nil || setDefinition == nil {
+		return nil, err
+	}
+
+	setParameters := withParameterDefaults(assignmentParameters, setDefinition.Parameters)
+
+	for _, reference := range setDefinition.PolicyDefinitions {
+		if reference == nil || reference.PolicyDefinitionID == nil {
+			continue
+		}
+
+		parameters := make(map[string]any)
+
+		for name, parameter := range reference.Parameters {
+			if parameter != nil {
+				parameters[name] = resolvePolicyValue(parameter.Value, setParameters)
+			}
+		}
+
+		policies = append(policies, effectivePolicy{
+			assignmentName: assignmentName,
+			assignmentId:   assignmentId,
+			definitionId:   *reference.PolicyDefinitionID,
+			parameters:     parameters,
+		})
+	}
+
+	return policies, nil
+}
+
+// getPolicyCompliance queries Azure Policy Insights for the latest compliance state of the storage account against a policy, which shows that the policy is evaluated against the storage account rather than only assigned at some scope
+func getPolicyCompliance(policy effectivePolicy) (compliance PolicyCompliance, err error) {
+	compliance = PolicyCompliance{
+		AssignmentName:     policy.assignmentName,
+		PolicyDefinitionID: policy.definitionId,
+	}
+
+	filter := fmt.Sprintf("policyDefinitionId eq '%s'", policy.definitionId)
+
+	if policy.assignmentId != "" {
+		filter = fmt.Sprintf("policyAssignmentId eq '%s' and %s", policy.assignmentId, filter)
+	}
+
+	pager := policyStatesClient.NewListQueryResultsForResourcePager(armpolicyinsights.PolicyStatesResourceLatest, currentTarget.storageAccountResourceId, &armpolicyinsights.QueryOptions{
+		Filter: to.Ptr(filter),
+		Expand: to.Ptr("PolicyEvaluationDetails"),
+	}, nil)
+
+	for pager.More() {
+		page, err := pager.NextPage(testSetContext)
+
+		if err != nil {
+			return compliance, fmt.Errorf("Could not get policy compliance state: %v", err)
+		}
+
+		for _, state := range page.Value {
+			if state.ComplianceState == nil {
+				continue
+			}
+
+			// A non-compliant state takes precedence over any other state of the same policy
+			if compliance.ComplianceState == "" || strings.EqualFold(*state.ComplianceState, "NonCompliant") {
+				compliance.ComplianceState = *state.ComplianceState
+				compliance.EvaluatedAt = state.Timestamp
+			}
+
+			if strings.EqualFold(*state.ComplianceState, "NonCompliant") {
+				compliance.NonCompliantReasons = append(compliance.NonCompliantReasons, getNonCompliantReasons(state.PolicyEvaluationDetails)...)
+			}
+		}
+	}
+
+	return compliance, nil
+}
+
+// getNonCompliantReasons describes the expressions of a policy rule which matched the storage account when it was evaluated
+func getNonCompliantReasons(details *armpolicyinsights.PolicyEvaluationDetails) (reasons []string) {
+	if details == nil {
+		return nil
+	}
+
+	for _, expression := range details.EvaluatedExpressions {
+		if expression == nil || expression.Result == nil || !strings.EqualFold(*expression.Result, "True") {
+			continue
+		}
+
+		subject := ""
+
+		if expression.Path != nil {
+			subject = *expression.Path
+		} else if expression.Expression != nil {
+			subject = *expression.Expression
+		}
+
+		operator := ""
+
+		if expression.Operator != nil {
+			operator = *expression.Operator
+		}
+
+		reasons = append(reasons, fmt.Sprintf("%s %s %v (current value: %v)", subject, operator, expression.TargetValue, expression.ExpressionValue))
+	}
+
+	if details.IfNotExistsDetails != nil && details.IfNotExistsDetails.TotalResources != nil {
+		reasons = append(reasons, fmt.Sprintf("none of the %d related resources evaluated met the existence condition", *details.IfNotExistsDetails.TotalResources))
+	}
+
+	return reasons
+}
+
+// nonComplianceMessage describes why the compliance state does not show the policy is satisfied, it is empty when the storage account is compliant
+func (compliance PolicyCompliance) nonComplianceMessage() string {
+	switch {
+	case compliance.ComplianceState == "":
+		return fmt.Sprintf("Azure Policy assignment %s has not been evaluated against the Storage Account, so it cannot be confirmed that the policy applies to the resource.", compliance.AssignmentName)
+	case strings.EqualFold(compliance.ComplianceState, "Compliant"):
+		return ""
+	case strings.EqualFold(compliance.ComplianceState, "NonCompliant") && len(compliance.NonCompliantReasons) > 0:
+		return fmt.Sprintf("The Storage Account is non-compliant with Azure Policy assignment %s: %s.", compliance.AssignmentName, strings.Join(compliance.NonCompliantReasons, "; "))
+	default:
+		return fmt.Sprintf("The compliance state of the Storage Account for Azure Policy assignment %s is %s.", compliance.AssignmentName, compliance.ComplianceState)
+	}
+}
+
+// getPolicyDefinition fetches a built-in, subscription or management group policy definition, returning nil for IDs that are not policy definitions
+func getPolicyDefinition(definitionId string) (*armpolicy.DefinitionProperties, error) {
+	cacheKey := strings.ToLower(definitionId)
+
+	if definition, ok := policyDefinitionCache[cacheKey]; ok {
+		return definition, nil
+	}
+
+	match := policyDefinitionIdRegex.FindStringSubmatch(definitionId)
+
+	if match == nil || !strings.EqualFold(match[3], "policyDefinitions") {
+		return nil, nil
+	}
+
+	var definition armpolicy.Definition
+	var err error
+
+	switch {
+	case match[1] != "":
+		var response armpolicy.DefinitionsClientGetAtManagementGroupResponse
+		response, err = policyDefinitionsClient.GetAtManagementGroup(testSetContext, match[4], match[1], nil)
+		definition = response.Definition
+	case match[2] != "":
+		var response armpolicy.DefinitionsClientGetResponse
+		response, err = policyDefinitionsClient.Get(testSetContext, match[4], nil)
+		definition = response.Definition
+	default:
+		var response armpolicy.DefinitionsClientGetBuiltInResponse
+		response, err = policyDefinitionsClient.GetBuiltIn(testSetContext, match[4], nil)
+		definition = response.Definition
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not get policy definition %s: %v", definitionId, err)
+	}
+
+	policyDefinitionCache[cacheKey] = definition.Properties
+
+	return definition.Properties, nil
+}
+
+// getPolicySetDefinition fetches a built-in, subscription or management group initiative definition
+func getPolicySetDefinition(setDefinitionId string) (*armpolicy.SetDefinitionProperties, error) {
+	cacheKey := strings.ToLower(setDefinitionId)
+
+	if setDefinition, ok := policySetDefinitionCache[cacheKey]; ok {
+		return setDefinition, nil
+	}
+
+	match := policyDefinitionIdRegex.FindStringSubmatch(setDefinitionId)
+
+	if match == nil || !strings.EqualFold(match[3], "policySetDefinitions") {
+		return nil, nil
+	}
+
+	var setDefinition armpolicy.SetDefinition
+	var err error
+
+	switch {
+	case match[1] != "":
+		var response armpolicy.SetDefinitionsClientGetAtManagementGroupResponse
+		response, err = policySetDefinitionsClient.GetAtManagementGroup(testSetContext, match[4], match[1], nil)
+		setDefinition = response.SetDefinition
+	case match[2] != "":
+		var response armpolicy.SetDefinitionsClientGetResponse
+		response, err = policySetDefinitionsClient.Get(testSetContext, match[4], nil)
+		setDefinition = response.SetDefinition
+	default:
+		var response armpolicy.SetDefinitionsClientGetBuiltInResponse
+		response, err = policySetDefinitionsClient.GetBuiltIn(testSetContext, match[4], nil)
+		setDefinition = response.SetDefinition
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Could not get policy set definition %s: %v", setDefinitionId, err)
+	}
+
+	policySetDefinitionCache[cacheKey] = setDefinition.Properties
+
+	return setDefinition.Properties, nil
+}
+
+// isBuiltInPolicy checks whether a policy definition ID refers to the built-in policy definition with the given name
+func isBuiltInPolicy(definitionId string, builtInDefinitionName string) bool {
+	return builtInDefinitionName != "" && strings.HasSuffix(strings.ToLower(definitionId), "/providers/microsoft.authorization/policydefinitions/"+strings.ToLower(builtInDefinitionName))
+}
+
+// withParameterDefaults fills in the default value of any parameter that has not been given a value
+func withParameterDefaults(values map[string]any, definitions map[string]*armpolicy.ParameterDefinitionsValue) map[string]any {
+	resolved := make(map[string]any, len(definitions))
+
+	for name, definition := range definitions {
+		if definition != nil && definition.DefaultValue != nil {
+			resolved[name] = definition.DefaultValue
+		}
+	}
+
+	for name, value := range values {
+		resolved[name] = value
+	}
+
+	return resolved
+}
+
+// resolvePolicyValue replaces a [parameters('name')] expression with the value of the parameter, other values are returned unchanged
+func resolvePolicyValue(value any, parameters map[string]any) any {
+	expression, ok := value.(string)
+
+	if !ok {
+		return value
+	}
+
+	match := policyParameterRegex.FindStringSubmatch(expression)
+
+	if match == nil {
+		return value
+	}
+
+	// Parameter names are case-insensitive
+	for name, parameterValue := range parameters {
+		if strings.EqualFold(name, match[1]) {
+			return parameterValue
+		}
+	}
+
+	return nil
+}
+
+// getPolicyEffect returns the lower-cased effect of a policy, with any parameter resolved
+func getPolicyEffect(policy effectivePolicy) string {
+	rule, ok := policy.definition.PolicyRule.(map[string]any)
+
+	if !ok {
+		return ""
+	}
+
+	then, ok := rule["then"].(map[string]any)
+
+	if !ok {
+		return ""
+	}
+
+	effect, _ := resolvePolicyValue(then["effect"], policy.parameters).(string)
+
+	return strings.ToLower(effect)
+}
+
+// getPolicyConditions flattens the if block of a policy rule into its field conditions, conditions under a not have their operator negated
+func getPolicyConditions(policy effectivePolicy) (conditions []policyCondition) {
+	rule, ok := policy.definition.PolicyRule.(map[string]any)
+
+	if !ok {
+		return nil
+	}
+
+	var walk func(node any, negated bool)
+
+	walk = func(node any, negated bool) {
+		switch typedNode := node.(type) {
+		case []any:
+			for _, child := range typedNode {
+				walk(child, negated)
+			}
+		case map[string]any:
+			for key, child := range typedNode {
+				switch strings.ToLower(key) {
+				case "allof", "anyof":
+					walk(child, negated)
+				case "not":
+					walk(child, !negated)
+				}
+			}
+
+			field, ok := typedNode["field"].(string)
+
+			if !ok {
+				return
+			}
+
+			for key, value := range typedNode {
+				operator := strings.ToLower(key)
+
+				if !slices.Contains(policyOperators, operator) {
+					continue
+				}
+
+				if negated {
+					if operator == "exists" {
+						value = !isTruthy(value)
+					} else {
+						operator = negatedPolicyOperators[operator]
+					}
+				}
+
+				conditions = append(conditions, policyCondition{
+					field:    field,
+					operator: operator,
+					value:    resolvePolicyValue(value, policy.parameters),
+				})
+			}
+		}
+	}
+
+	walk(rule["if"], false)
+
+	return conditions
+}
+
+// appliesToStorageAccounts checks that the type conditions of a policy rule do not exclude storage accounts
+func appliesToStorageAccounts(conditions []policyCondition) bool {
+	const storageAccountType = "microsoft.storage/storageaccounts"
+
+	for _, condition := range conditions {
+		if !strings.EqualFold(condition.field, "type") {
+			continue
+		}
+
+		types := toStringSlice(condition.value)
+
+		for i := range types {
+			types[i] = strings.ToLower(types[i])
+		}
+
+		switch condition.operator {
+		case "equals", "in":
+			if !slices.Contains(types, storageAccountType) {
+				return false
+			}
+		case "notequals", "notin":
+			if slices.Contains(types, storageAccountType) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// toStringSlice converts a policy value, which is either a single string or a list, to a list of strings
+func toStringSlice(value any) (values []string) {
+	switch typedValue := value.(type) {
+	case string:
+		return []string{typedValue}
+	case []string:
+		return append(values, typedValue...)
+	case []any:
+		for _, v := range typedValue {
+			if s, ok := v.(string); ok {
+				values = append(values, s)
+			}
+		}
+	}
+
+	return values
+}
+
+// toInt converts a numeric policy value, which is decoded from JSON as a float64, to an int
+func toInt(value any) (int, bool) {
+	switch typedValue := value.(type) {
+	case float64:
+		return int(typedValue), true
+	case int:
+		return typedValue, true
+	case int32:
+		return int(typedValue), true
+	case int64:
+		return int(typedValue), true
+	}
+
+	return 0, false
+}
+
+func isTruthy(value any) bool {
+	switch typedValue := value.(type) {
+	case bool:
+		return typedValue
+	case string:
+		return strings.EqualFold(typedValue, "true")
+	}
+
+	return false
+}
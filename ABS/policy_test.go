@@ -0,0 +1,436 @@
+package abs
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/policyinsights/armpolicyinsights"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/resources/armpolicy"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPolicyDefinitionsClient struct {
+	// definitions are keyed by the name of the policy definition
+	definitions map[string]*armpolicy.DefinitionProperties
+	getErr      error
+}
+
+func (mock *mockPolicyDefinitionsClient) Get(ctx context.Context, policyDefinitionName string, options *armpolicy.DefinitionsClientGetOptions) (armpolicy.DefinitionsClientGetResponse, error) {
+	return armpolicy.DefinitionsClientGetResponse{Definition: armpolicy.Definition{Properties: mock.definitions[policyDefinitionName]}}, mock.getErr
+}
+
+func (mock *mockPolicyDefinitionsClient) GetBuiltIn(ctx context.Context, policyDefinitionName string, options *armpolicy.DefinitionsClientGetBuiltInOptions) (armpolicy.DefinitionsClientGetBuiltInResponse, error) {
+	return armpolicy.DefinitionsClientGetBuiltInResponse{Definition: armpolicy.Definition{Properties: mock.definitions[policyDefinitionName]}}, mock.getErr
+}
+
+func (mock *mockPolicyDefinitionsClient) GetAtManagementGroup(ctx context.Context, policyDefinitionName string, managementGroupName string, options *armpolicy.DefinitionsClientGetAtManagementGroupOptions) (armpolicy.DefinitionsClientGetAtManagementGroupResponse, error) {
+	return armpolicy.DefinitionsClientGetAtManagementGroupResponse{Definition: armpolicy.Definition{Properties: mock.definitions[policyDefinitionName]}}, mock.getErr
+}
+
+type mockPolicySetDefinitionsClient struct {
+	// setDefinitions are keyed by the name of the policy set definition
+	setDefinitions map[string]*armpolicy.SetDefinitionProperties
+	getErr         error
+}
+
+func (mock *mockPolicySetDefinitionsClient) Get(ctx context.Context, policySetDefinitionName string, options *armpolicy.SetDefinitionsClientGetOptions) (armpolicy.SetDefinitionsClientGetResponse, error) {
+	return armpolicy.SetDefinitionsClientGetResponse{SetDefinition: armpolicy.SetDefinition{Properties: mock.setDefinitions[policySetDefinitionName]}}, mock.getErr
+}
+
+func (mock *mockPolicySetDefinitionsClient) GetBuiltIn(ctx context.Context, policySetDefinitionName string, options *armpolicy.SetDefinitionsClientGetBuiltInOptions) (armpolicy.SetDefinitionsClientGetBuiltInResponse, error) {
+	return armpolicy.SetDefinitionsClientGetBuiltInResponse{SetDefinition: armpolicy.SetDefinition{Properties: mock.setDefinitions[policySetDefinitionName]}}, mock.getErr
+}
+
+func (mock *mockPolicySetDefinitionsClient) GetAtManagementGroup(ctx context.Context, policySetDefinitionName string, managementGroupName string, options *armpolicy.SetDefinitionsClientGetAtManagementGroupOptions) (armpolicy.SetDefinitionsClientGetAtManagementGroupResponse, error) {
+	return armpolicy.SetDefinitionsClientGetAtManagementGroupResponse{SetDefinition: armpolicy.SetDefinition{Properties: mock.setDefinitions[policySetDefinitionName]}}, mock.getErr
+}
+
+type mockPolicyStatesClient struct {
+	// complianceState of the single policy state returned, no policy states are returned when it is empty
+	complianceState   string
+	evaluationDetails *armpolicyinsights.PolicyEvaluationDetails
+	pagerError        error
+}
+
+func (mock *mockPolicyStatesClient) NewListQueryResultsForResourcePager(policyStatesResource armpolicyinsights.PolicyStatesResource, resourceID string, queryOptions *armpolicyinsights.QueryOptions, options *armpolicyinsights.PolicyStatesClientListQueryResultsForResourceOptions) *runtime.Pager[armpolicyinsights.PolicyStatesClientListQueryResultsForResourceResponse] {
+	var states []*armpolicyinsights.PolicyState
+
+	if mock.complianceState != "" {
+		states = append(states, &armpolicyinsights.PolicyState{
+			ComplianceState:         to.Ptr(mock.complianceState),
+			PolicyEvaluationDetails: mock.evaluationDetails,
+		})
+	}
+
+	response := armpolicyinsights.PolicyStatesClientListQueryResultsForResourceResponse{
+		PolicyStatesQueryResults: armpolicyinsights.PolicyStatesQueryResults{Value: states},
+	}
+
+	return CreatePager([]armpolicyinsights.PolicyStatesClientListQueryResultsForResourceResponse{response}, mock.pagerError)
+}
+
+// setPolicyDefinitions replaces the policy definition clients and clears the definitions cached by earlier tests
+func setPolicyDefinitions(definitionsClient *mockPolicyDefinitionsClient, setDefinitionsClient *mockPolicySetDefinitionsClient) {
+	policyDefinitionsClient = definitionsClient
+	policySetDefinitionsClient = setDefinitionsClient
+	policyDefinitionCache = make(map[string]*armpolicy.DefinitionProperties)
+	policySetDefinitionCache = make(map[string]*armpolicy.SetDefinitionProperties)
+}
+
+// newPolicyDefinition creates a custom policy definition with the given if block and effect
+func newPolicyDefinition(condition map[string]any, effect string) *armpolicy.DefinitionProperties {
+	return &armpolicy.DefinitionProperties{
+		PolicyType: to.Ptr(armpolicy.PolicyTypeCustom),
+		Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+			"effect": {DefaultValue: effect},
+		},
+		PolicyRule: map[string]any{
+			"if":   condition,
+			"then": map[string]any{"effect": "[parameters('effect')]"},
+		},
+	}
+}
+
+func Test_CCC_C06_TR01_T01_succeeds_with_custom_policy(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		allowedLocations:   []interface{}{"westus", "eastus"},
+		policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-locations",
+	}
+
+	setPolicyDefinitions(&mockPolicyDefinitionsClient{
+		definitions: map[string]*armpolicy.DefinitionProperties{
+			"custom-locations": {
+				Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+					"listOfAllowedLocations": {},
+				},
+				PolicyRule: map[string]any{
+					"if": map[string]any{
+						"allOf": []any{
+							map[string]any{"field": "type", "equals": "Microsoft.Storage/storageAccounts"},
+							map[string]any{"field": "location", "notIn": "[parameters('listOfAllowedLocations')]"},
+						},
+					},
+					"then": map[string]any{"effect": "Deny"},
+				},
+			},
+		},
+	}, &mockPolicySetDefinitionsClient{})
+
+	policyStatesClient = &mockPolicyStatesClient{complianceState: "Compliant"}
+	allowedRegions = []string{"westus", "eastus"}
+
+	// Act
+	result := CCC_C06_TR01_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+}
+
+func Test_CCC_C06_TR01_T01_succeeds_with_custom_policy_in_initiative(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		policyDefinitionID: "/providers/Microsoft.Management/managementGroups/my-group/providers/Microsoft.Authorization/policySetDefinitions/my-initiative",
+	}
+
+	setPolicyDefinitions(&mockPolicyDefinitionsClient{
+		definitions: map[string]*armpolicy.DefinitionProperties{
+			"custom-locations": newPolicyDefinition(map[string]any{
+				"not": map[string]any{"field": "location", "in": "[parameters('locations')]"},
+			}, "Deny"),
+		},
+	}, &mockPolicySetDefinitionsClient{
+		setDefinitions: map[string]*armpolicy.SetDefinitionProperties{
+			"my-initiative": {
+				Parameters: map[string]*armpolicy.ParameterDefinitionsValue{
+					"initiativeLocations": {DefaultValue: []any{"westus"}},
+				},
+				PolicyDefinitions: []*armpolicy.DefinitionReference{
+					{
+						PolicyDefinitionID: to.Ptr("/providers/Microsoft.Management/managementGroups/my-group/providers/Microsoft.Authorization/policyDefinitions/custom-locations"),
+						Parameters: map[string]*armpolicy.ParameterValuesValue{
+							"locations": {Value: "[parameters('initiativeLocations')]"},
+						},
+					},
+				},
+			},
+		},
+	})
+
+	policyStatesClient = &mockPolicyStatesClient{complianceState: "Compliant"}
+	allowedRegions = []string{"westus", "eastus"}
+
+	// Act
+	result := CCC_C06_TR01_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+}
+
+func Test_CCC_C06_TR01_T01_fails_when_custom_policy_allows_other_regions(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-locations",
+	}
+
+	setPolicyDefinitions(&mockPolicyDefinitionsClient{
+		definitions: map[string]*armpolicy.DefinitionProperties{
+			"custom-locations": newPolicyDefinition(map[string]any{
+				"field": "location", "notIn": []any{"westus", "northeurope"},
+			}, "Deny"),
+		},
+	}, &mockPolicySetDefinitionsClient{})
+
+	policyStatesClient = &mockPolicyStatesClient{complianceState: "Compliant"}
+	allowedRegions = []string{"westus", "eastus"}
+
+	// Act
+	result := CCC_C06_TR01_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Contains(t, result.Message, "the additional regions are: [northeurope]")
+}
+
+func Test_CCC_C06_TR01_T01_fails_when_custom_policy_is_not_equivalent(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition map[string]any
+		effect    string
+	}{
+		{
+			name:      "audit effect",
+			condition: map[string]any{"field": "location", "notIn": []any{"westus"}},
+			effect:    "Audit",
+		},
+		{
+			name:      "location in allowed locations",
+			condition: map[string]any{"field": "location", "in": []any{"westus"}},
+			effect:    "Deny",
+		},
+		{
+			name: "other resource type",
+			condition: map[string]any{
+				"allOf": []any{
+					map[string]any{"field": "type", "equals": "Microsoft.Compute/virtualMachines"},
+					map[string]any{"field": "location", "notIn": []any{"westus"}},
+				},
+			},
+			effect: "Deny",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			policyClient = &mockPolicyClient{
+				enforcementMode:    armpolicy.EnforcementModeDefault,
+				policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-locations",
+			}
+
+			setPolicyDefinitions(&mockPolicyDefinitionsClient{
+				definitions: map[string]*armpolicy.DefinitionProperties{
+					"custom-locations": newPolicyDefinition(tt.condition, tt.effect),
+				},
+			}, &mockPolicySetDefinitionsClient{})
+
+			allowedRegions = []string{"westus"}
+
+			// Act
+			result := CCC_C06_TR01_T01()
+
+			// Assert
+			assert.Equal(t, false, result.Passed)
+			assert.Equal(t, "Neither the built-in Azure Policy Allowed locations, nor an equivalent custom policy, is assigned to the resource.", result.Message)
+		})
+	}
+}
+
+func Test_CCC_C06_TR01_T01_fails_when_policy_definition_errors(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-locations",
+	}
+
+	setPolicyDefinitions(&mockPolicyDefinitionsClient{getErr: assert.AnError}, &mockPolicySetDefinitionsClient{})
+
+	// Act
+	result := CCC_C06_TR01_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Contains(t, result.Message, "Could not get policy definition")
+}
+
+func Test_CCC_C11_TR02_T01_succeeds_with_custom_policy(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-rotation",
+	}
+
+	setPolicyDefinitions(&mockPolicyDefinitionsClient{
+		definitions: map[string]*armpolicy.DefinitionProperties{
+			"custom-rotation": newPolicyDefinition(map[string]any{
+				"field": "Microsoft.KeyVault.Data/vaults/keys/rotationPolicy.lifetimeActions[*].trigger.timeAfterCreateInDays", "greater": float64(60),
+			}, "Audit"),
+		},
+	}, &mockPolicySetDefinitionsClient{})
+
+	// Act
+	result := CCC_C11_TR02_T01()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Equal(t, KeyRotationPolicy{Name: "MaximumDaysToRotateRequiredByPolicy", Days: 60}, result.Value)
+}
+
+func Test_CCC_C11_TR03_T01_succeeds_with_custom_policy(t *testing.T) {
+	tests := []struct {
+		name      string
+		condition map[string]any
+	}{
+		{
+			name:      "key source not equal to Key Vault",
+			condition: map[string]any{"field": "Microsoft.Storage/storageAccounts/encryption.keySource", "notEquals": "Microsoft.Keyvault"},
+		},
+		{
+			name:      "key source equal to Microsoft.Storage",
+			condition: map[string]any{"field": "Microsoft.Storage/storageAccounts/encryption.keySource", "equals": "Microsoft.Storage"},
+		},
+		{
+			name:      "not key source in Key Vault",
+			condition: map[string]any{"not": map[string]any{"field": "Microsoft.Storage/storageAccounts/encryption.keySource", "in": []any{"Microsoft.Keyvault"}}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			policyClient = &mockPolicyClient{
+				enforcementMode:    armpolicy.EnforcementModeDefault,
+				policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-cmk",
+			}
+
+			setPolicyDefinitions(&mockPolicyDefinitionsClient{
+				definitions: map[string]*armpolicy.DefinitionProperties{
+					"custom-cmk": newPolicyDefinition(tt.condition, "Deny"),
+				},
+			}, &mockPolicySetDefinitionsClient{})
+
+			policyStatesClient = &mockPolicyStatesClient{complianceState: "Compliant"}
+
+			// Act
+			result := CCC_C11_TR03_T01()
+
+			// Assert
+			assert.Equal(t, true, result.Passed)
+		})
+	}
+}
+
+func Test_CCC_C11_TR03_T01_fails_when_custom_policy_is_disabled(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		policyDefinitionID: "/subscriptions/00000000-0000-0000-0000-000000000000/providers/Microsoft.Authorization/policyDefinitions/custom-cmk",
+	}
+
+	setPolicyDefinitions(&mockPolicyDefinitionsClient{
+		definitions: map[string]*armpolicy.DefinitionProperties{
+			"custom-cmk": newPolicyDefinition(map[string]any{"field": "Microsoft.Storage/storageAccounts/encryption.keySource", "notEquals": "Microsoft.Keyvault"}, "Disabled"),
+		},
+	}, &mockPolicySetDefinitionsClient{})
+
+	// Act
+	result := CCC_C11_TR03_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+}
+
+func Test_CCC_C06_TR01_T01_fails_when_policy_compliance_is_not_confirmed(t *testing.T) {
+	tests := []struct {
+		name            string
+		policyStates    *mockPolicyStatesClient
+		expectedMessage string
+	}{
+		{
+			name:            "policy states error",
+			policyStates:    &mockPolicyStatesClient{pagerError: assert.AnError},
+			expectedMessage: "Could not get policy compliance state",
+		},
+		{
+			name:            "policy not evaluated",
+			policyStates:    &mockPolicyStatesClient{},
+			expectedMessage: "has not been evaluated against the Storage Account",
+		},
+		{
+			name: "storage account non-compliant",
+			policyStates: &mockPolicyStatesClient{
+				complianceState: "NonCompliant",
+				evaluationDetails: &armpolicyinsights.PolicyEvaluationDetails{
+					EvaluatedExpressions: []*armpolicyinsights.ExpressionEvaluationDetails{
+						{
+							Path:            to.Ptr("location"),
+							Operator:        to.Ptr("NotIn"),
+							TargetValue:     []any{"westus", "eastus"},
+							ExpressionValue: "northeurope",
+							Result:          to.Ptr("True"),
+						},
+					},
+				},
+			},
+			expectedMessage: "The Storage Account is non-compliant with Azure Policy assignment : location NotIn [westus eastus] (current value: northeurope).",
+		},
+		{
+			name:            "storage account exempt",
+			policyStates:    &mockPolicyStatesClient{complianceState: "Exempt"},
+			expectedMessage: "is Exempt",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			policyClient = &mockPolicyClient{
+				enforcementMode:    armpolicy.EnforcementModeDefault,
+				allowedLocations:   []interface{}{"westus", "eastus"},
+				policyDefinitionID: "/providers/Microsoft.Authorization/policyDefinitions/e56962a6-4747-49cd-b67b-bf8b01975c4c",
+			}
+
+			policyStatesClient = tt.policyStates
+			allowedRegions = []string{"westus", "eastus"}
+
+			// Act
+			result := CCC_C06_TR01_T01()
+
+			// Assert
+			assert.Equal(t, false, result.Passed)
+			assert.Contains(t, result.Message, tt.expectedMessage)
+		})
+	}
+}
+
+func Test_CCC_C11_TR03_T01_fails_when_storage_account_is_non_compliant(t *testing.T) {
+	// Arrange
+	policyClient = &mockPolicyClient{
+		enforcementMode:    armpolicy.EnforcementModeDefault,
+		policyDefinitionID: "/providers/Microsoft.Authorization/policyDefinitions/6fac406b-40ca-413b-bf8e-0bf964659c25",
+	}
+
+	policyStatesClient = &mockPolicyStatesClient{complianceState: "NonCompliant"}
+
+	// Act
+	result := CCC_C11_TR03_T01()
+
+	// Assert
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "NonCompliant", result.Value.(PolicyCompliance).ComplianceState)
+}
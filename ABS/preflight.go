@@ -0,0 +1,297 @@
+package abs
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+// permissionScope is the scope that a required permission is checked at
+type permissionScope int
+
+const (
+	// scopeStorageAccount is used for actions on the storage account being assessed
+	scopeStorageAccount permissionScope = iota
+	// scopeResourceGroup is used for actions which create new resources alongside the storage account
+	scopeResourceGroup
+)
+
+// requiredPermission is an Azure RBAC action, or data action, that a TestSet needs
+type requiredPermission struct {
+	action     string
+	dataAction bool
+	scope      permissionScope
+}
+
+func (permission requiredPermission) String() string {
+	if permission.dataAction {
+		return permission.action + " (data action)"
+	}
+
+	if permission.scope == scopeResourceGroup {
+		return permission.action + " (resource group)"
+	}
+
+	return permission.action
+}
+
+func rbacAction(name string) requiredPermission {
+	return requiredPermission{action: name}
+}
+
+func rbacDataAction(name string) requiredPermission {
+	return requiredPermission{action: name, dataAction: true}
+}
+
+func rbacResourceGroupAction(name string) requiredPermission {
+	return requiredPermission{action: name, scope: scopeResourceGroup}
+}
+
+var (
+	readStorageAccount        = rbacAction("Microsoft.Storage/storageAccounts/read")
+	readBlobServiceProperties = rbacAction("Microsoft.Storage/storageAccounts/blobServices/read")
+	readDiagnosticSettings    = rbacAction("Microsoft.Insights/diagnosticSettings/read")
+	readBlobLogs              = rbacAction("Microsoft.Insights/logs/StorageBlobLogs/read")
+	readActivityLogs          = rbacAction("Microsoft.Insights/eventtypes/values/read")
+	readPolicyAssignments     = rbacAction("Microsoft.Authorization/policyAssignments/read")
+	readPolicyDefinitions     = rbacAction("Microsoft.Authorization/policyDefinitions/read")
+	readPolicySetDefinitions  = rbacAction("Microsoft.Authorization/policySetDefinitions/read")
+	queryPolicyStates         = rbacAction("Microsoft.PolicyInsights/policyStates/queryResults/action")
+	readStorageSkus           = rbacAction("Microsoft.Storage/skus/read")
+	readEncryptionScopes      = rbacAction("Microsoft.Storage/storageAccounts/encryptionScopes/read")
+	readKeyVaults             = rbacAction("Microsoft.KeyVault/vaults/read")
+	readKeys                  = rbacDataAction("Microsoft.KeyVault/vaults/keys/read")
+	readKeyRotationPolicies   = rbacDataAction("Microsoft.KeyVault/vaults/keyrotationpolicies/read")
+	readRoleAssignments       = rbacAction("Microsoft.Authorization/roleAssignments/read")
+	readRoleDefinitions       = rbacAction("Microsoft.Authorization/roleDefinitions/read")
+	readContainers            = rbacAction("Microsoft.Storage/storageAccounts/blobServices/containers/read")
+	writeContainers           = rbacAction("Microsoft.Storage/storageAccounts/blobServices/containers/write")
+	deleteContainers          = rbacAction("Microsoft.Storage/storageAccounts/blobServices/containers/delete")
+	readBlobs                 = rbacDataAction("Microsoft.Storage/storageAccounts/blobServices/containers/blobs/read")
+	writeBlobs                = rbacDataAction("Microsoft.Storage/storageAccounts/blobServices/containers/blobs/write")
+	deleteBlobs               = rbacDataAction("Microsoft.Storage/storageAccounts/blobServices/containers/blobs/delete")
+	getContainerAcls          = rbacAction("Microsoft.Storage/storageAccounts/blobServices/containers/getAcl/action")
+	generateUserDelegationKey = rbacAction("Microsoft.Storage/storageAccounts/blobServices/generateUserDelegationKey/action")
+	readPerimeterConfigs      = rbacAction("Microsoft.Storage/storageAccounts/networkSecurityPerimeterConfigurations/read")
+
+	// testSetPermissions lists the Azure RBAC actions that each TestSet needs in order to run
+	testSetPermissions = map[string][]requiredPermission{
+		"CCC_C01_TR01": {readStorageAccount},
+		"CCC_C02_TR01": {readStorageAccount},
+		"CCC_C03_TR02": {readStorageAccount, readContainers},
+		"CCC_C03_TR05": {readStorageAccount, readPerimeterConfigs, readBlobs},
+		"CCC_C04_TR01": {readStorageAccount, readDiagnosticSettings, readBlobLogs},
+		"CCC_C04_TR02": {readStorageAccount, readDiagnosticSettings, readBlobLogs},
+		"CCC_C04_TR03": {
+			readStorageAccount,
+			readActivityLogs,
+			rbacAction("Microsoft.Storage/storageAccounts/regenerateKey/action"),
+			rbacAction("Microsoft.Authorization/roleAssignments/write"),
+			rbacAction("Microsoft.Authorization/roleAssignments/delete"),
+		},
+		"CCC_C05_TR01": {readStorageAccount, readPerimeterConfigs, readBlobs},
+		"CCC_C05_TR04": {readDiagnosticSettings},
+		"CCC_C06_TR01": {
+			readPolicyAssignments,
+			readPolicyDefinitions,
+			readPolicySetDefinitions,
+			queryPolicyStates,
+			readStorageSkus,
+			rbacResourceGroupAction("Microsoft.Storage/storageAccounts/write"),
+			rbacResourceGroupAction("Microsoft.Storage/storageAccounts/delete"),
+		},
+		"CCC_C06_TR02": {
+			rbacAction("Microsoft.Resources/subscriptions/read"),
+			readStorageSkus,
+			rbacResourceGroupAction("Microsoft.RecoveryServices/vaults/write"),
+			rbacResourceGroupAction("Microsoft.RecoveryServices/vaults/delete"),
+		},
+		"CCC_C07_TR01":         {rbacAction("Microsoft.Security/defenderForStorageSettings/read")},
+		"CCC_C07_TR02":         {rbacAction("Microsoft.Security/defenderForStorageSettings/read")},
+		"CCC_C08_TR01":         {readStorageAccount},
+		"CCC_C08_TR02":         {readStorageAccount},
+		"CCC_C09_TR01":         {readDiagnosticSettings},
+		"CCC_C09_TR02":         {readDiagnosticSettings},
+		"CCC_C09_TR03":         {readDiagnosticSettings},
+		"CCC_C11_TR02":         {readStorageAccount, readPolicyAssignments, readPolicyDefinitions, readPolicySetDefinitions, readKeys, readKeyRotationPolicies},
+		"CCC_C11_TR03":         {readPolicyAssignments, readPolicyDefinitions, readPolicySetDefinitions, queryPolicyStates},
+		"CCC_C11_TR04":         {readStorageAccount, readKeyVaults, readRoleAssignments, readRoleDefinitions},
+		"CCC_F05_TR01":         {readStorageAccount, readContainers, getContainerAcls, generateUserDelegationKey, writeContainers, deleteContainers, readBlobs},
+		"CCC_ObjStor_C01_TR01": {readStorageAccount, readEncryptionScopes, readContainers},
+		"CCC_ObjStor_C01_TR02": {readStorageAccount, readEncryptionScopes, readContainers},
+		"CCC_ObjStor_C01_TR03": {readStorageAccount, readEncryptionScopes, readContainers, writeContainers, deleteContainers, writeBlobs},
+		"CCC_ObjStor_C01_TR04": {readStorageAccount, readEncryptionScopes, readContainers, writeContainers, deleteContainers, writeBlobs},
+		"CCC_ObjStor_C02_TR01": {readStorageAccount},
+		"CCC_ObjStor_C02_TR02": {readStorageAccount},
+		"CCC_ObjStor_C03_TR01": {readStorageAccount, readBlobServiceProperties, readContainers, writeContainers, deleteContainers, writeBlobs, deleteBlobs},
+		"CCC_ObjStor_C03_TR02": {readStorageAccount, readContainers},
+		"CCC_ObjStor_C04_TR01": {readStorageAccount, readContainers},
+		"CCC_ObjStor_C04_TR02": {readStorageAccount, readActivityLogs, readBlobLogs, writeContainers, deleteContainers, writeBlobs, deleteBlobs},
+		"CCC_ObjStor_C05_TR01": {readStorageAccount, writeContainers, deleteContainers, readBlobs, writeBlobs},
+		"CCC_ObjStor_C05_TR02": {readStorageAccount, writeContainers, deleteContainers, readBlobs, writeBlobs},
+		"CCC_ObjStor_C05_TR03": {readStorageAccount, writeContainers, deleteContainers, readBlobs, writeBlobs},
+		"CCC_ObjStor_C05_TR04": {readStorageAccount, readBlobServiceProperties, writeContainers, deleteContainers, readBlobs, writeBlobs, deleteBlobs},
+		"CCC_ObjStor_C06_TR01": {readDiagnosticSettings},
+	}
+)
+
+// Preflight reports which of the configured TestSets the current identity has the permissions to run, without running any of them
+func Preflight(output io.Writer) error {
+	// The TestSet names are collected before Initialize wraps the TestSets
+	var testSetNames []string
+
+	for _, testSuiteName := range Armory.Config.TestSuites {
+		for _, testSet := range Armory.TestSuites[testSuiteName] {
+			testSetName := getTestSetName(testSet)
+
+			if !slices.Contains(testSetNames, testSetName) {
+				testSetNames = append(testSetNames, testSetName)
+			}
+		}
+	}
+
+	err := Initialize()
+
+	if err != nil {
+		return err
+	}
+
+	err = requireAzure("preflight")
+
+	if err != nil {
+		return err
+	}
+
+	var result pluginkit.TestResult
+	principalId := ArmoryAzureUtils.GetCurrentPrincipalID(&result)
+
+	if principalId == "" {
+		return fmt.Errorf("failed to get current principal ID: %s", result.Message)
+	}
+
+	for _, target := range targets {
+		activateTarget(target)
+
+		fmt.Fprintf(output, "Principal: %s\nStorage account: %s\n", principalId, target.storageAccountResourceId)
+
+		resourcePermissions, resourceGroupPermissions, err := getEffectivePermissions()
+
+		if err != nil {
+			fmt.Fprintf(output, "Could not check permissions: %v\n\n", err)
+			continue
+		}
+
+		writePermissionMatrix(output, testSetNames, resourcePermissions, resourceGroupPermissions)
+		fmt.Fprintln(output)
+	}
+
+	return nil
+}
+
+// getEffectivePermissions lists the permissions the current identity has on the current storage account and its resource group
+func getEffectivePermissions() (resourcePermissions []*armauthorization.Permission, resourceGroupPermissions []*armauthorization.Permission, err error) {
+	if failed := currentTarget.getInitErrors().forComponents(componentPermissionsClient); len(failed) > 0 {
+		return nil, nil, failed
+	}
+
+	resourcePager := permissionsClient.NewListForResourcePager(currentTarget.resourceId.resourceGroupName, "Microsoft.Storage", "", "storageAccounts", currentTarget.resourceId.storageAccountName, nil)
+
+	for resourcePager.More() {
+		page, err := resourcePager.NextPage(pluginContext)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list permissions for storage account: %v", err)
+		}
+
+		resourcePermissions = append(resourcePermissions, page.Value...)
+	}
+
+	resourceGroupPager := permissionsClient.NewListForResourceGroupPager(currentTarget.resourceId.resourceGroupName, nil)
+
+	for resourceGroupPager.More() {
+		page, err := resourceGroupPager.NextPage(pluginContext)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to list permissions for resource group: %v", err)
+		}
+
+		resourceGroupPermissions = append(resourceGroupPermissions, page.Value...)
+	}
+
+	return resourcePermissions, resourceGroupPermissions, nil
+}
+
+// writePermissionMatrix writes whether each TestSet is runnable, blocked by missing permissions, or errored during initialization
+func writePermissionMatrix(output io.Writer, testSetNames []string, resourcePermissions []*armauthorization.Permission, resourceGroupPermissions []*armauthorization.Permission) {
+	writer := tabwriter.NewWriter(output, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(writer, "TESTSET\tSTATUS\tDETAILS")
+
+	for _, testSetName := range testSetNames {
+		if failed := currentTarget.getInitErrors().forComponents(testSetDependencies[testSetName]...); len(failed) > 0 {
+			fmt.Fprintf(writer, "%s\terrored\t%s\n", testSetName, failed.Error())
+			continue
+		}
+
+		var missing []string
+
+		for _, permission := range testSetPermissions[testSetName] {
+			permissions := resourcePermissions
+
+			if permission.scope == scopeResourceGroup {
+				permissions = resourceGroupPermissions
+			}
+
+			if !isPermitted(permissions, permission) {
+				missing = append(missing, permission.String())
+			}
+		}
+
+		if len(missing) > 0 {
+			fmt.Fprintf(writer, "%s\tblocked\tmissing %s\n", testSetName, strings.Join(missing, ", "))
+		} else {
+			fmt.Fprintf(writer, "%s\trunnable\t\n", testSetName)
+		}
+	}
+
+	writer.Flush()
+}
+
+// isPermitted checks a required permission against effective permissions, it is permitted when any one permission allows the action without also excluding it
+func isPermitted(permissions []*armauthorization.Permission, required requiredPermission) bool {
+	for _, permission := range permissions {
+		allowed, denied := permission.Actions, permission.NotActions
+
+		if required.dataAction {
+			allowed, denied = permission.DataActions, permission.NotDataActions
+		}
+
+		if matchesAnyAction(allowed, required.action) && !matchesAnyAction(denied, required.action) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesAnyAction compares an action against RBAC action patterns, which are case-insensitive and may contain * wildcards
+func matchesAnyAction(patterns []*string, action string) bool {
+	for _, pattern := range patterns {
+		if pattern == nil {
+			continue
+		}
+
+		expression := "(?i)^" + strings.ReplaceAll(regexp.QuoteMeta(*pattern), `\*`, ".*") + "$"
+
+		if regexp.MustCompile(expression).MatchString(action) {
+			return true
+		}
+	}
+
+	return false
+}
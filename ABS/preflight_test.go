@@ -0,0 +1,155 @@
+package abs
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/runtime"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/authorization/armauthorization/v2"
+	"github.com/stretchr/testify/assert"
+)
+
+type mockPermissionsClient struct {
+	resourcePermissions      []*armauthorization.Permission
+	resourceGroupPermissions []*armauthorization.Permission
+	pagerError               error
+}
+
+func (mock *mockPermissionsClient) NewListForResourcePager(resourceGroupName string, resourceProviderNamespace string, parentResourcePath string, resourceType string, resourceName string, options *armauthorization.PermissionsClientListForResourceOptions) *runtime.Pager[armauthorization.PermissionsClientListForResourceResponse] {
+	permissionsPages := []armauthorization.PermissionsClientListForResourceResponse{
+		{
+			PermissionGetResult: armauthorization.PermissionGetResult{
+				Value: mock.resourcePermissions,
+			},
+		},
+	}
+
+	return CreatePager(permissionsPages, mock.pagerError)
+}
+
+func (mock *mockPermissionsClient) NewListForResourceGroupPager(resourceGroupName string, options *armauthorization.PermissionsClientListForResourceGroupOptions) *runtime.Pager[armauthorization.PermissionsClientListForResourceGroupResponse] {
+	permissionsPages := []armauthorization.PermissionsClientListForResourceGroupResponse{
+		{
+			PermissionGetResult: armauthorization.PermissionGetResult{
+				Value: mock.resourceGroupPermissions,
+			},
+		},
+	}
+
+	return CreatePager(permissionsPages, mock.pagerError)
+}
+
+func Test_isPermitted(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions []*armauthorization.Permission
+		required    requiredPermission
+		expected    bool
+	}{
+		{
+			name:        "Exact action is permitted",
+			permissions: []*armauthorization.Permission{{Actions: []*string{to.Ptr("Microsoft.Storage/storageAccounts/read")}}},
+			required:    readStorageAccount,
+			expected:    true,
+		},
+		{
+			name:        "Wildcard action is permitted, ignoring case",
+			permissions: []*armauthorization.Permission{{Actions: []*string{to.Ptr("microsoft.storage/*")}}},
+			required:    readStorageAccount,
+			expected:    true,
+		},
+		{
+			name:        "Read wildcard does not permit writes",
+			permissions: []*armauthorization.Permission{{Actions: []*string{to.Ptr("*/read")}}},
+			required:    writeContainers,
+			expected:    false,
+		},
+		{
+			name: "Not action excludes a wildcard",
+			permissions: []*armauthorization.Permission{{
+				Actions:    []*string{to.Ptr("*")},
+				NotActions: []*string{to.Ptr("Microsoft.Authorization/*/Write")},
+			}},
+			required: rbacAction("Microsoft.Authorization/roleAssignments/write"),
+			expected: false,
+		},
+		{
+			name: "Another permission can still allow an excluded action",
+			permissions: []*armauthorization.Permission{
+				{Actions: []*string{to.Ptr("*")}, NotActions: []*string{to.Ptr("Microsoft.Authorization/*/Write")}},
+				{Actions: []*string{to.Ptr("Microsoft.Authorization/roleAssignments/*")}},
+			},
+			required: rbacAction("Microsoft.Authorization/roleAssignments/write"),
+			expected: true,
+		},
+		{
+			name:        "Data actions are not permitted by control plane actions",
+			permissions: []*armauthorization.Permission{{Actions: []*string{to.Ptr("*")}}},
+			required:    writeBlobs,
+			expected:    false,
+		},
+		{
+			name:        "Data action is permitted",
+			permissions: []*armauthorization.Permission{{DataActions: []*string{to.Ptr("Microsoft.Storage/storageAccounts/blobServices/containers/blobs/*")}}},
+			required:    writeBlobs,
+			expected:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, isPermitted(tt.permissions, tt.required))
+		})
+	}
+}
+
+func Test_getEffectivePermissions_succeeds(t *testing.T) {
+	// Arrange
+	currentTarget = &storageAccountTarget{}
+	permissionsClient = &mockPermissionsClient{
+		resourcePermissions:      []*armauthorization.Permission{{Actions: []*string{to.Ptr("*/read")}}},
+		resourceGroupPermissions: []*armauthorization.Permission{{Actions: []*string{to.Ptr("*")}}},
+	}
+
+	// Act
+	resourcePermissions, resourceGroupPermissions, err := getEffectivePermissions()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, resourcePermissions, 1)
+	assert.Len(t, resourceGroupPermissions, 1)
+}
+
+func Test_getEffectivePermissions_fails_when_pager_errors(t *testing.T) {
+	// Arrange
+	currentTarget = &storageAccountTarget{}
+	permissionsClient = &mockPermissionsClient{pagerError: assert.AnError}
+
+	// Act
+	_, _, err := getEffectivePermissions()
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to list permissions for storage account")
+}
+
+func Test_writePermissionMatrix(t *testing.T) {
+	// Arrange
+	currentTarget = &storageAccountTarget{}
+	initErrors = initializationErrors{{component: componentDefenderForStorageClient, err: assert.AnError}}
+	defer func() { initErrors = nil }()
+
+	resourcePermissions := []*armauthorization.Permission{{Actions: []*string{to.Ptr("*/read")}}}
+	resourceGroupPermissions := []*armauthorization.Permission{{Actions: []*string{to.Ptr("*/read")}}}
+
+	var output bytes.Buffer
+
+	// Act
+	writePermissionMatrix(&output, []string{"CCC_C02_TR01", "CCC_C04_TR03", "CCC_C06_TR02", "CCC_C07_TR01"}, resourcePermissions, resourceGroupPermissions)
+
+	// Assert
+	assert.Regexp(t, `CCC_C02_TR01\s+runnable`, output.String())
+	assert.Regexp(t, `CCC_C04_TR03\s+blocked\s+missing Microsoft.Storage/storageAccounts/regenerateKey/action`, output.String())
+	assert.Regexp(t, `CCC_C06_TR02\s+blocked\s+missing Microsoft.RecoveryServices/vaults/write \(resource group\)`, output.String())
+	assert.Regexp(t, `CCC_C07_TR01\s+errored\s+failed to initialize Defender for Storage client`, output.String())
+}
@@ -0,0 +1,445 @@
+package abs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/cloud"
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+const (
+	// storageApiVersion is the Microsoft.Storage API version used by the armstorage clients
+	storageApiVersion = "2023-05-01"
+
+	// defaultSoftDeleteRetentionDays is the retention period set when remediation enables soft delete
+	defaultSoftDeleteRetentionDays = 7
+)
+
+// remediation describes how to fix the configuration that a failed test found
+type remediation struct {
+	testName    string
+	description string
+	// testSet is re-run once the fix is applied, to confirm it
+	testSet pluginkit.TestSet
+	// change returns the change to make, from the current configuration of the storage account
+	change func(target *storageAccountTarget) remediationChange
+	// terraform returns the attributes of the azurerm_storage_account resource which make the same fix
+	terraform func(target *storageAccountTarget) []terraformAttribute
+	// azureCli returns the Azure CLI commands which make the same fix
+	azureCli func(target *storageAccountTarget) []string
+}
+
+// remediationChange is an update to the storage account or to its blob service properties, only one of which is set
+type remediationChange struct {
+	account      *armstorage.AccountUpdateParameters
+	blobServices *armstorage.BlobServiceProperties
+}
+
+// plannedRemediation is a change to a storage account, with the failed tests it fixes
+type plannedRemediation struct {
+	testNames    []string
+	descriptions []string
+	testSets     []pluginkit.TestSet
+	change       remediationChange
+}
+
+// remediations fix the failures of configuration tests
+var remediations = []remediation{
+	{
+		testName:    "CCC_C03_TR02_T01",
+		description: "Disable anonymous public access to blobs",
+		testSet:     CCC_C03_TR02,
+		change:      disableBlobPublicAccess,
+		terraform:   disableBlobPublicAccessTerraform,
+		azureCli:    disableBlobPublicAccessAzureCli,
+	},
+	{
+		testName:    "CCC_C03_TR02_T02",
+		description: "Disable Shared Key authorization",
+		testSet:     CCC_C03_TR02,
+		change:      disableSharedKeyAccess,
+		terraform:   disableSharedKeyAccessTerraform,
+		azureCli:    disableSharedKeyAccessAzureCli,
+	},
+	{
+		testName:    "CCC_ObjStor_C02_TR01_T01",
+		description: "Disable Shared Key authorization",
+		testSet:     CCC_ObjStor_C02_TR01,
+		change:      disableSharedKeyAccess,
+		terraform:   disableSharedKeyAccessTerraform,
+		azureCli:    disableSharedKeyAccessAzureCli,
+	},
+	{
+		testName:    "CCC_ObjStor_C02_TR02_T01",
+		description: "Disable Shared Key authorization",
+		testSet:     CCC_ObjStor_C02_TR02,
+		change:      disableSharedKeyAccess,
+		terraform:   disableSharedKeyAccessTerraform,
+		azureCli:    disableSharedKeyAccessAzureCli,
+	},
+	{
+		testName:    "CCC_C05_TR01_T01",
+		description: "Deny network access from sources outside the network rules, keeping the existing rules",
+		testSet:     CCC_C05_TR01,
+		change:      denyUnlistedNetworkAccess,
+		terraform:   denyUnlistedNetworkAccessTerraform,
+		azureCli:    denyUnlistedNetworkAccessAzureCli,
+	},
+	{
+		testName:    "CCC_ObjStor_C03_TR01_T01",
+		description: "Enable soft delete for containers, and prevent permanent delete of soft deleted blobs",
+		testSet:     CCC_ObjStor_C03_TR01,
+		change:      enableContainerSoftDelete,
+		terraform:   enableContainerSoftDeleteTerraform,
+		azureCli:    enableContainerSoftDeleteAzureCli,
+	},
+	{
+		testName:    "CCC_ObjStor_C03_TR01_T03",
+		description: "Enable soft delete for blobs, and prevent permanent delete of soft deleted blobs",
+		testSet:     CCC_ObjStor_C03_TR01,
+		change:      enableBlobSoftDelete,
+		terraform:   enableBlobSoftDeleteTerraform,
+		azureCli:    enableBlobSoftDeleteAzureCli,
+	},
+	{
+		testName:    "CCC_ObjStor_C05_TR01_T01",
+		description: "Enable blob versioning",
+		testSet:     CCC_ObjStor_C05_TR01,
+		change:      enableVersioning,
+		terraform:   enableVersioningTerraform,
+		azureCli:    enableVersioningAzureCli,
+	},
+	{
+		testName:    "CCC_C08_TR01_T01",
+		description: "Replicate the data across availability zones, and to a secondary region where the account tier supports it",
+		testSet:     CCC_C08_TR01,
+		change:      replicateAcrossZones,
+		terraform:   replicateAcrossZonesTerraform,
+		azureCli:    replicateAcrossZonesAzureCli,
+	},
+}
+
+func disableBlobPublicAccess(target *storageAccountTarget) remediationChange {
+	return remediationChange{account: &armstorage.AccountUpdateParameters{
+		Properties: &armstorage.AccountPropertiesUpdateParameters{AllowBlobPublicAccess: to.Ptr(false)},
+	}}
+}
+
+func disableSharedKeyAccess(target *storageAccountTarget) remediationChange {
+	return remediationChange{account: &armstorage.AccountUpdateParameters{
+		Properties: &armstorage.AccountPropertiesUpdateParameters{AllowSharedKeyAccess: to.Ptr(false)},
+	}}
+}
+
+// denyUnlistedNetworkAccess sets the default action to deny, the network rule set is replaced as a whole so the existing rules are kept in it
+func denyUnlistedNetworkAccess(target *storageAccountTarget) remediationChange {
+	networkRuleSet := armstorage.NetworkRuleSet{}
+
+	if target.storageAccountResource.Properties.NetworkRuleSet != nil {
+		networkRuleSet = *target.storageAccountResource.Properties.NetworkRuleSet
+	}
+
+	networkRuleSet.DefaultAction = to.Ptr(armstorage.DefaultActionDeny)
+
+	if bypass, removed := permittedBypass(target); removed {
+		networkRuleSet.Bypass = to.Ptr(armstorage.Bypass(strings.Join(bypass, ", ")))
+	}
+
+	return remediationChange{account: &armstorage.AccountUpdateParameters{
+		Properties: &armstorage.AccountPropertiesUpdateParameters{NetworkRuleSet: &networkRuleSet},
+	}}
+}
+
+// permittedBypass is the bypass of the network rules without trusted Azure services when they are forbidden from bypassing them.
+// IP rules outside of the approved CIDRs are left in place, as removing them could cut off the account's clients
+func permittedBypass(target *storageAccountTarget) (bypass []string, removed bool) {
+	if networkRuleSet := target.storageAccountResource.Properties.NetworkRuleSet; networkRuleSet != nil && azureServicesBypassForbidden {
+		for _, service := range splitBypass(networkRuleSet.Bypass) {
+			if service == string(armstorage.BypassAzureServices) {
+				removed = true
+			} else {
+				bypass = append(bypass, service)
+			}
+		}
+	}
+
+	if len(bypass) == 0 {
+		bypass = []string{string(armstorage.BypassNone)}
+	}
+
+	return bypass, removed
+}
+
+func enableContainerSoftDelete(target *storageAccountTarget) remediationChange {
+	properties := &armstorage.BlobServicePropertiesProperties{
+		ContainerDeleteRetentionPolicy: enabledRetentionPolicy(currentBlobServiceProperties(target).ContainerDeleteRetentionPolicy),
+	}
+
+	// The test also fails when soft deleted blobs can be permanently deleted
+	if blobRetentionPolicy := currentBlobServiceProperties(target).DeleteRetentionPolicy; blobRetentionPolicy != nil && blobRetentionPolicy.AllowPermanentDelete != nil && *blobRetentionPolicy.AllowPermanentDelete {
+		properties.DeleteRetentionPolicy = enabledRetentionPolicy(blobRetentionPolicy)
+		properties.DeleteRetentionPolicy.AllowPermanentDelete = to.Ptr(false)
+	}
+
+	return remediationChange{blobServices: &armstorage.BlobServiceProperties{BlobServiceProperties: properties}}
+}
+
+func enableBlobSoftDelete(target *storageAccountTarget) remediationChange {
+	policy := enabledRetentionPolicy(currentBlobServiceProperties(target).DeleteRetentionPolicy)
+	policy.AllowPermanentDelete = to.Ptr(false)
+
+	return remediationChange{blobServices: &armstorage.BlobServiceProperties{BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+		DeleteRetentionPolicy: policy,
+	}}}
+}
+
+// replicateAcrossZones changes the replication of the account, Premium accounts cannot be geo-replicated so are only made zone redundant
+func replicateAcrossZones(target *storageAccountTarget) remediationChange {
+	return remediationChange{account: &armstorage.AccountUpdateParameters{
+		SKU: &armstorage.SKU{Name: to.Ptr(zoneRedundantSku(target))},
+	}}
+}
+
+func zoneRedundantSku(target *storageAccountTarget) armstorage.SKUName {
+	if target.storageAccountResource.SKU != nil && target.storageAccountResource.SKU.Name != nil && strings.HasPrefix(string(*target.storageAccountResource.SKU.Name), "Premium_") {
+		return armstorage.SKUNamePremiumZRS
+	}
+
+	return armstorage.SKUNameStandardGZRS
+}
+
+func enableVersioning(target *storageAccountTarget) remediationChange {
+	return remediationChange{blobServices: &armstorage.BlobServiceProperties{BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+		IsVersioningEnabled: to.Ptr(true),
+	}}}
+}
+
+func currentBlobServiceProperties(target *storageAccountTarget) armstorage.BlobServicePropertiesProperties {
+	if target.blobServiceProperties == nil || target.blobServiceProperties.BlobServiceProperties == nil {
+		return armstorage.BlobServicePropertiesProperties{}
+	}
+
+	return *target.blobServiceProperties.BlobServiceProperties
+}
+
+// enabledRetentionPolicy enables a soft delete retention policy, keeping its retention period if it has one
+func enabledRetentionPolicy(current *armstorage.DeleteRetentionPolicy) *armstorage.DeleteRetentionPolicy {
+	policy := &armstorage.DeleteRetentionPolicy{
+		Enabled: to.Ptr(true),
+		Days:    to.Ptr(int32(defaultSoftDeleteRetentionDays)),
+	}
+
+	if current != nil && current.Days != nil && *current.Days > 0 {
+		policy.Days = current.Days
+	}
+
+	return policy
+}
+
+// method returns the HTTP method of the request which makes the change, blob service properties are set with PUT as they cannot be patched
+func (change remediationChange) method() string {
+	if change.blobServices != nil {
+		return http.MethodPut
+	}
+
+	return http.MethodPatch
+}
+
+// url returns the Azure Resource Manager URL the change is made to
+func (change remediationChange) url(target *storageAccountTarget) string {
+	endpoint := cloud.AzurePublic.Services[cloud.ResourceManager].Endpoint
+
+	if configured, ok := environmentClientOptions.Cloud.Services[cloud.ResourceManager]; ok && configured.Endpoint != "" {
+		endpoint = configured.Endpoint
+	}
+
+	resourceId := target.storageAccountResourceId
+
+	if change.blobServices != nil {
+		resourceId += "/blobServices/default"
+	}
+
+	return fmt.Sprintf("%s%s?api-version=%s", strings.TrimSuffix(endpoint, "/"), resourceId, storageApiVersion)
+}
+
+// body returns the JSON body of the request which makes the change, as the Azure SDK sends it
+func (change remediationChange) body() (string, error) {
+	var contents []byte
+	var err error
+
+	if change.blobServices != nil {
+		contents, err = json.Marshal(change.blobServices)
+	} else {
+		contents, err = json.Marshal(change.account)
+	}
+
+	if err != nil {
+		return "", err
+	}
+
+	var indented bytes.Buffer
+
+	err = json.Indent(&indented, contents, "  ", "  ")
+
+	return indented.String(), err
+}
+
+// apply makes the change to the storage account in Azure
+func (change remediationChange) apply(target *storageAccountTarget) (err error) {
+	ctx, cancel := context.WithTimeout(pluginContext, 30*time.Second)
+	defer cancel()
+
+	if change.blobServices != nil {
+		_, err = blobServicesClient.SetServiceProperties(ctx, target.resourceId.resourceGroupName, target.resourceId.storageAccountName, *change.blobServices, nil)
+	} else {
+		_, err = armstorageClient.Update(ctx, target.resourceId.resourceGroupName, target.resourceId.storageAccountName, *change.account, nil)
+	}
+
+	return err
+}
+
+// Remediate writes the request which fixes each failed configuration test, making the fixes and re-running their TestSets when apply is set
+func Remediate(output io.Writer, apply bool) error {
+	err := Initialize()
+
+	if err != nil {
+		return err
+	}
+
+	if apply {
+		err = requireAzure("remediate --apply")
+
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, target := range targets {
+		activateTarget(target)
+
+		fmt.Fprintf(output, "Storage account: %s\n", target.label())
+
+		if target.iacAddress != "" {
+			fmt.Fprint(output, "Not deployed yet, fix the Terraform or ARM template instead\n\n")
+			continue
+		}
+
+		planned, err := planRemediations(target)
+
+		if err != nil {
+			fmt.Fprintf(output, "Could not plan remediations: %v\n\n", err)
+			continue
+		}
+
+		if len(planned) == 0 {
+			fmt.Fprint(output, "Nothing to remediate\n\n")
+			continue
+		}
+
+		for _, remediation := range planned {
+			writeRemediation(output, target, remediation)
+
+			if apply {
+				fmt.Fprintf(output, "  Result: %s\n", applyRemediation(target, remediation))
+			} else {
+				fmt.Fprint(output, "  Result: not applied, run with --apply to make this change\n")
+			}
+		}
+
+		fmt.Fprintln(output)
+	}
+
+	return nil
+}
+
+// planRemediations runs the TestSets which have remediations against the target, returning the changes which fix their failed tests
+func planRemediations(target *storageAccountTarget) (planned []*plannedRemediation, err error) {
+	results := make(map[string]pluginkit.TestSetResult)
+
+	for _, remediation := range remediations {
+		testSetName := getTestSetName(remediation.testSet)
+
+		if _, ok := results[testSetName]; !ok {
+			// The artifacts created by the TestSet are deleted once it has run, as remediate does not run a whole suite
+			_, results[testSetName] = withCleanup(withTimeout(testSetName, withInitializationCheck(remediation.testSet)), true)()
+		}
+
+		testResult, ok := results[testSetName].Tests[remediation.testName]
+
+		if !ok || testResult.Passed {
+			continue
+		}
+
+		change := remediation.change(target)
+
+		body, err := change.body()
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to create the remediation for %s: %v", remediation.testName, err)
+		}
+
+		// The same change can fix the failures of more than one test
+		index := slices.IndexFunc(planned, func(p *plannedRemediation) bool {
+			existingBody, _ := p.change.body()
+			return p.change.method() == change.method() && existingBody == body
+		})
+
+		if index < 0 {
+			planned = append(planned, &plannedRemediation{change: change})
+			index = len(planned) - 1
+		}
+
+		planned[index].testNames = append(planned[index].testNames, remediation.testName)
+
+		if !slices.Contains(planned[index].descriptions, remediation.description) {
+			planned[index].descriptions = append(planned[index].descriptions, remediation.description)
+		}
+
+		planned[index].testSets = append(planned[index].testSets, remediation.testSet)
+	}
+
+	return planned, nil
+}
+
+func writeRemediation(output io.Writer, target *storageAccountTarget, remediation *plannedRemediation) {
+	body, _ := remediation.change.body()
+
+	fmt.Fprintf(output, "%s: %s\n", strings.Join(remediation.testNames, ", "), strings.Join(remediation.descriptions, ". "))
+	fmt.Fprintf(output, "  %s %s\n", remediation.change.method(), remediation.change.url(target))
+	fmt.Fprintf(output, "  %s\n", body)
+}
+
+// applyRemediation makes the change, reloads the storage account and re-runs the affected TestSets, describing the outcome
+func applyRemediation(target *storageAccountTarget, remediation *plannedRemediation) string {
+	err := remediation.change.apply(target)
+
+	if err != nil {
+		return fmt.Sprintf("failed to apply: %v", err)
+	}
+
+	target.initErrors = target.loadProperties()
+
+	var outcomes []string
+
+	for _, testSet := range remediation.testSets {
+		testSetName, result := withCleanup(withTimeout(getTestSetName(testSet), withInitializationCheck(testSet)), true)()
+
+		if result.Passed {
+			outcomes = append(outcomes, testSetName+" now passes")
+		} else {
+			outcomes = append(outcomes, fmt.Sprintf("%s still fails: %s", testSetName, result.Message))
+		}
+	}
+
+	return "applied, " + strings.Join(slices.Compact(outcomes), ", ")
+}
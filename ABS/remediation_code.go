@@ -0,0 +1,429 @@
+package abs
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+const remediationFileName = "remediation.md"
+
+// remediationFilePath is where the remediation of each failed test is written as Terraform, Bicep and Azure CLI, it is not written when empty
+var remediationFilePath string
+
+// terraformAttribute is an attribute of the azurerm_storage_account resource, nested in the given blocks, which must be changed
+type terraformAttribute struct {
+	blocks  []string
+	name    string
+	current string
+	desired string
+}
+
+func disableBlobPublicAccessTerraform(target *storageAccountTarget) []terraformAttribute {
+	return []terraformAttribute{{name: "allow_nested_items_to_be_public", current: hclBool(target.storageAccountResource.Properties.AllowBlobPublicAccess), desired: "false"}}
+}
+
+func disableBlobPublicAccessAzureCli(target *storageAccountTarget) []string {
+	return []string{azureCliAccountUpdate(target, "--allow-blob-public-access false")}
+}
+
+func disableSharedKeyAccessTerraform(target *storageAccountTarget) []terraformAttribute {
+	return []terraformAttribute{{name: "shared_access_key_enabled", current: hclBool(target.storageAccountResource.Properties.AllowSharedKeyAccess), desired: "false"}}
+}
+
+func disableSharedKeyAccessAzureCli(target *storageAccountTarget) []string {
+	return []string{azureCliAccountUpdate(target, "--allow-shared-key-access false")}
+}
+
+func denyUnlistedNetworkAccessTerraform(target *storageAccountTarget) []terraformAttribute {
+	current := ""
+
+	if networkRuleSet := target.storageAccountResource.Properties.NetworkRuleSet; networkRuleSet != nil && networkRuleSet.DefaultAction != nil {
+		current = strconv.Quote(string(*networkRuleSet.DefaultAction))
+	}
+
+	attributes := []terraformAttribute{{blocks: []string{"network_rules"}, name: "default_action", current: current, desired: `"Deny"`}}
+
+	if bypass, removed := permittedBypass(target); removed {
+		attributes = append(attributes, terraformAttribute{
+			blocks:  []string{"network_rules"},
+			name:    "bypass",
+			current: hclStringSet(splitBypass(target.storageAccountResource.Properties.NetworkRuleSet.Bypass)),
+			desired: hclStringSet(slices.DeleteFunc(bypass, func(service string) bool { return service == string(armstorage.BypassNone) })),
+		})
+	}
+
+	return attributes
+}
+
+func denyUnlistedNetworkAccessAzureCli(target *storageAccountTarget) []string {
+	arguments := "--default-action Deny"
+
+	if bypass, removed := permittedBypass(target); removed {
+		arguments += " --bypass " + strings.Join(bypass, " ")
+	}
+
+	return []string{azureCliAccountUpdate(target, arguments)}
+}
+
+func enableContainerSoftDeleteTerraform(target *storageAccountTarget) []terraformAttribute {
+	policy := currentBlobServiceProperties(target).ContainerDeleteRetentionPolicy
+	attributes := []terraformAttribute{{
+		blocks:  []string{"blob_properties", "container_delete_retention_policy"},
+		name:    "days",
+		current: hclRetentionDays(policy),
+		desired: strconv.Itoa(int(*enabledRetentionPolicy(policy).Days)),
+	}}
+
+	if permanentDeleteAllowed(target) {
+		attributes = append(attributes, terraformAttribute{blocks: []string{"blob_properties", "delete_retention_policy"}, name: "permanent_delete_enabled", current: "true", desired: "false"})
+	}
+
+	return attributes
+}
+
+func enableContainerSoftDeleteAzureCli(target *storageAccountTarget) []string {
+	days := *enabledRetentionPolicy(currentBlobServiceProperties(target).ContainerDeleteRetentionPolicy).Days
+	commands := []string{azureCliBlobServiceUpdate(target, fmt.Sprintf("--enable-container-delete-retention true --container-delete-retention-days %d", days))}
+
+	if permanentDeleteAllowed(target) {
+		commands = append(commands, azureCliDisallowPermanentDelete(target))
+	}
+
+	return commands
+}
+
+func enableBlobSoftDeleteTerraform(target *storageAccountTarget) []terraformAttribute {
+	policy := currentBlobServiceProperties(target).DeleteRetentionPolicy
+	blocks := []string{"blob_properties", "delete_retention_policy"}
+	attributes := []terraformAttribute{{blocks: blocks, name: "days", current: hclRetentionDays(policy), desired: strconv.Itoa(int(*enabledRetentionPolicy(policy).Days))}}
+
+	if permanentDeleteAllowed(target) {
+		attributes = append(attributes, terraformAttribute{blocks: blocks, name: "permanent_delete_enabled", current: "true", desired: "false"})
+	}
+
+	return attributes
+}
+
+func enableBlobSoftDeleteAzureCli(target *storageAccountTarget) []string {
+	days := *enabledRetentionPolicy(currentBlobServiceProperties(target).DeleteRetentionPolicy).Days
+	commands := []string{azureCliBlobServiceUpdate(target, fmt.Sprintf("--enable-delete-retention true --delete-retention-days %d", days))}
+
+	if permanentDeleteAllowed(target) {
+		commands = append(commands, azureCliDisallowPermanentDelete(target))
+	}
+
+	return commands
+}
+
+func enableVersioningTerraform(target *storageAccountTarget) []terraformAttribute {
+	return []terraformAttribute{{blocks: []string{"blob_properties"}, name: "versioning_enabled", current: hclBool(currentBlobServiceProperties(target).IsVersioningEnabled), desired: "true"}}
+}
+
+func enableVersioningAzureCli(target *storageAccountTarget) []string {
+	return []string{azureCliBlobServiceUpdate(target, "--enable-versioning true")}
+}
+
+// replicateAcrossZonesTerraform changes the replication type, azurerm splits the SKU into the account tier and the replication type
+func replicateAcrossZonesTerraform(target *storageAccountTarget) []terraformAttribute {
+	current := ""
+
+	if target.storageAccountResource.SKU != nil && target.storageAccountResource.SKU.Name != nil {
+		if _, replicationType, ok := strings.Cut(string(*target.storageAccountResource.SKU.Name), "_"); ok {
+			current = strconv.Quote(replicationType)
+		}
+	}
+
+	_, desired, _ := strings.Cut(string(zoneRedundantSku(target)), "_")
+
+	return []terraformAttribute{{name: "account_replication_type", current: current, desired: strconv.Quote(desired)}}
+}
+
+func replicateAcrossZonesAzureCli(target *storageAccountTarget) []string {
+	return []string{azureCliAccountUpdate(target, "--sku "+string(zoneRedundantSku(target)))}
+}
+
+func permanentDeleteAllowed(target *storageAccountTarget) bool {
+	policy := currentBlobServiceProperties(target).DeleteRetentionPolicy
+
+	return policy != nil && policy.AllowPermanentDelete != nil && *policy.AllowPermanentDelete
+}
+
+func hclBool(value *bool) string {
+	if value == nil {
+		return ""
+	}
+
+	return strconv.FormatBool(*value)
+}
+
+func hclStringSet(values []string) string {
+	quoted := make([]string, len(values))
+
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
+
+// hclRetentionDays returns the days of a retention policy, azurerm has no enabled attribute as the policy is disabled by leaving out its block
+func hclRetentionDays(policy *armstorage.DeleteRetentionPolicy) string {
+	if policy == nil || policy.Enabled == nil || !*policy.Enabled || policy.Days == nil {
+		return ""
+	}
+
+	return strconv.Itoa(int(*policy.Days))
+}
+
+func azureCliAccountUpdate(target *storageAccountTarget, arguments string) string {
+	return fmt.Sprintf("az storage account update --resource-group %s --name %s %s", azureCliResourceGroup(target), azureCliAccountName(target), arguments)
+}
+
+func azureCliBlobServiceUpdate(target *storageAccountTarget, arguments string) string {
+	return fmt.Sprintf("az storage account blob-service-properties update --resource-group %s --account-name %s %s", azureCliResourceGroup(target), azureCliAccountName(target), arguments)
+}
+
+// azureCliDisallowPermanentDelete prevents permanent delete of soft deleted blobs, which blob-service-properties update has no argument for
+func azureCliDisallowPermanentDelete(target *storageAccountTarget) string {
+	return fmt.Sprintf("az resource update --resource-group %s --namespace Microsoft.Storage --parent storageAccounts/%s --resource-type blobServices --name default --set properties.deleteRetentionPolicy.allowPermanentDelete=false", azureCliResourceGroup(target), azureCliAccountName(target))
+}
+
+// azureCliResourceGroup returns the resource group of the account, which a Terraform plan or ARM template may not set
+func azureCliResourceGroup(target *storageAccountTarget) string {
+	if target.resourceId.resourceGroupName == "" {
+		return "<resource-group>"
+	}
+
+	return target.resourceId.resourceGroupName
+}
+
+func azureCliAccountName(target *storageAccountTarget) string {
+	if target.resourceId.storageAccountName == "" {
+		return "<storage-account>"
+	}
+
+	return target.resourceId.storageAccountName
+}
+
+// terraformDiff shows the change to the attributes of the azurerm_storage_account resource as a diff
+func terraformDiff(target *storageAccountTarget, attributes []terraformAttribute) string {
+	var diff strings.Builder
+
+	fmt.Fprintf(&diff, " resource \"azurerm_storage_account\" %q {\n", terraformResourceName(target))
+	writeTerraformAttributes(&diff, attributes, 1)
+	diff.WriteString(" }\n")
+
+	return diff.String()
+}
+
+// writeTerraformAttributes writes the attributes at the given depth, followed by the blocks nested at that depth
+func writeTerraformAttributes(diff *strings.Builder, attributes []terraformAttribute, depth int) {
+	indent := strings.Repeat("  ", depth)
+	var blockNames []string
+
+	for _, attribute := range attributes {
+		if len(attribute.blocks) >= depth {
+			if !slices.Contains(blockNames, attribute.blocks[depth-1]) {
+				blockNames = append(blockNames, attribute.blocks[depth-1])
+			}
+
+			continue
+		}
+
+		if attribute.current == attribute.desired {
+			fmt.Fprintf(diff, " %s%s = %s\n", indent, attribute.name, attribute.desired)
+			continue
+		}
+
+		if attribute.current != "" {
+			fmt.Fprintf(diff, "-%s%s = %s\n", indent, attribute.name, attribute.current)
+		}
+
+		fmt.Fprintf(diff, "+%s%s = %s\n", indent, attribute.name, attribute.desired)
+	}
+
+	for _, blockName := range blockNames {
+		var nested []terraformAttribute
+
+		for _, attribute := range attributes {
+			if len(attribute.blocks) >= depth && attribute.blocks[depth-1] == blockName {
+				nested = append(nested, attribute)
+			}
+		}
+
+		fmt.Fprintf(diff, " %s%s {\n", indent, blockName)
+		writeTerraformAttributes(diff, nested, depth+1)
+		fmt.Fprintf(diff, " %s}\n", indent)
+	}
+}
+
+// terraformResourceName returns the name of the resource in the Terraform plan, or the storage account name for any other target
+func terraformResourceName(target *storageAccountTarget) string {
+	if _, name, ok := strings.Cut(target.iacAddress, "azurerm_storage_account."); ok {
+		return name
+	}
+
+	return azureCliAccountName(target)
+}
+
+// bicepProperties shows the change as the properties of the Bicep resource it is made to
+func bicepProperties(change remediationChange) (string, error) {
+	resourceType := "Microsoft.Storage/storageAccounts@" + storageApiVersion
+	var resource interface{} = change.account
+
+	if change.blobServices != nil {
+		resourceType = "Microsoft.Storage/storageAccounts/blobServices@" + storageApiVersion
+		resource = change.blobServices
+	}
+
+	contents, err := json.Marshal(resource)
+
+	if err != nil {
+		return "", err
+	}
+
+	var fields map[string]interface{}
+
+	err = json.Unmarshal(contents, &fields)
+
+	if err != nil {
+		return "", err
+	}
+
+	var properties strings.Builder
+
+	fmt.Fprintf(&properties, "// %s\n", resourceType)
+
+	for _, key := range slices.Sorted(maps.Keys(fields)) {
+		fmt.Fprintf(&properties, "%s: %s\n", key, bicepValue(fields[key], ""))
+	}
+
+	return properties.String(), nil
+}
+
+func bicepValue(value interface{}, indent string) string {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		var object strings.Builder
+
+		object.WriteString("{\n")
+
+		for _, key := range slices.Sorted(maps.Keys(typedValue)) {
+			fmt.Fprintf(&object, "%s  %s: %s\n", indent, key, bicepValue(typedValue[key], indent+"  "))
+		}
+
+		object.WriteString(indent + "}")
+
+		return object.String()
+	case []interface{}:
+		var array strings.Builder
+
+		array.WriteString("[\n")
+
+		for _, item := range typedValue {
+			fmt.Fprintf(&array, "%s  %s\n", indent, bicepValue(item, indent+"  "))
+		}
+
+		array.WriteString(indent + "]")
+
+		return array.String()
+	case string:
+		return "'" + strings.ReplaceAll(strings.ReplaceAll(typedValue, `\`, `\\`), "'", `\'`) + "'"
+	case float64:
+		return strconv.FormatFloat(typedValue, 'f', -1, 64)
+	case nil:
+		return "null"
+	default:
+		return fmt.Sprint(typedValue)
+	}
+}
+
+// StartRemediationFile removes the remediation file of an earlier assessment, it is only written when there is a write directory.
+// It is called when initializing an assessment, so that the preflight, cleanup, sweep and remediate commands keep the last one
+func StartRemediationFile() {
+	if Armory.Config == nil || Armory.Config.WriteDirectory == "" {
+		return
+	}
+
+	remediationFilePath = path.Join(Armory.Config.WriteDirectory, Armory.Config.ServiceName, remediationFileName)
+
+	err := os.Remove(remediationFilePath)
+
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("[ERROR] Failed to remove remediation file %s: %v", remediationFilePath, err)
+	}
+}
+
+// withRemediationCode wraps a TestSet so that the remediation of each of its failed tests is written to the remediation file
+func withRemediationCode(testSet pluginkit.TestSet) pluginkit.TestSet {
+	return func() (string, pluginkit.TestSetResult) {
+		testSetName, result := testSet()
+
+		if remediationFilePath == "" {
+			return testSetName, result
+		}
+
+		for _, remediation := range remediations {
+			testResult, ok := result.Tests[remediation.testName]
+
+			if !ok || testResult.Passed {
+				continue
+			}
+
+			err := writeRemediationCode(currentTarget, remediation, testResult)
+
+			if err != nil {
+				log.Printf("[ERROR] Failed to write the remediation of %s to %s: %v", remediation.testName, remediationFilePath, err)
+			}
+		}
+
+		return testSetName, result
+	}
+}
+
+// writeRemediationCode appends the remediation of a failed test, as Terraform, Bicep and Azure CLI, to the remediation file
+func writeRemediationCode(target *storageAccountTarget, remediation remediation, testResult pluginkit.TestResult) error {
+	bicep, err := bicepProperties(remediation.change(target))
+
+	if err != nil {
+		return err
+	}
+
+	var section strings.Builder
+
+	fmt.Fprintf(&section, "## %s: %s\n\n", target.label(), remediation.testName)
+	fmt.Fprintf(&section, "%s. %s\n\n", remediation.description, testResult.Message)
+	fmt.Fprintf(&section, "Terraform:\n\n```diff\n%s```\n\n", terraformDiff(target, remediation.terraform(target)))
+	fmt.Fprintf(&section, "Bicep:\n\n```bicep\n%s```\n\n", bicep)
+	fmt.Fprintf(&section, "Azure CLI:\n\n```sh\n%s\n```\n\n", strings.Join(remediation.azureCli(target), "\n"))
+
+	err = os.MkdirAll(path.Dir(remediationFilePath), 0755)
+
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(remediationFilePath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(section.String())
+
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+
+	return err
+}
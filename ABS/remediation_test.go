@@ -0,0 +1,220 @@
+package abs
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/azure/finos-azure-blob-storage-raid/ABS/emulator"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_remediation_changes(t *testing.T) {
+	target := &storageAccountTarget{
+		storageAccountResourceId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account",
+		storageAccountResource: armstorage.Account{Properties: &armstorage.AccountProperties{
+			NetworkRuleSet: &armstorage.NetworkRuleSet{
+				DefaultAction: to.Ptr(armstorage.DefaultActionAllow),
+				IPRules:       []*armstorage.IPRule{{IPAddressOrRange: to.Ptr("203.0.113.0/24")}},
+			},
+		}},
+		blobServiceProperties: &armstorage.BlobServiceProperties{BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+			DeleteRetentionPolicy: &armstorage.DeleteRetentionPolicy{Enabled: to.Ptr(true), Days: to.Ptr(int32(30)), AllowPermanentDelete: to.Ptr(true)},
+		}},
+	}
+
+	tests := []struct {
+		name           string
+		change         func(*storageAccountTarget) remediationChange
+		expectedMethod string
+		expectedUrl    string
+		expectedBody   []string
+	}{
+		{
+			name:           "account property",
+			change:         disableSharedKeyAccess,
+			expectedMethod: "PATCH",
+			expectedUrl:    "https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account?api-version=2023-05-01",
+			expectedBody:   []string{`"allowSharedKeyAccess": false`},
+		},
+		{
+			name:           "network rules are kept",
+			change:         denyUnlistedNetworkAccess,
+			expectedMethod: "PATCH",
+			expectedUrl:    "https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account?api-version=2023-05-01",
+			expectedBody:   []string{`"defaultAction": "Deny"`, `"value": "203.0.113.0/24"`},
+		},
+		{
+			name:           "blob service property keeps the retention period",
+			change:         enableContainerSoftDelete,
+			expectedMethod: "PUT",
+			expectedUrl:    "https://management.azure.com/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account/blobServices/default?api-version=2023-05-01",
+			expectedBody:   []string{`"containerDeleteRetentionPolicy": {`, `"days": 30`, `"allowPermanentDelete": false`},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			change := tt.change(target)
+			body, err := change.body()
+
+			// Assert
+			assert.NoError(t, err)
+			assert.Equal(t, tt.expectedMethod, change.method())
+			assert.Equal(t, tt.expectedUrl, change.url(target))
+
+			for _, expected := range tt.expectedBody {
+				assert.Contains(t, body, expected)
+			}
+		})
+	}
+}
+
+func Test_Remediate_is_a_dry_run_unless_applied(t *testing.T) {
+	// Arrange
+	server := emulator.NewServer(emulator.Public())
+	t.Cleanup(server.Close)
+
+	results := runTestSuite(t, server, nil)
+	assert.False(t, results["CCC_C03_TR02"].Passed)
+
+	var dryRunOutput, applyOutput bytes.Buffer
+
+	// Act
+	dryRunErr := Remediate(&dryRunOutput, false)
+	applyErr := Remediate(&applyOutput, true)
+
+	// Assert
+	assert.NoError(t, dryRunErr)
+	assert.Contains(t, dryRunOutput.String(), "CCC_C03_TR02_T01: Disable anonymous public access to blobs")
+	assert.Contains(t, dryRunOutput.String(), `"allowBlobPublicAccess": false`)
+	assert.Contains(t, dryRunOutput.String(), "not applied, run with --apply to make this change")
+
+	assert.NoError(t, applyErr)
+	assert.Contains(t, applyOutput.String(), "applied, CCC_C03_TR02 now passes")
+	assert.Contains(t, applyOutput.String(), "applied, CCC_C05_TR01 now passes")
+	assert.False(t, *currentTarget.storageAccountResource.Properties.AllowBlobPublicAccess)
+}
+
+func Test_denyUnlistedNetworkAccess_removes_the_Azure_services_bypass(t *testing.T) {
+	// Arrange
+	azureServicesBypassForbidden = true
+	defer func() { azureServicesBypassForbidden = false }()
+
+	target := &storageAccountTarget{
+		storageAccountResourceId: "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/account",
+		storageAccountResource: armstorage.Account{Name: to.Ptr("account"), Properties: &armstorage.AccountProperties{
+			NetworkRuleSet: &armstorage.NetworkRuleSet{
+				DefaultAction: to.Ptr(armstorage.DefaultActionAllow),
+				Bypass:        to.Ptr(armstorage.Bypass("AzureServices, Logging")),
+			},
+		}},
+	}
+
+	// Act
+	body, err := denyUnlistedNetworkAccess(target).body()
+	terraform := denyUnlistedNetworkAccessTerraform(target)
+	azureCli := denyUnlistedNetworkAccessAzureCli(target)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Contains(t, body, `"bypass": "Logging"`)
+	assert.Equal(t, terraformAttribute{blocks: []string{"network_rules"}, name: "bypass", current: `["AzureServices", "Logging"]`, desired: `["Logging"]`}, terraform[1])
+	assert.Contains(t, azureCli[0], "--default-action Deny --bypass Logging")
+}
+
+func Test_terraformDiff(t *testing.T) {
+	// Arrange
+	target := &storageAccountTarget{
+		iacAddress: "module.data.azurerm_storage_account.this",
+		blobServiceProperties: &armstorage.BlobServiceProperties{BlobServiceProperties: &armstorage.BlobServicePropertiesProperties{
+			DeleteRetentionPolicy: &armstorage.DeleteRetentionPolicy{Enabled: to.Ptr(true), Days: to.Ptr(int32(30)), AllowPermanentDelete: to.Ptr(true)},
+		}},
+	}
+
+	// Act
+	diff := terraformDiff(target, append(enableContainerSoftDeleteTerraform(target), enableVersioningTerraform(target)...))
+
+	// Assert
+	assert.Equal(t, ` resource "azurerm_storage_account" "this" {
+   blob_properties {
++    versioning_enabled = true
+     container_delete_retention_policy {
++      days = 7
+     }
+     delete_retention_policy {
+-      permanent_delete_enabled = true
++      permanent_delete_enabled = false
+     }
+   }
+ }
+`, diff)
+}
+
+func Test_failed_tests_have_their_remediation_written(t *testing.T) {
+	// Arrange
+	server := emulator.NewServer(emulator.Public())
+	t.Cleanup(server.Close)
+
+	// Act
+	runTestSuite(t, server, nil)
+
+	// Assert
+	remediationFile, err := os.ReadFile(path.Join(Armory.Config.WriteDirectory, Armory.Config.ServiceName, remediationFileName))
+	assert.NoError(t, err)
+	assert.Contains(t, string(remediationFile), "## publicaccount: CCC_C03_TR02_T01")
+	assert.Contains(t, string(remediationFile), "-  allow_nested_items_to_be_public = true\n+  allow_nested_items_to_be_public = false")
+	assert.Contains(t, string(remediationFile), "properties: {\n  allowBlobPublicAccess: false\n}")
+	assert.Contains(t, string(remediationFile), "az storage account update --resource-group "+currentTarget.resourceId.resourceGroupName+" --name publicaccount --allow-blob-public-access false")
+	assert.NotContains(t, string(remediationFile), "CCC_C08_TR01_T01")
+}
+
+func Test_Remediate_keeps_the_remediation_file_of_the_assessment(t *testing.T) {
+	// Arrange
+	server := emulator.NewServer(emulator.Public())
+	t.Cleanup(server.Close)
+
+	runTestSuite(t, server, nil)
+	remediationFile := path.Join(Armory.Config.WriteDirectory, Armory.Config.ServiceName, remediationFileName)
+
+	// Act
+	err := Remediate(io.Discard, false)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.FileExists(t, remediationFile)
+}
+
+func Test_planRemediations_deletes_the_artifacts_created_by_test_sets(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+	blobContainersClient = &blobContainersClientMock{}
+
+	previousRemediations := remediations
+	t.Cleanup(func() { remediations = previousRemediations })
+
+	remediations = []remediation{{
+		testName: "CCC_Test_TR01_T01",
+		testSet: func() (string, pluginkit.TestSetResult) {
+			trackArtifact(artifactContainer, "privateer-test-container-abc")
+
+			return "CCC_Test_TR01", pluginkit.TestSetResult{Tests: map[string]pluginkit.TestResult{"CCC_Test_TR01_T01": {Passed: false}}}
+		},
+		change: disableSharedKeyAccess,
+	}}
+
+	// Act
+	planned, err := planRemediations(currentTarget)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, planned, 1)
+	assert.Empty(t, testArtifacts.artifacts)
+	assert.NoFileExists(t, cleanupLedgerPath)
+}
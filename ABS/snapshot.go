@@ -0,0 +1,301 @@
+package abs
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+const (
+	storageAccountResourceType = "microsoft.storage/storageaccounts"
+	blobServicesResourceType   = "microsoft.storage/storageaccounts/blobservices"
+)
+
+var (
+	// assessingSnapshots is set when the storage accounts are read from exported snapshots rather than from Azure
+	assessingSnapshots bool
+
+	// snapshotTestSets only read the storage account and blob service properties, so can be run against a snapshot
+	snapshotTestSets = []string{
+		"CCC_C02_TR01",
+		"CCC_C03_TR02",
+		"CCC_C05_TR01",
+		"CCC_C08_TR01",
+		"CCC_C08_TR02",
+		"CCC_ObjStor_C02_TR01",
+		"CCC_ObjStor_C02_TR02",
+		"CCC_ObjStor_C03_TR01",
+		"CCC_ObjStor_C03_TR02",
+		"CCC_ObjStor_C04_TR01",
+		"CCC_ObjStor_C05_TR01",
+	}
+
+	// armTopLevelFields are the fields of a resource which ARM does not nest under properties
+	armTopLevelFields = []string{"id", "name", "type", "location", "tags", "sku", "kind", "identity", "extendedLocation", "properties"}
+
+	// cliPropertyNames maps the property names used by the Azure CLI to those used by ARM, where they differ
+	cliPropertyNames = map[string]string{
+		"enableHttpsTrafficOnly":   "supportsHttpsTrafficOnly",
+		"networkRuleSet":           "networkAcls",
+		"keyVaultProperties":       "keyvaultproperties",
+		"keyName":                  "keyname",
+		"keyVaultUri":              "keyvaulturi",
+		"keyVersion":               "keyversion",
+		"ipAddressOrRange":         "value",
+		"virtualNetworkResourceId": "id",
+	}
+)
+
+// initializeFromSnapshots sets up an offline assessment of the storage accounts in snapshot files, Terraform plans and ARM templates
+func initializeFromSnapshots(snapshotFiles []string, terraformPlanFiles []string, armTemplateFiles []string) (err error) {
+	err = loadTimeouts()
+
+	if err != nil {
+		return err
+	}
+
+	err = loadNetworkAllowlist()
+
+	if err != nil {
+		return err
+	}
+
+	initErrors = nil
+	subscriptionInitErrors = make(map[string]initializationErrors)
+	clientsSubscriptionId = ""
+
+	targets, err = loadSnapshots(snapshotFiles)
+
+	if err != nil {
+		return err
+	}
+
+	planTargets, err := loadTerraformPlans(terraformPlanFiles)
+
+	if err != nil {
+		return err
+	}
+
+	templateTargets, err := loadArmTemplates(armTemplateFiles)
+
+	if err != nil {
+		return err
+	}
+
+	targets = append(targets, planTargets...)
+	targets = append(targets, templateTargets...)
+
+	if len(targets) == 0 {
+		return fmt.Errorf("no storage accounts were found in the snapshot files, Terraform plans or ARM templates")
+	}
+
+	logInitializationErrors()
+	wrapTestSuites()
+	activateTarget(targets[0])
+
+	return nil
+}
+
+// loadSnapshots reads the storage accounts, and their blob service properties, from exported ARM resource JSON or Azure CLI output
+func loadSnapshots(snapshotFiles []string) (snapshotTargets []*storageAccountTarget, err error) {
+	blobServices := make(map[string]*armstorage.BlobServiceProperties)
+
+	for _, snapshotFile := range snapshotFiles {
+		info, err := os.Stat(snapshotFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot file %s: %v", snapshotFile, err)
+		}
+
+		contents, err := os.ReadFile(snapshotFile)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to read snapshot file %s: %v", snapshotFile, err)
+		}
+
+		resources, err := parseSnapshotResources(contents)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse snapshot file %s: %v", snapshotFile, err)
+		}
+
+		for _, resource := range resources {
+			resourceId, _ := resource["id"].(string)
+			resourceType, _ := resource["type"].(string)
+
+			switch strings.ToLower(resourceType) {
+			case storageAccountResourceType:
+				target, err := newStorageAccountTarget(resourceId)
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to load snapshot file %s: %v", snapshotFile, err)
+				}
+
+				err = unmarshalSnapshotResource(resource, &target.storageAccountResource)
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to load storage account %s from snapshot file %s: %v", resourceId, snapshotFile, err)
+				}
+
+				// Replication is judged against when the snapshot was taken, rather than when it is assessed
+				target.storageAccountPropertiesTimestamp = info.ModTime()
+
+				if target.storageAccountResource.Properties != nil && target.storageAccountResource.Properties.PrimaryEndpoints != nil && target.storageAccountResource.Properties.PrimaryEndpoints.Blob != nil {
+					target.storageAccountUri = *target.storageAccountResource.Properties.PrimaryEndpoints.Blob
+				}
+
+				snapshotTargets = append(snapshotTargets, target)
+
+			case blobServicesResourceType:
+				var blobServiceProperties armstorage.BlobServiceProperties
+
+				err = unmarshalSnapshotResource(resource, &blobServiceProperties)
+
+				if err != nil {
+					return nil, fmt.Errorf("failed to load blob service properties %s from snapshot file %s: %v", resourceId, snapshotFile, err)
+				}
+
+				accountId, _, _ := strings.Cut(strings.ToLower(resourceId), "/blobservices/")
+				blobServices[accountId] = &blobServiceProperties
+			}
+		}
+	}
+
+	for _, target := range snapshotTargets {
+		target.blobServiceProperties = blobServices[strings.ToLower(target.storageAccountResourceId)]
+
+		if target.blobServiceProperties == nil {
+			target.initErrors.add(componentBlobServiceProperties, target.resourceId.storageAccountName, fmt.Errorf("no blob service properties were found in the snapshot files"))
+		}
+	}
+
+	return snapshotTargets, nil
+}
+
+// parseSnapshotResources reads a single resource, an array of resources, or a list response with the resources under value
+func parseSnapshotResources(contents []byte) ([]map[string]interface{}, error) {
+	var parsed interface{}
+
+	err := json.Unmarshal(contents, &parsed)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if object, ok := parsed.(map[string]interface{}); ok {
+		if _, hasId := object["id"]; hasId {
+			return []map[string]interface{}{object}, nil
+		}
+
+		parsed = object["value"]
+	}
+
+	list, ok := parsed.([]interface{})
+
+	if !ok {
+		return nil, fmt.Errorf("expected a resource, an array of resources or a list of resources under value")
+	}
+
+	var resources []map[string]interface{}
+
+	for _, item := range list {
+		if resource, ok := item.(map[string]interface{}); ok {
+			resources = append(resources, resource)
+		}
+	}
+
+	return resources, nil
+}
+
+// unmarshalSnapshotResource converts a resource to the shape returned by ARM, the Azure CLI flattens the properties into the resource, before unmarshalling it
+func unmarshalSnapshotResource(resource map[string]interface{}, v interface{}) error {
+	if _, ok := resource["properties"]; !ok {
+		armResource := make(map[string]interface{})
+		properties := make(map[string]interface{})
+
+		for key, value := range resource {
+			if slices.Contains(armTopLevelFields, key) {
+				armResource[key] = value
+				continue
+			}
+
+			if armName, ok := cliPropertyNames[key]; ok {
+				key = armName
+			}
+
+			properties[key] = renameCliProperties(value)
+		}
+
+		armResource["properties"] = properties
+		resource = armResource
+	}
+
+	contents, err := json.Marshal(resource)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(contents, v)
+}
+
+// renameCliProperties renames the nested Azure CLI properties which ARM names differently
+func renameCliProperties(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case map[string]interface{}:
+		renamed := make(map[string]interface{}, len(typedValue))
+
+		for key, nestedValue := range typedValue {
+			if armName, ok := cliPropertyNames[key]; ok {
+				key = armName
+			}
+
+			renamed[key] = renameCliProperties(nestedValue)
+		}
+
+		return renamed
+	case []interface{}:
+		renamed := make([]interface{}, len(typedValue))
+
+		for i, nestedValue := range typedValue {
+			renamed[i] = renameCliProperties(nestedValue)
+		}
+
+		return renamed
+	default:
+		return value
+	}
+}
+
+// withSnapshotCheck wraps a TestSet so that it is only run against a snapshot if it can be assessed from the properties alone
+func withSnapshotCheck(testSetName string, testSet pluginkit.TestSet) pluginkit.TestSet {
+	return func() (string, pluginkit.TestSetResult) {
+		if !slices.Contains(snapshotTestSets, testSetName) {
+			return testSetName, newNotRunResult(testSetName, "TestSet was not run: it needs access to Azure, which an offline assessment of a snapshot does not have")
+		}
+
+		if currentTarget.iacAddress != "" && slices.Contains(deployedStateTestSets, testSetName) {
+			return testSetName, newNotRunResult(testSetName, "TestSet was not run: it assesses the state of a deployed storage account, which a Terraform plan or ARM template does not have")
+		}
+
+		if unresolved := currentTarget.getUnresolvedProperties(templatePropertyTestSets[testSetName]); len(unresolved) > 0 {
+			return testSetName, newNotRunResult(testSetName, fmt.Sprintf("TestSet was not run: the ARM template sets properties it assesses with expressions which cannot be resolved before deployment: %s", strings.Join(unresolved, ", ")))
+		}
+
+		return testSet()
+	}
+}
+
+// requireAzure returns an error if the given command, which needs access to Azure, is being run against snapshots
+func requireAzure(command string) error {
+	if assessingSnapshots {
+		return fmt.Errorf("%s needs access to Azure and cannot be run against snapshots, Terraform plans or ARM templates", command)
+	}
+
+	return nil
+}
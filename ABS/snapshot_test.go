@@ -0,0 +1,140 @@
+package abs
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	armSnapshot = `{"value": [
+		{
+			"id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/armsnapshot",
+			"name": "armsnapshot",
+			"type": "Microsoft.Storage/storageAccounts",
+			"location": "eastus",
+			"sku": {"name": "Standard_GZRS"},
+			"properties": {
+				"allowBlobPublicAccess": false,
+				"allowSharedKeyAccess": false,
+				"publicNetworkAccess": "Disabled",
+				"encryption": {"keySource": "Microsoft.Storage", "services": {"blob": {"enabled": true}}},
+				"primaryEndpoints": {"blob": "https://armsnapshot.blob.core.windows.net/"}
+			}
+		},
+		{
+			"id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/armsnapshot/blobServices/default",
+			"name": "default",
+			"type": "Microsoft.Storage/storageAccounts/blobServices",
+			"properties": {
+				"isVersioningEnabled": true,
+				"containerDeleteRetentionPolicy": {"enabled": true, "days": 7},
+				"deleteRetentionPolicy": {"enabled": true, "days": 7, "allowPermanentDelete": false}
+			}
+		}
+	]}`
+
+	cliSnapshot = `{
+		"id": "/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/rg/providers/Microsoft.Storage/storageAccounts/clisnapshot",
+		"name": "clisnapshot",
+		"type": "Microsoft.Storage/storageAccounts",
+		"location": "eastus",
+		"sku": {"name": "Standard_LRS"},
+		"allowBlobPublicAccess": true,
+		"allowSharedKeyAccess": true,
+		"enableHttpsTrafficOnly": true,
+		"publicNetworkAccess": "Enabled",
+		"networkRuleSet": {"defaultAction": "Deny", "ipRules": [{"ipAddressOrRange": "203.0.113.0/24", "action": "Allow"}]},
+		"encryption": {"keySource": "Microsoft.Keyvault", "keyVaultProperties": {"keyName": "key"}, "services": {"blob": {"enabled": true}}},
+		"primaryEndpoints": {"blob": "https://clisnapshot.blob.core.windows.net/"}
+	}`
+)
+
+// writeSnapshotFile writes the contents to a snapshot file in a temporary directory, returning its path
+func writeSnapshotFile(t *testing.T, name string, contents string) string {
+	snapshotFile := path.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(snapshotFile, []byte(contents), 0600))
+
+	return snapshotFile
+}
+
+func Test_loadSnapshots(t *testing.T) {
+	// Arrange
+	snapshotFiles := []string{
+		writeSnapshotFile(t, "arm.json", armSnapshot),
+		writeSnapshotFile(t, "cli.json", cliSnapshot),
+	}
+
+	// Act
+	snapshotTargets, err := loadSnapshots(snapshotFiles)
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Len(t, snapshotTargets, 2)
+
+	armTarget := snapshotTargets[0]
+	assert.Equal(t, "armsnapshot", armTarget.resourceId.storageAccountName)
+	assert.Equal(t, "https://armsnapshot.blob.core.windows.net/", armTarget.storageAccountUri)
+	assert.Equal(t, armstorage.SKUNameStandardGZRS, *armTarget.storageAccountResource.SKU.Name)
+	assert.True(t, *armTarget.blobServiceProperties.BlobServiceProperties.IsVersioningEnabled)
+	assert.Empty(t, armTarget.initErrors)
+
+	cliTarget := snapshotTargets[1]
+	assert.Equal(t, "clisnapshot", cliTarget.resourceId.storageAccountName)
+	assert.True(t, *cliTarget.storageAccountResource.Properties.AllowBlobPublicAccess)
+	assert.True(t, *cliTarget.storageAccountResource.Properties.EnableHTTPSTrafficOnly)
+	assert.Equal(t, armstorage.DefaultActionDeny, *cliTarget.storageAccountResource.Properties.NetworkRuleSet.DefaultAction)
+	assert.Equal(t, "203.0.113.0/24", *cliTarget.storageAccountResource.Properties.NetworkRuleSet.IPRules[0].IPAddressOrRange)
+	assert.Equal(t, "key", *cliTarget.storageAccountResource.Properties.Encryption.KeyVaultProperties.KeyName)
+	assert.Nil(t, cliTarget.blobServiceProperties)
+	assert.Len(t, cliTarget.initErrors.forComponents(componentBlobServiceProperties), 1)
+}
+
+func Test_parseSnapshotResources_rejects_other_JSON(t *testing.T) {
+	// Act
+	_, err := parseSnapshotResources([]byte(`"not a resource"`))
+
+	// Assert
+	assert.Error(t, err)
+}
+
+func Test_Initialize_assesses_snapshots_without_Azure(t *testing.T) {
+	// Arrange
+	previousTestSuites, previousConfig := Armory.TestSuites, Armory.Config
+	Armory.TestSuites = map[string][]pluginkit.TestSet{"tlp_red": {CCC_C01_TR01, CCC_C03_TR02, CCC_C08_TR01, CCC_ObjStor_C03_TR01}}
+	Armory.Config = &config.Config{Vars: map[string]interface{}{
+		"snapshotfiles": []interface{}{writeSnapshotFile(t, "arm.json", armSnapshot)},
+	}}
+
+	defer func() {
+		Armory.TestSuites, Armory.Config = previousTestSuites, previousConfig
+		assessingSnapshots = false
+	}()
+
+	// Act
+	err := Initialize()
+
+	// Assert
+	assert.NoError(t, err)
+	assert.True(t, assessingSnapshots)
+	assert.ErrorContains(t, requireAzure("cleanup"), "cleanup needs access to Azure")
+
+	results := make(map[string]pluginkit.TestSetResult)
+
+	for _, testSet := range Armory.TestSuites["tlp_red"] {
+		testSetName, result := testSet()
+		results[testSetName] = result
+	}
+
+	assert.False(t, results["CCC_C01_TR01"].Passed)
+	assert.Contains(t, results["CCC_C01_TR01"].Message, "TestSet was not run")
+	assert.Equal(t, "CCC.C01", results["CCC_C01_TR01"].ControlID)
+	assert.True(t, results["CCC_C03_TR02"].Passed)
+	assert.True(t, results["CCC_C08_TR01"].Passed)
+	assert.True(t, results["CCC_ObjStor_C03_TR01"].Passed)
+}
@@ -0,0 +1,167 @@
+package abs
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+)
+
+// containerRetention is when a test container's blobs stop being retained, so that the container can be deleted
+type containerRetention struct {
+	// deletableFrom is when the retention of the container's blobs expires, the zero time when they are not retained
+	deletableFrom time.Time
+	// legalHold prevents the container being deleted until the hold is cleared, however long ago it was created
+	legalHold bool
+}
+
+func (retention containerRetention) isDeletable(now time.Time) bool {
+	return !retention.legalHold && !now.Before(retention.deletableFrom)
+}
+
+func (retention containerRetention) String() string {
+	if retention.legalHold {
+		return "never (legal hold)"
+	}
+
+	if retention.deletableFrom.IsZero() {
+		return "now"
+	}
+
+	return retention.deletableFrom.Format(time.RFC3339)
+}
+
+// Sweep deletes the privateer-test-* containers whose blobs are no longer retained, and reports when the others can be deleted, nothing is deleted when dryRun is set
+func Sweep(output io.Writer, dryRun bool) error {
+	err := Initialize()
+
+	if err != nil {
+		return err
+	}
+
+	err = requireAzure("sweep")
+
+	if err != nil {
+		return err
+	}
+
+	for _, target := range targets {
+		activateTarget(target)
+
+		fmt.Fprintf(output, "Storage account: %s\n", target.storageAccountResourceId)
+
+		containers, err := findTestContainers()
+
+		if err != nil {
+			fmt.Fprintf(output, "Could not list test containers: %v\n\n", err)
+			continue
+		}
+
+		sweepContainers(output, containers, dryRun, time.Now().UTC())
+		fmt.Fprintln(output)
+	}
+
+	return nil
+}
+
+// findTestContainers lists the containers in the current storage account that were created by tests
+func findTestContainers() (containers []*armstorage.ListContainerItem, err error) {
+	if failed := currentTarget.getInitErrors().forComponents(componentBlobContainersClient); len(failed) > 0 {
+		return nil, failed
+	}
+
+	pager := blobContainersClient.NewListPager(currentTarget.resourceId.resourceGroupName, currentTarget.resourceId.storageAccountName, &armstorage.BlobContainersClientListOptions{
+		Filter: to.Ptr(testArtifactPrefix),
+	})
+
+	for pager.More() {
+		page, err := pager.NextPage(pluginContext)
+
+		if err != nil {
+			return nil, fmt.Errorf("failed to list containers: %v", err)
+		}
+
+		for _, container := range page.Value {
+			if container.Name != nil && strings.HasPrefix(*container.Name, testArtifactPrefix) {
+				containers = append(containers, container)
+			}
+		}
+	}
+
+	return containers, nil
+}
+
+// sweepContainers deletes the containers which are no longer retained, writing when each container can be deleted and what was done with it
+func sweepContainers(output io.Writer, containers []*armstorage.ListContainerItem, dryRun bool, now time.Time) {
+	writer := tabwriter.NewWriter(output, 1, 1, 2, ' ', 0)
+	fmt.Fprintln(writer, "CONTAINER\tDELETABLE FROM\tACTION")
+
+	for _, container := range containers {
+		retention := getContainerRetention(container.Properties)
+		action := "retained"
+
+		if retention.isDeletable(now) {
+			if dryRun {
+				action = "would delete"
+			} else if err := sweepContainer(*container.Name); err != nil {
+				action = fmt.Sprintf("failed to delete: %v", err)
+			} else {
+				action = "deleted"
+			}
+		}
+
+		fmt.Fprintf(writer, "%s\t%s\t%s\n", *container.Name, retention, action)
+	}
+
+	writer.Flush()
+}
+
+// getContainerRetention works out when a test container can be deleted, from the container's immutability policy or else the storage account's
+func getContainerRetention(properties *armstorage.ContainerProperties) (retention containerRetention) {
+	if properties == nil {
+		return retention
+	}
+
+	if properties.HasLegalHold != nil && *properties.HasLegalHold {
+		retention.legalHold = true
+		return retention
+	}
+
+	var retentionDays *int32
+
+	if properties.ImmutabilityPolicy != nil && properties.ImmutabilityPolicy.Properties != nil {
+		retentionDays = properties.ImmutabilityPolicy.Properties.ImmutabilityPeriodSinceCreationInDays
+	} else {
+		immutabilityConfiguration := ArmoryAzureUtils.GetImmutabilityConfiguration()
+
+		if immutabilityConfiguration.PolicyState != nil && *immutabilityConfiguration.PolicyState != armstorage.AccountImmutabilityPolicyStateDisabled {
+			retentionDays = immutabilityConfiguration.PolicyRetentionPeriodInDays
+		}
+	}
+
+	if retentionDays == nil || *retentionDays <= 0 || properties.LastModifiedTime == nil {
+		return retention
+	}
+
+	// The test blobs are written when the container is created, so they are retained for the immutability period from then
+	retention.deletableFrom = properties.LastModifiedTime.AddDate(0, 0, int(*retentionDays))
+
+	return retention
+}
+
+// sweepContainer deletes a test container in the current storage account, removing it from the cleanup ledger
+func sweepContainer(containerName string) error {
+	_, err := blobContainersClient.Delete(pluginContext, currentTarget.resourceId.resourceGroupName, currentTarget.resourceId.storageAccountName, containerName, nil)
+
+	if err != nil {
+		return err
+	}
+
+	releaseArtifact(artifactContainer, containerName)
+
+	return nil
+}
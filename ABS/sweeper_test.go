@@ -0,0 +1,121 @@
+package abs
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/stretchr/testify/assert"
+)
+
+func setAccountImmutabilityPolicy(state armstorage.AccountImmutabilityPolicyState, retentionDays int32) {
+	ArmoryAzureUtils = &azureUtilsMock{}
+	currentTarget.storageAccountResource = armstorage.Account{
+		Properties: &armstorage.AccountProperties{
+			ImmutableStorageWithVersioning: &armstorage.ImmutableStorageAccount{
+				Enabled: to.Ptr(true),
+				ImmutabilityPolicy: &armstorage.AccountImmutabilityPolicyProperties{
+					State:                                 to.Ptr(state),
+					ImmutabilityPeriodSinceCreationInDays: to.Ptr(retentionDays),
+				},
+			},
+		},
+	}
+}
+
+func Test_getContainerRetention(t *testing.T) {
+	createdAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name               string
+		properties         *armstorage.ContainerProperties
+		accountPolicyState armstorage.AccountImmutabilityPolicyState
+		expectedDeletable  time.Time
+		expectedLegalHold  bool
+	}{
+		{
+			name:               "container policy",
+			properties:         &armstorage.ContainerProperties{LastModifiedTime: to.Ptr(createdAt), ImmutabilityPolicy: &armstorage.ImmutabilityPolicyProperties{Properties: &armstorage.ImmutabilityPolicyProperty{ImmutabilityPeriodSinceCreationInDays: to.Ptr(int32(7))}}},
+			accountPolicyState: armstorage.AccountImmutabilityPolicyStateLocked,
+			expectedDeletable:  createdAt.AddDate(0, 0, 7),
+		},
+		{
+			name:               "account policy",
+			properties:         &armstorage.ContainerProperties{LastModifiedTime: to.Ptr(createdAt)},
+			accountPolicyState: armstorage.AccountImmutabilityPolicyStateLocked,
+			expectedDeletable:  createdAt.AddDate(0, 0, 30),
+		},
+		{
+			name:               "account policy disabled",
+			properties:         &armstorage.ContainerProperties{LastModifiedTime: to.Ptr(createdAt)},
+			accountPolicyState: armstorage.AccountImmutabilityPolicyStateDisabled,
+		},
+		{
+			name:               "legal hold",
+			properties:         &armstorage.ContainerProperties{LastModifiedTime: to.Ptr(createdAt), HasLegalHold: to.Ptr(true)},
+			accountPolicyState: armstorage.AccountImmutabilityPolicyStateDisabled,
+			expectedLegalHold:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			setAccountImmutabilityPolicy(tt.accountPolicyState, 30)
+
+			// Act
+			retention := getContainerRetention(tt.properties)
+
+			// Assert
+			assert.Equal(t, tt.expectedDeletable, retention.deletableFrom)
+			assert.Equal(t, tt.expectedLegalHold, retention.legalHold)
+		})
+	}
+}
+
+func Test_sweepContainers_deletes_containers_whose_retention_has_expired(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+	setAccountImmutabilityPolicy(armstorage.AccountImmutabilityPolicyStateLocked, 30)
+
+	now := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	blobContainersClient = &blobContainersClientMock{}
+	trackArtifact(artifactContainer, "privateer-test-container-expired")
+
+	containers := []*armstorage.ListContainerItem{
+		{Name: to.Ptr("privateer-test-container-expired"), Properties: &armstorage.ContainerProperties{LastModifiedTime: to.Ptr(now.AddDate(0, 0, -31))}},
+		{Name: to.Ptr("privateer-test-container-retained"), Properties: &armstorage.ContainerProperties{LastModifiedTime: to.Ptr(now.AddDate(0, 0, -1))}},
+	}
+
+	var output bytes.Buffer
+
+	// Act
+	sweepContainers(&output, containers, false, now)
+
+	// Assert
+	assert.Regexp(t, `privateer-test-container-expired\s+2026-01-31T00:00:00Z\s+deleted`, output.String())
+	assert.Regexp(t, `privateer-test-container-retained\s+2026-03-02T00:00:00Z\s+retained`, output.String())
+	assert.Empty(t, testArtifacts.artifacts)
+}
+
+func Test_sweepContainers_does_not_delete_in_dry_run(t *testing.T) {
+	// Arrange
+	setupCleanupTest(t)
+	setAccountImmutabilityPolicy(armstorage.AccountImmutabilityPolicyStateDisabled, 30)
+
+	blobContainersClient = &blobContainersClientMock{deleteError: assert.AnError}
+
+	containers := []*armstorage.ListContainerItem{
+		{Name: to.Ptr("privateer-test-container-abc"), Properties: &armstorage.ContainerProperties{}},
+	}
+
+	var output bytes.Buffer
+
+	// Act
+	sweepContainers(&output, containers, true, time.Now())
+
+	// Assert
+	assert.Regexp(t, `privateer-test-container-abc\s+now\s+would delete`, output.String())
+}
@@ -0,0 +1,190 @@
+package abs
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+// storageAccountTarget holds the state of a single storage account being assessed
+type storageAccountTarget struct {
+	storageAccountResourceId          string
+	storageAccountUri                 string
+	storageAccountResource            armstorage.Account
+	storageAccountPropertiesTimestamp time.Time
+	blobServiceProperties             *armstorage.BlobServiceProperties
+	resourceId                        resourceIdentifier
+	// iacAddress is the address of the resource in the Terraform plan or ARM template the storage account was read from
+	iacAddress string
+	// unresolvedProperties are the paths of the properties an ARM template sets with expressions which cannot be resolved before deployment
+	unresolvedProperties []string
+	// initErrors holds failures to load this storage account's properties
+	initErrors initializationErrors
+}
+
+type resourceIdentifier struct {
+	subscriptionId     string
+	resourceGroupName  string
+	storageAccountName string
+}
+
+var (
+	// targets is every storage account being assessed in this run
+	targets []*storageAccountTarget
+
+	// currentTarget is the storage account the TestSets are currently being run against
+	currentTarget = &storageAccountTarget{}
+
+	storageAccountResourceIdRegex = regexp.MustCompile(`^/subscriptions/(?P<subscription>[0-9a-fA-F-]+)/resourceGroups/(?P<resourceGroup>[-\w\._\(\)]+)/providers/Microsoft\.Storage/storageAccounts/(?P<storageAccount>[a-z0-9]+)$`)
+)
+
+func newStorageAccountTarget(storageAccountResourceId string) (*storageAccountTarget, error) {
+	match := storageAccountResourceIdRegex.FindStringSubmatch(storageAccountResourceId)
+
+	if len(match) == 0 {
+		return nil, fmt.Errorf("failed to parse storage account resource ID %s", storageAccountResourceId)
+	}
+
+	return &storageAccountTarget{
+		storageAccountResourceId: storageAccountResourceId,
+		resourceId: resourceIdentifier{
+			subscriptionId:     match[1],
+			resourceGroupName:  match[2],
+			storageAccountName: match[3],
+		},
+	}, nil
+}
+
+// loadProperties gets the storage account and blob service properties, the target's subscription clients must be active
+func (target *storageAccountTarget) loadProperties() (errs initializationErrors) {
+	scope := target.resourceId.storageAccountName
+	subscriptionErrors := subscriptionInitErrors[target.resourceId.subscriptionId]
+
+	// Set context with timeout
+	ctx, cancel := context.WithTimeout(pluginContext, 30*time.Second)
+	defer cancel()
+
+	if failed := subscriptionErrors.forComponents(componentStorageAccountsClient); len(failed) > 0 {
+		errs.add(componentStorageAccount, scope, failed)
+	} else {
+		errs.add(componentStorageAccount, scope, target.loadStorageAccount(ctx))
+	}
+
+	if failed := subscriptionErrors.forComponents(componentBlobServicesClient); len(failed) > 0 {
+		errs.add(componentBlobServiceProperties, scope, failed)
+	} else {
+		// Get blob service properties
+		blobServicePropertiesResponse, err := blobServicesClient.GetServiceProperties(ctx, target.resourceId.resourceGroupName, target.resourceId.storageAccountName, nil)
+
+		if err != nil {
+			errs.add(componentBlobServiceProperties, scope, fmt.Errorf("failed to get blob service properties for storage account %s with error: %v", target.resourceId.storageAccountName, err))
+		} else {
+			target.blobServiceProperties = &blobServicePropertiesResponse.BlobServiceProperties
+		}
+	}
+
+	return errs
+}
+
+func (target *storageAccountTarget) loadStorageAccount(ctx context.Context) error {
+	// Get storage account resource
+	storageAccountResponse, err := armstorageClient.GetProperties(ctx, target.resourceId.resourceGroupName, target.resourceId.storageAccountName, &armstorage.AccountsClientGetPropertiesOptions{Expand: to.Ptr(armstorage.StorageAccountExpandGeoReplicationStats)})
+
+	target.storageAccountPropertiesTimestamp = now()
+
+	if err != nil {
+		// If the GetProperties fails, this may be due to geo-replication stats not being available,
+		//  instead try to get the storage account without the expand parameter
+		storageAccountResponse, err = armstorageClient.GetProperties(ctx, target.resourceId.resourceGroupName, target.resourceId.storageAccountName, nil)
+
+		if err != nil {
+			return fmt.Errorf("failed to get storage account resource %s: %v", target.resourceId.storageAccountName, err)
+		}
+	}
+
+	target.storageAccountResource = storageAccountResponse.Account
+
+	// Discovered accounts include kinds such as FileStorage, which have no blob endpoint to assess
+	properties := target.storageAccountResource.Properties
+
+	if properties == nil || properties.PrimaryEndpoints == nil || properties.PrimaryEndpoints.Blob == nil {
+		return fmt.Errorf("storage account %s has no blob endpoint", target.resourceId.storageAccountName)
+	}
+
+	target.storageAccountUri = *properties.PrimaryEndpoints.Blob
+
+	return nil
+}
+
+// label names the storage account in test results, by its IaC address when it has not been deployed yet
+func (target *storageAccountTarget) label() string {
+	if target.iacAddress != "" {
+		return target.iacAddress
+	}
+
+	return target.resourceId.storageAccountName
+}
+
+// getInitErrors returns every initialization failure which affects this storage account
+func (target *storageAccountTarget) getInitErrors() (errs initializationErrors) {
+	errs = append(errs, initErrors...)
+	errs = append(errs, subscriptionInitErrors[target.resourceId.subscriptionId]...)
+	return append(errs, target.initErrors...)
+}
+
+// activateTarget points the TestSets at the given storage account, switching clients if it is in a different subscription
+func activateTarget(target *storageAccountTarget) {
+	// There are no clients when assessing snapshots
+	if !assessingSnapshots {
+		useSubscription(target.resourceId.subscriptionId)
+	}
+
+	currentTarget = target
+}
+
+// forEachTarget wraps a TestSet so that it is run against every target, with test results keyed by storage account name or IaC address
+func forEachTarget(testSet pluginkit.TestSet) pluginkit.TestSet {
+	return func() (testSetName string, result pluginkit.TestSetResult) {
+		var accountMessages []string
+		passedAccounts := 0
+
+		for _, target := range targets {
+			accountName := target.label()
+
+			activateTarget(target)
+			name, targetResult := testSet()
+
+			if result.Tests == nil {
+				testSetName = name
+				result = pluginkit.TestSetResult{
+					Description: targetResult.Description,
+					DocsURL:     targetResult.DocsURL,
+					ControlID:   targetResult.ControlID,
+					Tests:       make(map[string]pluginkit.TestResult),
+				}
+			}
+
+			for testName, testResult := range targetResult.Tests {
+				result.Tests[accountName+"/"+testName] = testResult
+			}
+
+			if targetResult.Passed {
+				passedAccounts++
+			}
+
+			result.BadStateAlert = result.BadStateAlert || targetResult.BadStateAlert
+			accountMessages = append(accountMessages, fmt.Sprintf("[%s] %s", accountName, targetResult.Message))
+		}
+
+		result.Passed = passedAccounts == len(targets)
+		result.Message = fmt.Sprintf("%d of %d storage accounts passed. %s", passedAccounts, len(targets), strings.Join(accountMessages, " "))
+
+		return
+	}
+}
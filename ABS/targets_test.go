@@ -0,0 +1,178 @@
+package abs
+
+import (
+	"testing"
+
+	"github.com/Azure/azure-sdk-for-go/sdk/azcore/to"
+	"github.com/Azure/azure-sdk-for-go/sdk/resourcemanager/storage/armstorage"
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_newStorageAccountTarget_succeeds(t *testing.T) {
+	// Act
+	target, err := newStorageAccountTarget("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg/providers/Microsoft.Storage/storageAccounts/mystorageaccount")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "00000000-0000-0000-0000-000000000000", target.resourceId.subscriptionId)
+	assert.Equal(t, "my-rg", target.resourceId.resourceGroupName)
+	assert.Equal(t, "mystorageaccount", target.resourceId.storageAccountName)
+}
+
+func Test_newStorageAccountTarget_succeeds_with_resource_group_containing_periods(t *testing.T) {
+	// Act
+	target, err := newStorageAccountTarget("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my.rg_(prod)/providers/Microsoft.Storage/storageAccounts/mystorageaccount")
+
+	// Assert
+	assert.NoError(t, err)
+	assert.Equal(t, "my.rg_(prod)", target.resourceId.resourceGroupName)
+}
+
+func Test_newStorageAccountTarget_fails_with_invalid_id(t *testing.T) {
+	// Act
+	_, err := newStorageAccountTarget("/subscriptions/00000000-0000-0000-0000-000000000000/resourceGroups/my-rg")
+
+	// Assert
+	assert.ErrorContains(t, err, "failed to parse storage account resource ID")
+}
+
+func Test_loadProperties_succeeds(t *testing.T) {
+	// Arrange
+	myMock := blobServicePropertiesMock{blobVersioningEnabled: true}
+	armstorageClient = &mockAccountsClient{
+		getPropertiesResponse: armstorage.AccountsClientGetPropertiesResponse{
+			Account: armstorage.Account{
+				Properties: &armstorage.AccountProperties{
+					PrimaryEndpoints: &armstorage.Endpoints{Blob: to.Ptr("https://mystorageaccount.blob.core.windows.net/")},
+				},
+			},
+		},
+	}
+	blobServicesClient = &mockBlobServicesClient{blobServiceProperties: *myMock.SetBlobServiceProperties()}
+	target := &storageAccountTarget{}
+
+	// Act
+	errs := target.loadProperties()
+
+	// Assert
+	assert.Empty(t, errs)
+	assert.Equal(t, "https://mystorageaccount.blob.core.windows.net/", target.storageAccountUri)
+	assert.Equal(t, true, *target.blobServiceProperties.BlobServiceProperties.IsVersioningEnabled)
+}
+
+func Test_loadProperties_fails_when_get_properties_errors(t *testing.T) {
+	// Arrange
+	armstorageClient = &mockAccountsClient{getPropertiesError: assert.AnError}
+	blobServicesClient = &mockBlobServicesClient{}
+	target := &storageAccountTarget{resourceId: resourceIdentifier{storageAccountName: "mystorageaccount"}}
+
+	// Act
+	errs := target.loadProperties()
+
+	// Assert
+	assert.Len(t, errs.forComponents(componentStorageAccount), 1)
+	assert.ErrorContains(t, errs, "failed to get storage account resource mystorageaccount")
+}
+
+func Test_loadProperties_fails_when_the_storage_account_has_no_blob_endpoint(t *testing.T) {
+	tests := []struct {
+		name       string
+		properties *armstorage.AccountProperties
+	}{
+		{name: "no properties"},
+		{name: "no primary endpoints", properties: &armstorage.AccountProperties{}},
+		{name: "FileStorage account", properties: &armstorage.AccountProperties{PrimaryEndpoints: &armstorage.Endpoints{File: to.Ptr("https://mystorageaccount.file.core.windows.net/")}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Arrange
+			armstorageClient = &mockAccountsClient{
+				getPropertiesResponse: armstorage.AccountsClientGetPropertiesResponse{Account: armstorage.Account{Properties: tt.properties}},
+			}
+			blobServicesClient = &mockBlobServicesClient{}
+			target := &storageAccountTarget{resourceId: resourceIdentifier{storageAccountName: "mystorageaccount"}}
+
+			// Act
+			errs := target.loadProperties()
+
+			// Assert
+			assert.Len(t, errs.forComponents(componentStorageAccount), 1)
+			assert.ErrorContains(t, errs, "storage account mystorageaccount has no blob endpoint")
+			assert.Empty(t, target.storageAccountUri)
+		})
+	}
+}
+
+func Test_loadProperties_skips_components_whose_clients_failed(t *testing.T) {
+	// Arrange
+	subscriptionInitErrors["00000000-0000-0000-0000-000000000000"] = initializationErrors{
+		{component: componentBlobServicesClient, err: assert.AnError},
+	}
+	defer delete(subscriptionInitErrors, "00000000-0000-0000-0000-000000000000")
+
+	armstorageClient = &mockAccountsClient{getPropertiesError: assert.AnError}
+	target := &storageAccountTarget{resourceId: resourceIdentifier{subscriptionId: "00000000-0000-0000-0000-000000000000", storageAccountName: "mystorageaccount"}}
+
+	// Act
+	errs := target.loadProperties()
+
+	// Assert
+	assert.Len(t, errs.forComponents(componentBlobServiceProperties), 1)
+	assert.ErrorIs(t, errs.forComponents(componentBlobServiceProperties)[0], assert.AnError)
+}
+
+func Test_forEachTarget_keys_results_by_storage_account(t *testing.T) {
+	// Arrange
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	targets = []*storageAccountTarget{
+		{resourceId: resourceIdentifier{subscriptionId: clientsSubscriptionId, storageAccountName: "accountone"}},
+		{resourceId: resourceIdentifier{subscriptionId: clientsSubscriptionId, storageAccountName: "accounttwo"}},
+	}
+	defer func() { targets = nil }()
+
+	testSet := func() (string, pluginkit.TestSetResult) {
+		passed := currentTarget.resourceId.storageAccountName == "accountone"
+		return "CCC_Test_TR01", pluginkit.TestSetResult{
+			Passed:      passed,
+			Description: "Test description",
+			Tests:       map[string]pluginkit.TestResult{"CCC_Test_TR01_T01": {Passed: passed}},
+		}
+	}
+
+	// Act
+	name, result := forEachTarget(testSet)()
+
+	// Assert
+	assert.Equal(t, "CCC_Test_TR01", name)
+	assert.Equal(t, false, result.Passed)
+	assert.Equal(t, "Test description", result.Description)
+	assert.Contains(t, result.Message, "1 of 2 storage accounts passed.")
+	assert.Equal(t, true, result.Tests["accountone/CCC_Test_TR01_T01"].Passed)
+	assert.Equal(t, false, result.Tests["accounttwo/CCC_Test_TR01_T01"].Passed)
+}
+
+func Test_forEachTarget_passes_when_all_storage_accounts_pass(t *testing.T) {
+	// Arrange
+	clientsSubscriptionId = "00000000-0000-0000-0000-000000000000"
+	targets = []*storageAccountTarget{
+		{resourceId: resourceIdentifier{subscriptionId: clientsSubscriptionId, storageAccountName: "accountone"}},
+		{resourceId: resourceIdentifier{subscriptionId: clientsSubscriptionId, storageAccountName: "accounttwo"}},
+	}
+	defer func() { targets = nil }()
+
+	testSet := func() (string, pluginkit.TestSetResult) {
+		return "CCC_Test_TR01", pluginkit.TestSetResult{
+			Passed: true,
+			Tests:  map[string]pluginkit.TestResult{"CCC_Test_TR01_T01": {Passed: true}},
+		}
+	}
+
+	// Act
+	_, result := forEachTarget(testSet)()
+
+	// Assert
+	assert.Equal(t, true, result.Passed)
+	assert.Len(t, result.Tests, 2)
+}
@@ -0,0 +1,257 @@
+package abs
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+)
+
+const (
+	// minCertificateValidity is how long the certificate of an endpoint must still be valid for, so that a failed renewal is noticed before clients are cut off
+	minCertificateValidity = 30 * 24 * time.Hour
+
+	minRSAKeySize   = 2048
+	minECDSAKeySize = 256
+)
+
+// HTTPBehaviour is how an endpoint answers a request sent without TLS
+type HTTPBehaviour string
+
+const (
+	HTTPRejected    HTTPBehaviour = "Rejected"
+	HTTPRedirected  HTTPBehaviour = "Redirected"
+	HTTPServed      HTTPBehaviour = "Served"
+	HTTPUnreachable HTTPBehaviour = "Unreachable"
+)
+
+// TlsReport is the TLS configuration of a service endpoint, as seen by the runner
+type TlsReport struct {
+	ProtocolVersion string
+	// CipherSuites are the TLS 1.2 cipher suites the endpoint accepted a handshake with
+	CipherSuites []CipherSuiteReport
+	// Certificates is the chain the endpoint presented, its own certificate first
+	Certificates []CertificateReport
+	HTTP         HTTPBehaviour
+	// StrictTransportSecurity is the Strict-Transport-Security header of the endpoint's HTTPS responses
+	StrictTransportSecurity string
+	Findings                []string
+}
+
+// CipherSuiteReport is a cipher suite the endpoint accepts, and whether it is a strong one
+type CipherSuiteReport struct {
+	Name           string
+	ForwardSecrecy bool
+	AEAD           bool
+	Insecure       bool
+}
+
+// CertificateReport is a certificate in the chain an endpoint presents
+type CertificateReport struct {
+	Subject  string
+	Issuer   string
+	KeyType  string
+	KeySize  int
+	NotAfter time.Time
+	DNSNames []string
+}
+
+func (suite CipherSuiteReport) weak() bool {
+	return !suite.ForwardSecrecy || !suite.AEAD || suite.Insecure
+}
+
+// InspectTLS records the protocol version, accepted TLS 1.2 cipher suites, certificate chain and HTTP behaviour of an endpoint.
+// It only fails when no trusted TLS connection can be made: the protocol version and HTTP behaviour are already judged by the other tests of CCC_C01_TR01,
+// and weak cipher suites and certificates are chosen by Azure rather than the customer, so the weaknesses are reported as findings
+func (*tlsFunctions) InspectTLS(endpoint string, result *pluginkit.TestResult) {
+	response, err := sendTLSProbe(endpoint, &tls.Config{RootCAs: trustedRootCAs})
+
+	if err != nil {
+		SetResultFailure(result, fmt.Sprintf("TLS connection failed with error: %v", err))
+		return
+	}
+
+	if response.TLS == nil {
+		SetResultFailure(result, "error: No TLS information found in response")
+		return
+	}
+
+	report := TlsReport{
+		ProtocolVersion:         tls.VersionName(response.TLS.Version),
+		StrictTransportSecurity: response.Header.Get("Strict-Transport-Security"),
+	}
+
+	for _, certificate := range response.TLS.PeerCertificates {
+		report.Certificates = append(report.Certificates, newCertificateReport(certificate))
+	}
+
+	// Go only negotiates the TLS 1.3 cipher suites it considers secure, so only those of TLS 1.2 are enumerated
+	for _, suite := range tls12CipherSuites() {
+		_, err := sendTLSProbe(endpoint, &tls.Config{
+			RootCAs:      trustedRootCAs,
+			MinVersion:   tls.VersionTLS12,
+			MaxVersion:   tls.VersionTLS12,
+			CipherSuites: []uint16{suite.ID},
+		})
+
+		if err == nil {
+			report.CipherSuites = append(report.CipherSuites, newCipherSuiteReport(suite))
+		}
+	}
+
+	httpResponse, err := sendTLSProbe(strings.Replace(endpoint, "https", "http", 1), nil)
+	report.HTTP = getHTTPBehaviour(httpResponse, err)
+
+	report.Findings = report.getFindings(now())
+	result.Value = report
+	result.Passed = true
+	result.Message = fmt.Sprintf("%s is negotiated and HTTP requests are %s", report.ProtocolVersion, strings.ToLower(string(report.HTTP)))
+
+	if len(report.Findings) > 0 {
+		result.Message += fmt.Sprintf(", the endpoint's TLS findings are reported without failing the test: %s", strings.Join(report.Findings, "; "))
+	}
+}
+
+// getFindings lists the weaknesses of the TLS configuration of the endpoint
+func (report TlsReport) getFindings(now time.Time) (findings []string) {
+	if !slices.Contains([]string{"TLS 1.2", "TLS 1.3"}, report.ProtocolVersion) {
+		findings = append(findings, fmt.Sprintf("%s is negotiated rather than TLS 1.2 or higher", report.ProtocolVersion))
+	}
+
+	if report.HTTP == HTTPServed {
+		findings = append(findings, "HTTP requests are served")
+	}
+
+	var weakSuites []string
+
+	for _, suite := range report.CipherSuites {
+		if suite.weak() {
+			weakSuites = append(weakSuites, suite.Name)
+		}
+	}
+
+	if len(weakSuites) > 0 {
+		findings = append(findings, fmt.Sprintf("cipher suites without forward secrecy or authenticated encryption are accepted over TLS 1.2: %s", strings.Join(weakSuites, ", ")))
+	}
+
+	for _, certificate := range report.Certificates {
+		if (certificate.KeyType == "RSA" && certificate.KeySize < minRSAKeySize) || (certificate.KeyType == "ECDSA" && certificate.KeySize < minECDSAKeySize) {
+			findings = append(findings, fmt.Sprintf("certificate %s has a weak %d bit %s key", certificate.Subject, certificate.KeySize, certificate.KeyType))
+		}
+
+		if certificate.NotAfter.Before(now.Add(minCertificateValidity)) {
+			findings = append(findings, fmt.Sprintf("certificate %s expires on %s", certificate.Subject, certificate.NotAfter.Format(time.DateOnly)))
+		}
+	}
+
+	if report.HTTP == HTTPRedirected {
+		// A redirect still sends the first request in plaintext, only HSTS stops clients from sending it again
+		hsts := strings.ToLower(report.StrictTransportSecurity)
+
+		if !strings.Contains(hsts, "max-age=") || strings.Contains(hsts, "max-age=0") {
+			findings = append(findings, "HTTP requests are redirected to HTTPS, but no Strict-Transport-Security header is sent")
+		}
+	}
+
+	return findings
+}
+
+// tls12CipherSuites are the cipher suites Go can offer for TLS 1.2, including those it considers insecure
+func tls12CipherSuites() (suites []*tls.CipherSuite) {
+	for _, suite := range append(tls.CipherSuites(), tls.InsecureCipherSuites()...) {
+		if slices.Contains(suite.SupportedVersions, tls.VersionTLS12) {
+			suites = append(suites, suite)
+		}
+	}
+
+	return suites
+}
+
+func newCipherSuiteReport(suite *tls.CipherSuite) CipherSuiteReport {
+	return CipherSuiteReport{
+		Name:           suite.Name,
+		ForwardSecrecy: strings.HasPrefix(suite.Name, "TLS_ECDHE_"),
+		AEAD:           strings.Contains(suite.Name, "_GCM_") || strings.Contains(suite.Name, "_CHACHA20_POLY1305"),
+		Insecure:       suite.Insecure,
+	}
+}
+
+func newCertificateReport(certificate *x509.Certificate) (report CertificateReport) {
+	report = CertificateReport{
+		Subject:  certificate.Subject.String(),
+		Issuer:   certificate.Issuer.String(),
+		NotAfter: certificate.NotAfter,
+		DNSNames: certificate.DNSNames,
+	}
+
+	switch key := certificate.PublicKey.(type) {
+	case *rsa.PublicKey:
+		report.KeyType = "RSA"
+		report.KeySize = key.N.BitLen()
+	case *ecdsa.PublicKey:
+		report.KeyType = "ECDSA"
+		report.KeySize = key.Curve.Params().BitSize
+	case ed25519.PublicKey:
+		report.KeyType = "Ed25519"
+		report.KeySize = 256
+	default:
+		report.KeyType = certificate.PublicKeyAlgorithm.String()
+	}
+
+	return report
+}
+
+// getHTTPBehaviour classifies the response to a request sent without TLS, Azure Storage rejects it with a 400 when secure transfer is required
+func getHTTPBehaviour(response *http.Response, err error) HTTPBehaviour {
+	switch {
+	case err != nil || response == nil:
+		return HTTPUnreachable
+	case response.StatusCode >= http.StatusMultipleChoices && response.StatusCode < http.StatusBadRequest && strings.HasPrefix(response.Header.Get("Location"), "https://"):
+		return HTTPRedirected
+	case response.StatusCode == http.StatusBadRequest:
+		return HTTPRejected
+	default:
+		return HTTPServed
+	}
+}
+
+// sendTLSProbe makes an unauthenticated list request with the given TLS configuration, without following redirects
+func sendTLSProbe(endpoint string, tlsConfig *tls.Config) (*http.Response, error) {
+	client := newStorageHTTPClient(tlsConfig)
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	request, err := newListRequest(endpoint, "")
+
+	if err != nil {
+		return nil, err
+	}
+
+	response, err := client.Do(request)
+
+	if err != nil {
+		var urlErr *url.Error
+
+		// The request URL is already known to the caller
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+
+		return nil, err
+	}
+
+	response.Body.Close()
+
+	return response, nil
+}
@@ -0,0 +1,173 @@
+package abs
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/privateerproj/privateer-sdk/pluginkit"
+	"github.com/stretchr/testify/assert"
+)
+
+func Test_InspectTLS_reports_weak_cipher_suites_without_failing(t *testing.T) {
+	// Arrange
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Strict-Transport-Security", "max-age=31536000")
+	}))
+	server.TLS = &tls.Config{
+		MaxVersion: tls.VersionTLS12,
+		CipherSuites: []uint16{
+			tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+			tls.TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA,
+			tls.TLS_RSA_WITH_AES_128_GCM_SHA256,
+		},
+	}
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	previousRootCAs := trustedRootCAs
+	trustedRootCAs = server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+	defer func() { trustedRootCAs = previousRootCAs }()
+
+	var result pluginkit.TestResult
+
+	// Act
+	(&tlsFunctions{}).InspectTLS(server.URL+"/", &result)
+
+	// Assert
+	report := result.Value.(TlsReport)
+	assert.True(t, result.Passed, result.Message)
+	assert.Contains(t, result.Message, "TLS 1.2 is negotiated and HTTP requests are rejected")
+	assert.Len(t, report.Findings, 1)
+	assert.Contains(t, report.Findings[0], "cipher suites without forward secrecy or authenticated encryption are accepted over TLS 1.2: ")
+	assert.Contains(t, report.Findings[0], "TLS_ECDHE_RSA_WITH_AES_128_CBC_SHA")
+	assert.Contains(t, report.Findings[0], "TLS_RSA_WITH_AES_128_GCM_SHA256")
+	assert.NotContains(t, report.Findings[0], "TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256")
+	assert.Equal(t, "TLS 1.2", report.ProtocolVersion)
+	assert.Len(t, report.CipherSuites, 3)
+	assert.Equal(t, "max-age=31536000", report.StrictTransportSecurity)
+	assert.Equal(t, HTTPRejected, report.HTTP)
+	assert.Equal(t, "RSA", report.Certificates[0].KeyType)
+}
+
+func Test_InspectTLS_fails_when_the_certificate_is_not_trusted(t *testing.T) {
+	// Arrange
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	t.Cleanup(server.Close)
+
+	var result pluginkit.TestResult
+
+	// Act
+	(&tlsFunctions{}).InspectTLS(server.URL+"/", &result)
+
+	// Assert
+	assert.False(t, result.Passed)
+	assert.Contains(t, result.Message, "TLS connection failed with error: tls: failed to verify certificate")
+}
+
+func Test_TlsReport_getFindings(t *testing.T) {
+	now := time.Date(2026, time.October, 1, 0, 0, 0, 0, time.UTC)
+	strongCertificate := CertificateReport{Subject: "CN=*.blob.core.windows.net", KeyType: "RSA", KeySize: 2048, NotAfter: now.AddDate(0, 6, 0)}
+
+	tests := []struct {
+		name             string
+		report           TlsReport
+		expectedFindings []string
+	}{
+		{
+			name: "strong configuration",
+			report: TlsReport{
+				ProtocolVersion: "TLS 1.3",
+				CipherSuites:    []CipherSuiteReport{{Name: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", ForwardSecrecy: true, AEAD: true}},
+				Certificates:    []CertificateReport{strongCertificate},
+				HTTP:            HTTPRejected,
+			},
+		},
+		{
+			name: "weak cipher suites",
+			report: TlsReport{
+				ProtocolVersion: "TLS 1.2",
+				CipherSuites: []CipherSuiteReport{
+					{Name: "TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384", ForwardSecrecy: true, AEAD: true},
+					{Name: "TLS_RSA_WITH_AES_256_GCM_SHA384", AEAD: true},
+				},
+				Certificates: []CertificateReport{strongCertificate},
+				HTTP:         HTTPRejected,
+			},
+			expectedFindings: []string{"cipher suites without forward secrecy or authenticated encryption are accepted over TLS 1.2: TLS_RSA_WITH_AES_256_GCM_SHA384"},
+		},
+		{
+			name:             "protocol version below TLS 1.2",
+			report:           TlsReport{ProtocolVersion: "TLS 1.1", Certificates: []CertificateReport{strongCertificate}, HTTP: HTTPRejected},
+			expectedFindings: []string{"TLS 1.1 is negotiated rather than TLS 1.2 or higher"},
+		},
+		{
+			name: "weak certificate keys and expiring certificate",
+			report: TlsReport{
+				ProtocolVersion: "TLS 1.3",
+				Certificates: []CertificateReport{
+					{Subject: "CN=leaf", KeyType: "RSA", KeySize: 1024, NotAfter: now.AddDate(0, 0, 10)},
+					{Subject: "CN=intermediate", KeyType: "ECDSA", KeySize: 224, NotAfter: now.AddDate(1, 0, 0)},
+				},
+				HTTP: HTTPRejected,
+			},
+			expectedFindings: []string{
+				"certificate CN=leaf has a weak 1024 bit RSA key",
+				"certificate CN=leaf expires on 2026-10-11",
+				"certificate CN=intermediate has a weak 224 bit ECDSA key",
+			},
+		},
+		{
+			name:             "HTTP served",
+			report:           TlsReport{ProtocolVersion: "TLS 1.3", Certificates: []CertificateReport{strongCertificate}, HTTP: HTTPServed},
+			expectedFindings: []string{"HTTP requests are served"},
+		},
+		{
+			name:             "HTTP redirected without HSTS",
+			report:           TlsReport{ProtocolVersion: "TLS 1.3", Certificates: []CertificateReport{strongCertificate}, HTTP: HTTPRedirected, StrictTransportSecurity: "max-age=0"},
+			expectedFindings: []string{"HTTP requests are redirected to HTTPS, but no Strict-Transport-Security header is sent"},
+		},
+		{
+			name:   "HTTP redirected with HSTS",
+			report: TlsReport{ProtocolVersion: "TLS 1.3", Certificates: []CertificateReport{strongCertificate}, HTTP: HTTPRedirected, StrictTransportSecurity: "max-age=31536000; includeSubDomains"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			findings := tt.report.getFindings(now)
+
+			// Assert
+			assert.Equal(t, tt.expectedFindings, findings)
+		})
+	}
+}
+
+func Test_getHTTPBehaviour(t *testing.T) {
+	tests := []struct {
+		name             string
+		response         *http.Response
+		err              error
+		expectedBehavior HTTPBehaviour
+	}{
+		{name: "rejected", response: &http.Response{StatusCode: http.StatusBadRequest}, expectedBehavior: HTTPRejected},
+		{name: "redirected to HTTPS", response: &http.Response{StatusCode: http.StatusMovedPermanently, Header: http.Header{"Location": {"https://account.z6.web.core.windows.net/"}}}, expectedBehavior: HTTPRedirected},
+		{name: "redirected to HTTP", response: &http.Response{StatusCode: http.StatusFound, Header: http.Header{"Location": {"http://example.com/"}}}, expectedBehavior: HTTPServed},
+		{name: "served", response: &http.Response{StatusCode: http.StatusOK}, expectedBehavior: HTTPServed},
+		{name: "connection refused", err: errors.New("connection refused"), expectedBehavior: HTTPUnreachable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Act
+			behaviour := getHTTPBehaviour(tt.response, tt.err)
+
+			// Assert
+			assert.Equal(t, tt.expectedBehavior, behaviour)
+		})
+	}
+}
@@ -1,14 +1,16 @@
 package main
 
 import (
+	"context"
 	"fmt"
-
+	"log"
 	"os"
 
 	abs "github.com/azure/finos-azure-blob-storage-raid/ABS"
 
 	"github.com/privateerproj/privateer-sdk/command"
 	"github.com/privateerproj/privateer-sdk/config"
+	"github.com/spf13/cobra"
 )
 
 var (
@@ -23,7 +25,6 @@ var (
 
 	PluginName   = "github-repo"
 	RequiredVars = []string{
-		"storageAccountResourceId",
 		"allowedRegions",
 	}
 
@@ -40,7 +41,91 @@ var (
 
 // initializer is a custom function to set up the armory for our usecase
 func initializer(c *config.Config) (err error) {
-	return abs.Initialize()
+	err = abs.Initialize()
+	if err == nil {
+		abs.StartRemediationFile()
+	}
+	return err
+}
+
+// preflightCommand reports which TestSets the current identity has the Azure permissions to run
+func preflightCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "preflight",
+		Short: "Check the Azure permissions needed by each test set, without running them",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := command.ActiveVessel.StockArmory()
+			if err == nil {
+				err = abs.Preflight(os.Stdout)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+}
+
+// cleanupCommand deletes the resources created by tests which earlier runs left behind
+func cleanupCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:   "cleanup",
+		Short: "Delete the privateer-test-* resources left behind by earlier runs, and those in the cleanup ledger",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := command.ActiveVessel.StockArmory()
+			if err == nil {
+				err = abs.Cleanup(os.Stdout)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+}
+
+// sweepCommand deletes the test containers whose blobs are no longer retained by an immutability policy
+func sweepCommand() *cobra.Command {
+	var dryRun bool
+
+	cmd := &cobra.Command{
+		Use:   "sweep",
+		Short: "Delete the privateer-test-* containers whose immutability retention has expired, and report when the others can be deleted",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := command.ActiveVessel.StockArmory()
+			if err == nil {
+				err = abs.Sweep(os.Stdout, dryRun)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Report which containers would be deleted without deleting them")
+
+	return cmd
+}
+
+// remediateCommand shows, and optionally makes, the changes which fix the failed configuration tests
+func remediateCommand() *cobra.Command {
+	var apply bool
+
+	cmd := &cobra.Command{
+		Use:   "remediate",
+		Short: "Show the Azure Resource Manager requests which fix the failed configuration tests, and make them with --apply",
+		Run: func(cmd *cobra.Command, args []string) {
+			err := command.ActiveVessel.StockArmory()
+			if err == nil {
+				err = abs.Remediate(os.Stdout, apply)
+			}
+			if err != nil {
+				log.Fatal(err)
+			}
+		},
+	}
+
+	cmd.Flags().BoolVar(&apply, "apply", false, "Make the changes and re-run the affected TestSets to confirm them")
+
+	return cmd
 }
 
 func main() {
@@ -48,6 +133,17 @@ func main() {
 		Version = fmt.Sprintf("%s-%s", Version, VersionPostfix)
 	}
 
+	// Interrupting the run cancels the requests to Azure which are in flight, the resources created by tests are still cleaned up
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	abs.SetContext(ctx)
+	abs.HandleInterrupts(cancel)
+	runCmd.AddCommand(preflightCommand())
+	runCmd.AddCommand(cleanupCommand())
+	runCmd.AddCommand(sweepCommand())
+	runCmd.AddCommand(remediateCommand())
+
 	err := runCmd.Execute()
 	if err != nil {
 		os.Exit(1)